@@ -0,0 +1,58 @@
+// Command mockidp runs a local OpenID provider for trying out and testing the school SSO login.
+//
+//	go run ./cmd/mockidp -addr :9096 -users users.json
+//
+// The users file is a JSON array of {"sub", "email", "email_verified", "name", "roles"}; the
+// account is picked with the login_hint parameter of the SSO login.
+package main
+
+import (
+	"eduanalytics/internal/app/service/oidc/mockidp"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":9096", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9096", "issuer URL, must match the address the API reaches")
+	clientID := flag.String("client-id", "eduanalytics", "client id of the API")
+	clientSecret := flag.String("client-secret", "secret", "client secret of the API")
+	usersFile := flag.String("users", "", "JSON file with the accounts of the provider")
+	flag.Parse()
+
+	users := []mockidp.User{
+		{Subject: "teacher-1", Email: "teacher@example.com", EmailVerified: true, Name: "Test Teacher", Roles: []string{"teacher"}},
+		{Subject: "student-1", Email: "student@example.com", EmailVerified: true, Name: "Test Student", Roles: []string{"student"}},
+	}
+	if *usersFile != "" {
+		data, err := os.ReadFile(*usersFile)
+		if err != nil {
+			log.Fatalf("reading users: %v", err)
+		}
+		if err := json.Unmarshal(data, &users); err != nil {
+			log.Fatalf("parsing users: %v", err)
+		}
+	}
+
+	provider, err := mockidp.New(mockidp.Config{
+		Issuer:       *issuer,
+		ClientID:     *clientID,
+		ClientSecret: *clientSecret,
+		Users:        users,
+	})
+	if err != nil {
+		log.Fatalf("creating provider: %v", err)
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           provider.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Printf("mock OpenID provider %s listening on %s", *issuer, *addr)
+	log.Fatal(server.ListenAndServe())
+}
@@ -3,6 +3,8 @@ package auth
 import (
 	"eduanalytics/internal/app/api/middleware/jwt"
 	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/service/apikey"
 	"eduanalytics/internal/app/service/logger"
 	"errors"
 	"net/http"
@@ -12,25 +14,41 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// Authentication is a middleware that verifies JWT token and enforces RBAC authorization
-func Authentication(jwtService jwt.IJwtService, enforcer *casbin.Enforcer) gin.HandlerFunc {
+// Authentication is a middleware that verifies JWT token and enforces RBAC authorization.
+// Machine clients may send an API key in the X-API-Key header instead of a bearer token, they
+// are authorized with the role of the key. A nil apiKeys only accepts bearer tokens.
+func Authentication(jwtService jwt.IJwtService, apiKeys apikey.IApiKeyService, enforcer casbin.IEnforcer) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		log := logger.Logger(ctx.Request.Context())
 
-		token, err := getHeaderToken(ctx)
-		if err != nil {
-			log.Warnf("No token found for path: %s", ctx.Request.URL.Path)
-			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - No token provided"})
-			ctx.Abort()
-			return
-		}
+		var claims *dto.User
+		if rawKey := ctx.GetHeader(constants.API_KEY_HEADER); rawKey != "" && apiKeys != nil {
+			key, err := apiKeys.Authenticate(ctx, rawKey)
+			if err != nil {
+				log.Warnf("Invalid api key for path: %s: %v", ctx.Request.URL.Path, err)
+				ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - Invalid API key"})
+				ctx.Abort()
+				return
+			}
+			ctx.Set(constants.CTK_API_KEY.String(), key)
+			claims = apiKeyClaims(key)
+		} else {
+			token, err := getHeaderToken(ctx)
+			if err != nil {
+				log.Warnf("No token found for path: %s", ctx.Request.URL.Path)
+				ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - No token provided"})
+				ctx.Abort()
+				return
+			}
 
-		claims, valid := jwtService.VerifyToken(ctx, token)
-		if !valid {
-			log.Warnf("Invalid token for path: %s", ctx.Request.URL.Path)
-			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - Invalid token"})
-			ctx.Abort()
-			return
+			var valid bool
+			claims, valid = jwtService.VerifyToken(ctx, token)
+			if !valid {
+				log.Warnf("Invalid token for path: %s", ctx.Request.URL.Path)
+				ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized - Invalid token"})
+				ctx.Abort()
+				return
+			}
 		}
 
 		ctx.Set(constants.CTK_CLAIM_KEY.String(), claims)
@@ -43,7 +61,7 @@ func Authentication(jwtService jwt.IJwtService, enforcer *casbin.Enforcer) gin.H
 			return
 		}
 
-		allowed, err := enforcer.Enforce(user.Role, ctx.Request.URL.Path, ctx.Request.Method)
+		allowed, err := enforceRoles(enforcer, user, PolicyObject(ctx), ctx.Request.Method)
 		if err != nil {
 			log.Errorf("Casbin enforcement error: %v", err)
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Authorization check failed"})
@@ -52,8 +70,8 @@ func Authentication(jwtService jwt.IJwtService, enforcer *casbin.Enforcer) gin.H
 		}
 
 		if !allowed {
-			log.Warnf("Access denied for user: %s, role: %s, path: %s, method: %s",
-				user.Email, user.Role, ctx.Request.URL.Path, ctx.Request.Method)
+			log.Warnf("Access denied for user: %s, roles: %v, path: %s, method: %s",
+				user.Email, user.Roles, ctx.Request.URL.Path, ctx.Request.Method)
 			ctx.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access this resource"})
 			ctx.Abort()
 			return
@@ -64,6 +82,40 @@ func Authentication(jwtService jwt.IJwtService, enforcer *casbin.Enforcer) gin.H
 	}
 }
 
+// enforceRoles allows the request when one of the user's assigned roles may call the route
+func enforceRoles(enforcer casbin.IEnforcer, user *dto.User, object, method string) (bool, error) {
+	for _, role := range user.Roles {
+		allowed, err := enforcer.Enforce(role, object, method)
+		if err != nil || allowed {
+			return allowed, err
+		}
+	}
+	return false, nil
+}
+
+// apiKeyClaims represents an API key as the user of the request. It is not a user account, so
+// the id is 0 and the email names the key.
+func apiKeyClaims(key *dto.ApiKey) *dto.User {
+	return &dto.User{
+		Name:          key.Name,
+		Email:         "api-key:" + key.Prefix,
+		Role:          key.Role,
+		Roles:         []string{key.Role},
+		SchoolId:      key.SchoolId,
+		EmailVerified: true,
+	}
+}
+
+// PolicyObject returns the Casbin object of the request: the matched route pattern such as
+// /classrooms/:id without the API prefix, so policies match every id of a parameterised route
+func PolicyObject(ctx *gin.Context) string {
+	path := ctx.FullPath()
+	if path == "" {
+		path = ctx.Request.URL.Path
+	}
+	return strings.TrimPrefix(path, constants.API_V1)
+}
+
 func getHeaderToken(ctx *gin.Context) (string, error) {
 	header := string(ctx.GetHeader(constants.AUTHORIZATION))
 	return extractToken(header)
@@ -1,6 +1,7 @@
 package casbin
 
 import (
+	"eduanalytics/internal/app/api/middleware/auth"
 	"eduanalytics/internal/app/constants"
 	"eduanalytics/internal/app/db/dto"
 	"eduanalytics/internal/app/service/logger"
@@ -10,13 +11,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func Authorizer(enforcer *casbin.Enforcer) gin.HandlerFunc {
+func Authorizer(enforcer casbin.IEnforcer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		log := logger.Logger(c.Request.Context())
 
 		claims, exists := c.Get(constants.CTK_CLAIM_KEY.String())
 		if !exists {
-			if err := checkPermission(enforcer, constants.ROLE_PUBLIC, c.Request.URL.Path, c.Request.Method); err != nil {
+			if err := checkPermission(enforcer, constants.ROLE_PUBLIC, auth.PolicyObject(c), c.Request.Method); err != nil {
 				log.Warnf("Public access denied for path: %s", c.Request.URL.Path)
 				c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 				c.Abort()
@@ -34,9 +35,15 @@ func Authorizer(enforcer *casbin.Enforcer) gin.HandlerFunc {
 			return
 		}
 
-		if err := checkPermission(enforcer, user.Role, c.Request.URL.Path, c.Request.Method); err != nil {
-			log.Warnf("Access denied for user: %s, role: %s, path: %s, method: %s",
-				user.Email, user.Role, c.Request.URL.Path, c.Request.Method)
+		var err error
+		for _, role := range user.Roles {
+			if err = checkPermission(enforcer, role, auth.PolicyObject(c), c.Request.Method); err == nil {
+				break
+			}
+		}
+		if err != nil || len(user.Roles) == 0 {
+			log.Warnf("Access denied for user: %s, roles: %v, path: %s, method: %s",
+				user.Email, user.Roles, c.Request.URL.Path, c.Request.Method)
 			c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to access this resource"})
 			c.Abort()
 			return
@@ -47,7 +54,7 @@ func Authorizer(enforcer *casbin.Enforcer) gin.HandlerFunc {
 	}
 }
 
-func checkPermission(enforcer *casbin.Enforcer, role, path, method string) error {
+func checkPermission(enforcer casbin.IEnforcer, role, path, method string) error {
 	allowed, err := enforcer.Enforce(role, path, method)
 	if err != nil {
 		return err
@@ -2,35 +2,58 @@ package jwt
 
 import (
 	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
 	"eduanalytics/internal/app/db/dto"
 	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/keystore"
 	"eduanalytics/internal/app/service/session"
 
 	"context"
 	"eduanalytics/internal/app/service/logger"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
+// IJwtService issues and verifies tokens. Access tokens carry the user's ID, role and school so
+// that VerifyToken only has to check that the user is still active; a role change must therefore
+// call InvalidateAllUserSessions, which makes the outstanding access tokens fail verification.
 type IJwtService interface {
-	CreateNewTokens(ctx context.Context, email, userAgent, ipAddress string) (*TokenDetails, error)
+	CreateNewTokens(ctx context.Context, user *dto.User, userAgent, ipAddress string) (*TokenDetails, error)
 	VerifyToken(ctx context.Context, tokenString string) (*dto.User, bool)
 	RefreshToken(ctx context.Context, tokenString, userAgent, ipAddress string) (*TokenDetails, error)
 	InvalidateSession(ctx context.Context, sessionID string) error
 	InvalidateAllUserSessions(ctx context.Context, email string) error
 }
 
+// ErrUserDeactivated is returned when tokens are requested for a deactivated or deleted user
+var ErrUserDeactivated = errors.New("user is deactivated")
+
+const (
+	tokenUseAccess  = "access"
+	tokenUseRefresh = "refresh"
+)
+
 type JwtService struct {
-	DBClient       repository.IUsersRepository
-	SessionManager session.ISessionManager
+	DBClient         repository.IUsersRepository
+	SessionManager   session.ISessionManager
+	EventsController events.IEventsController
+	KeyStore         keystore.IKeyStore
 }
 
-func NewJwtService(dbClient repository.IUsersRepository, sessionManager session.ISessionManager) IJwtService {
+func NewJwtService(
+	dbClient repository.IUsersRepository,
+	sessionManager session.ISessionManager,
+	eventsController events.IEventsController,
+	keyStore keystore.IKeyStore,
+) IJwtService {
 	return &JwtService{
-		DBClient:       dbClient,
-		SessionManager: sessionManager,
+		DBClient:         dbClient,
+		SessionManager:   sessionManager,
+		EventsController: eventsController,
+		KeyStore:         keyStore,
 	}
 }
 
@@ -42,18 +65,32 @@ type TokenDetails struct {
 	SessionID    string `json:"session_id"`
 }
 
-func (j *JwtService) CreateNewTokens(ctx context.Context, email, userAgent, ipAddress string) (*TokenDetails, error) {
+func (j *JwtService) CreateNewTokens(ctx context.Context, user *dto.User, userAgent, ipAddress string) (*TokenDetails, error) {
 	log := logger.Logger(ctx)
-	log.Infof("Creating token for ", email)
+	log.Infof("Creating token for ", user.Email)
 
-	var err error
+	if user.DeactivatedAt != nil {
+		return nil, ErrUserDeactivated
+	}
+
+	if err := j.loadRoles(ctx, user); err != nil {
+		return nil, err
+	}
 
 	// Create a new session
-	sess, err := j.SessionManager.CreateSession(ctx, email, userAgent, ipAddress)
+	sess, err := j.SessionManager.CreateSession(ctx, user.Email, userAgent, ipAddress)
 	if err != nil {
 		return nil, err
 	}
 
+	return j.generateTokens(sess, user)
+}
+
+// generateTokens signs an access and refresh token pair bound to the given session
+func (j *JwtService) generateTokens(sess *session.Session, user *dto.User) (*TokenDetails, error) {
+	var err error
+	email := sess.Email
+
 	td := &TokenDetails{}
 	td.SessionID = sess.SessionID
 	td.AtExpires = time.Now().Add(time.Minute * time.Duration(constants.Config.JwtConfig.JWT_ACCESS_EXP)).Unix()
@@ -61,11 +98,15 @@ func (j *JwtService) CreateNewTokens(ctx context.Context, email, userAgent, ipAd
 	atClaims := jwt.MapClaims{}
 	atClaims["authorized"] = true
 	atClaims["email"] = email
+	atClaims["user_id"] = user.Id
+	atClaims["role"] = user.Role
+	atClaims["roles"] = user.Roles
+	atClaims["school_id"] = user.SchoolId
 	atClaims["session_id"] = sess.SessionID
+	atClaims["token_use"] = tokenUseAccess
 	atClaims["exp"] = td.AtExpires
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
 
-	td.AccessToken, err = at.SignedString([]byte(constants.Config.JwtConfig.JWT_ACCESS_SECRET))
+	td.AccessToken, err = j.signToken(atClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -76,70 +117,199 @@ func (j *JwtService) CreateNewTokens(ctx context.Context, email, userAgent, ipAd
 	rtClaims := jwt.MapClaims{}
 	rtClaims["email"] = email
 	rtClaims["session_id"] = sess.SessionID
+	rtClaims["family_id"] = sess.FamilyID
+	rtClaims["jti"] = sess.RefreshTokenID
+	rtClaims["token_use"] = tokenUseRefresh
 	rtClaims["exp"] = td.RtExpires
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
 
-	td.RefreshToken, err = rt.SignedString([]byte(constants.Config.JwtConfig.JWT_REFRESH_SECRET))
+	td.RefreshToken, err = j.signToken(rtClaims)
 	if err != nil {
 		return nil, err
 	}
 	return td, nil
 }
 
-func (j *JwtService) RefreshToken(ctx context.Context, tokenString, userAgent, ipAddress string) (*TokenDetails, error) {
+// signToken signs the claims with the active key and advertises it in the kid header
+func (j *JwtService) signToken(claims jwt.MapClaims) (string, error) {
+	key, err := j.KeyStore.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	claims["iss"] = constants.Config.JwtConfig.JWT_ISSUER
+	claims["iat"] = time.Now().Unix()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// parseToken verifies the signature with the key named by the kid header and checks that the
+// token was issued for the expected use, so a refresh token is never accepted as an access token
+func (j *JwtService) parseToken(tokenString, tokenUse string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, err := j.KeyStore.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(constants.Config.JwtConfig.JWT_REFRESH_SECRET), nil
+		return key.PublicKey, nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		// Check if session is still valid
-		if sessionID, exists := claims["session_id"].(string); exists {
-			if !j.SessionManager.IsSessionValid(ctx, sessionID) {
-				return nil, fmt.Errorf("session expired or invalid")
-			}
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if use, _ := claims["token_use"].(string); use != tokenUse {
+		return nil, fmt.Errorf("invalid token use")
+	}
+	if !claims.VerifyIssuer(constants.Config.JwtConfig.JWT_ISSUER, true) {
+		return nil, fmt.Errorf("invalid token issuer")
+	}
+	return claims, nil
+}
+
+func (j *JwtService) RefreshToken(ctx context.Context, tokenString, userAgent, ipAddress string) (*TokenDetails, error) {
+	log := logger.Logger(ctx)
+
+	claims, err := j.parseToken(tokenString, tokenUseRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, _ := claims["session_id"].(string)
+	refreshTokenID, _ := claims["jti"].(string)
+	if sessionID == "" || refreshTokenID == "" {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	// Refresh tokens are single use, the old session is replaced by a new one in the same family
+	sess, err := j.SessionManager.RotateSession(ctx, sessionID, refreshTokenID, userAgent, ipAddress)
+	if errors.Is(err, session.ErrRefreshTokenReused) {
+		email, _ := claims["email"].(string)
+		familyID, _ := claims["family_id"].(string)
+		j.recordRefreshTokenReuse(ctx, email, familyID, sessionID, userAgent, ipAddress)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Reload the user so the new access token picks up role and school changes
+	u, err := j.DBClient.GetUserByEmail(ctx, sess.Email)
+	if err != nil {
+		if delErr := j.SessionManager.DeleteSession(ctx, sess.SessionID); delErr != nil {
+			log.Errorf("Failed to delete session of missing user: %v", delErr)
 		}
+		return nil, err
+	}
+	if u.DeactivatedAt != nil {
+		if delErr := j.SessionManager.DeleteSession(ctx, sess.SessionID); delErr != nil {
+			log.Errorf("Failed to delete session of deactivated user: %v", delErr)
+		}
+		return nil, ErrUserDeactivated
+	}
+	if err := j.loadRoles(ctx, u); err != nil {
+		return nil, err
+	}
 
-		return j.CreateNewTokens(ctx, claims["email"].(string), userAgent, ipAddress)
+	return j.generateTokens(sess, u)
+}
+
+// loadRoles loads the roles assigned to the user, which are carried in the access token
+func (j *JwtService) loadRoles(ctx context.Context, user *dto.User) error {
+	roles, err := j.DBClient.GetUserRoleNames(ctx, user.Id)
+	if err != nil {
+		return err
+	}
+	// An empty list rather than none, so the token does not fall back to the base role
+	if roles == nil {
+		roles = []string{}
 	}
-	return nil, fmt.Errorf("invalid token")
+	user.Roles = roles
+	return nil
 }
 
-func (j *JwtService) VerifyToken(ctx context.Context, tokenString string) (*dto.User, bool) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(constants.Config.JwtConfig.JWT_ACCESS_SECRET), nil
+// recordRefreshTokenReuse publishes a security event for a replayed refresh token
+func (j *JwtService) recordRefreshTokenReuse(ctx context.Context, email, familyID, sessionID, userAgent, ipAddress string) {
+	log := logger.Logger(ctx)
+	log.Warnf("Refresh token reuse detected for user %s, session family %s revoked", email, familyID)
+
+	u, err := j.DBClient.GetUserByEmail(ctx, email)
+	if err != nil {
+		log.Errorf("Failed to fetch user for security event: %v", err)
+		return
+	}
+
+	j.EventsController.PublishEvent(dto.Event{
+		EventName: constants.EVENT_REFRESH_TOKEN_REUSED,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    u.Id,
+		Metadata: map[string]interface{}{
+			"family_id":  familyID,
+			"session_id": sessionID,
+			"user_agent": userAgent,
+			"ip_address": ipAddress,
+		},
 	})
+}
+
+func (j *JwtService) VerifyToken(ctx context.Context, tokenString string) (*dto.User, bool) {
+	claims, err := j.parseToken(tokenString, tokenUseAccess)
 	if err != nil {
 		return nil, false
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		// Verify session is still active
-		if sessionID, exists := claims["session_id"].(string); exists {
-			if !j.SessionManager.IsSessionValid(ctx, sessionID) {
-				return nil, false
-			}
-		}
-
-		email := claims["email"].(string)
-		u, err := j.DBClient.GetUserByEmail(ctx, email)
-		if err != nil {
+	// Verify session is still active
+	if sessionID, exists := claims["session_id"].(string); exists {
+		if !j.SessionManager.IsSessionValid(ctx, sessionID) {
 			return nil, false
 		}
+	}
 
-		return u, true
+	// The claims are trusted for the short lifetime of the access token
+	email, _ := claims["email"].(string)
+	role, _ := claims["role"].(string)
+	userID, _ := claims["user_id"].(float64)
+	schoolID, _ := claims["school_id"].(float64)
+	if email == "" || role == "" || userID == 0 {
+		return nil, false
 	}
-	return nil, false
+
+	// Deactivation takes effect immediately, not only when the access token expires
+	active, err := j.DBClient.IsUserActive(ctx, int(userID))
+	if err != nil {
+		logger.Logger(ctx).Errorf("Failed to check whether user %d is active: %v", int(userID), err)
+		return nil, false
+	}
+	if !active {
+		return nil, false
+	}
+
+	// Tokens issued before roles were assigned carry the base role only
+	roles := []string{role}
+	if rolesClaim, ok := claims["roles"].([]interface{}); ok {
+		roles = make([]string, 0, len(rolesClaim))
+		for _, r := range rolesClaim {
+			if name, ok := r.(string); ok {
+				roles = append(roles, name)
+			}
+		}
+	}
+
+	return &dto.User{
+		Id:       int(userID),
+		Email:    email,
+		Role:     role,
+		SchoolId: int(schoolID),
+		Roles:    roles,
+	}, true
 }
 
 func (j *JwtService) InvalidateSession(ctx context.Context, sessionID string) error {
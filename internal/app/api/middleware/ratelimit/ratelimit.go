@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/ratelimit"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit is a middleware that limits requests with the limiter of the matched route.
+// Authenticated requests are counted per user ID, so on protected routes it has to run after
+// the authentication middleware; anonymous requests are counted per client IP. Every response
+// carries the RateLimit-* headers of the IETF draft "RateLimit header fields for HTTP".
+func RateLimit(routes *ratelimit.Routes) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limiter := routes.For(ctx.Request.Method, ctx.FullPath())
+		if limiter == nil {
+			ctx.Next()
+			return
+		}
+
+		key, role := "ip:"+ctx.ClientIP(), ""
+		if claims, exists := ctx.Get(constants.CTK_CLAIM_KEY.String()); exists {
+			if user, ok := claims.(*dto.User); ok && user != nil {
+				key, role = "user:"+strconv.Itoa(user.Id), user.Role
+			}
+		}
+		if apiKey, exists := ctx.Get(constants.CTK_API_KEY.String()); exists {
+			if apiKey, ok := apiKey.(*dto.ApiKey); ok && apiKey != nil {
+				key = "api_key:" + strconv.Itoa(apiKey.Id)
+			}
+		}
+
+		if allow(ctx, limiter, key, role) {
+			ctx.Next()
+		}
+	}
+}
+
+// RateLimitByIP is a coarse limit per client IP that runs before authentication, so requests
+// with invalid credentials are limited too and cannot make every request look up a token or an
+// API key. A nil limiter disables it.
+func RateLimitByIP(limiter ratelimit.ILimiter) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if limiter == nil || allow(ctx, limiter, "ip:"+ctx.ClientIP(), "") {
+			ctx.Next()
+		}
+	}
+}
+
+// allow counts the request against the limiter and sets the RateLimit-* headers. A request over
+// the limit is answered with 429 and aborted.
+func allow(ctx *gin.Context, limiter ratelimit.ILimiter, key, role string) bool {
+	log := logger.Logger(ctx.Request.Context())
+	policy := limiter.Policy()
+
+	result := limiter.Allow(ctx.Request.Context(), key, role)
+	ctx.Header(constants.RATELIMIT_POLICY, fmt.Sprintf("%d;w=%d", result.Limit, int(policy.Window.Seconds())))
+	ctx.Header(constants.RATELIMIT_LIMIT, strconv.Itoa(result.Limit))
+	ctx.Header(constants.RATELIMIT_REMAINING, strconv.Itoa(result.Remaining))
+	ctx.Header(constants.RATELIMIT_RESET, ceilSeconds(result.Reset))
+
+	if !result.Allowed {
+		log.Warnf("Rate limit %s exceeded by %s on path: %s", policy.Name, key, ctx.Request.URL.Path)
+		ctx.Header(constants.RETRY_AFTER, ceilSeconds(result.RetryAfter))
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please slow down"})
+		ctx.Abort()
+		return false
+	}
+	return true
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
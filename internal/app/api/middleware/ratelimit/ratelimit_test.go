@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func newLoginRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logger.SugarLogger = zap.NewNop().Sugar()
+
+	login := ratelimit.NewLimiter(ratelimit.Policy{Name: "login", Limit: 2, Window: time.Minute}, nil)
+	routes := ratelimit.NewRoutes(nil).Set(http.MethodPost, "/auth/login", login)
+
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	router.Use(RateLimit(routes))
+	router.POST("/auth/login", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		wantLast       int
+	}{
+		{
+			name:       "no trusted proxies",
+			remoteAddr: "203.0.113.7:40000",
+			wantLast:   http.StatusTooManyRequests,
+		},
+		{
+			name:           "untrusted peer",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "203.0.113.7:40000",
+			wantLast:       http.StatusTooManyRequests,
+		},
+		{
+			// Behind a trusted proxy every forwarded client has its own bucket
+			name:           "trusted proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.1.2.3:40000",
+			wantLast:       http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newLoginRouter(t, tt.trustedProxies)
+
+			var status int
+			for _, forwardedFor := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+				req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+				req.RemoteAddr = tt.remoteAddr
+				req.Header.Set("X-Forwarded-For", forwardedFor)
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				status = rec.Code
+			}
+			if status != tt.wantLast {
+				t.Errorf("third login attempt returned %d, want %d", status, tt.wantLast)
+			}
+		})
+	}
+}
+
+// Requests with rejected credentials are limited per IP before the authentication runs
+func TestRateLimitByIPRunsBeforeAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.SugarLogger = zap.NewNop().Sugar()
+
+	authenticated := 0
+	router := gin.New()
+	router.Use(RateLimitByIP(ratelimit.NewLimiter(ratelimit.Policy{Name: "ip", Limit: 2, Window: time.Minute}, nil)))
+	router.Use(func(c *gin.Context) {
+		authenticated++
+		c.AbortWithStatus(http.StatusUnauthorized)
+	})
+	router.GET("/classrooms", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/classrooms", nil)
+		req.RemoteAddr = "203.0.113.7:40000"
+		req.Header.Set("Authorization", "Bearer eak_invalid")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("request %d returned %d, want %d", i+1, rec.Code, want)
+		}
+	}
+	if authenticated != 2 {
+		t.Errorf("authentication ran %d times, want 2", authenticated)
+	}
+
+	// Another client has its own limit
+	req := httptest.NewRequest(http.MethodGet, "/classrooms", nil)
+	req.RemoteAddr = "198.51.100.1:40000"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("request of another IP returned %d, want 401", rec.Code)
+	}
+}
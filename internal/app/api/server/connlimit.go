@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/service/logger"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+type connRequestsKey struct{}
+
+// Run serves the router on HTTPSERVER_LISTEN:HTTPSERVER_PORT, enforcing
+// HTTPSERVER_MAX_CONNECTIONS_PER_IP on accepted connections
+func Run(ctx context.Context, router *gin.Engine) error {
+	log := logger.Logger(ctx)
+	serverConfig := constants.Config.HTTPServerConfig
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(serverConfig.HTTPSERVER_LISTEN, serverConfig.HTTPSERVER_PORT))
+	if err != nil {
+		return err
+	}
+	if serverConfig.HTTPSERVER_MAX_CONNECTIONS_PER_IP > 0 {
+		listener = newPerIPLimitListener(ctx, listener, serverConfig.HTTPSERVER_MAX_CONNECTIONS_PER_IP)
+	}
+
+	srv := &http.Server{
+		Handler: router,
+		// Every connection gets its own request counter for requestsPerConnectionMiddleware
+		ConnContext: func(ctx context.Context, _ net.Conn) context.Context {
+			return context.WithValue(ctx, connRequestsKey{}, new(int64))
+		},
+	}
+
+	log.Infof("Listening and serving HTTP on %s", listener.Addr())
+	return srv.Serve(listener)
+}
+
+// requestsPerConnectionMiddleware asks the client to close a keep-alive connection once it has
+// carried HTTPSERVER_MAX_REQUESTS_PER_CONNECTION requests, which spreads long-lived clients
+// across instances behind a load balancer
+func requestsPerConnectionMiddleware(max int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if counter, ok := c.Request.Context().Value(connRequestsKey{}).(*int64); ok && max > 0 {
+			if atomic.AddInt64(counter, 1) >= int64(max) {
+				c.Header("Connection", "close")
+			}
+		}
+		c.Next()
+	}
+}
+
+// perIPLimitListener closes connections from IPs that already hold max open connections
+type perIPLimitListener struct {
+	net.Listener
+	ctx   context.Context
+	max   int
+	mu    sync.Mutex
+	conns map[string]int // ip -> open connections
+}
+
+func newPerIPLimitListener(ctx context.Context, listener net.Listener, max int) net.Listener {
+	return &perIPLimitListener{
+		Listener: listener,
+		ctx:      ctx,
+		max:      max,
+		conns:    make(map[string]int),
+	}
+}
+
+func (l *perIPLimitListener) Accept() (net.Conn, error) {
+	log := logger.Logger(l.ctx)
+
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err != nil {
+			ip = conn.RemoteAddr().String()
+		}
+
+		if l.acquire(ip) {
+			return &perIPConn{Conn: conn, release: func() { l.release(ip) }}, nil
+		}
+
+		log.Warnf("Connection from %s rejected, limit of %d connections per IP reached", ip, l.max)
+		conn.Close()
+	}
+}
+
+func (l *perIPLimitListener) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conns[ip] >= l.max {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *perIPLimitListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conns[ip]--
+	if l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+// perIPConn releases its slot in the listener exactly once when closed
+type perIPConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *perIPConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
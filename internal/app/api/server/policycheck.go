@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/service/logger"
+	"strings"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/util"
+	"github.com/gin-gonic/gin"
+)
+
+// PolicyReport lists the API routes without any Casbin policy and the policies that match no
+// route, both as "METHOD /path"
+type PolicyReport struct {
+	OrphanRoutes   []string
+	OrphanPolicies []string
+}
+
+// CheckPolicies compares the registered API routes with the Casbin policies. A route without a
+// policy is forbidden for everyone behind the authentication middleware, a policy without a
+// route usually means a renamed route or a typo.
+func CheckPolicies(routes gin.RoutesInfo, enforcer casbin.IEnforcer) *PolicyReport {
+	policies := enforcer.GetPolicy()
+
+	report := &PolicyReport{}
+	matched := make([]bool, len(policies))
+
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, constants.API_V1) {
+			continue
+		}
+		object := strings.TrimPrefix(route.Path, constants.API_V1)
+
+		covered := false
+		for i, policy := range policies {
+			// p = sub, obj, act
+			if len(policy) < 3 || policy[2] != route.Method || !util.KeyMatch2(object, policy[1]) {
+				continue
+			}
+			covered = true
+			matched[i] = true
+		}
+		if !covered {
+			report.OrphanRoutes = append(report.OrphanRoutes, route.Method+" "+object)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, policy := range policies {
+		if matched[i] || len(policy) < 3 {
+			continue
+		}
+		orphan := policy[2] + " " + policy[1]
+		if !seen[orphan] {
+			seen[orphan] = true
+			report.OrphanPolicies = append(report.OrphanPolicies, orphan)
+		}
+	}
+
+	return report
+}
+
+// logPolicyReport runs the route/policy self-check at startup and reports every orphan
+func logPolicyReport(ctx context.Context, router *gin.Engine, enforcer casbin.IEnforcer) {
+	log := logger.Logger(ctx)
+
+	report := CheckPolicies(router.Routes(), enforcer)
+	for _, route := range report.OrphanRoutes {
+		log.Warnf("Casbin policy self-check: route %s has no policy", route)
+	}
+	for _, policy := range report.OrphanPolicies {
+		log.Warnf("Casbin policy self-check: policy %s matches no route", policy)
+	}
+	if len(report.OrphanRoutes) == 0 && len(report.OrphanPolicies) == 0 {
+		log.Info("Casbin policy self-check passed, every route has a policy")
+	}
+}
@@ -4,14 +4,26 @@ import (
 	"context"
 	"eduanalytics/internal/app/api/middleware/auth"
 	"eduanalytics/internal/app/api/middleware/jwt"
+	"eduanalytics/internal/app/api/middleware/ratelimit"
 	"eduanalytics/internal/app/constants"
 	"eduanalytics/internal/app/controller"
 	"eduanalytics/internal/app/controller/events"
 	"eduanalytics/internal/app/controller/ws"
 	"eduanalytics/internal/app/db"
 	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/apikey"
+	"eduanalytics/internal/app/service/authz"
+	"eduanalytics/internal/app/service/keystore"
 	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/loginguard"
+	"eduanalytics/internal/app/service/mailer"
+	"eduanalytics/internal/app/service/mfa"
+	"eduanalytics/internal/app/service/oidc"
+	ratelimitservice "eduanalytics/internal/app/service/ratelimit"
+	"eduanalytics/internal/app/service/rbac"
 	"eduanalytics/internal/app/service/session"
+	"eduanalytics/internal/app/service/util"
+	"net/http"
 	"path/filepath"
 	"strings"
 	"time"
@@ -64,6 +76,12 @@ func NewRouter(ctx context.Context) *gin.Engine {
 	log.Info("setting up service and controllers")
 
 	router := gin.New()
+	// The client IP is taken from X-Forwarded-For only when the request comes from one of these
+	// proxies. It keys the rate limits and the login lockout, so trusting every peer would let a
+	// client pick its own IP.
+	if err := router.SetTrustedProxies(constants.Config.HTTPServerConfig.HTTPSERVER_TRUSTED_PROXIES); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
@@ -80,28 +98,14 @@ func NewRouter(ctx context.Context) *gin.Engine {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PATCH", "DELETE", "PUT", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Accept", "Content-Type", constants.AUTHORIZATION, constants.CORRELATION_KEY_ID.String()},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Accept", "Content-Type", constants.AUTHORIZATION, constants.API_KEY_HEADER, constants.CORRELATION_KEY_ID.String()},
+		ExposeHeaders:    []string{"Content-Length", constants.RATELIMIT_POLICY, constants.RATELIMIT_LIMIT, constants.RATELIMIT_REMAINING, constants.RATELIMIT_RESET, constants.RETRY_AFTER},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	router.Use(uuidInjectionMiddleware())
-
-	// Initialize Casbin enforcer
-	modelPath := filepath.Join("internal", "config", "casbin_model.conf")
-	policyPath := filepath.Join("internal", "config", "casbin_policy.csv")
-	enforcer, err := casbin.NewEnforcer(modelPath, policyPath)
-	if err != nil {
-		log.Fatalf("Failed to initialize Casbin enforcer: %v", err)
-	}
-
-	// Load policy from file
-	err = enforcer.LoadPolicy()
-	if err != nil {
-		log.Fatalf("Failed to load Casbin policy: %v", err)
-	}
-	log.Info("Casbin enforcer initialized successfully")
+	router.Use(requestsPerConnectionMiddleware(constants.Config.HTTPServerConfig.HTTPSERVER_MAX_REQUESTS_PER_CONNECTION))
 
 	// Initialize Database
 	dbConn, err := db.Init(ctx)
@@ -117,37 +121,138 @@ func NewRouter(ctx context.Context) *gin.Engine {
 	responseRepository := repository.NewResponseRepository(dbService)
 	reportsRepository := repository.NewReportsRepository(dbService)
 	classroomRepository := repository.NewClassroomsRepository(dbService)
+	schoolsRepository := repository.NewSchoolsRepository(dbService)
+	userTokensRepository := repository.NewUserTokensRepository(dbService)
+	mfaRepository := repository.NewMfaRepository(dbService)
+	identityProvidersRepository := repository.NewIdentityProvidersRepository(dbService)
+	apiKeysRepository := repository.NewApiKeysRepository(dbService)
+	casbinRulesRepository := repository.NewCasbinRulesRepository(dbService)
+	rolesRepository := repository.NewRolesRepository(dbService)
+	auditLogRepository := repository.NewAuditLogRepository(dbService)
+	importJobsRepository := repository.NewImportJobsRepository(dbService)
+	rostersRepository := repository.NewRostersRepository(dbService)
+	oneRosterRepository := repository.NewOneRosterRepository(dbService)
+	dashboardsRepository := repository.NewDashboardsRepository(dbService)
+
+	// Initialize Casbin enforcer with the policy stored in the database
+	enforcer := initEnforcer(ctx, casbinRulesRepository)
+
+	// Initialize Mailer
+	mailService, err := mailer.NewMailer(constants.Config.MailerConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
+	// Initialize Events Controller and start persisting published events
+	eventsController := events.NewEventsController(eventsRepository)
+	eventsController.StartWorkerPool(ctx, 5)
 
 	// Initialize Session Manager (24 hours session expiry)
 	sessionManager := session.NewSessionManager(24 * time.Hour)
 
+	// Initialize failed login tracking
+	authConfig := constants.Config.AuthConfig
+	loginGuard := loginguard.NewLoginGuard(loginguard.Policy{
+		MaxAccountFailures: authConfig.AUTH_LOGIN_MAX_ATTEMPTS,
+		MaxIPFailures:      authConfig.AUTH_LOGIN_IP_MAX_ATTEMPTS,
+		DelayAfter:         authConfig.AUTH_LOGIN_DELAY_AFTER,
+		BaseDelay:          time.Second,
+		MaxDelay:           time.Duration(authConfig.AUTH_LOGIN_MAX_DELAY) * time.Second,
+		LockoutDuration:    time.Duration(authConfig.AUTH_LOGIN_LOCKOUT_DURATION) * time.Minute,
+		Window:             time.Duration(authConfig.AUTH_LOGIN_ATTEMPT_WINDOW) * time.Minute,
+	})
+
+	// Initialize token signing keys
+	keyStore := initKeyStore(ctx)
+
 	// Initialize JWT Service
-	jwtService := jwt.NewJwtService(usersRepository, sessionManager)
+	jwtService := jwt.NewJwtService(usersRepository, sessionManager, eventsController, keyStore)
+
+	// Initialize TOTP second factor
+	mfaService := initMfaService(ctx, mfaRepository)
+
+	// Initialize API keys of machine clients
+	apiKeyService := apikey.NewApiKeyService(apiKeysRepository)
+
+	// Initialize OpenID Connect single sign-on
+	oidcClient := oidc.NewClient(time.Duration(authConfig.AUTH_SSO_HTTP_TIMEOUT) * time.Second)
+	ssoStates := oidc.NewStateStore(time.Duration(authConfig.AUTH_SSO_STATE_EXP) * time.Minute)
+
+	// Initialize resource-level authorization
+	authorizer := authz.NewAuthorizer(classroomRepository)
 
 	// Initialize Controllers
-	oAuthController := controller.NewOAuthController(usersRepository, jwtService)
-	eventsController := events.NewEventsController(eventsRepository)
+	oAuthController := controller.NewOAuthController(usersRepository, schoolsRepository, userTokensRepository, jwtService, mailService, loginGuard, eventsController, mfaService)
 	quizController := controller.NewQuizController(quizRepository, eventsController)
 	responseController := controller.NewResponseController(responseRepository, eventsController)
-	reportController := controller.NewReportController(reportsRepository, eventsController)
+	reportController := controller.NewReportController(reportsRepository, usersRepository, classroomRepository, quizRepository, schoolsRepository, authorizer, auditLogRepository, eventsController)
 	wsController := ws.NewWSController(responseRepository, eventsController)
-	classroomController := controller.NewClassroomController(classroomRepository, usersRepository)
+	classroomController := controller.NewClassroomController(classroomRepository, usersRepository, authorizer, auditLogRepository, eventsController)
+	meController := controller.NewMeController(dashboardsRepository, classroomRepository, schoolsRepository)
+	sessionController := controller.NewSessionController(usersRepository, jwtService, sessionManager)
+	userController := controller.NewUserController(usersRepository, schoolsRepository, userTokensRepository, jwtService, mailService, loginGuard, eventsController)
+	jwksController := controller.NewJWKSController(keyStore)
+	mfaController := controller.NewMfaController(usersRepository, mfaRepository, mfaService, eventsController)
+	apiKeyController := controller.NewApiKeyController(apiKeysRepository, apiKeyService, eventsController)
+	rbacController := controller.NewRbacController(enforcer, rolesRepository, auditLogRepository, eventsController)
+	auditLogController := controller.NewAuditLogController(auditLogRepository)
+	schoolController := controller.NewSchoolController(schoolsRepository, eventsController)
+	roleController := controller.NewRoleController(rolesRepository, usersRepository, enforcer, jwtService, eventsController)
+	ssoController := controller.NewSsoController(usersRepository, schoolsRepository, identityProvidersRepository, userTokensRepository, jwtService, mfaService, oidcClient, ssoStates, eventsController, authConfig.AUTH_SSO_REDIRECT_URL)
+	importController := controller.NewImportController(importJobsRepository, rostersRepository, oneRosterRepository, userTokensRepository, mailService, eventsController)
+	importController.StartWorkers(ctx, 2)
+
+	router.GET(JWKS, jwksController.GetJWKS)
+
+	rateLimits, ipRateLimit := initRateLimits(ctx)
 
-	v1 := router.Group("/api/v1")
+	v1 := router.Group(constants.API_V1)
 	{
-		v1.POST(REGISTER, oAuthController.Register)
-		v1.POST(LOGIN, oAuthController.Login)
+		public := v1.Group("")
+		{
+			public.Use(ratelimit.RateLimit(rateLimits))
+			public.POST(REGISTER, oAuthController.Register)
+			public.GET(VERIFY_EMAIL, oAuthController.VerifyEmail)
+			public.POST(RESEND_VERIFICATION, oAuthController.ResendVerification)
+			public.POST(FORGOT_PASSWORD, oAuthController.ForgotPassword)
+			public.POST(RESET_PASSWORD, oAuthController.ResetPassword)
+			public.POST(LOGIN, oAuthController.Login)
+			public.POST(LOGIN_MFA, oAuthController.LoginMfa)
+			public.POST(LOGIN_MFA_ENROLL, oAuthController.LoginMfaEnroll)
+			public.GET(SSO_LOGIN, ssoController.StartSso)
+			public.GET(SSO_CALLBACK, ssoController.SsoCallback)
+			// The refresh token authenticates itself, the access token may already be expired
+			public.POST(REFRESH, oAuthController.RefreshToken)
+		}
 
 		authenticated := v1.Group("/auth")
 		{
-			authenticated.Use(auth.Authentication(jwtService, enforcer))
-			authenticated.POST(REFRESH, oAuthController.RefreshToken)
+			// Account routes act on the signed in user, API keys are not accepted. Requests are
+			// limited per IP before their credentials are checked and per user after.
+			authenticated.Use(ratelimit.RateLimitByIP(ipRateLimit))
+			authenticated.Use(auth.Authentication(jwtService, nil, enforcer))
+			authenticated.Use(ratelimit.RateLimit(rateLimits))
 			authenticated.POST(LOGOUT, oAuthController.Logout)
+			authenticated.POST(CHANGE_PASSWORD, oAuthController.ChangePassword)
+
+			// Session routes
+			authenticated.GET(SESSIONS, sessionController.GetSessions)
+			authenticated.DELETE(SESSIONS, sessionController.RevokeAllSessions)
+			authenticated.DELETE(SESSIONS+SESSION_DETAILS, sessionController.RevokeSession)
+
+			// MFA routes
+			authenticated.GET(MFA, mfaController.GetMfaStatus)
+			authenticated.DELETE(MFA, mfaController.DisableMfa)
+			authenticated.POST(MFA_ENROLL, mfaController.EnrollMfa)
+			authenticated.POST(MFA_CONFIRM, mfaController.ConfirmMfa)
+			authenticated.POST(MFA_RECOVERY_CODES, mfaController.RegenerateRecoveryCodes)
 		}
 
 		protected := v1.Group("")
 		{
-			protected.Use(auth.Authentication(jwtService, enforcer))
+			protected.Use(ratelimit.RateLimitByIP(ipRateLimit))
+			protected.Use(auth.Authentication(jwtService, apiKeyService, enforcer))
+			protected.Use(ratelimit.RateLimit(rateLimits))
 
 			protected.POST(QUIZZES, quizController.CreateQuiz)
 			protected.POST(RESPONSES, responseController.SubmitResponse)
@@ -162,15 +267,219 @@ func NewRouter(ctx context.Context) *gin.Engine {
 			protected.GET(CLASSROOMS+CLASSROOM_DETAILS, classroomController.GetClassroom)
 			protected.PUT(CLASSROOMS+CLASSROOM_DETAILS, classroomController.UpdateClassroom)
 			protected.DELETE(CLASSROOMS+CLASSROOM_DETAILS, classroomController.DeleteClassroom)
+			protected.POST(CLASSROOMS+CLASSROOM_PURGE, classroomController.PurgeClassroom)
 			protected.POST(CLASSROOMS+CLASSROOM_DETAILS+"/enroll", classroomController.EnrollStudents)
 			protected.DELETE(CLASSROOMS+CLASSROOM_DETAILS+"/students/:student_id", classroomController.UnenrollStudent)
 			protected.GET(CLASSROOMS+CLASSROOM_LIST_STUDENT, classroomController.GetStudentsByClassroom)
+			protected.GET(CLASSROOMS+CLASSROOM_ENROLLMENTS, classroomController.GetEnrollments)
+			protected.POST(CLASSROOMS+CLASSROOM_TRANSFER, classroomController.TransferStudents)
+			protected.GET(CLASSROOMS+CLASSROOM_MEMBERS, classroomController.GetClassroomMembers)
+			protected.POST(CLASSROOMS+CLASSROOM_MEMBERS, classroomController.AddClassroomMember)
+			protected.DELETE(CLASSROOMS+CLASSROOM_MEMBER, classroomController.RemoveClassroomMember)
+			protected.GET(TEACHER_CLASSROOMS, classroomController.GetClassroomsByTeacher)
+			protected.GET(STUDENT_CLASSROOMS, classroomController.GetClassroomsByStudent)
+
+			// Routes of the signed in user, looked up from the access token
+			protected.GET(ME+ME_CLASSROOMS, meController.GetMyClassrooms)
+			protected.GET(ME+ME_QUIZZES, meController.GetMyQuizzes)
+			protected.GET(ME+ME_DASHBOARD, meController.GetMyDashboard)
+
+			// User administration routes
+			protected.GET(USERS, userController.GetUsers)
+			protected.POST(USERS, userController.CreateUser)
+			protected.GET(USERS+USER_DETAILS, userController.GetUser)
+			protected.PUT(USERS+USER_DETAILS, userController.UpdateUser)
+			protected.DELETE(USERS+USER_DETAILS, userController.DeleteUser)
+			protected.PUT(USERS+USER_BASE_ROLE, userController.ChangeUserRole)
+			protected.POST(USERS+USER_DEACTIVATE, userController.DeactivateUser)
+			protected.POST(USERS+USER_REACTIVATE, userController.ReactivateUser)
+			protected.POST(USERS+USER_UNLOCK, userController.UnlockUser)
+			protected.GET(USERS+USER_SESSIONS, sessionController.GetUserSessions)
+			protected.DELETE(USERS+USER_SESSIONS, sessionController.RevokeAllUserSessions)
+			protected.DELETE(USERS+USER_SESSIONS+SESSION_DETAILS, sessionController.RevokeUserSession)
+			protected.DELETE(USERS+USER_MFA, mfaController.ResetUserMfa)
+			protected.GET(USERS+USER_ROLES, roleController.GetUserRoles)
+			protected.POST(USERS+USER_ROLES, roleController.AssignRole)
+			protected.DELETE(USERS+USER_ROLES+USER_ROLE, roleController.UnassignRole)
+
+			// Import routes, imports run in the background and are polled
+			protected.POST(IMPORTS+IMPORT_ROSTER, importController.ImportRoster)
+			protected.GET(IMPORTS+IMPORT_DETAILS, importController.GetImportJob)
+			protected.POST(ONEROSTER+ONEROSTER_IMPORT, importController.ImportOneRoster)
+			protected.GET(ONEROSTER+ONEROSTER_EXPORT, importController.ExportOneRoster)
+
+			// Role administration routes
+			protected.GET(ROLES, roleController.GetRoles)
+			protected.POST(ROLES, roleController.CreateRole)
+			protected.GET(ROLES+ROLE_DETAILS, roleController.GetRole)
+			protected.PUT(ROLES+ROLE_DETAILS, roleController.UpdateRole)
+			protected.DELETE(ROLES+ROLE_DETAILS, roleController.DeleteRole)
+
+			// MFA administration routes
+			protected.GET(MFA_REQUIREMENTS, mfaController.GetMfaRequirements)
+			protected.PUT(MFA_REQUIREMENTS+MFA_REQUIREMENT_FOR, mfaController.SetMfaRequirement)
+
+			// API key administration routes
+			protected.GET(API_KEYS, apiKeyController.GetApiKeys)
+			protected.POST(API_KEYS, apiKeyController.CreateApiKey)
+			protected.DELETE(API_KEYS+API_KEY_DETAILS, apiKeyController.RevokeApiKey)
+
+			// RBAC policy administration routes
+			protected.GET(RBAC+RBAC_POLICIES, rbacController.GetPolicies)
+			protected.POST(RBAC+RBAC_POLICIES, rbacController.AddPolicy)
+			protected.DELETE(RBAC+RBAC_POLICIES, rbacController.RemovePolicy)
+			protected.GET(RBAC+RBAC_INHERITANCE, rbacController.GetRoleInheritance)
+			protected.POST(RBAC+RBAC_INHERITANCE, rbacController.AddRoleInheritance)
+			protected.DELETE(RBAC+RBAC_INHERITANCE, rbacController.RemoveRoleInheritance)
+
+			// Audit log routes
+			protected.GET(AUDIT_LOG, auditLogController.GetAuditLogs)
+			protected.GET(AUDIT_LOG+AUDIT_LOG_VERIFY, auditLogController.VerifyAuditLog)
+
+			// School routes, only super admins manage schools
+			protected.GET(SCHOOLS, schoolController.GetSchools)
+			protected.POST(SCHOOLS, schoolController.CreateSchool)
+			protected.GET(SCHOOLS+SCHOOL_DETAILS, schoolController.GetSchool)
+			protected.PUT(SCHOOLS+SCHOOL_DETAILS, schoolController.UpdateSchool)
+			protected.DELETE(SCHOOLS+SCHOOL_DETAILS, schoolController.DeleteSchool)
+			protected.GET(SCHOOLS+SCHOOL_SETTINGS, schoolController.GetSchoolSettings)
+			protected.PUT(SCHOOLS+SCHOOL_SETTINGS, schoolController.UpdateSchoolSettings)
+
+			// School SSO administration routes
+			protected.GET(SCHOOLS+SCHOOL_SSO, ssoController.GetIdentityProvider)
+			protected.PUT(SCHOOLS+SCHOOL_SSO, ssoController.SaveIdentityProvider)
+			protected.DELETE(SCHOOLS+SCHOOL_SSO, ssoController.DeleteIdentityProvider)
 		}
 	}
 
+	logPolicyReport(ctx, router, enforcer)
+
 	return router
 }
 
+// initRateLimits builds the per-route rate limit policies. Login and the other public auth
+// routes are limited strictly per IP, reports are expensive queries and response submission
+// is bulk traffic; every other route gets the default limit. The coarse per IP limit of the
+// authenticated routes applies before their credentials are checked.
+func initRateLimits(ctx context.Context) (*ratelimitservice.Routes, ratelimitservice.ILimiter) {
+	log := logger.Logger(ctx)
+	rateConfig := constants.Config.RateLimitConfig
+
+	if !rateConfig.RATE_LIMIT_ENABLED {
+		log.Warn("Rate limiting is disabled")
+		return ratelimitservice.NewRoutes(nil), nil
+	}
+
+	roleMultipliers, err := ratelimitservice.ParseRoleMultipliers(rateConfig.RATE_LIMIT_ROLE_MULTIPLIERS)
+	if err != nil {
+		log.Fatalf("Failed to parse RATE_LIMIT_ROLE_MULTIPLIERS: %v", err)
+	}
+
+	window := time.Duration(rateConfig.RATE_LIMIT_WINDOW) * time.Second
+	newLimiter := func(name string, limit int) ratelimitservice.ILimiter {
+		return ratelimitservice.NewLimiter(ratelimitservice.Policy{Name: name, Limit: limit, Window: window}, roleMultipliers)
+	}
+
+	login := newLimiter("login", rateConfig.RATE_LIMIT_LOGIN)
+	account := newLimiter("auth", rateConfig.RATE_LIMIT_AUTH)
+	reports := newLimiter("reports", rateConfig.RATE_LIMIT_REPORTS)
+	responses := newLimiter("responses", rateConfig.RATE_LIMIT_RESPONSES)
+
+	const prefix = constants.API_V1
+	routes := ratelimitservice.NewRoutes(newLimiter("default", rateConfig.RATE_LIMIT_DEFAULT)).
+		Set(http.MethodPost, prefix+LOGIN, login).
+		Set(http.MethodPost, prefix+LOGIN_MFA, login).
+		Set(http.MethodPost, prefix+LOGIN_MFA_ENROLL, account).
+		Set(http.MethodPost, prefix+REGISTER, account).
+		Set(http.MethodGet, prefix+VERIFY_EMAIL, account).
+		Set(http.MethodPost, prefix+RESEND_VERIFICATION, account).
+		Set(http.MethodPost, prefix+FORGOT_PASSWORD, account).
+		Set(http.MethodPost, prefix+RESET_PASSWORD, account).
+		Set(http.MethodPost, prefix+REFRESH, account).
+		Set(http.MethodGet, prefix+SSO_LOGIN, login).
+		Set(http.MethodGet, prefix+SSO_CALLBACK, login).
+		Set(http.MethodGet, prefix+REPORT_STUDENT_PERFORMANCE, reports).
+		Set(http.MethodGet, prefix+REPORT_CLASSROOM_ENGAGEMENT, reports).
+		Set(http.MethodGet, prefix+REPORT_CONTENT_EFFECTIVENESS, reports).
+		Set(http.MethodPost, prefix+RESPONSES, responses)
+
+	// Every user behind a school's NAT shares the IP, so the limit is well above a single user's
+	return routes, newLimiter("ip", rateConfig.RATE_LIMIT_IP)
+}
+
+// initEnforcer creates the Casbin enforcer from the policy stored in the database, seeding it
+// from AUTH_RBAC_POLICY_SEED on first start, and reloads the policy whenever another instance
+// changes it
+func initEnforcer(ctx context.Context, casbinRulesRepository repository.ICasbinRulesRepository) *casbin.SyncedEnforcer {
+	log := logger.Logger(ctx)
+	authConfig := constants.Config.AuthConfig
+
+	modelPath := filepath.Join("internal", "config", "casbin_model.conf")
+	enforcer, err := rbac.NewEnforcer(ctx, modelPath, authConfig.AUTH_RBAC_POLICY_SEED, casbinRulesRepository)
+	if err != nil {
+		log.Fatalf("Failed to initialize Casbin enforcer: %v", err)
+	}
+
+	watcher, err := rbac.NewWatcher(ctx, db.DSN(), casbinRulesRepository, time.Duration(authConfig.AUTH_RBAC_RELOAD_INTERVAL)*time.Second)
+	if err != nil {
+		log.Fatalf("Failed to listen for Casbin policy changes: %v", err)
+	}
+	if err := rbac.Watch(enforcer, watcher); err != nil {
+		log.Fatalf("Failed to watch Casbin policy changes: %v", err)
+	}
+
+	log.Info("Casbin enforcer initialized successfully")
+	return enforcer
+}
+
+// initMfaService creates the MFA service. Local environments without AUTH_MFA_ENCRYPTION_KEY
+// get a random key, enrollments made with it cannot be used after a restart.
+func initMfaService(ctx context.Context, mfaRepository repository.IMfaRepository) mfa.IMfaService {
+	log := logger.Logger(ctx)
+	authConfig := constants.Config.AuthConfig
+
+	encryptionKey := authConfig.AUTH_MFA_ENCRYPTION_KEY
+	if encryptionKey == "" && strings.EqualFold(constants.Config.Environment, constants.Local.String()) {
+		key, err := util.GenerateToken()
+		if err != nil {
+			log.Fatalf("Failed to generate MFA encryption key: %v", err)
+		}
+		log.Warn("AUTH_MFA_ENCRYPTION_KEY is not set, using an ephemeral key")
+		encryptionKey = key
+	}
+
+	mfaService, err := mfa.NewMfaService(mfaRepository, authConfig.AUTH_MFA_ISSUER, encryptionKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize MFA: %v", err)
+	}
+	return mfaService
+}
+
+// initKeyStore loads the token signing keys from JWT_KEY_DIR. Local environments without a key
+// directory fall back to an ephemeral key so the service can start without any setup.
+func initKeyStore(ctx context.Context) keystore.IKeyStore {
+	log := logger.Logger(ctx)
+	jwtConfig := constants.Config.JwtConfig
+
+	if jwtConfig.JWT_KEY_DIR == "" && strings.EqualFold(constants.Config.Environment, constants.Local.String()) {
+		keyStore, err := keystore.NewEphemeralKeyStore(ctx)
+		if err != nil {
+			log.Fatalf("Failed to generate ephemeral signing key: %v", err)
+		}
+		return keyStore
+	}
+
+	keyStore, err := keystore.NewKeyStore(ctx, jwtConfig.JWT_KEY_DIR, jwtConfig.JWT_SIGNING_KEY_ID)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	if jwtConfig.JWT_KEY_RELOAD_INTERVAL > 0 {
+		go keystore.StartReloader(ctx, keyStore, time.Duration(jwtConfig.JWT_KEY_RELOAD_INTERVAL)*time.Second)
+	}
+	return keyStore
+}
+
 // uuidInjectionMiddleware injects the request context with a correlation id of type uuid
 func uuidInjectionMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -2,13 +2,33 @@ package server
 
 const (
 	HEALTH_CHECK = "/health-check"
+	JWKS         = "/.well-known/jwks.json"
 
-	REGISTER = "/auth/register"
-	LOGIN    = "/auth/login"
-	REFRESH  = "/refresh"
-	LOGOUT   = "/logout"
+	REGISTER            = "/auth/register"
+	VERIFY_EMAIL        = "/auth/verify-email"
+	RESEND_VERIFICATION = "/auth/verify-email/resend"
+	FORGOT_PASSWORD     = "/auth/forgot-password"
+	RESET_PASSWORD      = "/auth/reset-password"
+	CHANGE_PASSWORD     = "/change-password"
+	LOGIN               = "/auth/login"
+	LOGIN_MFA           = "/auth/login/mfa"
+	LOGIN_MFA_ENROLL    = "/auth/login/mfa/enroll"
+	REFRESH             = "/auth/refresh"
+	SSO_LOGIN           = "/auth/sso/login/:school_id"
+	SSO_CALLBACK        = "/auth/sso/callback"
+	LOGOUT              = "/logout"
 
-	QUIZZES            = "/quizzes"
+	SESSIONS        = "/sessions"
+	SESSION_DETAILS = "/:session_id"
+
+	MFA                 = "/mfa"
+	MFA_ENROLL          = "/mfa/enroll"
+	MFA_CONFIRM         = "/mfa/confirm"
+	MFA_RECOVERY_CODES  = "/mfa/recovery-codes"
+	MFA_REQUIREMENTS    = "/mfa/requirements"
+	MFA_REQUIREMENT_FOR = "/:role"
+
+	QUIZZES                      = "/quizzes"
 	REPORT_STUDENT_PERFORMANCE   = "/student-performance"
 	REPORT_CLASSROOM_ENGAGEMENT  = "/classroom-engagement"
 	REPORT_CONTENT_EFFECTIVENESS = "/content-effectiveness"
@@ -17,7 +37,6 @@ const (
 
 	WS_QUIZ = "/ws/quiz"
 
-
 	START_QUIZ         = "/quizzes/:id/start"
 	ADD_QUIZ_QUESTION  = "/quizzes/:id/questions"
 	GET_QUIZ_QUESTION  = "/quizzes/:id/questions/:qid"
@@ -33,7 +52,57 @@ const (
 	CAPTURE_EVENT       = "/events"
 	CAPTURE_BATCH_EVENT = "/batch"
 
+	USERS           = "/users"
+	USER_DETAILS    = "/:id"
+	USER_BASE_ROLE  = "/:id/role"
+	USER_DEACTIVATE = "/:id/deactivate"
+	USER_REACTIVATE = "/:id/reactivate"
+	USER_UNLOCK     = "/:id/unlock"
+	USER_MFA        = "/:id/mfa"
+	USER_SESSIONS   = "/:id/sessions"
+	USER_ROLES      = "/:id/roles"
+	USER_ROLE       = "/:role"
+
+	IMPORTS        = "/imports"
+	IMPORT_ROSTER  = "/roster"
+	IMPORT_DETAILS = "/:id"
+
+	ONEROSTER        = "/oneroster"
+	ONEROSTER_IMPORT = "/import"
+	ONEROSTER_EXPORT = "/export"
+
+	ROLES        = "/roles"
+	ROLE_DETAILS = "/:name"
+
+	API_KEYS        = "/api-keys"
+	API_KEY_DETAILS = "/:id"
+
+	RBAC             = "/rbac"
+	RBAC_POLICIES    = "/policies"
+	RBAC_INHERITANCE = "/inheritance"
+
+	AUDIT_LOG        = "/audit-log"
+	AUDIT_LOG_VERIFY = "/verify"
+
+	SCHOOLS         = "/schools"
+	SCHOOL_DETAILS  = "/:id"
+	SCHOOL_SETTINGS = "/:id/settings"
+	SCHOOL_SSO      = "/:id/sso"
+
 	CLASSROOMS             = "/classrooms"
 	CLASSROOM_LIST_STUDENT = "/:id/students"
 	CLASSROOM_DETAILS      = "/:id"
+	CLASSROOM_ENROLLMENTS  = "/:id/enrollments"
+	CLASSROOM_TRANSFER     = "/:id/transfer"
+	CLASSROOM_MEMBERS      = "/:id/members"
+	CLASSROOM_MEMBER       = "/:id/members/:user_id"
+	CLASSROOM_PURGE        = "/:id/purge"
+
+	TEACHER_CLASSROOMS = "/teachers/:teacher_id/classrooms"
+	STUDENT_CLASSROOMS = "/students/:student_id/classrooms"
+
+	ME            = "/me"
+	ME_CLASSROOMS = "/classrooms"
+	ME_QUIZZES    = "/quizzes"
+	ME_DASHBOARD  = "/dashboard"
 )
@@ -4,12 +4,24 @@ import "eduanalytics/internal/config"
 
 var Config *config.ServiceConfig
 
+// API_V1 is the prefix of the versioned API routes, Casbin policies name routes without it
+const API_V1 = "/api/v1"
+
 const (
 	//Header constants
-	AUTHORIZATION      = "Authorization"
-	BEARER             = "Bearer "
-	CTK_CLAIM_KEY      = CONTEXT_KEY("claims")
-	CORRELATION_KEY_ID = CORRELATION_KEY("X-Correlation-ID")
+	AUTHORIZATION       = "Authorization"
+	BEARER              = "Bearer "
+	API_KEY_HEADER      = "X-API-Key"
+	RATELIMIT_POLICY    = "RateLimit-Policy"
+	RATELIMIT_LIMIT     = "RateLimit-Limit"
+	RATELIMIT_REMAINING = "RateLimit-Remaining"
+	RATELIMIT_RESET     = "RateLimit-Reset"
+	RETRY_AFTER         = "Retry-After"
+	CTK_CLAIM_KEY       = CONTEXT_KEY("claims")
+	CTK_API_KEY         = CONTEXT_KEY("api_key")
+	CTK_AUDIT_ACTOR     = CONTEXT_KEY("audit_actor")
+	CTK_TENANT_ID       = CONTEXT_KEY("tenant_id")
+	CORRELATION_KEY_ID  = CORRELATION_KEY("X-Correlation-ID")
 )
 
 type (
@@ -21,10 +33,145 @@ type (
 
 // Role constants
 const (
-	ROLE_ADMIN   = "admin"
-	ROLE_TEACHER = "teacher"
-	ROLE_STUDENT = "student"
-	ROLE_PUBLIC  = "public"
+	ROLE_SUPER_ADMIN = "super_admin"
+	ROLE_ADMIN       = "admin"
+	ROLE_TEACHER     = "teacher"
+	ROLE_STUDENT     = "student"
+	ROLE_PUBLIC      = "public"
+)
+
+// User token purposes
+const (
+	TOKEN_PURPOSE_EMAIL_VERIFICATION = "email_verification"
+	TOKEN_PURPOSE_PASSWORD_RESET     = "password_reset"
+	TOKEN_PURPOSE_MFA_CHALLENGE      = "mfa_challenge"
+)
+
+// OneRoster resource types of mapped sourcedIds
+const (
+	SOURCED_ID_ORG        = "org"
+	SOURCED_ID_USER       = "user"
+	SOURCED_ID_CLASS      = "class"
+	SOURCED_ID_ENROLLMENT = "enrollment"
+)
+
+// Import job kinds and statuses
+const (
+	IMPORT_KIND_ROSTER      = "roster"
+	IMPORT_KIND_ONEROSTER   = "oneroster"
+	IMPORT_STATUS_PENDING   = "pending"
+	IMPORT_STATUS_RUNNING   = "running"
+	IMPORT_STATUS_COMPLETED = "completed"
+	IMPORT_STATUS_FAILED    = "failed"
+)
+
+// Quiz statuses of the dashboards, by the quiz's start and end time
+const (
+	QUIZ_STATUS_UPCOMING  = "upcoming"
+	QUIZ_STATUS_ACTIVE    = "active"
+	QUIZ_STATUS_COMPLETED = "completed"
+)
+
+// Enrollment statuses, enrollments that ended keep their row with the reason they ended
+const (
+	ENROLLMENT_STATUS_ACTIVE      = "active"
+	ENROLLMENT_STATUS_DROPPED     = "dropped"
+	ENROLLMENT_STATUS_TRANSFERRED = "transferred"
+)
+
+// Roles of the members of a classroom besides its teacher
+const (
+	CLASSROOM_MEMBER_CO_TEACHER = "co_teacher"
+	CLASSROOM_MEMBER_ASSISTANT  = "assistant"
+)
+
+// Security event constants
+const (
+	EVENT_APP_AUTH             = "auth"
+	EVENT_REFRESH_TOKEN_REUSED = "refresh_token_reused"
+	EVENT_ACCOUNT_LOCKED       = "account_locked"
+	EVENT_ACCOUNT_UNLOCKED     = "account_unlocked"
+	EVENT_IP_LOCKED            = "ip_locked"
+	EVENT_SUSPICIOUS_LOGIN     = "suspicious_login"
+	EVENT_MFA_ENABLED          = "mfa_enabled"
+	EVENT_MFA_DISABLED         = "mfa_disabled"
+	EVENT_MFA_RECOVERY_USED    = "mfa_recovery_code_used"
+	EVENT_SSO_LOGIN            = "sso_login"
+	EVENT_API_KEY_CREATED      = "api_key_created"
+	EVENT_API_KEY_REVOKED      = "api_key_revoked"
+	EVENT_ACCESS_DENIED        = "access_denied"
+	EVENT_RBAC_POLICY_ADDED    = "rbac_policy_added"
+	EVENT_RBAC_POLICY_REMOVED  = "rbac_policy_removed"
+	EVENT_ROLE_CREATED         = "role_created"
+	EVENT_ROLE_DELETED         = "role_deleted"
+	EVENT_ROLE_ASSIGNED        = "role_assigned"
+	EVENT_ROLE_UNASSIGNED      = "role_unassigned"
+	EVENT_SCHOOL_CREATED       = "school_created"
+	EVENT_SCHOOL_UPDATED       = "school_updated"
+	EVENT_SCHOOL_DELETED       = "school_deleted"
+	EVENT_USER_UPDATED         = "user_updated"
+	EVENT_USER_ROLE_CHANGED    = "user_role_changed"
+	EVENT_USER_DEACTIVATED     = "user_deactivated"
+	EVENT_USER_REACTIVATED     = "user_reactivated"
+	EVENT_USER_DELETED         = "user_deleted"
+	EVENT_ROSTER_IMPORTED      = "roster_imported"
+	EVENT_ONEROSTER_IMPORTED   = "oneroster_imported"
+	EVENT_ONEROSTER_EXPORTED   = "oneroster_exported"
+)
+
+// Audit log actor types
+const (
+	AUDIT_ACTOR_USER      = "user"
+	AUDIT_ACTOR_API_KEY   = "api_key"
+	AUDIT_ACTOR_ANONYMOUS = "anonymous"
+	AUDIT_ACTOR_SYSTEM    = "system"
+)
+
+// Audit log resource types
+const (
+	AUDIT_RESOURCE_CLASSROOM = "classroom"
+	AUDIT_RESOURCE_USER      = "user"
+	AUDIT_RESOURCE_ROLE      = "role"
+	AUDIT_RESOURCE_API_KEY   = "api_key"
+	AUDIT_RESOURCE_POLICY    = "policy"
+	AUDIT_RESOURCE_STUDENT   = "student"
+	AUDIT_RESOURCE_QUIZ      = "quiz"
+	AUDIT_RESOURCE_SCHOOL    = "school"
+)
+
+// Audit log actions
+const (
+	AUDIT_CLASSROOM_CREATE   = "classroom.create"
+	AUDIT_CLASSROOM_UPDATE   = "classroom.update"
+	AUDIT_CLASSROOM_ARCHIVE  = "classroom.archive"
+	AUDIT_CLASSROOM_DELETE   = "classroom.delete"
+	AUDIT_CLASSROOM_ENROLL   = "classroom.enroll"
+	AUDIT_CLASSROOM_UNENROLL = "classroom.unenroll"
+	AUDIT_CLASSROOM_TRANSFER = "classroom.transfer"
+	AUDIT_CLASSROOM_MEMBER   = "classroom.member_add"
+	AUDIT_CLASSROOM_UNMEMBER = "classroom.member_remove"
+	AUDIT_USER_CREATE        = "user.create"
+	AUDIT_USER_ROLE_CHANGE   = "user.role_change"
+	AUDIT_USER_PASSWORD      = "user.password_change"
+	AUDIT_USER_ROLE_ASSIGN   = "user.role_assign"
+	AUDIT_USER_ROLE_UNASSIGN = "user.role_unassign"
+	AUDIT_USER_UPDATE        = "user.update"
+	AUDIT_USER_DEACTIVATE    = "user.deactivate"
+	AUDIT_USER_REACTIVATE    = "user.reactivate"
+	AUDIT_USER_DELETE        = "user.delete"
+	AUDIT_ROLE_CREATE        = "role.create"
+	AUDIT_ROLE_UPDATE        = "role.update"
+	AUDIT_ROLE_DELETE        = "role.delete"
+	AUDIT_API_KEY_CREATE     = "api_key.create"
+	AUDIT_API_KEY_REVOKE     = "api_key.revoke"
+	AUDIT_POLICY_ADD         = "policy.add"
+	AUDIT_POLICY_REMOVE      = "policy.remove"
+	AUDIT_ACCESS_DENIED      = "access.denied"
+	AUDIT_REPORT_VIEW        = "report.view"
+	AUDIT_SCHOOL_CREATE      = "school.create"
+	AUDIT_SCHOOL_UPDATE      = "school.update"
+	AUDIT_SCHOOL_SETTINGS    = "school.settings_update"
+	AUDIT_SCHOOL_DELETE      = "school.delete"
 )
 
 var DBLOGMODE bool
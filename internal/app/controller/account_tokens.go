@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/mailer"
+	"eduanalytics/internal/app/service/util"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// issueUserToken stores the hash of a new single-use token and returns the token itself
+func issueUserToken(ctx context.Context, tokens repository.IUserTokensRepository, userId int, purpose string, ttl time.Duration) (string, error) {
+	token, err := util.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := tokens.CreateToken(ctx, &dto.UserToken{
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: util.HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// sendVerificationEmail replaces any outstanding verification token of the user and mails a new link
+func sendVerificationEmail(ctx context.Context, tokens repository.IUserTokensRepository, m mailer.IMailer, user *dto.User) error {
+	if err := tokens.InvalidateUserTokens(ctx, user.Id, constants.TOKEN_PURPOSE_EMAIL_VERIFICATION); err != nil {
+		return err
+	}
+
+	ttl := time.Minute * time.Duration(constants.Config.AuthConfig.AUTH_EMAIL_VERIFICATION_EXP)
+	token, err := issueUserToken(ctx, tokens, user.Id, constants.TOKEN_PURPOSE_EMAIL_VERIFICATION, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := constants.Config.MailerConfig.MAILER_BASE_URL + "/api/v1/auth/verify-email?token=" + url.QueryEscape(token)
+	return m.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your EduAnalytics account",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease verify your email address by opening the link below. "+
+			"The link expires in %s.\n\n%s\n", user.Name, ttl, link),
+	})
+}
+
+// sendPasswordResetEmail replaces any outstanding reset token of the user and mails a new one
+func sendPasswordResetEmail(ctx context.Context, tokens repository.IUserTokensRepository, m mailer.IMailer, user *dto.User) error {
+	if err := tokens.InvalidateUserTokens(ctx, user.Id, constants.TOKEN_PURPOSE_PASSWORD_RESET); err != nil {
+		return err
+	}
+
+	ttl := time.Minute * time.Duration(constants.Config.AuthConfig.AUTH_PASSWORD_RESET_EXP)
+	token, err := issueUserToken(ctx, tokens, user.Id, constants.TOKEN_PURPOSE_PASSWORD_RESET, ttl)
+	if err != nil {
+		return err
+	}
+
+	return m.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your EduAnalytics password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the token below to reset your password. It can be used once and "+
+			"expires in %s. If you did not ask for a reset you can ignore this email.\n\n%s\n", user.Name, ttl, token),
+	})
+}
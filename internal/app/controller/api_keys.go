@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/apikey"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/dto/response"
+	"eduanalytics/internal/app/service/logger"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// IApiKeyController represents the interface for ApiKeyController
+type IApiKeyController interface {
+	CreateApiKey(c *gin.Context)
+	GetApiKeys(c *gin.Context)
+	RevokeApiKey(c *gin.Context)
+}
+
+// ApiKeyController lets admins manage the API keys of their school
+type ApiKeyController struct {
+	Repo    repository.IApiKeysRepository
+	ApiKeys apikey.IApiKeyService
+	Events  events.IEventsController
+}
+
+// NewApiKeyController creates a new instance of ApiKeyController
+func NewApiKeyController(
+	repo repository.IApiKeysRepository,
+	apiKeys apikey.IApiKeyService,
+	eventsController events.IEventsController,
+) IApiKeyController {
+	return &ApiKeyController{
+		Repo:    repo,
+		ApiKeys: apiKeys,
+		Events:  eventsController,
+	}
+}
+
+// CreateApiKey issues a key for the admin's school; the key is only returned in this response
+func (a *ApiKeyController) CreateApiKey(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := a.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	var req request.CreateApiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	authConfig := constants.Config.AuthConfig
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = authConfig.AUTH_API_KEY_DEFAULT_EXP
+	}
+	if days > authConfig.AUTH_API_KEY_MAX_EXP {
+		RespondWithError(c, http.StatusBadRequest, "expires_in_days must not exceed "+strconv.Itoa(authConfig.AUTH_API_KEY_MAX_EXP))
+		return
+	}
+
+	key := &dto.ApiKey{
+		Name:      req.Name,
+		SchoolId:  admin.SchoolId,
+		Role:      req.Role,
+		CreatedBy: &admin.Id,
+		ExpiresAt: time.Now().AddDate(0, 0, days),
+	}
+
+	rawKey, err := a.ApiKeys.Create(ctx, key)
+	if err != nil {
+		log.Error("error while creating api key", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	a.publishApiKeyEvent(constants.EVENT_API_KEY_CREATED, admin, key)
+	log.Infof("API key %d (%s) with role %s created by admin %d", key.Id, key.Prefix, key.Role, admin.Id)
+	RespondWithSuccess(c, http.StatusCreated, "API key created, store the key in a safe place",
+		response.CreateApiKeyResponse{ApiKey: key, Key: rawKey})
+}
+
+// GetApiKeys lists the keys of the admin's school without their secrets
+func (a *ApiKeyController) GetApiKeys(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := a.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	keys, err := a.Repo.GetApiKeys(ctx, admin.SchoolId)
+	if err != nil {
+		log.Error("error while fetching api keys", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "API keys", keys)
+}
+
+// RevokeApiKey revokes a key of the admin's school with immediate effect
+func (a *ApiKeyController) RevokeApiKey(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := a.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		RespondWithError(c, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	err = a.Repo.RevokeApiKey(ctx, id, admin.SchoolId)
+	if gorm.IsRecordNotFoundError(err) {
+		RespondWithError(c, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		log.Error("error while revoking api key", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	a.publishApiKeyEvent(constants.EVENT_API_KEY_REVOKED, admin, &dto.ApiKey{Id: id, SchoolId: admin.SchoolId})
+	log.Infof("API key %d revoked by admin %d", id, admin.Id)
+	RespondWithSuccess(c, http.StatusOK, "API key revoked", nil)
+}
+
+// adminClaims returns the admin of the request; keys are managed by people, not by other keys
+func (a *ApiKeyController) adminClaims(c *gin.Context) (*dto.User, bool) {
+	if _, isApiKey := getApiKey(c); isApiKey {
+		RespondWithError(c, http.StatusForbidden, "API keys cannot manage API keys")
+		return nil, false
+	}
+
+	admin, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return nil, false
+	}
+	return admin, true
+}
+
+func (a *ApiKeyController) publishApiKeyEvent(eventName string, admin *dto.User, key *dto.ApiKey) {
+	a.Events.PublishEvent(dto.Event{
+		EventName: eventName,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    admin.Id,
+		Metadata: map[string]interface{}{
+			"school_id":  key.SchoolId,
+			"api_key_id": key.Id,
+			"role":       key.Role,
+		},
+	})
+}
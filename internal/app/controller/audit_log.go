@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/dto/response"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/util"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditLogPageSize caps the page size of the audit log query
+const maxAuditLogPageSize = 100
+
+// IAuditLogController represents the interface for AuditLogController
+type IAuditLogController interface {
+	GetAuditLogs(c *gin.Context)
+	VerifyAuditLog(c *gin.Context)
+}
+
+// AuditLogController lets admins search the audit log of their school and verify its hash chain
+type AuditLogController struct {
+	Repo repository.IAuditLogRepository
+}
+
+// NewAuditLogController creates a new instance of AuditLogController
+func NewAuditLogController(repo repository.IAuditLogRepository) IAuditLogController {
+	return &AuditLogController{
+		Repo: repo,
+	}
+}
+
+// GetAuditLogs returns a page of the audit log of the admin's school, newest first unless
+// sort=ASC
+func (a *AuditLogController) GetAuditLogs(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := a.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	var query request.AuditLogQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	query.GetAllData = false
+	query.Validate()
+	if *query.Limit > maxAuditLogPageSize {
+		query.Limit = util.Int(maxAuditLogPageSize)
+		query.Offset = *query.Limit * (*query.Page - 1)
+	}
+
+	entries, total, err := a.Repo.GetAuditLogs(ctx, dto.AuditLogFilter{
+		SchoolId:     admin.SchoolId,
+		ActorId:      query.ActorId,
+		Action:       query.Action,
+		ResourceType: query.ResourceType,
+		ResourceId:   query.ResourceId,
+		From:         query.From,
+		To:           query.To,
+		Limit:        *query.Limit,
+		Offset:       query.Offset,
+		Ascending:    strings.EqualFold(query.Sort, "ASC"),
+	})
+	if err != nil {
+		log.Error("error while fetching audit log", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	query.Total = total
+	query.TotalPage = (total + *query.Limit - 1) / *query.Limit
+	c.JSON(http.StatusOK, response.ResponseV2{
+		Success: true,
+		Message: "Audit log",
+		Data:    entries,
+		Request: query.Pagination,
+	})
+}
+
+// VerifyAuditLog recomputes the hash chain of the whole audit log. The chain spans every school,
+// so a broken chain is reported even if the changed entry belongs to another school.
+func (a *AuditLogController) VerifyAuditLog(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := a.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	status, err := a.Repo.VerifyAuditChain(ctx)
+	if err != nil {
+		log.Error("error while verifying audit log", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	if !status.Valid {
+		log.Errorf("Audit log hash chain broken at entry %d, verified by admin %d", *status.FirstInvalidId, admin.Id)
+	}
+	RespondWithSuccess(c, http.StatusOK, "Audit log verified", status)
+}
+
+// adminClaims returns the admin of the request; the audit log is read by people, not by API keys
+func (a *AuditLogController) adminClaims(c *gin.Context) (*dto.User, bool) {
+	if _, isApiKey := getApiKey(c); isApiKey {
+		RespondWithError(c, http.StatusForbidden, "API keys cannot read the audit log")
+		return nil, false
+	}
+
+	admin, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return nil, false
+	}
+	return admin, true
+}
+
+// recordAudit appends an action of the controller layer, e.g. a report view, to the audit log.
+// details are stored as the after data of the entry.
+func recordAudit(ctx context.Context, auditLog repository.IAuditLogRepository, action, resourceType, resourceId string,
+	schoolId *int, details map[string]interface{}) error {
+	entry := &dto.AuditLog{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceId:   resourceId,
+		SchoolId:     schoolId,
+	}
+	if details != nil {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		after := dto.JSONText(raw)
+		entry.After = &after
+	}
+	return auditLog.AppendAuditLog(ctx, entry)
+}
@@ -1,15 +1,27 @@
 package controller
 
 import (
+	"context"
 	"eduanalytics/internal/app/api/middleware/jwt"
 	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
 	"eduanalytics/internal/app/db/dto"
 	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
 	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/dto/response"
 	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/loginguard"
+	"eduanalytics/internal/app/service/mailer"
+	"eduanalytics/internal/app/service/mfa"
 	"eduanalytics/internal/app/service/util"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,55 +29,322 @@ import (
 // IOAuthController represents the interface for OAuthController
 type IOAuthController interface {
 	Register(c *gin.Context)
+	VerifyEmail(c *gin.Context)
+	ResendVerification(c *gin.Context)
+	ForgotPassword(c *gin.Context)
+	ResetPassword(c *gin.Context)
+	ChangePassword(c *gin.Context)
 	Login(c *gin.Context)
+	LoginMfa(c *gin.Context)
+	LoginMfaEnroll(c *gin.Context)
 	RefreshToken(c *gin.Context)
 	Logout(c *gin.Context)
 }
 
 // OAuthController is the implementation of the IOAuthController interface
 type OAuthController struct {
-	DBClient repository.IUsersRepository
-	JWT      jwt.IJwtService
+	DBClient    repository.IUsersRepository
+	SchoolsRepo repository.ISchoolsRepository
+	TokensRepo  repository.IUserTokensRepository
+	JWT         jwt.IJwtService
+	Mailer      mailer.IMailer
+	LoginGuard  loginguard.ILoginGuard
+	Events      events.IEventsController
+	Mfa         mfa.IMfaService
 }
 
 // NewOAuthController creates a new instance of OAuthController
 func NewOAuthController(
 	dbClient repository.IUsersRepository,
+	schoolsRepo repository.ISchoolsRepository,
+	tokensRepo repository.IUserTokensRepository,
 	jwt jwt.IJwtService,
+	mailer mailer.IMailer,
+	loginGuard loginguard.ILoginGuard,
+	eventsController events.IEventsController,
+	mfaService mfa.IMfaService,
 ) IOAuthController {
 	return &OAuthController{
-		DBClient: dbClient,
-		JWT:      jwt,
+		DBClient:    dbClient,
+		SchoolsRepo: schoolsRepo,
+		TokensRepo:  tokensRepo,
+		JWT:         jwt,
+		Mailer:      mailer,
+		LoginGuard:  loginGuard,
+		Events:      eventsController,
+		Mfa:         mfaService,
 	}
 }
 
+// Register is the public self-registration endpoint, it only ever creates unverified students.
+// Teacher and admin accounts are created by admins through UserController.CreateUser.
 func (u *OAuthController) Register(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
 	log := logger.Logger(ctx)
 
-	var dataFromBody dto.User
-	err := json.NewDecoder(c.Request.Body).Decode(&dataFromBody)
-	if err != nil {
-		log.Errorf(constants.BadRequest, err)
-		RespondWithError(c, http.StatusBadRequest, constants.BadRequest)
+	var req request.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
 		return
 	}
 
-	dataFromBody.Password, err = util.GenerateHash(dataFromBody.Password)
+	if err := util.ValidatePasswordPolicy(req.Password); err != nil {
+		RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := u.SchoolsRepo.GetSchool(ctx, spec.ByID(req.SchoolId)); err != nil {
+		log.Errorf("School not found: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "School not found")
+		return
+	}
+
+	if _, err := u.DBClient.GetUserByEmail(ctx, req.Email); err == nil {
+		RespondWithError(c, http.StatusConflict, "Email already registered")
+		return
+	}
+
+	hash, err := util.GenerateHash(req.Password)
 	if err != nil {
 		log.Error("error while generating hash", err)
 		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
 		return
 	}
 
-	if err := u.DBClient.CreateUser(ctx, &dataFromBody); err != nil {
-		log.Error("error while updating user", err)
+	user := dto.User{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: hash,
+		Role:     constants.ROLE_STUDENT,
+		SchoolId: req.SchoolId,
+	}
+	if err := u.DBClient.CreateUser(ctx, &user); err != nil {
+		log.Error("error while creating user", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	user.Password = ""
+
+	// The account exists even if the mail fails, the user can ask for a new link
+	if err := sendVerificationEmail(ctx, u.TokensRepo, u.Mailer, &user); err != nil {
+		log.Errorf("Failed to send verification email: %v", err)
+	}
+
+	RespondWithSuccess(c, http.StatusAccepted, "User Created Successfully, please verify your email", user)
+}
+
+// VerifyEmail consumes the token from the verification link
+func (u *OAuthController) VerifyEmail(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	token := c.Query("token")
+	if token == "" {
+		RespondWithError(c, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	userToken, err := u.TokensRepo.GetActiveToken(ctx, util.HashToken(token), constants.TOKEN_PURPOSE_EMAIL_VERIFICATION)
+	if err != nil {
+		log.Warnf("Invalid verification token: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+
+	if err := u.TokensRepo.MarkTokenUsed(ctx, userToken.Id); err != nil {
+		if errors.Is(err, repository.ErrTokenAlreadyUsed) {
+			RespondWithError(c, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		log.Error("error while consuming verification token", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	if err := u.DBClient.MarkEmailVerified(ctx, userToken.UserId); err != nil {
+		log.Error("error while verifying email", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Email verified successfully", nil)
+}
+
+// ResendVerification mails a new verification link. The response does not reveal whether the account exists.
+func (u *OAuthController) ResendVerification(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	var req request.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if user, err := u.DBClient.GetUserByEmail(ctx, req.Email); err == nil && !user.EmailVerified {
+		if err := sendVerificationEmail(ctx, u.TokensRepo, u.Mailer, user); err != nil {
+			log.Errorf("Failed to send verification email: %v", err)
+		}
+	}
+
+	RespondWithSuccess(c, http.StatusAccepted, "If the account exists and is not verified, a verification email has been sent", nil)
+}
+
+// ForgotPassword mails a single-use reset token. The response does not reveal whether the account exists.
+func (u *OAuthController) ForgotPassword(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	var req request.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if user, err := u.DBClient.GetUserByEmail(ctx, req.Email); err == nil {
+		if err := sendPasswordResetEmail(ctx, u.TokensRepo, u.Mailer, user); err != nil {
+			log.Errorf("Failed to send password reset email: %v", err)
+		}
+	}
+
+	RespondWithSuccess(c, http.StatusAccepted, "If the account exists, a password reset email has been sent", nil)
+}
+
+// ResetPassword sets a new password using a reset token and signs the user out everywhere
+func (u *OAuthController) ResetPassword(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	var req request.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := util.ValidatePasswordPolicy(req.NewPassword); err != nil {
+		RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userToken, err := u.TokensRepo.GetActiveToken(ctx, util.HashToken(req.Token), constants.TOKEN_PURPOSE_PASSWORD_RESET)
+	if err != nil {
+		log.Warnf("Invalid password reset token: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+
+	user, err := u.DBClient.GetUser(ctx, spec.ByID(userToken.UserId))
+	if err != nil {
+		log.Error("error while fetching user", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+
+	if err := u.TokensRepo.MarkTokenUsed(ctx, userToken.Id); err != nil {
+		if errors.Is(err, repository.ErrTokenAlreadyUsed) {
+			RespondWithError(c, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		log.Error("error while consuming password reset token", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	if err := u.setPassword(c, user, req.NewPassword); err != nil {
+		return
+	}
+
+	// Receiving the token proves ownership of the address
+	if !user.EmailVerified {
+		if err := u.DBClient.MarkEmailVerified(ctx, user.Id); err != nil {
+			log.Errorf("Failed to mark email verified: %v", err)
+		}
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Password reset successfully, please log in again", nil)
+}
+
+// ChangePassword replaces the password of the authenticated user and signs them out everywhere
+func (u *OAuthController) ChangePassword(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	claims, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	var req request.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	user, err := u.DBClient.GetUserByEmail(ctx, claims.Email)
+	if err != nil {
+		log.Error("error while fetching user", err)
 		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
 		return
 	}
-	dataFromBody.Password = ""
 
-	RespondWithSuccess(c, http.StatusAccepted, "User Created Successfully", dataFromBody)
+	if !util.ValidatePassword(req.CurrentPassword, user.Password) {
+		RespondWithError(c, http.StatusUnauthorized, "Current password is incorrect")
+		return
+	}
+
+	if req.CurrentPassword == req.NewPassword {
+		RespondWithError(c, http.StatusBadRequest, "New password must be different from the current password")
+		return
+	}
+
+	if err := util.ValidatePasswordPolicy(req.NewPassword); err != nil {
+		RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := u.setPassword(c, user, req.NewPassword); err != nil {
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Password changed successfully, please log in again", nil)
+}
+
+// setPassword stores the new password hash, discards outstanding reset tokens and invalidates
+// every session of the user. It writes the error response itself.
+func (u *OAuthController) setPassword(c *gin.Context, user *dto.User, password string) error {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	hash, err := util.GenerateHash(password)
+	if err != nil {
+		log.Error("error while generating hash", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return err
+	}
+
+	if err := u.DBClient.UpdatePassword(ctx, user.Id, hash); err != nil {
+		log.Error("error while updating password", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return err
+	}
+
+	if err := u.TokensRepo.InvalidateUserTokens(ctx, user.Id, constants.TOKEN_PURPOSE_PASSWORD_RESET); err != nil {
+		log.Errorf("Failed to invalidate password reset tokens: %v", err)
+	}
+
+	if err := u.JWT.InvalidateAllUserSessions(ctx, user.Email); err != nil {
+		log.Error("error while invalidating sessions", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return err
+	}
+
+	return nil
 }
 
 func (u *OAuthController) Login(c *gin.Context) {
@@ -80,46 +359,311 @@ func (u *OAuthController) Login(c *gin.Context) {
 		return
 	}
 
+	// Get user agent and IP address
+	userAgent := c.Request.UserAgent()
+	ipAddress := c.ClientIP()
+
+	if retryAfter, allowed := u.LoginGuard.Check(ctx, dataFromBody.Email, ipAddress); !allowed {
+		log.Warnf("Login attempt for %s from %s rejected, retry after %s", dataFromBody.Email, ipAddress, retryAfter)
+		c.Header(constants.RETRY_AFTER, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		RespondWithError(c, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+		return
+	}
+
 	user, err := u.DBClient.GetUserByEmail(ctx, dataFromBody.Email)
 	if err != nil {
 		log.Error("error while fetching user", err)
+		if result := u.LoginGuard.RecordFailure(ctx, dataFromBody.Email, ipAddress); result.IPLocked {
+			u.publishIPLocked(nil, userAgent, ipAddress)
+		}
 		RespondWithError(c, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
 	if !util.ValidatePassword(dataFromBody.Password, user.Password) {
 		log.Error("invalid password")
+		result := u.LoginGuard.RecordFailure(ctx, user.Email, ipAddress)
+		if result.AccountLocked {
+			u.publishLoginEvent(constants.EVENT_ACCOUNT_LOCKED, user, result.Failures, userAgent, ipAddress)
+		}
+		if result.IPLocked {
+			u.publishIPLocked(user, userAgent, ipAddress)
+		}
 		RespondWithError(c, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
-	// Get user agent and IP address
+	// A correct password after a run of failures may be a guessed one
+	if failures := u.LoginGuard.RecordSuccess(ctx, user.Email, ipAddress); failures >= constants.Config.AuthConfig.AUTH_LOGIN_DELAY_AFTER {
+		log.Warnf("Successful login for %s after %d failed attempts", user.Email, failures)
+		u.publishLoginEvent(constants.EVENT_SUSPICIOUS_LOGIN, user, failures, userAgent, ipAddress)
+	}
+
+	if user.DeactivatedAt != nil {
+		log.Warnf("Login attempt of deactivated user %d", user.Id)
+		RespondWithError(c, http.StatusForbidden, "Account is deactivated")
+		return
+	}
+
+	if !user.EmailVerified {
+		log.Warnf("Login attempt with unverified email: %s", user.Email)
+		RespondWithError(c, http.StatusForbidden, "Email address not verified")
+		return
+	}
+
+	// Tokens are only issued by LoginMfa when the user has or needs a second factor
+	challenge, err := issueMfaChallenge(ctx, u.Mfa, u.TokensRepo, user)
+	if err != nil {
+		log.Error("error while checking mfa", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	if challenge != nil {
+		RespondWithSuccess(c, http.StatusOK, "MFA required", challenge)
+		return
+	}
+
+	token, err := u.JWT.CreateNewTokens(ctx, user, userAgent, ipAddress)
+	if err != nil {
+		log.Error("error while creating new tokens", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Login Successfully", token)
+}
+
+// LoginMfa is the second login step, it checks the TOTP or recovery code of the challenge and
+// issues the tokens. A user who has to enroll confirms the enrollment with the first code.
+func (u *OAuthController) LoginMfa(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	var req request.MfaLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	user, challenge, ok := u.getMfaChallenge(c, req.MfaToken)
+	if !ok {
+		return
+	}
+
 	userAgent := c.Request.UserAgent()
 	ipAddress := c.ClientIP()
 
-	token, err := u.JWT.CreateNewTokens(ctx, user.Email, userAgent, ipAddress)
+	if retryAfter, allowed := u.LoginGuard.Check(ctx, user.Email, ipAddress); !allowed {
+		log.Warnf("MFA attempt for %s from %s rejected, retry after %s", user.Email, ipAddress, retryAfter)
+		c.Header(constants.RETRY_AFTER, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		RespondWithError(c, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+		return
+	}
+
+	status, err := u.Mfa.GetStatus(ctx, user)
+	if err != nil {
+		log.Error("error while fetching mfa status", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	var recoveryCodes []string
+	if status.Enabled {
+		usedRecoveryCode, err := u.Mfa.Verify(ctx, user, req.Code)
+		if err != nil {
+			u.rejectMfaCode(c, user, err, userAgent, ipAddress)
+			return
+		}
+		if usedRecoveryCode {
+			log.Warnf("User %d logged in with a recovery code", user.Id)
+			publishMfaEvent(u.Events, constants.EVENT_MFA_RECOVERY_USED, user, map[string]interface{}{
+				"user_agent": userAgent,
+				"ip_address": ipAddress,
+			})
+		}
+	} else if status.Required {
+		recoveryCodes, err = u.Mfa.ConfirmEnrollment(ctx, user, req.Code)
+		if err != nil {
+			u.rejectMfaCode(c, user, err, userAgent, ipAddress)
+			return
+		}
+		publishMfaEvent(u.Events, constants.EVENT_MFA_ENABLED, user, nil)
+	}
+
+	if err := u.TokensRepo.MarkTokenUsed(ctx, challenge.Id); err != nil {
+		if errors.Is(err, repository.ErrTokenAlreadyUsed) {
+			RespondWithError(c, http.StatusUnauthorized, "Invalid or expired MFA token")
+			return
+		}
+		log.Error("error while consuming mfa token", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	u.LoginGuard.RecordSuccess(ctx, user.Email, ipAddress)
+
+	token, err := u.JWT.CreateNewTokens(ctx, user, userAgent, ipAddress)
+	if errors.Is(err, jwt.ErrUserDeactivated) {
+		RespondWithError(c, http.StatusForbidden, "Account is deactivated")
+		return
+	}
 	if err != nil {
 		log.Error("error while creating new tokens", err)
 		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
 		return
 	}
 
-	RespondWithSuccess(c, http.StatusOK, "Login Successfully", token)
+	RespondWithSuccess(c, http.StatusOK, "Login Successfully", response.MfaLoginResponse{
+		TokenDetails:  token,
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// LoginMfaEnroll starts the enrollment of a user whose role requires MFA during the login, the
+// enrollment is confirmed by LoginMfa
+func (u *OAuthController) LoginMfaEnroll(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	var req request.MfaEnrollLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	user, _, ok := u.getMfaChallenge(c, req.MfaToken)
+	if !ok {
+		return
+	}
+
+	enrollment, err := u.Mfa.BeginEnrollment(ctx, user)
+	if errors.Is(err, mfa.ErrAlreadyEnabled) {
+		RespondWithError(c, http.StatusConflict, "MFA is already enabled")
+		return
+	}
+	if err != nil {
+		log.Error("error while starting mfa enrollment", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Scan the provisioning URI and confirm with a code", enrollment)
+}
+
+// issueMfaChallenge returns a challenge when the user has a second factor or the role requires
+// one, and nil when the first factor is enough. Password and SSO logins share it.
+func issueMfaChallenge(ctx context.Context, mfaService mfa.IMfaService, tokensRepo repository.IUserTokensRepository, user *dto.User) (*response.MfaChallengeResponse, error) {
+	status, err := mfaService.GetStatus(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Enabled && !status.Required {
+		return nil, nil
+	}
+
+	ttl := time.Minute * time.Duration(constants.Config.AuthConfig.AUTH_MFA_CHALLENGE_EXP)
+	token, err := issueUserToken(ctx, tokensRepo, user.Id, constants.TOKEN_PURPOSE_MFA_CHALLENGE, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response.MfaChallengeResponse{
+		MfaRequired:        true,
+		MfaToken:           token,
+		EnrollmentRequired: !status.Enabled,
+		ExpiresAt:          time.Now().Add(ttl),
+	}, nil
+}
+
+// getMfaChallenge resolves an MFA token issued by Login to its user
+func (u *OAuthController) getMfaChallenge(c *gin.Context, mfaToken string) (*dto.User, *dto.UserToken, bool) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	challenge, err := u.TokensRepo.GetActiveToken(ctx, util.HashToken(mfaToken), constants.TOKEN_PURPOSE_MFA_CHALLENGE)
+	if err != nil {
+		log.Warnf("Invalid mfa token: %v", err)
+		RespondWithError(c, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return nil, nil, false
+	}
+
+	user, err := u.DBClient.GetUser(ctx, spec.ByID(challenge.UserId))
+	if err != nil {
+		log.Error("error while fetching user", err)
+		RespondWithError(c, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return nil, nil, false
+	}
+
+	return user, challenge, true
+}
+
+// rejectMfaCode answers a failed second factor, wrong codes count as failed logins
+func (u *OAuthController) rejectMfaCode(c *gin.Context, user *dto.User, err error, userAgent, ipAddress string) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	if !errors.Is(err, mfa.ErrInvalidCode) && !errors.Is(err, repository.ErrMfaEnrollmentNotPending) {
+		log.Error("error while verifying mfa code", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	log.Warnf("Invalid mfa code for user %d", user.Id)
+	result := u.LoginGuard.RecordFailure(ctx, user.Email, ipAddress)
+	if result.AccountLocked {
+		u.publishLoginEvent(constants.EVENT_ACCOUNT_LOCKED, user, result.Failures, userAgent, ipAddress)
+	}
+	if result.IPLocked {
+		u.publishIPLocked(user, userAgent, ipAddress)
+	}
+	RespondWithError(c, http.StatusUnauthorized, "Invalid MFA code")
+}
+
+// publishLoginEvent records a login security event for the user
+func (u *OAuthController) publishLoginEvent(eventName string, user *dto.User, failures int, userAgent, ipAddress string) {
+	u.Events.PublishEvent(dto.Event{
+		EventName: eventName,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    user.Id,
+		Metadata: map[string]interface{}{
+			"school_id":       user.SchoolId,
+			"failed_attempts": failures,
+			"user_agent":      userAgent,
+			"ip_address":      ipAddress,
+		},
+	})
+}
+
+// publishIPLocked records the lockout of a client IP. The user is the account of the attempt
+// that locked it, nil for an unknown email.
+func (u *OAuthController) publishIPLocked(user *dto.User, userAgent, ipAddress string) {
+	metadata := map[string]interface{}{
+		"user_agent": userAgent,
+		"ip_address": ipAddress,
+	}
+	event := dto.Event{EventName: constants.EVENT_IP_LOCKED, App: constants.EVENT_APP_AUTH, Metadata: metadata}
+	if user != nil {
+		event.UserId = user.Id
+		metadata["school_id"] = user.SchoolId
+	}
+	u.Events.PublishEvent(event)
 }
 
 func (u *OAuthController) RefreshToken(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
 	log := logger.Logger(ctx)
 
-	refreshToken := c.GetHeader(constants.AUTHORIZATION)
+	// Prefer the body, fall back to the Authorization header
+	var requestBody struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	var refreshToken string
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err == nil {
+		refreshToken = requestBody.RefreshToken
+	}
 	if refreshToken == "" {
-		// Try to get from body
-		var requestBody struct {
-			RefreshToken string `json:"refresh_token"`
-		}
-		if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err == nil {
-			refreshToken = requestBody.RefreshToken
-		}
+		refreshToken = c.GetHeader(constants.AUTHORIZATION)
 	}
 
 	if refreshToken == "" {
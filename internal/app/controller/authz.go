@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/authz"
+	"eduanalytics/internal/app/service/correlation"
+	"eduanalytics/internal/app/service/logger"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Resource types of access checks
+const (
+	resourceSchool    = "school"
+	resourceClassroom = "classroom"
+	resourceStudent   = "student"
+	resourceTeacher   = "teacher"
+	resourceQuiz      = "quiz"
+)
+
+// authzSubject describes the caller of the request for resource-level checks
+func authzSubject(c *gin.Context) (authz.Subject, bool) {
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return authz.Subject{}, false
+	}
+
+	subject := authz.Subject{UserId: user.Id, Role: user.Role, SchoolId: user.SchoolId}
+	if key, isApiKey := getApiKey(c); isApiKey {
+		subject.ApiKeyId = key.Id
+	}
+	return subject, true
+}
+
+// authorize answers the request unless the access check passed. Denials are logged, recorded as
+// access_denied events and written to the audit log with the actor, API key and IP address.
+func authorize(c *gin.Context, eventsController events.IEventsController, auditLog repository.IAuditLogRepository, subject authz.Subject,
+	check error, resource string, resourceId int, action authz.Action) bool {
+	if check == nil {
+		return true
+	}
+
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	if !errors.Is(check, authz.ErrForbidden) {
+		log.Errorf("Access check on %s %d failed: %v", resource, resourceId, check)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return false
+	}
+
+	log.Warnf("Access denied: user %d, role %s, school %d, %s %s %d, path: %s",
+		subject.UserId, subject.Role, subject.SchoolId, action, resource, resourceId, c.Request.URL.Path)
+
+	metadata := map[string]interface{}{
+		"resource":    resource,
+		"resource_id": resourceId,
+		"action":      action,
+		"role":        subject.Role,
+		"school_id":   subject.SchoolId,
+		"method":      c.Request.Method,
+		"path":        c.FullPath(),
+		"ip_address":  c.ClientIP(),
+	}
+
+	// An API key is recorded under the admin who created it, or under no user
+	userId := subject.UserId
+	if key, isApiKey := getApiKey(c); isApiKey {
+		metadata["api_key_id"] = key.Id
+		userId = 0
+		if key.CreatedBy != nil {
+			userId = *key.CreatedBy
+		}
+	}
+
+	event := dto.Event{
+		EventName: constants.EVENT_ACCESS_DENIED,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    userId,
+		Metadata:  metadata,
+	}
+	if resource == resourceClassroom {
+		event.ClassroomId = resourceId
+	}
+	eventsController.PublishEvent(event)
+
+	// The actor, its API key and IP address are taken from the request context. The request is
+	// denied whether or not the denial could be recorded.
+	var schoolId *int
+	if subject.SchoolId != 0 {
+		schoolId = &subject.SchoolId
+	}
+	err := recordAudit(ctx, auditLog, constants.AUDIT_ACCESS_DENIED, resource, strconv.Itoa(resourceId), schoolId,
+		map[string]interface{}{"action": action, "method": c.Request.Method, "path": c.FullPath()})
+	if err != nil {
+		log.Error("error while recording access denial", err)
+	}
+
+	RespondWithError(c, http.StatusForbidden, "You don't have permission to access this resource")
+	return false
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/service/util"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getUserClaims returns the user set on the context by the authentication middleware
+func getUserClaims(c *gin.Context) (*dto.User, bool) {
+	claims, exists := c.Get(constants.CTK_CLAIM_KEY.String())
+	if !exists {
+		return nil, false
+	}
+
+	user, ok := claims.(*dto.User)
+	if !ok || user == nil {
+		return nil, false
+	}
+	return user, true
+}
+
+// getSuperAdminClaims returns the super admin of the request and answers it for anyone else.
+// Changes that reach every school check the role here as well, because school admins could
+// otherwise be granted the route by a policy.
+func getSuperAdminClaims(c *gin.Context) (*dto.User, bool) {
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return nil, false
+	}
+	if _, isApiKey := getApiKey(c); isApiKey || user.Role != constants.ROLE_SUPER_ADMIN {
+		RespondWithError(c, http.StatusForbidden, "Only super admins can do this")
+		return nil, false
+	}
+	return user, true
+}
+
+// getApiKey returns the API key the request was authenticated with, if any
+func getApiKey(c *gin.Context) (*dto.ApiKey, bool) {
+	value, exists := c.Get(constants.CTK_API_KEY.String())
+	if !exists {
+		return nil, false
+	}
+
+	key, ok := value.(*dto.ApiKey)
+	return key, ok && key != nil
+}
+
+// getSessionIDFromHeader extracts the session ID from the bearer token without validating it.
+// It must only be used on routes where the token was already verified by the middleware.
+func getSessionIDFromHeader(c *gin.Context) string {
+	accessToken := c.GetHeader(constants.AUTHORIZATION)
+
+	// Remove "Bearer " prefix if present
+	if len(accessToken) > len(constants.BEARER) && accessToken[:len(constants.BEARER)] == constants.BEARER {
+		accessToken = accessToken[len(constants.BEARER):]
+	}
+
+	claims, err := util.ParseTokenClaims(accessToken)
+	if err != nil || claims == nil {
+		return ""
+	}
+
+	sessionID, _ := claims["session_id"].(string)
+	return sessionID
+}
@@ -1,27 +1,43 @@
 package controller
 
 import (
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
 	"eduanalytics/internal/app/db/dto"
 	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
+	"eduanalytics/internal/app/service/authz"
 	"eduanalytics/internal/app/service/correlation"
 	request "eduanalytics/internal/app/service/dto/request"
 	response "eduanalytics/internal/app/service/dto/response"
 	"eduanalytics/internal/app/service/logger"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
+// maxClassroomPageSize caps the page size of the classroom list
+const maxClassroomPageSize = 100
+
 type IClassroomController interface {
 	CreateClassroom(c *gin.Context)
 	GetClassroom(c *gin.Context)
 	GetClassrooms(c *gin.Context)
 	UpdateClassroom(c *gin.Context)
 	DeleteClassroom(c *gin.Context)
+	PurgeClassroom(c *gin.Context)
 	EnrollStudents(c *gin.Context)
 	UnenrollStudent(c *gin.Context)
+	TransferStudents(c *gin.Context)
 	GetStudentsByClassroom(c *gin.Context)
+	GetEnrollments(c *gin.Context)
+	GetClassroomMembers(c *gin.Context)
+	AddClassroomMember(c *gin.Context)
+	RemoveClassroomMember(c *gin.Context)
 	GetClassroomsByTeacher(c *gin.Context)
 	GetClassroomsByStudent(c *gin.Context)
 }
@@ -29,12 +45,24 @@ type IClassroomController interface {
 type ClassroomController struct {
 	ClassroomRepo repository.IClassroomsRepository
 	UserRepo      repository.IUsersRepository
+	Authz         authz.IAuthorizer
+	AuditLog      repository.IAuditLogRepository
+	Events        events.IEventsController
 }
 
-func NewClassroomController(classroomRepo repository.IClassroomsRepository, userRepo repository.IUsersRepository) IClassroomController {
+func NewClassroomController(
+	classroomRepo repository.IClassroomsRepository,
+	userRepo repository.IUsersRepository,
+	authorizer authz.IAuthorizer,
+	auditLog repository.IAuditLogRepository,
+	eventsController events.IEventsController,
+) IClassroomController {
 	return &ClassroomController{
 		ClassroomRepo: classroomRepo,
 		UserRepo:      userRepo,
+		Authz:         authorizer,
+		AuditLog:      auditLog,
+		Events:        eventsController,
 	}
 }
 
@@ -43,6 +71,11 @@ func (ctrl *ClassroomController) CreateClassroom(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
 	log := logger.Logger(ctx)
 
+	subject, ok := authzSubject(c)
+	if !ok {
+		return
+	}
+
 	var req request.CreateClassroomRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Errorf("Invalid request: %v", err)
@@ -54,7 +87,7 @@ func (ctrl *ClassroomController) CreateClassroom(c *gin.Context) {
 	}
 
 	// Verify teacher exists and has teacher role
-	teacher, err := ctrl.UserRepo.GetUser(ctx, "id = "+strconv.Itoa(req.TeacherId))
+	teacher, err := ctrl.UserRepo.GetUser(ctx, spec.ByID(req.TeacherId))
 	if err != nil {
 		log.Errorf("Teacher not found: %v", err)
 		c.JSON(http.StatusNotFound, response.ResponseV2{
@@ -73,13 +106,34 @@ func (ctrl *ClassroomController) CreateClassroom(c *gin.Context) {
 		return
 	}
 
+	if teacher.SchoolId != req.SchoolId {
+		log.Errorf("Teacher %d does not belong to school %d", teacher.Id, req.SchoolId)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Teacher belongs to another school",
+		})
+		return
+	}
+
 	classroom := &dto.Classroom{
 		Name:      req.Name,
 		SchoolId:  req.SchoolId,
 		TeacherId: req.TeacherId,
 	}
 
-	if err := ctrl.ClassroomRepo.CreateClassroom(ctx, classroom); err != nil {
+	// Teachers can only create classrooms of their own, admins only in their school
+	if !authorize(c, ctrl.Events, ctrl.AuditLog, subject, ctrl.Authz.Classroom(ctx, subject, classroom, authz.ActionWrite),
+		resourceClassroom, 0, authz.ActionWrite) {
+		return
+	}
+
+	if err := ctrl.ClassroomRepo.CreateClassroom(ctx, classroom); errors.Is(err, repository.ErrTenantMismatch) {
+		c.JSON(http.StatusForbidden, response.ResponseV2{
+			Success: false,
+			Message: "Classroom belongs to another school",
+		})
+		return
+	} else if err != nil {
 		log.Errorf("Failed to create classroom: %v", err)
 		c.JSON(http.StatusInternalServerError, response.ResponseV2{
 			Success: false,
@@ -111,13 +165,8 @@ func (ctrl *ClassroomController) GetClassroom(c *gin.Context) {
 		return
 	}
 
-	classroom, err := ctrl.ClassroomRepo.GetClassroomByID(ctx, id)
-	if err != nil {
-		log.Errorf("Classroom not found: %v", err)
-		c.JSON(http.StatusNotFound, response.ResponseV2{
-			Success: false,
-			Message: "Classroom not found",
-		})
+	classroom, ok := ctrl.getAuthorizedClassroom(c, id, authz.ActionRead)
+	if !ok {
 		return
 	}
 
@@ -127,67 +176,104 @@ func (ctrl *ClassroomController) GetClassroom(c *gin.Context) {
 	})
 }
 
-// GetClassrooms retrieves all classrooms (can filter by teacher or school)
+// GetClassrooms returns a page of the classrooms matching the filters. Students only see the
+// classrooms they are enrolled in and teachers default to their own classrooms; admins see their
+// school. Archived classrooms are only listed with the archived status.
 func (ctrl *ClassroomController) GetClassrooms(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
 	log := logger.Logger(ctx)
 
-	teacherId := c.Query("teacher_id")
-	schoolId := c.Query("school_id")
+	subject, ok := authzSubject(c)
+	if !ok {
+		return
+	}
 
-	var classrooms []dto.Classroom
-	var err error
+	var query request.ClassroomQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if !validatePage(c, &query.Pagination, maxClassroomPageSize) {
+		return
+	}
 
-	if teacherId != "" {
-		tid, parseErr := strconv.Atoi(teacherId)
-		if parseErr != nil {
-			log.Errorf("Invalid teacher ID: %v", parseErr)
-			c.JSON(http.StatusBadRequest, response.ResponseV2{
-				Success: false,
-				Message: "Invalid teacher ID",
-			})
+	filter := spec.New().
+		OrderBy(query.Order, !strings.EqualFold(query.Sort, "ASC")).
+		OrderBy("id", false).
+		Paginate(*query.Limit, query.Offset)
+
+	// Only admin API keys list the school, keys of other roles own no classrooms to list
+	isUser := subject.ApiKeyId == 0
+	if !isUser && subject.Role != constants.ROLE_ADMIN {
+		if !authorize(c, ctrl.Events, ctrl.AuditLog, subject, ctrl.Authz.School(ctx, subject, subject.SchoolId), resourceSchool, subject.SchoolId, authz.ActionRead) {
 			return
 		}
-		classrooms, err = ctrl.ClassroomRepo.GetClassroomsByTeacher(ctx, tid)
+	}
+	switch {
+	case isUser && subject.Role == constants.ROLE_STUDENT:
+		enrolled, err := ctrl.ClassroomRepo.GetClassroomsByStudent(ctx, subject.UserId)
 		if err != nil {
 			log.Errorf("Failed to retrieve classrooms: %v", err)
-			c.JSON(http.StatusInternalServerError, response.ResponseV2{
-				Success: false,
-				Message: "Failed to retrieve classrooms",
-			})
+			RespondWithError(c, http.StatusInternalServerError, "Failed to retrieve classrooms")
 			return
 		}
-	} else if schoolId != "" {
-		sid, parseErr := strconv.Atoi(schoolId)
-		if parseErr != nil {
-			log.Errorf("Invalid school ID: %v", parseErr)
-			c.JSON(http.StatusBadRequest, response.ResponseV2{
-				Success: false,
-				Message: "Invalid school ID",
-			})
+		ids := make([]int, 0, len(enrolled))
+		for _, classroom := range enrolled {
+			ids = append(ids, classroom.Id)
+		}
+		filter.And("id", spec.In, ids)
+	case isUser && subject.Role == constants.ROLE_TEACHER && query.TeacherId == 0:
+		query.TeacherId = subject.UserId
+	}
+	if query.TeacherId != 0 && query.TeacherId != subject.UserId && !(isUser && subject.Role == constants.ROLE_STUDENT) {
+		if !ctrl.authorizeTeacher(c, subject, query.TeacherId) {
 			return
 		}
-		classrooms, err = ctrl.ClassroomRepo.GetClassroomsBySchool(ctx, sid)
-		if err != nil {
-			log.Errorf("Failed to retrieve classrooms: %v", err)
-			c.JSON(http.StatusInternalServerError, response.ResponseV2{
-				Success: false,
-				Message: "Failed to retrieve classrooms",
-			})
+	}
+	if query.SchoolId != 0 && query.SchoolId != subject.SchoolId {
+		if !authorize(c, ctrl.Events, ctrl.AuditLog, subject, ctrl.Authz.School(ctx, subject, query.SchoolId), resourceSchool, query.SchoolId, authz.ActionRead) {
 			return
 		}
+	}
+
+	if query.TeacherId != 0 {
+		filter.And("teacher_id", spec.Eq, query.TeacherId)
+	}
+	if query.SchoolId != 0 {
+		filter.And("school_id", spec.Eq, query.SchoolId)
+	}
+	if query.Query != "" {
+		filter.And("name", spec.ILike, "%"+query.Query+"%")
+	}
+	if query.CreatedFrom != nil {
+		filter.And("created_at", spec.Gte, *query.CreatedFrom)
+	}
+	if query.CreatedTo != nil {
+		filter.And("created_at", spec.Lt, *query.CreatedTo)
+	}
+	if query.Status == "archived" {
+		filter.And("archived_at", spec.NotNull, nil)
 	} else {
-		// Get all classrooms - this might need authorization checks
-		c.JSON(http.StatusBadRequest, response.ResponseV2{
-			Success: false,
-			Message: "Please provide teacher_id or school_id parameter",
-		})
+		filter.And("archived_at", spec.IsNull, nil)
+	}
+
+	classrooms, total, err := ctrl.ClassroomRepo.GetClassrooms(ctx, filter)
+	if errors.Is(err, spec.ErrUnknownField) {
+		RespondWithError(c, http.StatusBadRequest, "Invalid order: "+query.Order)
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to retrieve classrooms: %v", err)
+		RespondWithError(c, http.StatusInternalServerError, "Failed to retrieve classrooms")
 		return
 	}
 
+	setTotal(&query.Pagination, total)
 	c.JSON(http.StatusOK, response.ResponseV2{
 		Success: true,
 		Data:    response.ToClassroomResponseList(classrooms),
+		Request: query,
 	})
 }
 
@@ -196,6 +282,11 @@ func (ctrl *ClassroomController) UpdateClassroom(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
 	log := logger.Logger(ctx)
 
+	subject, ok := authzSubject(c)
+	if !ok {
+		return
+	}
+
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
@@ -217,20 +308,19 @@ func (ctrl *ClassroomController) UpdateClassroom(c *gin.Context) {
 		return
 	}
 
-	// Check if classroom exists
-	_, err = ctrl.ClassroomRepo.GetClassroomByID(ctx, id)
-	if err != nil {
-		log.Errorf("Classroom not found: %v", err)
-		c.JSON(http.StatusNotFound, response.ResponseV2{
-			Success: false,
-			Message: "Classroom not found",
-		})
+	// Only the classroom's teacher and admins may hand the classroom over, not its co-teachers
+	action := authz.ActionWrite
+	if req.TeacherId > 0 {
+		action = authz.ActionManage
+	}
+	existing, ok := ctrl.getAuthorizedClassroom(c, id, action)
+	if !ok {
 		return
 	}
 
 	// If teacher ID is being updated, verify the new teacher
 	if req.TeacherId > 0 {
-		teacher, err := ctrl.UserRepo.GetUser(ctx, "id = "+strconv.Itoa(req.TeacherId))
+		teacher, err := ctrl.UserRepo.GetUser(ctx, spec.ByID(req.TeacherId))
 		if err != nil {
 			log.Errorf("Teacher not found: %v", err)
 			c.JSON(http.StatusNotFound, response.ResponseV2{
@@ -248,6 +338,22 @@ func (ctrl *ClassroomController) UpdateClassroom(c *gin.Context) {
 			})
 			return
 		}
+
+		if teacher.SchoolId != existing.SchoolId {
+			log.Errorf("Teacher %d does not belong to school %d", teacher.Id, existing.SchoolId)
+			c.JSON(http.StatusBadRequest, response.ResponseV2{
+				Success: false,
+				Message: "Teacher belongs to another school",
+			})
+			return
+		}
+
+		// A teacher cannot hand the classroom over to someone else
+		reassigned := &dto.Classroom{Id: id, SchoolId: existing.SchoolId, TeacherId: req.TeacherId}
+		if !authorize(c, ctrl.Events, ctrl.AuditLog, subject, ctrl.Authz.Classroom(ctx, subject, reassigned, authz.ActionWrite),
+			resourceClassroom, id, authz.ActionWrite) {
+			return
+		}
 	}
 
 	classroom := &dto.Classroom{
@@ -274,7 +380,9 @@ func (ctrl *ClassroomController) UpdateClassroom(c *gin.Context) {
 	})
 }
 
-// DeleteClassroom deletes a classroom
+// DeleteClassroom archives a classroom: it becomes read-only and is hidden from lists, but its
+// quizzes and responses stay reportable until it is purged. Deleting an archived classroom again
+// succeeds without changing it.
 func (ctrl *ClassroomController) DeleteClassroom(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
 	log := logger.Logger(ctx)
@@ -290,29 +398,88 @@ func (ctrl *ClassroomController) DeleteClassroom(c *gin.Context) {
 		return
 	}
 
-	// Check if classroom exists
-	_, err = ctrl.ClassroomRepo.GetClassroomByID(ctx, id)
+	// Archived classrooms are read-only, getAuthorizedClassroom would refuse to archive them again
+	if _, ok := ctrl.loadAuthorizedClassroom(c, id, authz.ActionManage); !ok {
+		return
+	}
+
+	if err := ctrl.ClassroomRepo.ArchiveClassroom(ctx, id); err != nil {
+		log.Errorf("Failed to archive classroom: %v", err)
+		c.JSON(http.StatusInternalServerError, response.ResponseV2{
+			Success: false,
+			Message: "Failed to archive classroom",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response.ResponseV2{
+		Success: true,
+		Message: "Classroom archived successfully",
+	})
+}
+
+// PurgeClassroom permanently deletes an archived classroom with its quizzes, questions, responses,
+// events, enrollments and members. With dry_run it only reports what would be deleted.
+func (ctrl *ClassroomController) PurgeClassroom(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
 	if err != nil {
-		log.Errorf("Classroom not found: %v", err)
-		c.JSON(http.StatusNotFound, response.ResponseV2{
+		log.Errorf("Invalid classroom ID: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
 			Success: false,
-			Message: "Classroom not found",
+			Message: "Invalid classroom ID",
+		})
+		return
+	}
+
+	var query request.PurgeClassroomQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
 		})
 		return
 	}
 
-	if err := ctrl.ClassroomRepo.DeleteClassroom(ctx, id); err != nil {
-		log.Errorf("Failed to delete classroom: %v", err)
+	subject, ok := authzSubject(c)
+	if !ok {
+		return
+	}
+	// Archived classrooms are read-only, getAuthorizedClassroom would refuse to manage them
+	if _, ok := ctrl.loadAuthorizedClassroom(c, id, authz.ActionManage); !ok {
+		return
+	}
+
+	purge, err := ctrl.ClassroomRepo.PurgeClassroom(ctx, id, query.DryRun)
+	if errors.Is(err, repository.ErrClassroomNotArchived) {
+		c.JSON(http.StatusConflict, response.ResponseV2{
+			Success: false,
+			Message: "Only archived classrooms can be purged, archive it first",
+		})
+		return
+	} else if err != nil {
+		log.Errorf("Failed to purge classroom %d: %v", id, err)
 		c.JSON(http.StatusInternalServerError, response.ResponseV2{
 			Success: false,
-			Message: "Failed to delete classroom",
+			Message: "Failed to purge classroom, nothing was deleted",
 		})
 		return
 	}
 
+	message := "Classroom purged successfully"
+	if query.DryRun {
+		message = "Dry run, nothing was deleted"
+	} else {
+		log.Infof("Classroom %d purged by user %d: %+v", id, subject.UserId, *purge)
+	}
 	c.JSON(http.StatusOK, response.ResponseV2{
 		Success: true,
-		Message: "Classroom deleted successfully",
+		Message: message,
+		Data:    purge,
 	})
 }
 
@@ -342,20 +509,14 @@ func (ctrl *ClassroomController) EnrollStudents(c *gin.Context) {
 		return
 	}
 
-	// Check if classroom exists
-	_, err = ctrl.ClassroomRepo.GetClassroomByID(ctx, classroomId)
-	if err != nil {
-		log.Errorf("Classroom not found: %v", err)
-		c.JSON(http.StatusNotFound, response.ResponseV2{
-			Success: false,
-			Message: "Classroom not found",
-		})
+	classroom, ok := ctrl.getAuthorizedClassroom(c, classroomId, authz.ActionWrite)
+	if !ok {
 		return
 	}
 
 	// Verify all students exist and have student role
 	for _, studentId := range req.StudentIds {
-		student, err := ctrl.UserRepo.GetUser(ctx, "id = "+strconv.Itoa(studentId))
+		student, err := ctrl.UserRepo.GetUser(ctx, spec.ByID(studentId))
 		if err != nil {
 			log.Errorf("Student not found: %v", studentId)
 			c.JSON(http.StatusNotFound, response.ResponseV2{
@@ -373,9 +534,24 @@ func (ctrl *ClassroomController) EnrollStudents(c *gin.Context) {
 			})
 			return
 		}
+
+		if student.SchoolId != classroom.SchoolId {
+			log.Errorf("Student %d does not belong to school %d", studentId, classroom.SchoolId)
+			c.JSON(http.StatusBadRequest, response.ResponseV2{
+				Success: false,
+				Message: "Student with ID " + strconv.Itoa(studentId) + " belongs to another school",
+			})
+			return
+		}
 	}
 
-	if err := ctrl.ClassroomRepo.EnrollStudents(ctx, classroomId, req.StudentIds); err != nil {
+	if err := ctrl.ClassroomRepo.EnrollStudents(ctx, classroomId, req.StudentIds); errors.Is(err, repository.ErrTenantMismatch) {
+		c.JSON(http.StatusForbidden, response.ResponseV2{
+			Success: false,
+			Message: "Students of another school cannot be enrolled",
+		})
+		return
+	} else if err != nil {
 		log.Errorf("Failed to enroll students: %v", err)
 		c.JSON(http.StatusInternalServerError, response.ResponseV2{
 			Success: false,
@@ -390,7 +566,7 @@ func (ctrl *ClassroomController) EnrollStudents(c *gin.Context) {
 	})
 }
 
-// UnenrollStudent removes a student from a classroom
+// UnenrollStudent removes a student from a classroom, the enrollment is kept as dropped
 func (ctrl *ClassroomController) UnenrollStudent(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
 	log := logger.Logger(ctx)
@@ -417,14 +593,7 @@ func (ctrl *ClassroomController) UnenrollStudent(c *gin.Context) {
 		return
 	}
 
-	// Check if classroom exists
-	_, err = ctrl.ClassroomRepo.GetClassroomByID(ctx, classroomId)
-	if err != nil {
-		log.Errorf("Classroom not found: %v", err)
-		c.JSON(http.StatusNotFound, response.ResponseV2{
-			Success: false,
-			Message: "Classroom not found",
-		})
+	if _, ok := ctrl.getAuthorizedClassroom(c, classroomId, authz.ActionWrite); !ok {
 		return
 	}
 
@@ -443,8 +612,9 @@ func (ctrl *ClassroomController) UnenrollStudent(c *gin.Context) {
 	})
 }
 
-// GetStudentsByClassroom retrieves all students in a classroom
-func (ctrl *ClassroomController) GetStudentsByClassroom(c *gin.Context) {
+// TransferStudents moves students to another section, ending their enrollments in this classroom
+// as transferred. The caller must be able to write both classrooms.
+func (ctrl *ClassroomController) TransferStudents(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
 	log := logger.Logger(ctx)
 
@@ -459,18 +629,91 @@ func (ctrl *ClassroomController) GetStudentsByClassroom(c *gin.Context) {
 		return
 	}
 
-	// Check if classroom exists
-	_, err = ctrl.ClassroomRepo.GetClassroomByID(ctx, classroomId)
+	var req request.TransferStudentsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	if req.ToClassroomId == classroomId {
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Students cannot be transferred to the classroom they are in",
+		})
+		return
+	}
+
+	if _, ok := ctrl.getAuthorizedClassroom(c, classroomId, authz.ActionWrite); !ok {
+		return
+	}
+	if _, ok := ctrl.getAuthorizedClassroom(c, req.ToClassroomId, authz.ActionWrite); !ok {
+		return
+	}
+
+	err = ctrl.ClassroomRepo.TransferStudents(ctx, classroomId, req.ToClassroomId, req.StudentIds)
+	switch {
+	case errors.Is(err, repository.ErrNotEnrolled):
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Every student must be enrolled in the classroom, nothing was transferred",
+		})
+		return
+	case errors.Is(err, repository.ErrTenantMismatch):
+		c.JSON(http.StatusForbidden, response.ResponseV2{
+			Success: false,
+			Message: "Students cannot be transferred to another school",
+		})
+		return
+	case err != nil:
+		log.Errorf("Failed to transfer students: %v", err)
+		c.JSON(http.StatusInternalServerError, response.ResponseV2{
+			Success: false,
+			Message: "Failed to transfer students",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response.ResponseV2{
+		Success: true,
+		Message: "Students transferred successfully",
+	})
+}
+
+// GetStudentsByClassroom retrieves the students enrolled in a classroom, or those enrolled at the
+// time of the as_of query parameter
+func (ctrl *ClassroomController) GetStudentsByClassroom(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	idParam := c.Param("id")
+	classroomId, err := strconv.Atoi(idParam)
 	if err != nil {
-		log.Errorf("Classroom not found: %v", err)
-		c.JSON(http.StatusNotFound, response.ResponseV2{
+		log.Errorf("Invalid classroom ID: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
 			Success: false,
-			Message: "Classroom not found",
+			Message: "Invalid classroom ID",
 		})
 		return
 	}
 
-	students, err := ctrl.ClassroomRepo.GetStudentsByClassroom(ctx, classroomId)
+	var query request.AsOfQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	if _, ok := ctrl.getAuthorizedClassroom(c, classroomId, authz.ActionRead); !ok {
+		return
+	}
+
+	students, err := ctrl.ClassroomRepo.GetStudentsByClassroom(ctx, classroomId, query.AsOf)
 	if err != nil {
 		log.Errorf("Failed to retrieve students: %v", err)
 		c.JSON(http.StatusInternalServerError, response.ResponseV2{
@@ -486,6 +729,220 @@ func (ctrl *ClassroomController) GetStudentsByClassroom(c *gin.Context) {
 	})
 }
 
+// GetEnrollments retrieves the enrollment history of a classroom, ended enrollments included
+func (ctrl *ClassroomController) GetEnrollments(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	idParam := c.Param("id")
+	classroomId, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.Errorf("Invalid classroom ID: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Invalid classroom ID",
+		})
+		return
+	}
+
+	if _, ok := ctrl.getAuthorizedClassroom(c, classroomId, authz.ActionRead); !ok {
+		return
+	}
+
+	enrollments, err := ctrl.ClassroomRepo.GetEnrollments(ctx, classroomId)
+	if err != nil {
+		log.Errorf("Failed to retrieve enrollments: %v", err)
+		c.JSON(http.StatusInternalServerError, response.ResponseV2{
+			Success: false,
+			Message: "Failed to retrieve enrollments",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response.ResponseV2{
+		Success: true,
+		Data:    enrollments,
+	})
+}
+
+// GetClassroomMembers retrieves the co-teachers and teaching assistants of a classroom
+func (ctrl *ClassroomController) GetClassroomMembers(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	idParam := c.Param("id")
+	classroomId, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.Errorf("Invalid classroom ID: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Invalid classroom ID",
+		})
+		return
+	}
+
+	if _, ok := ctrl.getAuthorizedClassroom(c, classroomId, authz.ActionRead); !ok {
+		return
+	}
+
+	members, err := ctrl.ClassroomRepo.GetClassroomMembers(ctx, classroomId)
+	if err != nil {
+		log.Errorf("Failed to retrieve classroom members: %v", err)
+		c.JSON(http.StatusInternalServerError, response.ResponseV2{
+			Success: false,
+			Message: "Failed to retrieve classroom members",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response.ResponseV2{
+		Success: true,
+		Data:    members,
+	})
+}
+
+// AddClassroomMember adds a teacher of the school as co-teacher or teaching assistant of a
+// classroom, or changes the role of a member
+func (ctrl *ClassroomController) AddClassroomMember(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	idParam := c.Param("id")
+	classroomId, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.Errorf("Invalid classroom ID: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Invalid classroom ID",
+		})
+		return
+	}
+
+	var req request.AddClassroomMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	classroom, ok := ctrl.getAuthorizedClassroom(c, classroomId, authz.ActionManage)
+	if !ok {
+		return
+	}
+
+	user, err := ctrl.UserRepo.GetUser(ctx, spec.ByID(req.UserId))
+	if err != nil {
+		log.Errorf("User not found: %v", err)
+		c.JSON(http.StatusNotFound, response.ResponseV2{
+			Success: false,
+			Message: "User not found",
+		})
+		return
+	}
+
+	switch {
+	case user.Role != constants.ROLE_TEACHER:
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "User is not a teacher",
+		})
+		return
+	case user.SchoolId != classroom.SchoolId:
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Teacher belongs to another school",
+		})
+		return
+	case user.Id == classroom.TeacherId:
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "The classroom's teacher cannot be a member of it",
+		})
+		return
+	}
+
+	member := &dto.ClassroomMember{
+		ClassroomId: classroomId,
+		UserId:      req.UserId,
+		Role:        req.Role,
+	}
+	if err := ctrl.ClassroomRepo.AddClassroomMember(ctx, member); errors.Is(err, repository.ErrTenantMismatch) {
+		c.JSON(http.StatusForbidden, response.ResponseV2{
+			Success: false,
+			Message: "Teachers of another school cannot be added",
+		})
+		return
+	} else if err != nil {
+		log.Errorf("Failed to add classroom member: %v", err)
+		c.JSON(http.StatusInternalServerError, response.ResponseV2{
+			Success: false,
+			Message: "Failed to add classroom member",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response.ResponseV2{
+		Success: true,
+		Message: "Classroom member added successfully",
+		Data:    member,
+	})
+}
+
+// RemoveClassroomMember removes a co-teacher or teaching assistant from a classroom
+func (ctrl *ClassroomController) RemoveClassroomMember(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	idParam := c.Param("id")
+	classroomId, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.Errorf("Invalid classroom ID: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Invalid classroom ID",
+		})
+		return
+	}
+
+	userIdParam := c.Param("user_id")
+	userId, err := strconv.Atoi(userIdParam)
+	if err != nil {
+		log.Errorf("Invalid user ID: %v", err)
+		c.JSON(http.StatusBadRequest, response.ResponseV2{
+			Success: false,
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	if _, ok := ctrl.getAuthorizedClassroom(c, classroomId, authz.ActionManage); !ok {
+		return
+	}
+
+	if err := ctrl.ClassroomRepo.RemoveClassroomMember(ctx, classroomId, userId); gorm.IsRecordNotFoundError(err) {
+		c.JSON(http.StatusNotFound, response.ResponseV2{
+			Success: false,
+			Message: "User is not a member of the classroom",
+		})
+		return
+	} else if err != nil {
+		log.Errorf("Failed to remove classroom member: %v", err)
+		c.JSON(http.StatusInternalServerError, response.ResponseV2{
+			Success: false,
+			Message: "Failed to remove classroom member",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, response.ResponseV2{
+		Success: true,
+		Message: "Classroom member removed successfully",
+	})
+}
+
 // GetClassroomsByTeacher retrieves all classrooms for a teacher
 func (ctrl *ClassroomController) GetClassroomsByTeacher(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
@@ -502,6 +959,11 @@ func (ctrl *ClassroomController) GetClassroomsByTeacher(c *gin.Context) {
 		return
 	}
 
+	subject, ok := authzSubject(c)
+	if !ok || !ctrl.authorizeTeacher(c, subject, teacherId) {
+		return
+	}
+
 	classrooms, err := ctrl.ClassroomRepo.GetClassroomsByTeacher(ctx, teacherId)
 	if err != nil {
 		log.Errorf("Failed to retrieve classrooms: %v", err)
@@ -534,6 +996,25 @@ func (ctrl *ClassroomController) GetClassroomsByStudent(c *gin.Context) {
 		return
 	}
 
+	subject, ok := authzSubject(c)
+	if !ok {
+		return
+	}
+
+	student, err := ctrl.UserRepo.GetUser(ctx, spec.ByID(studentId))
+	if err != nil {
+		log.Errorf("Student not found: %v", err)
+		c.JSON(http.StatusNotFound, response.ResponseV2{
+			Success: false,
+			Message: "Student not found",
+		})
+		return
+	}
+
+	if !authorize(c, ctrl.Events, ctrl.AuditLog, subject, ctrl.Authz.Student(ctx, subject, student), resourceStudent, studentId, authz.ActionRead) {
+		return
+	}
+
 	classrooms, err := ctrl.ClassroomRepo.GetClassroomsByStudent(ctx, studentId)
 	if err != nil {
 		log.Errorf("Failed to retrieve classrooms: %v", err)
@@ -549,3 +1030,65 @@ func (ctrl *ClassroomController) GetClassroomsByStudent(c *gin.Context) {
 		Data:    response.ToClassroomResponseList(classrooms),
 	})
 }
+
+// getAuthorizedClassroom loads the classroom and checks that the caller may act on it, archived
+// classrooms can only be read
+func (ctrl *ClassroomController) getAuthorizedClassroom(c *gin.Context, id int, action authz.Action) (*dto.Classroom, bool) {
+	classroom, ok := ctrl.loadAuthorizedClassroom(c, id, action)
+	if !ok {
+		return nil, false
+	}
+	if classroom.ArchivedAt != nil && action != authz.ActionRead {
+		c.JSON(http.StatusConflict, response.ResponseV2{
+			Success: false,
+			Message: "Classroom is archived and read-only",
+		})
+		return nil, false
+	}
+	return classroom, true
+}
+
+// loadAuthorizedClassroom loads the classroom and checks that the caller may act on it, archived
+// or not; only archiving and purging act on archived classrooms beyond reading them
+func (ctrl *ClassroomController) loadAuthorizedClassroom(c *gin.Context, id int, action authz.Action) (*dto.Classroom, bool) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	subject, ok := authzSubject(c)
+	if !ok {
+		return nil, false
+	}
+
+	classroom, err := ctrl.ClassroomRepo.GetClassroomByID(ctx, id)
+	if err != nil {
+		log.Errorf("Classroom not found: %v", err)
+		c.JSON(http.StatusNotFound, response.ResponseV2{
+			Success: false,
+			Message: "Classroom not found",
+		})
+		return nil, false
+	}
+
+	if !authorize(c, ctrl.Events, ctrl.AuditLog, subject, ctrl.Authz.Classroom(ctx, subject, classroom, action), resourceClassroom, id, action) {
+		return nil, false
+	}
+	return classroom, true
+}
+
+// authorizeTeacher checks that the caller may see the classrooms of the teacher
+func (ctrl *ClassroomController) authorizeTeacher(c *gin.Context, subject authz.Subject, teacherId int) bool {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	teacher, err := ctrl.UserRepo.GetUser(ctx, spec.ByID(teacherId))
+	if err != nil {
+		log.Errorf("Teacher not found: %v", err)
+		c.JSON(http.StatusNotFound, response.ResponseV2{
+			Success: false,
+			Message: "Teacher not found",
+		})
+		return false
+	}
+
+	return authorize(c, ctrl.Events, ctrl.AuditLog, subject, ctrl.Authz.Teacher(ctx, subject, teacher), resourceTeacher, teacherId, authz.ActionRead)
+}
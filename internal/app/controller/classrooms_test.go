@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/authz"
+	"eduanalytics/internal/app/service/logger"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+// fakeClassrooms serves the classrooms by id and by enrolled student and records the archived ones
+type fakeClassrooms struct {
+	repository.IClassroomsRepository
+	classrooms map[int]*dto.Classroom
+	enrolled   map[int][]dto.Classroom
+	archived   []int
+}
+
+func (f *fakeClassrooms) GetClassroomByID(ctx context.Context, id int) (*dto.Classroom, error) {
+	classroom, ok := f.classrooms[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return classroom, nil
+}
+
+func (f *fakeClassrooms) GetClassroomsByStudent(ctx context.Context, studentId int) ([]dto.Classroom, error) {
+	return f.enrolled[studentId], nil
+}
+
+func (f *fakeClassrooms) IsStudentOfTeacher(ctx context.Context, teacherId int, studentId int) (bool, error) {
+	for _, classroom := range f.enrolled[studentId] {
+		if classroom.TeacherId == teacherId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeClassrooms) ArchiveClassroom(ctx context.Context, id int) error {
+	f.archived = append(f.archived, id)
+	return nil
+}
+
+// fakeAuditLog keeps the appended entries
+type fakeAuditLog struct {
+	repository.IAuditLogRepository
+	entries []dto.AuditLog
+}
+
+func (f *fakeAuditLog) AppendAuditLog(ctx context.Context, entry *dto.AuditLog) error {
+	f.entries = append(f.entries, *entry)
+	return nil
+}
+
+func TestDeleteClassroom(t *testing.T) {
+	logger.SugarLogger = zap.NewNop().Sugar()
+	gin.SetMode(gin.TestMode)
+	archivedAt := time.Now()
+
+	tests := []struct {
+		name       string
+		user       dto.User
+		classroom  dto.Classroom
+		wantStatus int
+	}{
+		{
+			name:       "active classroom",
+			user:       dto.User{Id: 1, Role: constants.ROLE_ADMIN, SchoolId: 1},
+			classroom:  dto.Classroom{Id: 10, SchoolId: 1, TeacherId: 2},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "already archived classroom",
+			user:       dto.User{Id: 1, Role: constants.ROLE_ADMIN, SchoolId: 1},
+			classroom:  dto.Classroom{Id: 10, SchoolId: 1, TeacherId: 2, ArchivedAt: &archivedAt},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "teacher of the archived classroom",
+			user:       dto.User{Id: 2, Role: constants.ROLE_TEACHER, SchoolId: 1},
+			classroom:  dto.Classroom{Id: 10, SchoolId: 1, TeacherId: 2, ArchivedAt: &archivedAt},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "archived classroom of another school",
+			user:       dto.User{Id: 1, Role: constants.ROLE_ADMIN, SchoolId: 1},
+			classroom:  dto.Classroom{Id: 10, SchoolId: 2, TeacherId: 2, ArchivedAt: &archivedAt},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "archived classroom of another teacher",
+			user:       dto.User{Id: 3, Role: constants.ROLE_TEACHER, SchoolId: 1},
+			classroom:  dto.Classroom{Id: 10, SchoolId: 1, TeacherId: 2, ArchivedAt: &archivedAt},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classroom := tt.classroom
+			classrooms := &fakeClassrooms{classrooms: map[int]*dto.Classroom{classroom.Id: &classroom}}
+			ctrl := NewClassroomController(classrooms, nil, authz.NewAuthorizer(classrooms), &fakeAuditLog{}, &fakeEvents{})
+
+			user := tt.user
+			router := gin.New()
+			router.DELETE("/classrooms/:id", func(c *gin.Context) {
+				c.Set(constants.CTK_CLAIM_KEY.String(), &user)
+			}, ctrl.DeleteClassroom)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/classrooms/10", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if archived := len(classrooms.archived) == 1; archived != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("archived = %v, want archived only when allowed", classrooms.archived)
+			}
+		})
+	}
+}
+
+func TestGetClassroomsByStudent(t *testing.T) {
+	logger.SugarLogger = zap.NewNop().Sugar()
+	gin.SetMode(gin.TestMode)
+
+	users := &fakeSsoUsers{users: map[int]*dto.User{
+		101: {Id: 101, Role: constants.ROLE_STUDENT, SchoolId: 1},
+		102: {Id: 102, Role: constants.ROLE_STUDENT, SchoolId: 1},
+	}}
+	classrooms := &fakeClassrooms{enrolled: map[int][]dto.Classroom{
+		101: {{Id: 10, SchoolId: 1, TeacherId: 2}},
+	}}
+	auditLog, events := &fakeAuditLog{}, &fakeEvents{}
+	ctrl := NewClassroomController(classrooms, users, authz.NewAuthorizer(classrooms), auditLog, events)
+
+	tests := []struct {
+		name       string
+		user       dto.User
+		apiKey     *dto.ApiKey
+		path       string
+		wantStatus int
+	}{
+		{name: "the student", user: dto.User{Id: 101, Role: constants.ROLE_STUDENT, SchoolId: 1}, path: "/students/101/classrooms", wantStatus: http.StatusOK},
+		{name: "another student", user: dto.User{Id: 102, Role: constants.ROLE_STUDENT, SchoolId: 1}, path: "/students/101/classrooms", wantStatus: http.StatusForbidden},
+		{name: "teacher of the student", user: dto.User{Id: 2, Role: constants.ROLE_TEACHER, SchoolId: 1}, path: "/students/101/classrooms", wantStatus: http.StatusOK},
+		{name: "another teacher", user: dto.User{Id: 3, Role: constants.ROLE_TEACHER, SchoolId: 1}, path: "/students/101/classrooms", wantStatus: http.StatusForbidden},
+		{name: "admin", user: dto.User{Id: 1, Role: constants.ROLE_ADMIN, SchoolId: 1}, path: "/students/101/classrooms", wantStatus: http.StatusOK},
+		{name: "admin of another school", user: dto.User{Id: 1, Role: constants.ROLE_ADMIN, SchoolId: 2}, path: "/students/101/classrooms", wantStatus: http.StatusForbidden},
+		{name: "teacher API key", user: dto.User{Id: 2, Role: constants.ROLE_TEACHER, SchoolId: 1}, apiKey: &dto.ApiKey{Id: 9}, path: "/students/101/classrooms", wantStatus: http.StatusForbidden},
+		{name: "unknown student", user: dto.User{Id: 1, Role: constants.ROLE_ADMIN, SchoolId: 1}, path: "/students/999/classrooms", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			router := gin.New()
+			router.GET("/students/:student_id/classrooms", func(c *gin.Context) {
+				c.Set(constants.CTK_CLAIM_KEY.String(), &user)
+				if tt.apiKey != nil {
+					c.Set(constants.CTK_API_KEY.String(), tt.apiKey)
+				}
+			}, ctrl.GetClassroomsByStudent)
+
+			auditLog.entries, events.published = nil, nil
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			// Every denial is published and audited, also of API keys created by no user
+			denied := tt.wantStatus == http.StatusForbidden
+			if denied != (len(events.published) == 1) {
+				t.Errorf("published events = %+v", events.published)
+			}
+			if !denied {
+				if len(auditLog.entries) != 0 {
+					t.Errorf("audit entries = %+v, want none", auditLog.entries)
+				}
+				return
+			}
+			if len(auditLog.entries) != 1 {
+				t.Fatalf("audit entries = %+v, want the denial", auditLog.entries)
+			}
+			entry := auditLog.entries[0]
+			if entry.Action != constants.AUDIT_ACCESS_DENIED || entry.ResourceType != resourceStudent || entry.ResourceId != "101" ||
+				entry.SchoolId == nil || *entry.SchoolId != tt.user.SchoolId {
+				t.Errorf("audit entry = %+v", entry)
+			}
+		})
+	}
+}
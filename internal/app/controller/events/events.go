@@ -44,7 +44,7 @@ func (e *EventsController) StartWorkerPool(ctx context.Context, workers int) {
 
 				if err := e.DBClient.CreateEvent(ctx, &event); err != nil {
 					log.Errorf("Worker %d failed: %v\n", id, err)
-					return
+					continue
 				}
 			}
 		}(i)
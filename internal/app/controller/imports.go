@@ -0,0 +1,374 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/mailer"
+	"eduanalytics/internal/app/service/roster"
+	"eduanalytics/internal/app/service/util"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// maxImportFileSize caps the size of an uploaded import file
+	maxImportFileSize = 5 << 20
+	// maxRosterRows caps the rows of a roster file
+	maxRosterRows = 5000
+	// importQueueSize is the number of imports waiting for a worker before new ones are refused
+	importQueueSize = 20
+	// staleImportAge is the age after which an unfinished import is considered abandoned by a
+	// stopped instance
+	staleImportAge = time.Hour
+)
+
+// IImportController represents the interface for ImportController
+type IImportController interface {
+	StartWorkers(ctx context.Context, workers int)
+	ImportRoster(c *gin.Context)
+	ImportOneRoster(c *gin.Context)
+	ExportOneRoster(c *gin.Context)
+	GetImportJob(c *gin.Context)
+}
+
+// importTask is a queued import job with the context of the request that created it, which
+// carries the actor and the school for the audit log and tenant scoping. run validates and
+// applies the parsed file and sets the outcome on the job.
+type importTask struct {
+	ctx context.Context
+	job *dto.ImportJob
+	run func(ctx context.Context, job *dto.ImportJob)
+}
+
+// ImportController imports rosters and OneRoster bundles in the background. The upload is
+// parsed in the request and queued as a job, clients poll the job for its status and validation
+// report.
+type ImportController struct {
+	Jobs       repository.IImportJobsRepository
+	Rosters    repository.IRostersRepository
+	OneRoster  repository.IOneRosterRepository
+	TokensRepo repository.IUserTokensRepository
+	Mailer     mailer.IMailer
+	Events     events.IEventsController
+	queue      chan importTask
+}
+
+// NewImportController creates a new instance of ImportController
+func NewImportController(
+	jobs repository.IImportJobsRepository,
+	rosters repository.IRostersRepository,
+	oneRoster repository.IOneRosterRepository,
+	tokensRepo repository.IUserTokensRepository,
+	mailer mailer.IMailer,
+	eventsController events.IEventsController,
+) IImportController {
+	return &ImportController{
+		Jobs:       jobs,
+		Rosters:    rosters,
+		OneRoster:  oneRoster,
+		TokensRepo: tokensRepo,
+		Mailer:     mailer,
+		Events:     eventsController,
+		queue:      make(chan importTask, importQueueSize),
+	}
+}
+
+// StartWorkers fails the imports abandoned by stopped instances and runs the workers of the queue
+func (i *ImportController) StartWorkers(ctx context.Context, workers int) {
+	log := logger.Logger(ctx)
+
+	failed, err := i.Jobs.FailStaleImportJobs(ctx, time.Now().Add(-staleImportAge), "the import was interrupted, upload the file again")
+	if err != nil {
+		log.Errorf("Failed to fail stale import jobs: %v", err)
+	} else if failed > 0 {
+		log.Warnf("Failed %d stale import jobs", failed)
+	}
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for task := range i.queue {
+				i.runImport(task)
+			}
+		}()
+	}
+}
+
+// ImportRoster validates a roster CSV file and, unless it is a dry run, creates and updates the
+// users, classrooms and enrollments it describes in the admin's school. The import runs in the
+// background, the response is the job to poll.
+func (i *ImportController) ImportRoster(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := i.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+	var req request.RosterImportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		RespondWithError(c, http.StatusBadRequest, "A CSV file of at most 5 MB is required in the file field")
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		log.Errorf("Failed to open uploaded file: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "The file cannot be read")
+		return
+	}
+	defer file.Close()
+
+	rows, err := roster.Parse(file, maxRosterRows)
+	if errors.Is(err, roster.ErrTooManyRows) {
+		RespondWithError(c, http.StatusBadRequest, fmt.Sprintf("The file has more than %d rows, split it into several imports", maxRosterRows))
+		return
+	} else if err != nil {
+		RespondWithError(c, http.StatusBadRequest, "Invalid CSV file: "+err.Error())
+		return
+	}
+
+	schoolId := admin.SchoolId
+	job := dto.ImportJob{
+		SchoolId:  &schoolId,
+		Kind:      constants.IMPORT_KIND_ROSTER,
+		DryRun:    req.DryRun,
+		FileName:  header.Filename,
+		TotalRows: len(rows),
+		CreatedBy: &admin.Id,
+	}
+	if !i.enqueue(c, ctx, &job, func(ctx context.Context, job *dto.ImportJob) {
+		i.runRosterImport(ctx, job, rows)
+	}) {
+		return
+	}
+
+	log.Infof("Roster import %d of %d rows queued by admin %d", job.Id, len(rows), admin.Id)
+	RespondWithSuccess(c, http.StatusAccepted, "Import queued", job)
+}
+
+// GetImportJob returns an import job of the admin's school with its validation report
+func (i *ImportController) GetImportJob(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	if _, ok := i.adminClaims(c); !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		RespondWithError(c, http.StatusBadRequest, "Invalid import ID")
+		return
+	}
+
+	job, err := i.Jobs.GetImportJob(ctx, id)
+	if gorm.IsRecordNotFoundError(err) {
+		RespondWithError(c, http.StatusNotFound, "Import not found")
+		return
+	} else if err != nil {
+		log.Errorf("Failed to get import job %d: %v", id, err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Import fetched successfully", job)
+}
+
+// enqueue creates the job and queues it. When the queue is full the job is failed and the
+// request answered with 503.
+func (i *ImportController) enqueue(c *gin.Context, ctx context.Context, job *dto.ImportJob, run func(ctx context.Context, job *dto.ImportJob)) bool {
+	log := logger.Logger(ctx)
+
+	if err := i.Jobs.CreateImportJob(ctx, job); err != nil {
+		log.Errorf("Failed to create import job: %v", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return false
+	}
+
+	select {
+	case i.queue <- importTask{ctx: ctx, job: job, run: run}:
+	default:
+		job.Status = constants.IMPORT_STATUS_FAILED
+		job.Error = "too many imports are running, try again later"
+		if err := i.Jobs.FinishImportJob(ctx, job); err != nil {
+			log.Errorf("Failed to fail import job %d: %v", job.Id, err)
+		}
+		RespondWithError(c, http.StatusServiceUnavailable, "Too many imports are running, try again later")
+		return false
+	}
+
+	return true
+}
+
+// runImport marks the job running, runs it and stores its outcome. Jobs fail unless run
+// completes them; a panic fails the job instead of stopping the worker.
+func (i *ImportController) runImport(task importTask) {
+	ctx, job := task.ctx, task.job
+	log := logger.Logger(ctx)
+
+	job.Status = constants.IMPORT_STATUS_FAILED
+	defer func() {
+		if err := i.Jobs.FinishImportJob(ctx, job); err != nil {
+			log.Errorf("Failed to finish import job %d: %v", job.Id, err)
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Import job %d panicked: %v\n%s", job.Id, r, debug.Stack())
+			job.Status = constants.IMPORT_STATUS_FAILED
+			job.Error = "the import failed unexpectedly"
+		}
+	}()
+
+	if err := i.Jobs.StartImportJob(ctx, job.Id); err != nil {
+		log.Errorf("Failed to start import job %d: %v", job.Id, err)
+	}
+
+	task.run(ctx, job)
+}
+
+// runRosterImport validates the rows against the school and, when every row is valid and the
+// job is not a dry run, applies them in one transaction. Users created by the import are sent a
+// verification email; they choose a password with the password reset.
+func (i *ImportController) runRosterImport(ctx context.Context, job *dto.ImportJob, rows []dto.RosterRow) {
+	log := logger.Logger(ctx)
+
+	schoolId := *job.SchoolId
+	seen := map[string]bool{}
+	var emails []string
+	for _, row := range rows {
+		for _, email := range []string{row.Email, row.TeacherEmail} {
+			if email != "" && !seen[email] {
+				seen[email] = true
+				emails = append(emails, email)
+			}
+		}
+	}
+
+	dir, err := i.Rosters.GetRosterDirectory(ctx, schoolId, emails)
+	if err != nil {
+		log.Errorf("Failed to load the directory of import job %d: %v", job.Id, err)
+		job.Error = "the import failed, nothing was imported"
+		return
+	}
+
+	result := roster.Validate(rows, dir)
+	job.ErrorRows = result.Invalid
+	job.Report = toJSONText(result.Rows)
+	job.Summary = toJSONText(result.Summary)
+
+	switch {
+	case job.DryRun:
+		job.Status = constants.IMPORT_STATUS_COMPLETED
+		return
+	case result.Invalid > 0:
+		job.Summary = nil
+		job.Error = fmt.Sprintf("%d of %d rows are invalid, nothing was imported", result.Invalid, len(rows))
+		return
+	}
+
+	passwordHash, err := unknownPasswordHash()
+	if err != nil {
+		log.Errorf("Failed to generate a password for import job %d: %v", job.Id, err)
+		job.Error = "the import failed, nothing was imported"
+		return
+	}
+
+	created, err := i.Rosters.ApplyRoster(ctx, schoolId, &result.Plan, passwordHash)
+	if err != nil {
+		log.Errorf("Failed to apply import job %d: %v", job.Id, err)
+		job.Summary = nil
+		job.Error = "the import failed, nothing was imported"
+		return
+	}
+	job.Status = constants.IMPORT_STATUS_COMPLETED
+
+	i.sendVerificationEmails(ctx, created)
+	i.Events.PublishEvent(dto.Event{
+		EventName: constants.EVENT_ROSTER_IMPORTED,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    jobCreator(job),
+		Metadata: map[string]interface{}{
+			"school_id":     schoolId,
+			"import_job_id": job.Id,
+			"summary":       result.Summary,
+		},
+	})
+	log.Infof("Roster import %d completed: %+v", job.Id, result.Summary)
+}
+
+// sendVerificationEmails sends the users created by an import a verification email
+func (i *ImportController) sendVerificationEmails(ctx context.Context, users []dto.User) {
+	log := logger.Logger(ctx)
+
+	for _, user := range users {
+		user := user
+		if err := sendVerificationEmail(ctx, i.TokensRepo, i.Mailer, &user); err != nil {
+			log.Errorf("Failed to send verification email to user %d: %v", user.Id, err)
+		}
+	}
+}
+
+// unknownPasswordHash returns the hash of a random password nobody knows, users created by
+// imports set their own with the password reset
+func unknownPasswordHash() (string, error) {
+	secret, err := util.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	return util.GenerateHash(secret)
+}
+
+// jobCreator returns the user who created the job, 0 when the user was deleted
+func jobCreator(job *dto.ImportJob) int {
+	if job.CreatedBy != nil {
+		return *job.CreatedBy
+	}
+	return 0
+}
+
+// adminClaims returns the signed in admin, imports are not available to API keys
+func (i *ImportController) adminClaims(c *gin.Context) (*dto.User, bool) {
+	if _, isApiKey := getApiKey(c); isApiKey {
+		RespondWithError(c, http.StatusForbidden, "API keys cannot import data")
+		return nil, false
+	}
+
+	admin, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return nil, false
+	}
+	return admin, true
+}
+
+// toJSONText marshals a value for a json column
+func toJSONText(value interface{}) *dto.JSONText {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	text := dto.JSONText(data)
+	return &text
+}
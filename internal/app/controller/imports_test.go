@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/logger"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeImportJobs records the jobs that were finished
+type fakeImportJobs struct {
+	repository.IImportJobsRepository
+	finished chan dto.ImportJob
+}
+
+func (f *fakeImportJobs) StartImportJob(ctx context.Context, id int) error {
+	return nil
+}
+
+func (f *fakeImportJobs) FinishImportJob(ctx context.Context, job *dto.ImportJob) error {
+	f.finished <- *job
+	return nil
+}
+
+func (f *fakeImportJobs) FailStaleImportJobs(ctx context.Context, createdBefore time.Time, reason string) (int, error) {
+	return 0, nil
+}
+
+// A panicking import fails its job and the worker goes on with the next one
+func TestImportWorkerRecoversFromPanic(t *testing.T) {
+	logger.SugarLogger = zap.NewNop().Sugar()
+	jobs := &fakeImportJobs{finished: make(chan dto.ImportJob, 2)}
+	ctrl := NewImportController(jobs, nil, nil, nil, nil, nil).(*ImportController)
+	ctrl.StartWorkers(context.Background(), 1)
+
+	ctrl.queue <- importTask{ctx: context.Background(), job: &dto.ImportJob{Id: 1}, run: func(ctx context.Context, job *dto.ImportJob) {
+		var rows []dto.RosterRow
+		_ = rows[0]
+	}}
+	ctrl.queue <- importTask{ctx: context.Background(), job: &dto.ImportJob{Id: 2}, run: func(ctx context.Context, job *dto.ImportJob) {
+		job.Status = constants.IMPORT_STATUS_COMPLETED
+	}}
+
+	for _, want := range []dto.ImportJob{
+		{Id: 1, Status: constants.IMPORT_STATUS_FAILED, Error: "the import failed unexpectedly"},
+		{Id: 2, Status: constants.IMPORT_STATUS_COMPLETED},
+	} {
+		select {
+		case job := <-jobs.finished:
+			if job.Id != want.Id || job.Status != want.Status || job.Error != want.Error {
+				t.Errorf("finished job = %+v, want %+v", job, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("job %d was not finished", want.Id)
+		}
+	}
+}
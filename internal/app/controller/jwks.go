@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"eduanalytics/internal/app/service/keystore"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IJWKSController represents the interface for JWKSController
+type IJWKSController interface {
+	GetJWKS(c *gin.Context)
+}
+
+// JWKSController publishes the public token verification keys
+type JWKSController struct {
+	KeyStore keystore.IKeyStore
+}
+
+// NewJWKSController creates a new instance of JWKSController
+func NewJWKSController(keyStore keystore.IKeyStore) IJWKSController {
+	return &JWKSController{
+		KeyStore: keyStore,
+	}
+}
+
+// GetJWKS returns the key set in the standard JWKS format so other services can verify tokens
+func (j *JWKSController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, j.KeyStore.JWKS())
+}
@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	response "eduanalytics/internal/app/service/dto/response"
+	"eduanalytics/internal/app/service/logger"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxCompletedQuizzes caps the completed quizzes of a student, the most recent are listed
+	maxCompletedQuizzes = 50
+	// maxDashboardCompletedQuizzes caps the completed quizzes of the teacher dashboard
+	maxDashboardCompletedQuizzes = 10
+)
+
+// IMeController represents the interface for MeController
+type IMeController interface {
+	GetMyClassrooms(c *gin.Context)
+	GetMyQuizzes(c *gin.Context)
+	GetMyDashboard(c *gin.Context)
+}
+
+// MeController serves the classrooms, quizzes and dashboard of the signed in user. Everything is
+// looked up by the user of the access token, so the routes take no user IDs.
+type MeController struct {
+	Dashboards    repository.IDashboardsRepository
+	ClassroomRepo repository.IClassroomsRepository
+	SchoolsRepo   repository.ISchoolsRepository
+}
+
+// NewMeController creates a new instance of MeController
+func NewMeController(
+	dashboards repository.IDashboardsRepository,
+	classroomRepo repository.IClassroomsRepository,
+	schoolsRepo repository.ISchoolsRepository,
+) IMeController {
+	return &MeController{
+		Dashboards:    dashboards,
+		ClassroomRepo: classroomRepo,
+		SchoolsRepo:   schoolsRepo,
+	}
+}
+
+// GetMyClassrooms returns the classrooms a student is enrolled in or a teacher teaches
+func (m *MeController) GetMyClassrooms(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	user, ok := m.userClaims(c)
+	if !ok {
+		return
+	}
+
+	var classrooms []dto.Classroom
+	var err error
+	switch user.Role {
+	case constants.ROLE_STUDENT:
+		classrooms, err = m.ClassroomRepo.GetClassroomsByStudent(ctx, user.Id)
+	case constants.ROLE_TEACHER:
+		classrooms, err = m.ClassroomRepo.GetClassroomsByTeacher(ctx, user.Id)
+	default:
+		RespondWithError(c, http.StatusForbidden, "Only students and teachers have classrooms")
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to retrieve classrooms of user %d: %v", user.Id, err)
+		RespondWithError(c, http.StatusInternalServerError, "Failed to retrieve classrooms")
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Classrooms", response.ToClassroomResponseList(classrooms))
+}
+
+// GetMyQuizzes returns the quizzes of the student's classrooms grouped into upcoming, active and
+// completed, with the student's score graded on the school's scale. Completed quizzes are
+// limited to the most recent.
+func (m *MeController) GetMyQuizzes(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	user, ok := m.userClaims(c)
+	if !ok {
+		return
+	}
+	if user.Role != constants.ROLE_STUDENT {
+		RespondWithError(c, http.StatusForbidden, "Only students have quizzes to take")
+		return
+	}
+
+	var query request.MyQuizzesQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	quizzes, err := m.Dashboards.GetStudentQuizzes(ctx, user.Id)
+	if err != nil {
+		log.Errorf("Failed to retrieve quizzes of student %d: %v", user.Id, err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	school, err := m.SchoolsRepo.GetSchool(ctx, spec.ByID(user.SchoolId))
+	if err != nil {
+		log.Errorf("Failed to fetch school of student %d: %v", user.Id, err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	statuses := make([]string, len(quizzes))
+	for i := range quizzes {
+		statuses[i] = quizStatus(quizzes[i].StartTime, quizzes[i].EndTime, time.Now())
+	}
+	groups := groupQuizzes(statuses, maxCompletedQuizzes)
+	toResponses := func(indexes []int) []response.StudentQuizResponse {
+		responses := make([]response.StudentQuizResponse, 0, len(indexes))
+		for _, i := range indexes {
+			responses = append(responses, response.ToStudentQuizResponse(&quizzes[i], statuses[i], school.GradingScale))
+		}
+		return responses
+	}
+
+	data := response.QuizGroupsResponse{
+		Upcoming:  toResponses(groups[constants.QUIZ_STATUS_UPCOMING]),
+		Active:    toResponses(groups[constants.QUIZ_STATUS_ACTIVE]),
+		Completed: toResponses(groups[constants.QUIZ_STATUS_COMPLETED]),
+	}
+	switch query.Status {
+	case constants.QUIZ_STATUS_UPCOMING:
+		data.Active, data.Completed = nil, nil
+	case constants.QUIZ_STATUS_ACTIVE:
+		data.Upcoming, data.Completed = nil, nil
+	case constants.QUIZ_STATUS_COMPLETED:
+		data.Upcoming, data.Active = nil, nil
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Quizzes", data)
+}
+
+// GetMyDashboard returns the teacher's classrooms with their students and the quizzes of the
+// classrooms with their participation. Completed quizzes are limited to the most recent.
+func (m *MeController) GetMyDashboard(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	user, ok := m.userClaims(c)
+	if !ok {
+		return
+	}
+	if user.Role != constants.ROLE_TEACHER {
+		RespondWithError(c, http.StatusForbidden, "The dashboard is for teachers")
+		return
+	}
+
+	classrooms, err := m.Dashboards.GetTeacherClassrooms(ctx, user.Id)
+	if err != nil {
+		log.Errorf("Failed to retrieve classrooms of teacher %d: %v", user.Id, err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	students, err := m.Dashboards.CountTeacherStudents(ctx, user.Id)
+	if err != nil {
+		log.Errorf("Failed to count students of teacher %d: %v", user.Id, err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	quizzes, err := m.Dashboards.GetTeacherQuizzes(ctx, user.Id)
+	if err != nil {
+		log.Errorf("Failed to retrieve quizzes of teacher %d: %v", user.Id, err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	dashboard := response.TeacherDashboardResponse{
+		Classrooms: make([]response.TeacherClassroomResponse, 0, len(classrooms)),
+		Students:   students,
+	}
+	for i := range classrooms {
+		dashboard.Classrooms = append(dashboard.Classrooms, response.TeacherClassroomResponse{
+			ClassroomResponse: response.ToClassroomResponse(&classrooms[i].Classroom),
+			Students:          classrooms[i].Students,
+		})
+	}
+
+	statuses := make([]string, len(quizzes))
+	for i := range quizzes {
+		statuses[i] = quizStatus(quizzes[i].StartTime, quizzes[i].EndTime, time.Now())
+	}
+	groups := groupQuizzes(statuses, maxDashboardCompletedQuizzes)
+	toResponses := func(indexes []int) []response.TeacherQuizResponse {
+		responses := make([]response.TeacherQuizResponse, 0, len(indexes))
+		for _, i := range indexes {
+			responses = append(responses, response.ToTeacherQuizResponse(&quizzes[i], statuses[i]))
+		}
+		return responses
+	}
+	dashboard.Quizzes = response.QuizGroupsResponse{
+		Upcoming:  toResponses(groups[constants.QUIZ_STATUS_UPCOMING]),
+		Active:    toResponses(groups[constants.QUIZ_STATUS_ACTIVE]),
+		Completed: toResponses(groups[constants.QUIZ_STATUS_COMPLETED]),
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Dashboard", dashboard)
+}
+
+// userClaims returns the signed in user, API keys act for a school and have no classrooms
+func (m *MeController) userClaims(c *gin.Context) (*dto.User, bool) {
+	if _, isApiKey := getApiKey(c); isApiKey {
+		RespondWithError(c, http.StatusForbidden, "API keys have no classrooms or quizzes of their own")
+		return nil, false
+	}
+
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return nil, false
+	}
+	return user, true
+}
+
+// quizStatus returns whether the quiz starts later, is open or has ended
+func quizStatus(start, end, now time.Time) string {
+	switch {
+	case now.Before(start):
+		return constants.QUIZ_STATUS_UPCOMING
+	case now.Before(end):
+		return constants.QUIZ_STATUS_ACTIVE
+	default:
+		return constants.QUIZ_STATUS_COMPLETED
+	}
+}
+
+// groupQuizzes groups the indexes of quizzes sorted by start time by their status. Completed
+// quizzes are listed most recent first and limited to maxCompleted.
+func groupQuizzes(statuses []string, maxCompleted int) map[string][]int {
+	groups := map[string][]int{}
+	for i, status := range statuses {
+		if status != constants.QUIZ_STATUS_COMPLETED {
+			groups[status] = append(groups[status], i)
+		}
+	}
+	for i := len(statuses) - 1; i >= 0 && len(groups[constants.QUIZ_STATUS_COMPLETED]) < maxCompleted; i-- {
+		if statuses[i] == constants.QUIZ_STATUS_COMPLETED {
+			groups[constants.QUIZ_STATUS_COMPLETED] = append(groups[constants.QUIZ_STATUS_COMPLETED], i)
+		}
+	}
+	return groups
+}
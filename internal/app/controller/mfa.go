@@ -0,0 +1,343 @@
+package controller
+
+import (
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/dto/response"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/mfa"
+	"eduanalytics/internal/app/service/util"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IMfaController represents the interface for MfaController
+type IMfaController interface {
+	GetMfaStatus(c *gin.Context)
+	EnrollMfa(c *gin.Context)
+	ConfirmMfa(c *gin.Context)
+	RegenerateRecoveryCodes(c *gin.Context)
+	DisableMfa(c *gin.Context)
+	GetMfaRequirements(c *gin.Context)
+	SetMfaRequirement(c *gin.Context)
+	ResetUserMfa(c *gin.Context)
+}
+
+// MfaController manages the second factor of the authenticated user and the per-role MFA
+// requirements
+type MfaController struct {
+	DBClient repository.IUsersRepository
+	MfaRepo  repository.IMfaRepository
+	Mfa      mfa.IMfaService
+	Events   events.IEventsController
+}
+
+// NewMfaController creates a new instance of MfaController
+func NewMfaController(
+	dbClient repository.IUsersRepository,
+	mfaRepo repository.IMfaRepository,
+	mfaService mfa.IMfaService,
+	eventsController events.IEventsController,
+) IMfaController {
+	return &MfaController{
+		DBClient: dbClient,
+		MfaRepo:  mfaRepo,
+		Mfa:      mfaService,
+		Events:   eventsController,
+	}
+}
+
+// GetMfaStatus reports whether the authenticated user has MFA enabled or required
+func (m *MfaController) GetMfaStatus(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	status, err := m.Mfa.GetStatus(ctx, user)
+	if err != nil {
+		log.Error("error while fetching mfa status", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "MFA status", status)
+}
+
+// EnrollMfa generates a TOTP secret and its otpauth:// provisioning URI for a QR code
+func (m *MfaController) EnrollMfa(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	enrollment, err := m.Mfa.BeginEnrollment(ctx, user)
+	if errors.Is(err, mfa.ErrAlreadyEnabled) {
+		RespondWithError(c, http.StatusConflict, "MFA is already enabled")
+		return
+	}
+	if err != nil {
+		log.Error("error while starting mfa enrollment", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Scan the provisioning URI and confirm with a code", enrollment)
+}
+
+// ConfirmMfa enables MFA with the first code from the authenticator and returns the recovery codes
+func (m *MfaController) ConfirmMfa(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	var req request.MfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	codes, err := m.Mfa.ConfirmEnrollment(ctx, user, req.Code)
+	switch {
+	case errors.Is(err, repository.ErrMfaEnrollmentNotPending):
+		RespondWithError(c, http.StatusBadRequest, "No pending MFA enrollment")
+		return
+	case errors.Is(err, mfa.ErrInvalidCode):
+		RespondWithError(c, http.StatusBadRequest, "Invalid MFA code")
+		return
+	case err != nil:
+		log.Error("error while confirming mfa enrollment", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	publishMfaEvent(m.Events, constants.EVENT_MFA_ENABLED, user, nil)
+	RespondWithSuccess(c, http.StatusOK, "MFA enabled, store the recovery codes in a safe place",
+		response.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after checking a current code
+func (m *MfaController) RegenerateRecoveryCodes(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	var req request.MfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if !m.verifyCode(c, user, req.Code) {
+		return
+	}
+
+	codes, err := m.Mfa.RegenerateRecoveryCodes(ctx, user)
+	if err != nil {
+		log.Error("error while regenerating recovery codes", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Recovery codes regenerated", response.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableMfa removes the second factor of the authenticated user unless the role requires one
+func (m *MfaController) DisableMfa(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	claims, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	var req request.DisableMfaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	required, err := m.Mfa.IsRequired(ctx, claims.Role)
+	if err != nil {
+		log.Error("error while fetching mfa requirement", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	if required {
+		RespondWithError(c, http.StatusForbidden, "MFA is required for your role")
+		return
+	}
+
+	user, err := m.DBClient.GetUserByEmail(ctx, claims.Email)
+	if err != nil {
+		log.Error("error while fetching user", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	if !util.ValidatePassword(req.Password, user.Password) {
+		RespondWithError(c, http.StatusUnauthorized, "Password is incorrect")
+		return
+	}
+
+	if !m.verifyCode(c, user, req.Code) {
+		return
+	}
+
+	if err := m.Mfa.Disable(ctx, user); err != nil {
+		log.Error("error while disabling mfa", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	publishMfaEvent(m.Events, constants.EVENT_MFA_DISABLED, user, nil)
+	RespondWithSuccess(c, http.StatusOK, "MFA disabled", nil)
+}
+
+// GetMfaRequirements lists the roles with an MFA requirement setting
+func (m *MfaController) GetMfaRequirements(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	requirements, err := m.MfaRepo.GetRoleRequirements(ctx)
+	if err != nil {
+		log.Error("error while fetching mfa requirements", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "MFA requirements", requirements)
+}
+
+// SetMfaRequirement requires or stops requiring MFA for every member of a role. Members without
+// a second factor have to enroll at their next login.
+func (m *MfaController) SetMfaRequirement(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	role := c.Param("role")
+	if role != constants.ROLE_ADMIN && role != constants.ROLE_TEACHER && role != constants.ROLE_STUDENT {
+		RespondWithError(c, http.StatusBadRequest, "Unknown role")
+		return
+	}
+
+	var req request.MfaRequirementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := m.MfaRepo.SetRoleRequirement(ctx, role, *req.Required); err != nil {
+		log.Error("error while saving mfa requirement", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	log.Infof("MFA requirement for role %s set to %t", role, *req.Required)
+	RespondWithSuccess(c, http.StatusOK, "MFA requirement updated", dto.MfaRoleRequirement{Role: role, Required: *req.Required})
+}
+
+// ResetUserMfa removes the second factor of a user who lost the authenticator and the recovery
+// codes; if the role requires MFA the user enrolls again at the next login
+func (m *MfaController) ResetUserMfa(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Errorf("Invalid user ID: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := m.DBClient.GetUser(ctx, spec.ByID(id))
+	if err != nil {
+		log.Errorf("User not found: %v", err)
+		RespondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := m.Mfa.Disable(ctx, user); err != nil {
+		log.Error("error while resetting mfa", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	publishMfaEvent(m.Events, constants.EVENT_MFA_DISABLED, user, map[string]interface{}{"reset_by": admin.Id})
+	log.Infof("MFA of user %d reset by admin %d", user.Id, admin.Id)
+	RespondWithSuccess(c, http.StatusOK, "MFA reset successfully", nil)
+}
+
+// verifyCode checks a TOTP or recovery code of the user and answers the request if it is wrong
+func (m *MfaController) verifyCode(c *gin.Context, user *dto.User, code string) bool {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	_, err := m.Mfa.Verify(ctx, user, code)
+	switch {
+	case errors.Is(err, mfa.ErrNotEnabled):
+		RespondWithError(c, http.StatusBadRequest, "MFA is not enabled")
+		return false
+	case errors.Is(err, mfa.ErrInvalidCode):
+		RespondWithError(c, http.StatusUnauthorized, "Invalid MFA code")
+		return false
+	case err != nil:
+		log.Error("error while verifying mfa code", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return false
+	}
+	return true
+}
+
+// publishMfaEvent records an MFA security event for the user
+func publishMfaEvent(eventsController events.IEventsController, eventName string, user *dto.User, metadata map[string]interface{}) {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["school_id"] = user.SchoolId
+
+	eventsController.PublishEvent(dto.Event{
+		EventName: eventName,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    user.Id,
+		Metadata:  metadata,
+	})
+}
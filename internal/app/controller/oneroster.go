@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"archive/zip"
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/oneroster"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// maxOneRosterFileSize caps the size of an uploaded OneRoster bundle
+	maxOneRosterFileSize = 20 << 20
+	// maxOneRosterRows caps the rows of all files of a OneRoster bundle
+	maxOneRosterRows = 50000
+)
+
+// ImportOneRoster validates a zipped OneRoster 1.1 or 1.2 CSV bundle and, unless it is a dry
+// run, syncs its schools, users, classes and enrollments. Admins sync their own school, super
+// admins every school of the bundle. The import runs in the background, the response is the
+// job to poll.
+func (i *ImportController) ImportOneRoster(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := i.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxOneRosterFileSize)
+	var req request.OneRosterImportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		RespondWithError(c, http.StatusBadRequest, "A zip file of at most 20 MB is required in the file field")
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		log.Errorf("Failed to open uploaded file: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "The file cannot be read")
+		return
+	}
+	defer file.Close()
+
+	bundle, err := oneroster.ReadBundle(file, header.Size, maxOneRosterRows)
+	if errors.Is(err, oneroster.ErrTooManyRows) {
+		RespondWithError(c, http.StatusBadRequest, fmt.Sprintf("The bundle has more than %d rows, split it into several imports", maxOneRosterRows))
+		return
+	} else if err != nil {
+		RespondWithError(c, http.StatusBadRequest, "Invalid OneRoster bundle: "+err.Error())
+		return
+	}
+
+	// District imports of super admins belong to no school
+	job := dto.ImportJob{
+		Kind:      constants.IMPORT_KIND_ONEROSTER,
+		DryRun:    req.DryRun,
+		FileName:  header.Filename,
+		TotalRows: bundle.Rows(),
+		CreatedBy: &admin.Id,
+	}
+	if admin.Role != constants.ROLE_SUPER_ADMIN {
+		schoolId := admin.SchoolId
+		job.SchoolId = &schoolId
+	}
+	if !i.enqueue(c, ctx, &job, func(ctx context.Context, job *dto.ImportJob) {
+		i.runOneRosterImport(ctx, job, bundle, req.OrgSourcedId)
+	}) {
+		return
+	}
+
+	log.Infof("OneRoster import %d of %d rows queued by admin %d", job.Id, job.TotalRows, admin.Id)
+	RespondWithSuccess(c, http.StatusAccepted, "Import queued", job)
+}
+
+// ExportOneRoster downloads a school as a zipped OneRoster 1.2 CSV bundle. Admins export their
+// own school, super admins the school of the school_id query parameter.
+func (i *ImportController) ExportOneRoster(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := i.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	var query request.OneRosterExportQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	schoolId := admin.SchoolId
+	if admin.Role == constants.ROLE_SUPER_ADMIN {
+		if query.SchoolId == 0 {
+			RespondWithError(c, http.StatusBadRequest, "school_id is required")
+			return
+		}
+		schoolId = query.SchoolId
+	}
+
+	export, err := i.OneRoster.GetOneRosterExport(ctx, schoolId)
+	if gorm.IsRecordNotFoundError(err) {
+		RespondWithError(c, http.StatusNotFound, "School not found")
+		return
+	} else if errors.Is(err, repository.ErrTenantMismatch) {
+		RespondWithError(c, http.StatusForbidden, "Admins can only export their own school")
+		return
+	} else if err != nil {
+		log.Errorf("Failed to get OneRoster export of school %d: %v", schoolId, err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="oneroster-school-%d.zip"`, schoolId))
+	c.Status(http.StatusOK)
+
+	// Once streaming started the status cannot change, a failure leaves a broken zip
+	archive := zip.NewWriter(c.Writer)
+	if err := oneroster.WriteBundle(archive, export); err != nil {
+		log.Errorf("Failed to write OneRoster export of school %d: %v", schoolId, err)
+		return
+	}
+	if err := archive.Close(); err != nil {
+		log.Errorf("Failed to write OneRoster export of school %d: %v", schoolId, err)
+		return
+	}
+
+	i.Events.PublishEvent(dto.Event{
+		EventName: constants.EVENT_ONEROSTER_EXPORTED,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    admin.Id,
+		Metadata: map[string]interface{}{
+			"school_id":   schoolId,
+			"users":       len(export.Users),
+			"classrooms":  len(export.Classrooms),
+			"enrollments": len(export.Enrollments),
+		},
+	})
+	log.Infof("OneRoster export of school %d downloaded by admin %d", schoolId, admin.Id)
+}
+
+// runOneRosterImport validates the bundle and, when every row is valid and the job is not a dry
+// run, applies it in one transaction. Users created enabled are sent a verification email.
+func (i *ImportController) runOneRosterImport(ctx context.Context, job *dto.ImportJob, bundle *oneroster.Bundle, orgSourcedId string) {
+	log := logger.Logger(ctx)
+
+	var schoolId int
+	if job.SchoolId != nil {
+		schoolId = *job.SchoolId
+	}
+
+	seen := map[string]bool{}
+	var sourcedIds, emails []string
+	add := func(sourcedId string) {
+		if sourcedId != "" && !seen[sourcedId] {
+			seen[sourcedId] = true
+			sourcedIds = append(sourcedIds, sourcedId)
+		}
+	}
+	for _, org := range bundle.Orgs {
+		add(org.SourcedId)
+	}
+	for _, user := range bundle.Users {
+		add(user.SourcedId)
+		if user.Email != "" {
+			emails = append(emails, user.Email)
+		}
+	}
+	for _, class := range bundle.Classes {
+		add(class.SourcedId)
+	}
+	for _, enrollment := range bundle.Enrollments {
+		add(enrollment.SourcedId)
+		add(enrollment.ClassSourcedId)
+		add(enrollment.UserSourcedId)
+	}
+
+	dir, err := i.OneRoster.GetOneRosterDirectory(ctx, schoolId, sourcedIds, emails)
+	if err != nil {
+		log.Errorf("Failed to load the directory of import job %d: %v", job.Id, err)
+		job.Error = "the import failed, nothing was imported"
+		return
+	}
+
+	result := oneroster.Validate(bundle, dir, orgSourcedId)
+	job.ErrorRows = result.Invalid
+	job.Report = toJSONText(result.Rows)
+	job.Summary = toJSONText(result.Summary)
+
+	switch {
+	case job.DryRun:
+		job.Status = constants.IMPORT_STATUS_COMPLETED
+		return
+	case result.Invalid > 0:
+		job.Summary = nil
+		job.Error = fmt.Sprintf("%d of %d rows are invalid, nothing was imported", result.Invalid, job.TotalRows)
+		return
+	}
+
+	passwordHash, err := unknownPasswordHash()
+	if err != nil {
+		log.Errorf("Failed to generate a password for import job %d: %v", job.Id, err)
+		job.Error = "the import failed, nothing was imported"
+		return
+	}
+
+	created, err := i.OneRoster.ApplyOneRoster(ctx, &result.Plan, passwordHash)
+	if err != nil {
+		log.Errorf("Failed to apply import job %d: %v", job.Id, err)
+		job.Summary = nil
+		job.Error = "the import failed, nothing was imported"
+		return
+	}
+	job.Status = constants.IMPORT_STATUS_COMPLETED
+
+	i.sendVerificationEmails(ctx, created)
+	i.Events.PublishEvent(dto.Event{
+		EventName: constants.EVENT_ONEROSTER_IMPORTED,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    jobCreator(job),
+		Metadata: map[string]interface{}{
+			"school_id":     job.SchoolId,
+			"import_job_id": job.Id,
+			"summary":       result.Summary,
+		},
+	})
+	log.Infof("OneRoster import %d completed: %+v", job.Id, result.Summary)
+}
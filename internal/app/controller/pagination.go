@@ -0,0 +1,31 @@
+package controller
+
+import (
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/util"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validatePage applies the pagination defaults, caps the page size at maxLimit and answers the
+// request if limit or page are not positive
+func validatePage(c *gin.Context, page *request.Pagination, maxLimit int) bool {
+	page.GetAllData = false
+	page.Validate()
+	if *page.Limit < 1 || *page.Page < 1 {
+		RespondWithError(c, http.StatusBadRequest, "limit and page must be positive")
+		return false
+	}
+	if *page.Limit > maxLimit {
+		page.Limit = util.Int(maxLimit)
+		page.Offset = *page.Limit * (*page.Page - 1)
+	}
+	return true
+}
+
+// setTotal records the number of matching rows and pages on the echoed pagination
+func setTotal(page *request.Pagination, total int) {
+	page.Total = total
+	page.TotalPage = (total + *page.Limit - 1) / *page.Limit
+}
@@ -8,6 +8,7 @@ import (
 	"eduanalytics/internal/app/service/correlation"
 	"eduanalytics/internal/app/service/logger"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -44,7 +45,13 @@ func (q *QuizController) CreateQuiz(c *gin.Context) {
 		return
 	}
 
-	if err := q.DBClient.CreateQuiz(ctx, &quiz); err != nil {
+	if err := q.DBClient.CreateQuiz(ctx, &quiz); errors.Is(err, repository.ErrTenantMismatch) {
+		RespondWithError(c, http.StatusForbidden, "Classroom belongs to another school")
+		return
+	} else if errors.Is(err, repository.ErrClassroomArchived) {
+		RespondWithError(c, http.StatusConflict, "Classroom is archived and read-only")
+		return
+	} else if err != nil {
 		log.Error("error while creating quiz", err)
 		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
 		return
@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/dto/response"
+	"eduanalytics/internal/app/service/logger"
+	"net/http"
+	"strings"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// Casbin policy types
+const (
+	ptypePolicy          = "p"
+	ptypeRoleInheritance = "g"
+)
+
+// IRbacController represents the interface for RbacController
+type IRbacController interface {
+	GetPolicies(c *gin.Context)
+	AddPolicy(c *gin.Context)
+	RemovePolicy(c *gin.Context)
+	GetRoleInheritance(c *gin.Context)
+	AddRoleInheritance(c *gin.Context)
+	RemoveRoleInheritance(c *gin.Context)
+}
+
+// RbacController lets super admins manage the Casbin policies, which apply to every school.
+// Changes are stored in the database and reach every instance without a restart.
+type RbacController struct {
+	Enforcer casbin.IEnforcer
+	Roles    repository.IRolesRepository
+	AuditLog repository.IAuditLogRepository
+	Events   events.IEventsController
+}
+
+// NewRbacController creates a new instance of RbacController
+func NewRbacController(enforcer casbin.IEnforcer, roles repository.IRolesRepository, auditLog repository.IAuditLogRepository, eventsController events.IEventsController) IRbacController {
+	return &RbacController{
+		Enforcer: enforcer,
+		Roles:    roles,
+		AuditLog: auditLog,
+		Events:   eventsController,
+	}
+}
+
+// GetPolicies lists the policies, optionally of a single role
+func (r *RbacController) GetPolicies(c *gin.Context) {
+	if _, ok := r.superAdminClaims(c); !ok {
+		return
+	}
+
+	policies := r.Enforcer.GetPolicy()
+	if role := c.Query("role"); role != "" {
+		policies = r.Enforcer.GetFilteredPolicy(0, role)
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Policies", response.ToPolicyResponseList(withoutSuperAdmin(policies)))
+}
+
+// AddPolicy allows a role to call a route
+func (r *RbacController) AddPolicy(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	superAdmin, ok := r.superAdminClaims(c)
+	if !ok {
+		return
+	}
+
+	var req request.PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if !r.requireRoles(c, req.Role) {
+		return
+	}
+
+	added, err := r.Enforcer.AddPolicy(req.Role, req.Path, req.Method)
+	if err != nil {
+		log.Error("error while adding policy", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	if !added {
+		RespondWithError(c, http.StatusConflict, "Policy already exists")
+		return
+	}
+
+	r.recordPolicyChange(ctx, constants.AUDIT_POLICY_ADD, ptypePolicy, req.Role, req.Path, req.Method)
+	r.publishRbacEvent(constants.EVENT_RBAC_POLICY_ADDED, superAdmin, ptypePolicy, req.Role, req.Path, req.Method)
+	log.Infof("Policy %s %s %s added by super admin %d", req.Role, req.Method, req.Path, superAdmin.Id)
+	RespondWithSuccess(c, http.StatusCreated, "Policy added",
+		response.PolicyResponse{Role: req.Role, Path: req.Path, Method: req.Method})
+}
+
+// RemovePolicy revokes a role's access to a route
+func (r *RbacController) RemovePolicy(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	superAdmin, ok := r.superAdminClaims(c)
+	if !ok {
+		return
+	}
+
+	var req request.PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if req.Role == constants.ROLE_SUPER_ADMIN {
+		RespondWithError(c, http.StatusBadRequest, "Unknown role: "+constants.ROLE_SUPER_ADMIN)
+		return
+	}
+
+	removed, err := r.Enforcer.RemovePolicy(req.Role, req.Path, req.Method)
+	if err != nil {
+		log.Error("error while removing policy", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	if !removed {
+		RespondWithError(c, http.StatusNotFound, "Policy not found")
+		return
+	}
+
+	r.recordPolicyChange(ctx, constants.AUDIT_POLICY_REMOVE, ptypePolicy, req.Role, req.Path, req.Method)
+	r.publishRbacEvent(constants.EVENT_RBAC_POLICY_REMOVED, superAdmin, ptypePolicy, req.Role, req.Path, req.Method)
+	log.Infof("Policy %s %s %s removed by super admin %d", req.Role, req.Method, req.Path, superAdmin.Id)
+	RespondWithSuccess(c, http.StatusOK, "Policy removed", nil)
+}
+
+// GetRoleInheritance lists which roles inherit the policies of other roles
+func (r *RbacController) GetRoleInheritance(c *gin.Context) {
+	if _, ok := r.superAdminClaims(c); !ok {
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Role inheritance",
+		response.ToRoleInheritanceResponseList(withoutSuperAdmin(r.Enforcer.GetGroupingPolicy())))
+}
+
+// AddRoleInheritance lets a role inherit every policy of another role
+func (r *RbacController) AddRoleInheritance(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	superAdmin, ok := r.superAdminClaims(c)
+	if !ok {
+		return
+	}
+
+	var req request.RoleInheritanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if !r.requireRoles(c, req.Role, req.Inherits) {
+		return
+	}
+
+	added, err := r.Enforcer.AddGroupingPolicy(req.Role, req.Inherits)
+	if err != nil {
+		log.Error("error while adding role inheritance", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	if !added {
+		RespondWithError(c, http.StatusConflict, "Role inheritance already exists")
+		return
+	}
+
+	r.recordPolicyChange(ctx, constants.AUDIT_POLICY_ADD, ptypeRoleInheritance, req.Role, req.Inherits)
+	r.publishRbacEvent(constants.EVENT_RBAC_POLICY_ADDED, superAdmin, ptypeRoleInheritance, req.Role, req.Inherits)
+	log.Infof("Role %s inherits %s, added by super admin %d", req.Role, req.Inherits, superAdmin.Id)
+	RespondWithSuccess(c, http.StatusCreated, "Role inheritance added",
+		response.RoleInheritanceResponse{Role: req.Role, Inherits: req.Inherits})
+}
+
+// RemoveRoleInheritance stops a role from inheriting the policies of another role
+func (r *RbacController) RemoveRoleInheritance(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	superAdmin, ok := r.superAdminClaims(c)
+	if !ok {
+		return
+	}
+
+	var req request.RoleInheritanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if req.Role == constants.ROLE_SUPER_ADMIN || req.Inherits == constants.ROLE_SUPER_ADMIN {
+		RespondWithError(c, http.StatusBadRequest, "Unknown role: "+constants.ROLE_SUPER_ADMIN)
+		return
+	}
+
+	removed, err := r.Enforcer.RemoveGroupingPolicy(req.Role, req.Inherits)
+	if err != nil {
+		log.Error("error while removing role inheritance", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	if !removed {
+		RespondWithError(c, http.StatusNotFound, "Role inheritance not found")
+		return
+	}
+
+	r.recordPolicyChange(ctx, constants.AUDIT_POLICY_REMOVE, ptypeRoleInheritance, req.Role, req.Inherits)
+	r.publishRbacEvent(constants.EVENT_RBAC_POLICY_REMOVED, superAdmin, ptypeRoleInheritance, req.Role, req.Inherits)
+	log.Infof("Role %s no longer inherits %s, removed by super admin %d", req.Role, req.Inherits, superAdmin.Id)
+	RespondWithSuccess(c, http.StatusOK, "Role inheritance removed", nil)
+}
+
+// withoutSuperAdmin drops the rules of the super admin role, which are not managed through the API
+func withoutSuperAdmin(rules [][]string) [][]string {
+	filtered := make([][]string, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule) > 0 && rule[0] != constants.ROLE_SUPER_ADMIN && (len(rule) < 2 || rule[1] != constants.ROLE_SUPER_ADMIN) {
+			filtered = append(filtered, rule)
+		}
+	}
+	return filtered
+}
+
+// requireRoles answers the request unless every role exists, see POST /roles
+func (r *RbacController) requireRoles(c *gin.Context, names ...string) bool {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	for _, name := range names {
+		known, err := knownRole(ctx, r.Roles, name)
+		if err != nil {
+			log.Error("error while fetching role", err)
+			RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+			return false
+		}
+		if !known {
+			RespondWithError(c, http.StatusBadRequest, "Unknown role: "+name)
+			return false
+		}
+	}
+	return true
+}
+
+// superAdminClaims returns the super admin of the request; policies are managed by people, not
+// by API keys
+func (r *RbacController) superAdminClaims(c *gin.Context) (*dto.User, bool) {
+	if _, isApiKey := getApiKey(c); isApiKey {
+		RespondWithError(c, http.StatusForbidden, "API keys cannot manage policies")
+		return nil, false
+	}
+	return getSuperAdminClaims(c)
+}
+
+// recordPolicyChange records a policy change in the audit log. The enforcer already applied the
+// change, so a failure is logged rather than returned.
+func (r *RbacController) recordPolicyChange(ctx context.Context, action, ptype string, rule ...string) {
+	err := recordAudit(ctx, r.AuditLog, action, constants.AUDIT_RESOURCE_POLICY, ptype+", "+strings.Join(rule, ", "), nil,
+		map[string]interface{}{"ptype": ptype, "rule": rule})
+	if err != nil {
+		logger.Logger(ctx).Error("error while recording policy change", err)
+	}
+}
+
+func (r *RbacController) publishRbacEvent(eventName string, superAdmin *dto.User, ptype string, rule ...string) {
+	r.Events.PublishEvent(dto.Event{
+		EventName: eventName,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    superAdmin.Id,
+		Metadata: map[string]interface{}{
+			"ptype": ptype,
+			"rule":  rule,
+		},
+	})
+}
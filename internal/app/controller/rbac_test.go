@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/logger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// fakeSchools creates schools in memory
+type fakeSchools struct {
+	repository.ISchoolsRepository
+	created []dto.School
+}
+
+func (f *fakeSchools) CreateSchool(ctx context.Context, school *dto.School) error {
+	school.Id = len(f.created) + 1
+	f.created = append(f.created, *school)
+	return nil
+}
+
+// Roles, policies and schools reach every school, so their handlers refuse anyone but a super
+// admin even when a policy grants the route
+func TestPlatformChangesRequireSuperAdmin(t *testing.T) {
+	logger.SugarLogger = zap.NewNop().Sugar()
+	gin.SetMode(gin.TestMode)
+
+	schools := &fakeSchools{}
+	rbac := NewRbacController(nil, nil, nil, &fakeEvents{})
+	roles := NewRoleController(nil, nil, nil, nil, &fakeEvents{})
+	schoolCtrl := NewSchoolController(schools, &fakeEvents{})
+
+	routes := []struct {
+		method  string
+		path    string
+		body    string
+		handler gin.HandlerFunc
+	}{
+		{http.MethodGet, "/rbac/policies", "", rbac.GetPolicies},
+		{http.MethodPost, "/rbac/policies", `{"role":"admin","path":"/schools","method":"POST"}`, rbac.AddPolicy},
+		{http.MethodDelete, "/rbac/policies", `{"role":"teacher","path":"/classrooms","method":"GET"}`, rbac.RemovePolicy},
+		{http.MethodPost, "/rbac/inheritance", `{"role":"admin","inherits":"super_admin"}`, rbac.AddRoleInheritance},
+		{http.MethodDelete, "/rbac/inheritance", `{"role":"teacher","inherits":"student"}`, rbac.RemoveRoleInheritance},
+		{http.MethodPost, "/roles", `{"name":"parent"}`, roles.CreateRole},
+		{http.MethodPut, "/roles/parent", `{"description":"Parents"}`, roles.UpdateRole},
+		{http.MethodDelete, "/roles/parent", "", roles.DeleteRole},
+		{http.MethodPut, "/schools/2", `{"name":"Other school"}`, schoolCtrl.UpdateSchool},
+		{http.MethodDelete, "/schools/2", "", schoolCtrl.DeleteSchool},
+	}
+	callers := []struct {
+		name   string
+		user   dto.User
+		apiKey *dto.ApiKey
+	}{
+		{name: "school admin", user: dto.User{Id: 1, Role: constants.ROLE_ADMIN, SchoolId: 1}},
+		{name: "teacher", user: dto.User{Id: 2, Role: constants.ROLE_TEACHER, SchoolId: 1}},
+		{name: "super admin API key", user: dto.User{Id: 3, Role: constants.ROLE_SUPER_ADMIN}, apiKey: &dto.ApiKey{Id: 9}},
+	}
+
+	for _, caller := range callers {
+		for _, route := range routes {
+			t.Run(caller.name+" "+route.method+" "+route.path, func(t *testing.T) {
+				user := caller.user
+				router := gin.New()
+				router.Handle(route.method, route.path, func(c *gin.Context) {
+					c.Set(constants.CTK_CLAIM_KEY.String(), &user)
+					if caller.apiKey != nil {
+						c.Set(constants.CTK_API_KEY.String(), caller.apiKey)
+					}
+				}, route.handler)
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(route.method, route.path, strings.NewReader(route.body)))
+				if w.Code != http.StatusForbidden {
+					t.Errorf("status = %d, want 403: %s", w.Code, w.Body.String())
+				}
+			})
+		}
+	}
+
+	// Only the super admin creates a school
+	for _, tt := range []struct {
+		user       dto.User
+		wantStatus int
+	}{
+		{user: dto.User{Id: 1, Role: constants.ROLE_ADMIN, SchoolId: 1}, wantStatus: http.StatusForbidden},
+		{user: dto.User{Id: 3, Role: constants.ROLE_SUPER_ADMIN}, wantStatus: http.StatusCreated},
+	} {
+		user := tt.user
+		router := gin.New()
+		router.POST("/schools", func(c *gin.Context) {
+			c.Set(constants.CTK_CLAIM_KEY.String(), &user)
+		}, schoolCtrl.CreateSchool)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/schools", strings.NewReader(`{"name":"New school"}`)))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: POST /schools status = %d, want %d: %s", user.Role, w.Code, tt.wantStatus, w.Body.String())
+		}
+	}
+	if len(schools.created) != 1 {
+		t.Errorf("created schools = %+v, want only the super admin's", schools.created)
+	}
+}
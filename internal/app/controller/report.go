@@ -4,7 +4,10 @@ import (
 	"eduanalytics/internal/app/constants"
 	"eduanalytics/internal/app/controller/events"
 	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
+	"eduanalytics/internal/app/service/authz"
 	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
 	"eduanalytics/internal/app/service/logger"
 	"net/http"
 	"strconv"
@@ -20,15 +23,33 @@ type IReportController interface {
 
 type ReportController struct {
 	DBClient         repository.IReportsRepository
+	UserRepo         repository.IUsersRepository
+	ClassroomRepo    repository.IClassroomsRepository
+	QuizRepo         repository.IQuizzesRepository
+	SchoolsRepo      repository.ISchoolsRepository
+	Authz            authz.IAuthorizer
+	AuditLog         repository.IAuditLogRepository
 	EventsController events.IEventsController
 }
 
 func NewReportController(
 	dbClient repository.IReportsRepository,
+	userRepo repository.IUsersRepository,
+	classroomRepo repository.IClassroomsRepository,
+	quizRepo repository.IQuizzesRepository,
+	schoolsRepo repository.ISchoolsRepository,
+	authorizer authz.IAuthorizer,
+	auditLog repository.IAuditLogRepository,
 	eventsController events.IEventsController,
 ) IReportController {
 	return &ReportController{
 		DBClient:         dbClient,
+		UserRepo:         userRepo,
+		ClassroomRepo:    classroomRepo,
+		QuizRepo:         quizRepo,
+		SchoolsRepo:      schoolsRepo,
+		Authz:            authorizer,
+		AuditLog:         auditLog,
 		EventsController: eventsController,
 	}
 }
@@ -45,6 +66,23 @@ func (r *ReportController) StudentPerformanceReport(c *gin.Context) {
 		return
 	}
 
+	subject, ok := authzSubject(c)
+	if !ok {
+		return
+	}
+
+	student, err := r.UserRepo.GetUser(ctx, spec.ByID(id))
+	if err != nil {
+		log.Errorf("Student not found: %v", err)
+		RespondWithError(c, http.StatusNotFound, "Student not found")
+		return
+	}
+
+	// Students only see their own performance, teachers that of their students
+	if !authorize(c, r.EventsController, r.AuditLog, subject, r.Authz.Student(ctx, subject, student), resourceStudent, id, authz.ActionRead) {
+		return
+	}
+
 	name, attempts, correct, accuracy, err := r.DBClient.GetStudentPerformanceReport(ctx, id)
 	if err != nil {
 		log.Error("error while getting student performance report", err)
@@ -52,16 +90,29 @@ func (r *ReportController) StudentPerformanceReport(c *gin.Context) {
 		return
 	}
 
+	// Grades follow the grading scale of the student's school
+	school, err := r.SchoolsRepo.GetSchool(ctx, spec.ByID(student.SchoolId))
+	if err != nil {
+		log.Error("error while fetching school of student", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	if !r.recordReportView(c, "student_performance", constants.AUDIT_RESOURCE_STUDENT, id, &student.SchoolId) {
+		return
+	}
+
 	var response = make(map[string]interface{})
 	response["student"] = name
 	response["attempts"] = attempts
 	response["correct"] = correct
 	response["accuracy"] = accuracy
+	response["grade"] = school.GradingScale.Grade(accuracy * 100)
 
 	RespondWithSuccess(c, http.StatusOK, "Student performance report", response)
 }
 
-// GET /api/v1/reports/classroom-engagement?classroom_id=10
+// GET /api/v1/reports/classroom-engagement?classroom_id=10&as_of=2026-01-31T00:00:00Z
 func (r *ReportController) ClassroomEngagementReport(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
 	log := logger.Logger(ctx)
@@ -73,22 +124,52 @@ func (r *ReportController) ClassroomEngagementReport(c *gin.Context) {
 		return
 	}
 
-	name, participants, avgTime, err := r.DBClient.GetClassroomEngagementReport(ctx, id)
+	// as_of limits the report to the students enrolled at that time
+	var query request.AsOfQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	subject, ok := authzSubject(c)
+	if !ok {
+		return
+	}
+
+	classroom, err := r.ClassroomRepo.GetClassroomByID(ctx, id)
+	if err != nil {
+		log.Errorf("Classroom not found: %v", err)
+		RespondWithError(c, http.StatusNotFound, "Classroom not found")
+		return
+	}
+
+	if !authorize(c, r.EventsController, r.AuditLog, subject, r.Authz.Classroom(ctx, subject, classroom, authz.ActionRead), resourceClassroom, id, authz.ActionRead) {
+		return
+	}
+
+	name, participants, avgTime, err := r.DBClient.GetClassroomEngagementReport(ctx, id, query.AsOf)
 	if err != nil {
 		log.Error("error while getting classroom engagement report", err)
 		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
 		return
 	}
 
+	if !r.recordReportView(c, "classroom_engagement", constants.AUDIT_RESOURCE_CLASSROOM, id, &classroom.SchoolId) {
+		return
+	}
+
 	var response = make(map[string]interface{})
 	response["classroom"] = name
 	response["participants"] = participants
 	response["avg_time"] = avgTime
+	if query.AsOf != nil {
+		response["as_of"] = query.AsOf
+	}
 
 	RespondWithSuccess(c, http.StatusOK, "Classroom Engagement Report", response)
 }
 
-// GET /api/v1/reports/content-effectiveness?quiz_id=15
+// GET /api/v1/reports/content-effectiveness?quiz_id=15&as_of=2026-01-31T00:00:00Z
 func (r *ReportController) ContentEffectivenessReport(c *gin.Context) {
 	ctx := correlation.WithReqContext(c)
 	log := logger.Logger(ctx)
@@ -100,14 +181,60 @@ func (r *ReportController) ContentEffectivenessReport(c *gin.Context) {
 		return
 	}
 
-	reports, err := r.DBClient.GetContentEffectivenessReport(ctx, id)
+	// as_of limits the report to the students enrolled at that time
+	var query request.AsOfQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	subject, ok := authzSubject(c)
+	if !ok {
+		return
+	}
+
+	quiz, err := r.QuizRepo.GetQuiz(ctx, spec.ByID(id))
+	if err != nil {
+		log.Errorf("Quiz not found: %v", err)
+		RespondWithError(c, http.StatusNotFound, "Quiz not found")
+		return
+	}
+
+	if !authorize(c, r.EventsController, r.AuditLog, subject, r.Authz.Quiz(ctx, subject, quiz), resourceQuiz, id, authz.ActionRead) {
+		return
+	}
+
+	reports, err := r.DBClient.GetContentEffectivenessReport(ctx, id, query.AsOf)
 	if err != nil {
 		log.Error("error while getting content effectiveness report", err)
 		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
 		return
 	}
 
+	if !r.recordReportView(c, "content_effectiveness", constants.AUDIT_RESOURCE_QUIZ, id, nil) {
+		return
+	}
+
 	var response = make(map[string]interface{})
 	response["reports"] = reports
+	if query.AsOf != nil {
+		response["as_of"] = query.AsOf
+	}
 	RespondWithSuccess(c, http.StatusOK, "Content Effectiveness Report", response)
 }
+
+// recordReportView records who viewed a report in the audit log, reports are not served unless
+// the view is recorded
+func (r *ReportController) recordReportView(c *gin.Context, report, resourceType string, resourceId int, schoolId *int) bool {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	err := recordAudit(ctx, r.AuditLog, constants.AUDIT_REPORT_VIEW, resourceType, strconv.Itoa(resourceId), schoolId,
+		map[string]interface{}{"report": report})
+	if err != nil {
+		log.Error("error while recording report view", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return false
+	}
+	return true
+}
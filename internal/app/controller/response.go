@@ -8,6 +8,7 @@ import (
 	"eduanalytics/internal/app/service/correlation"
 	"eduanalytics/internal/app/service/dto/response"
 	"eduanalytics/internal/app/service/logger"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -43,7 +44,13 @@ func (r *ResponseController) SubmitResponse(c *gin.Context) {
 		return
 	}
 
-	if err := r.DBClient.CreateResponse(ctx, &response); err != nil {
+	if err := r.DBClient.CreateResponse(ctx, &response); errors.Is(err, repository.ErrTenantMismatch) {
+		RespondWithError(c, http.StatusForbidden, "Student belongs to another school")
+		return
+	} else if errors.Is(err, repository.ErrClassroomArchived) {
+		RespondWithError(c, http.StatusConflict, "The quiz's classroom is archived and read-only")
+		return
+	} else if err != nil {
 		log.Error("error while creating response", err)
 		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
 		return
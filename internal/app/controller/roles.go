@@ -0,0 +1,472 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/api/middleware/jwt"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/dto/response"
+	"eduanalytics/internal/app/service/logger"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// roleNamePattern restricts role names to lower case identifiers such as teaching_assistant
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// IRoleController represents the interface for RoleController
+type IRoleController interface {
+	GetRoles(c *gin.Context)
+	GetRole(c *gin.Context)
+	CreateRole(c *gin.Context)
+	UpdateRole(c *gin.Context)
+	DeleteRole(c *gin.Context)
+	GetUserRoles(c *gin.Context)
+	AssignRole(c *gin.Context)
+	UnassignRole(c *gin.Context)
+}
+
+// RoleController lets super admins define custom roles, which exist in every school, and admins
+// assign roles to the users of their school. The permissions of a role are the Casbin policies
+// with its name.
+type RoleController struct {
+	Repo     repository.IRolesRepository
+	DBClient repository.IUsersRepository
+	Enforcer casbin.IEnforcer
+	JWT      jwt.IJwtService
+	Events   events.IEventsController
+}
+
+// NewRoleController creates a new instance of RoleController
+func NewRoleController(
+	repo repository.IRolesRepository,
+	dbClient repository.IUsersRepository,
+	enforcer casbin.IEnforcer,
+	jwtService jwt.IJwtService,
+	eventsController events.IEventsController,
+) IRoleController {
+	return &RoleController{
+		Repo:     repo,
+		DBClient: dbClient,
+		Enforcer: enforcer,
+		JWT:      jwtService,
+		Events:   eventsController,
+	}
+}
+
+// GetRoles lists the built-in and custom roles
+func (r *RoleController) GetRoles(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	if _, ok := r.adminClaims(c); !ok {
+		return
+	}
+
+	roles, err := r.Repo.GetRoles(ctx)
+	if err != nil {
+		log.Error("error while fetching roles", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	schoolRoles := make([]dto.Role, 0, len(roles))
+	for _, role := range roles {
+		if role.Name != constants.ROLE_SUPER_ADMIN {
+			schoolRoles = append(schoolRoles, role)
+		}
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Roles", schoolRoles)
+}
+
+// GetRole returns a role with the roles it inherits and its policies
+func (r *RoleController) GetRole(c *gin.Context) {
+	if _, ok := r.adminClaims(c); !ok {
+		return
+	}
+
+	role, ok := r.getRole(c, c.Param("name"))
+	if !ok {
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Role", r.toRoleResponse(role))
+}
+
+// CreateRole creates a custom role inheriting the policies of the given roles
+func (r *RoleController) CreateRole(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	superAdmin, ok := r.superAdminClaims(c)
+	if !ok {
+		return
+	}
+
+	var req request.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if !roleNamePattern.MatchString(req.Name) || req.Name == constants.ROLE_PUBLIC {
+		RespondWithError(c, http.StatusBadRequest, "Role names are lower case letters, digits and underscores and cannot be public")
+		return
+	}
+
+	if _, err := r.Repo.GetRoleByName(ctx, req.Name); err == nil {
+		RespondWithError(c, http.StatusConflict, "Role already exists")
+		return
+	} else if !gorm.IsRecordNotFoundError(err) {
+		log.Error("error while fetching role", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	for _, inherited := range req.Inherits {
+		if known, err := knownRole(ctx, r.Repo, inherited); err != nil || !known || inherited == constants.ROLE_PUBLIC {
+			RespondWithError(c, http.StatusBadRequest, "Unknown inherited role: "+inherited)
+			return
+		}
+	}
+
+	role := &dto.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedBy:   &superAdmin.Id,
+	}
+	if err := r.Repo.CreateRole(ctx, role); err != nil {
+		log.Error("error while creating role", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	for _, inherited := range req.Inherits {
+		if _, err := r.Enforcer.AddGroupingPolicy(role.Name, inherited); err != nil {
+			log.Errorf("error while adding inheritance of role %s from %s: %v", role.Name, inherited, err)
+			RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+			return
+		}
+	}
+
+	r.publishRoleEvent(constants.EVENT_ROLE_CREATED, superAdmin, role, nil)
+	log.Infof("Role %s created by super admin %d", role.Name, superAdmin.Id)
+	RespondWithSuccess(c, http.StatusCreated, "Role created", r.toRoleResponse(role))
+}
+
+// UpdateRole updates the description of a role; roles are not renamed, policies refer to the name
+func (r *RoleController) UpdateRole(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	if _, ok := r.superAdminClaims(c); !ok {
+		return
+	}
+
+	var req request.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	name := c.Param("name")
+	if name == constants.ROLE_SUPER_ADMIN {
+		RespondWithError(c, http.StatusNotFound, "Role not found")
+		return
+	}
+	err := r.Repo.UpdateRoleDescription(ctx, name, req.Description)
+	if gorm.IsRecordNotFoundError(err) {
+		RespondWithError(c, http.StatusNotFound, "Role not found")
+		return
+	}
+	if err != nil {
+		log.Error("error while updating role", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	role, ok := r.getRole(c, name)
+	if !ok {
+		return
+	}
+	RespondWithSuccess(c, http.StatusOK, "Role updated", r.toRoleResponse(role))
+}
+
+// DeleteRole deletes a custom role with its assignments and policies
+func (r *RoleController) DeleteRole(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	superAdmin, ok := r.superAdminClaims(c)
+	if !ok {
+		return
+	}
+
+	role, ok := r.getRole(c, c.Param("name"))
+	if !ok {
+		return
+	}
+	if role.BuiltIn {
+		RespondWithError(c, http.StatusBadRequest, "Built-in roles cannot be deleted")
+		return
+	}
+
+	if err := r.Repo.DeleteRole(ctx, role.Name); err != nil && !gorm.IsRecordNotFoundError(err) {
+		log.Error("error while deleting role", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	// DeleteRole removes the role's policies and the roles inheriting from it, the roles it
+	// inherits from are removed separately
+	_, err := r.Enforcer.DeleteRole(role.Name)
+	if err == nil {
+		_, err = r.Enforcer.RemoveFilteredGroupingPolicy(0, role.Name)
+	}
+	if err != nil {
+		log.Errorf("error while deleting policies of role %s: %v", role.Name, err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	r.publishRoleEvent(constants.EVENT_ROLE_DELETED, superAdmin, role, nil)
+	log.Infof("Role %s deleted by super admin %d", role.Name, superAdmin.Id)
+	RespondWithSuccess(c, http.StatusOK, "Role deleted", nil)
+}
+
+// GetUserRoles lists the roles assigned to a user of the admin's school
+func (r *RoleController) GetUserRoles(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := r.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	user, ok := r.getSchoolUser(c, admin)
+	if !ok {
+		return
+	}
+
+	roles, err := r.Repo.GetUserRoles(ctx, user.Id)
+	if err != nil {
+		log.Error("error while fetching user roles", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "User roles", roles)
+}
+
+// AssignRole assigns a role to a user of the admin's school, it applies from the next token
+// refresh
+func (r *RoleController) AssignRole(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := r.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	var req request.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	user, ok := r.getSchoolUser(c, admin)
+	if !ok {
+		return
+	}
+
+	role, ok := r.getRole(c, req.Role)
+	if !ok {
+		return
+	}
+
+	if err := r.Repo.AssignRole(ctx, user.Id, role.Id, admin.Id); err != nil {
+		log.Error("error while assigning role", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	r.publishRoleEvent(constants.EVENT_ROLE_ASSIGNED, admin, role, user)
+	log.Infof("Role %s assigned to user %d by admin %d", role.Name, user.Id, admin.Id)
+	RespondWithSuccess(c, http.StatusOK, "Role assigned", nil)
+}
+
+// UnassignRole removes a role from a user of the admin's school. The user's sessions are
+// revoked so the removed permissions do not outlive the current access token.
+func (r *RoleController) UnassignRole(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := r.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	user, ok := r.getSchoolUser(c, admin)
+	if !ok {
+		return
+	}
+
+	role, ok := r.getRole(c, c.Param("role"))
+	if !ok {
+		return
+	}
+
+	err := r.Repo.UnassignRole(ctx, user.Id, role.Id)
+	if gorm.IsRecordNotFoundError(err) {
+		RespondWithError(c, http.StatusNotFound, "Role is not assigned to the user")
+		return
+	}
+	if err != nil {
+		log.Error("error while unassigning role", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	if err := r.JWT.InvalidateAllUserSessions(ctx, user.Email); err != nil {
+		log.Errorf("Failed to revoke sessions of user %d: %v", user.Id, err)
+	}
+
+	r.publishRoleEvent(constants.EVENT_ROLE_UNASSIGNED, admin, role, user)
+	log.Infof("Role %s removed from user %d by admin %d", role.Name, user.Id, admin.Id)
+	RespondWithSuccess(c, http.StatusOK, "Role removed", nil)
+}
+
+// getRole resolves a role by name and answers the request if it does not exist. The super admin
+// role is managed by the platform and not visible to school admins.
+func (r *RoleController) getRole(c *gin.Context, name string) (*dto.Role, bool) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	if name == constants.ROLE_SUPER_ADMIN {
+		RespondWithError(c, http.StatusNotFound, "Role not found")
+		return nil, false
+	}
+
+	role, err := r.Repo.GetRoleByName(ctx, name)
+	if gorm.IsRecordNotFoundError(err) {
+		RespondWithError(c, http.StatusNotFound, "Role not found")
+		return nil, false
+	}
+	if err != nil {
+		log.Error("error while fetching role", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return nil, false
+	}
+	return role, true
+}
+
+// getSchoolUser resolves the user referenced by the :id route parameter within the admin's school
+func (r *RoleController) getSchoolUser(c *gin.Context, admin *dto.User) (*dto.User, bool) {
+	ctx := correlation.WithReqContext(c)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		RespondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return nil, false
+	}
+
+	user, err := r.DBClient.GetUser(ctx, spec.ByID(id))
+	if err != nil || user.SchoolId != admin.SchoolId {
+		RespondWithError(c, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// adminClaims returns the admin of the request; roles are managed by people, not by API keys
+func (r *RoleController) adminClaims(c *gin.Context) (*dto.User, bool) {
+	if _, isApiKey := getApiKey(c); isApiKey {
+		RespondWithError(c, http.StatusForbidden, "API keys cannot manage roles")
+		return nil, false
+	}
+
+	admin, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return nil, false
+	}
+	return admin, true
+}
+
+// superAdminClaims returns the super admin of the request; roles are shared by every school, so
+// only super admins create, change or delete them
+func (r *RoleController) superAdminClaims(c *gin.Context) (*dto.User, bool) {
+	if _, isApiKey := getApiKey(c); isApiKey {
+		RespondWithError(c, http.StatusForbidden, "API keys cannot manage roles")
+		return nil, false
+	}
+	return getSuperAdminClaims(c)
+}
+
+func (r *RoleController) toRoleResponse(role *dto.Role) response.RoleResponse {
+	inherits := []string{}
+	for _, rule := range r.Enforcer.GetFilteredGroupingPolicy(0, role.Name) {
+		// Built-in roles are linked to themselves in the policy
+		if len(rule) > 1 && rule[1] != role.Name {
+			inherits = append(inherits, rule[1])
+		}
+	}
+
+	return response.RoleResponse{
+		Role:     role,
+		Inherits: inherits,
+		Policies: response.ToPolicyResponseList(r.Enforcer.GetFilteredPolicy(0, role.Name)),
+	}
+}
+
+func (r *RoleController) publishRoleEvent(eventName string, admin *dto.User, role *dto.Role, user *dto.User) {
+	metadata := map[string]interface{}{
+		"role": role.Name,
+	}
+	// Super admins belong to no school
+	if admin.Role != constants.ROLE_SUPER_ADMIN {
+		metadata["school_id"] = admin.SchoolId
+	}
+	if user != nil {
+		metadata["target_user_id"] = user.Id
+	}
+
+	r.Events.PublishEvent(dto.Event{
+		EventName: eventName,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    admin.Id,
+		Metadata:  metadata,
+	})
+}
+
+// knownRole reports whether policies may name the role: a stored role or the public pseudo-role.
+// The super admin role is left out, school admins cannot change what it may call.
+func knownRole(ctx context.Context, roles repository.IRolesRepository, name string) (bool, error) {
+	if name == constants.ROLE_PUBLIC {
+		return true, nil
+	}
+	if name == constants.ROLE_SUPER_ADMIN {
+		return false, nil
+	}
+	_, err := roles.GetRoleByName(ctx, name)
+	if gorm.IsRecordNotFoundError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,367 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/dto/response"
+	"eduanalytics/internal/app/service/logger"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// maxSchoolPageSize caps the page size of the school list
+const maxSchoolPageSize = 100
+
+// ISchoolController represents the interface for SchoolController
+type ISchoolController interface {
+	GetSchools(c *gin.Context)
+	CreateSchool(c *gin.Context)
+	GetSchool(c *gin.Context)
+	UpdateSchool(c *gin.Context)
+	DeleteSchool(c *gin.Context)
+	GetSchoolSettings(c *gin.Context)
+	UpdateSchoolSettings(c *gin.Context)
+}
+
+// SchoolController lets super admins manage schools and members of a school read its settings.
+// Repositories only return the school of the caller unless the caller is a super admin, so other
+// schools are not found.
+type SchoolController struct {
+	Repo   repository.ISchoolsRepository
+	Events events.IEventsController
+}
+
+// NewSchoolController creates a new instance of SchoolController
+func NewSchoolController(repo repository.ISchoolsRepository, eventsController events.IEventsController) ISchoolController {
+	return &SchoolController{
+		Repo:   repo,
+		Events: eventsController,
+	}
+}
+
+// GetSchools returns a page of the schools, query searches the name
+func (s *SchoolController) GetSchools(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	var query request.Pagination
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if !validatePage(c, &query, maxSchoolPageSize) {
+		return
+	}
+
+	filter := spec.New().
+		OrderBy(query.Order, !strings.EqualFold(query.Sort, "ASC")).
+		OrderBy("id", false).
+		Paginate(*query.Limit, query.Offset)
+	if query.Query != "" {
+		filter.And("name", spec.ILike, "%"+query.Query+"%")
+	}
+
+	schools, total, err := s.Repo.GetSchools(ctx, filter)
+	if errors.Is(err, spec.ErrUnknownField) {
+		RespondWithError(c, http.StatusBadRequest, "Invalid order: "+query.Order)
+		return
+	}
+	if err != nil {
+		log.Error("error while fetching schools", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	setTotal(&query, total)
+	c.JSON(http.StatusOK, response.ResponseV2{
+		Success: true,
+		Message: "Schools",
+		Data:    schools,
+		Request: query,
+	})
+}
+
+// CreateSchool creates a school, its first admin is then created with POST /users
+func (s *SchoolController) CreateSchool(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	superAdmin, ok := getSuperAdminClaims(c)
+	if !ok {
+		return
+	}
+
+	var req request.CreateSchoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	school := &dto.School{
+		Name:     req.Name,
+		Address:  req.Address,
+		Timezone: req.Timezone,
+	}
+	if req.Timezone != "" {
+		if err := validateTimezone(req.Timezone); err != nil {
+			RespondWithError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if len(req.GradingScale) > 0 {
+		scale, err := toGradingScale(req.GradingScale)
+		if err != nil {
+			RespondWithError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		school.GradingScale = scale
+	}
+
+	if err := s.Repo.CreateSchool(ctx, school); err != nil {
+		log.Error("error while creating school", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	s.publishSchoolEvent(constants.EVENT_SCHOOL_CREATED, superAdmin.Id, school.Id)
+	log.Infof("School %d created by super admin %d", school.Id, superAdmin.Id)
+	RespondWithSuccess(c, http.StatusCreated, "School created successfully", school)
+}
+
+// GetSchool returns a school, members of a school can only read their own
+func (s *SchoolController) GetSchool(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	id, ok := schoolID(c)
+	if !ok {
+		return
+	}
+
+	school, err := s.Repo.GetSchool(ctx, spec.ByID(id))
+	if err != nil {
+		log.Errorf("School not found: %v", err)
+		RespondWithError(c, http.StatusNotFound, "School not found")
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "School retrieved successfully", school)
+}
+
+// UpdateSchool changes the name and address of a school
+func (s *SchoolController) UpdateSchool(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	superAdmin, ok := getSuperAdminClaims(c)
+	if !ok {
+		return
+	}
+
+	id, ok := schoolID(c)
+	if !ok {
+		return
+	}
+
+	var req request.UpdateSchoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := s.Repo.UpdateSchool(ctx, id, &dto.School{Name: req.Name, Address: req.Address}); err != nil {
+		s.respondWithSchoolError(ctx, c, "updating school", err)
+		return
+	}
+
+	school, err := s.Repo.GetSchool(ctx, spec.ByID(id))
+	if err != nil {
+		log.Error("error while fetching school", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	s.publishSchoolEvent(constants.EVENT_SCHOOL_UPDATED, superAdmin.Id, id)
+	RespondWithSuccess(c, http.StatusOK, "School updated successfully", school)
+}
+
+// DeleteSchool deletes a school once its users and classrooms are gone
+func (s *SchoolController) DeleteSchool(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	superAdmin, ok := getSuperAdminClaims(c)
+	if !ok {
+		return
+	}
+
+	id, ok := schoolID(c)
+	if !ok {
+		return
+	}
+
+	if err := s.Repo.DeleteSchool(ctx, id); err != nil {
+		s.respondWithSchoolError(ctx, c, "deleting school", err)
+		return
+	}
+
+	s.publishSchoolEvent(constants.EVENT_SCHOOL_DELETED, superAdmin.Id, id)
+	log.Infof("School %d deleted by super admin %d", id, superAdmin.Id)
+	RespondWithSuccess(c, http.StatusOK, "School deleted successfully", nil)
+}
+
+// GetSchoolSettings returns the timezone and grading scale of a school
+func (s *SchoolController) GetSchoolSettings(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	id, ok := schoolID(c)
+	if !ok {
+		return
+	}
+
+	school, err := s.Repo.GetSchool(ctx, spec.ByID(id))
+	if err != nil {
+		log.Errorf("School not found: %v", err)
+		RespondWithError(c, http.StatusNotFound, "School not found")
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "School settings retrieved successfully", response.SchoolSettings{
+		Timezone:     school.Timezone,
+		GradingScale: school.GradingScale,
+	})
+}
+
+// UpdateSchoolSettings replaces the timezone and grading scale of a school; admins change their
+// own school, super admins any school
+func (s *SchoolController) UpdateSchoolSettings(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	id, ok := schoolID(c)
+	if !ok {
+		return
+	}
+
+	var req request.SchoolSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := validateTimezone(req.Timezone); err != nil {
+		RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	scale, err := toGradingScale(req.GradingScale)
+	if err != nil {
+		RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.Repo.UpdateSchoolSettings(ctx, id, req.Timezone, scale); err != nil {
+		s.respondWithSchoolError(ctx, c, "updating school settings", err)
+		return
+	}
+
+	s.publishSchoolEvent(constants.EVENT_SCHOOL_UPDATED, user.Id, id)
+	log.Infof("Settings of school %d updated by user %d", id, user.Id)
+	RespondWithSuccess(c, http.StatusOK, "School settings updated successfully", response.SchoolSettings{
+		Timezone:     req.Timezone,
+		GradingScale: scale,
+	})
+}
+
+// respondWithSchoolError maps an error of a school change to the response
+func (s *SchoolController) respondWithSchoolError(ctx context.Context, c *gin.Context, action string, err error) {
+	log := logger.Logger(ctx)
+
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		RespondWithError(c, http.StatusNotFound, "School not found")
+	case errors.Is(err, repository.ErrSchoolNotEmpty):
+		RespondWithError(c, http.StatusConflict, "School still has users or classrooms")
+	default:
+		log.Errorf("error while %s: %v", action, err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+	}
+}
+
+func (s *SchoolController) publishSchoolEvent(eventName string, userId, schoolId int) {
+	s.Events.PublishEvent(dto.Event{
+		EventName: eventName,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    userId,
+		Metadata: map[string]interface{}{
+			"school_id": schoolId,
+		},
+	})
+}
+
+// schoolID parses the school id of the route
+func schoolID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		RespondWithError(c, http.StatusBadRequest, "Invalid school ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// validateTimezone accepts IANA timezone names known to the server
+func validateTimezone(timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+		return errors.New("unknown timezone: " + timezone)
+	}
+	return nil
+}
+
+// toGradingScale orders the bands from the highest down and requires distinct grades and
+// thresholds and a band starting at 0, so every score gets a grade
+func toGradingScale(bands []request.GradeBand) (dto.GradingScale, error) {
+	scale := make(dto.GradingScale, 0, len(bands))
+	grades := make(map[string]bool, len(bands))
+	for _, band := range bands {
+		if grades[band.Grade] {
+			return nil, errors.New("duplicate grade: " + band.Grade)
+		}
+		grades[band.Grade] = true
+		scale = append(scale, dto.GradeBand{Grade: band.Grade, MinPercent: *band.MinPercent})
+	}
+
+	sort.Slice(scale, func(i, j int) bool { return scale[i].MinPercent > scale[j].MinPercent })
+	for i := 1; i < len(scale); i++ {
+		if scale[i].MinPercent == scale[i-1].MinPercent {
+			return nil, errors.New("grades " + scale[i-1].Grade + " and " + scale[i].Grade + " have the same min_percent")
+		}
+	}
+	if scale[len(scale)-1].MinPercent != 0 {
+		return nil, errors.New("the lowest grade must start at min_percent 0")
+	}
+	return scale, nil
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"eduanalytics/internal/app/api/middleware/jwt"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
+	"eduanalytics/internal/app/service/correlation"
+	"eduanalytics/internal/app/service/dto/response"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/session"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ISessionController represents the interface for SessionController
+type ISessionController interface {
+	GetSessions(c *gin.Context)
+	RevokeSession(c *gin.Context)
+	RevokeAllSessions(c *gin.Context)
+	GetUserSessions(c *gin.Context)
+	RevokeUserSession(c *gin.Context)
+	RevokeAllUserSessions(c *gin.Context)
+}
+
+// SessionController exposes the session manager over HTTP
+type SessionController struct {
+	DBClient       repository.IUsersRepository
+	JWT            jwt.IJwtService
+	SessionManager session.ISessionManager
+}
+
+// NewSessionController creates a new instance of SessionController
+func NewSessionController(
+	dbClient repository.IUsersRepository,
+	jwt jwt.IJwtService,
+	sessionManager session.ISessionManager,
+) ISessionController {
+	return &SessionController{
+		DBClient:       dbClient,
+		JWT:            jwt,
+		SessionManager: sessionManager,
+	}
+}
+
+// GetSessions lists the active sessions of the authenticated user
+func (s *SessionController) GetSessions(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	sessions := s.SessionManager.GetActiveSessions(ctx, user.Email)
+	RespondWithSuccess(c, http.StatusOK, "Active sessions", response.ToSessionResponseList(sessions, getSessionIDFromHeader(c)))
+}
+
+// RevokeSession revokes one of the authenticated user's sessions
+func (s *SessionController) RevokeSession(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	sessionID := c.Param("session_id")
+	sess, err := s.SessionManager.GetSession(ctx, sessionID)
+	if err != nil || sess == nil || sess.Email != user.Email {
+		log.Warnf("Session %s not found for user %s", sessionID, user.Email)
+		RespondWithError(c, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	if err := s.JWT.InvalidateSession(ctx, sessionID); err != nil {
+		log.Error("error while invalidating session", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Session revoked successfully", nil)
+}
+
+// RevokeAllSessions logs the authenticated user out of every device
+func (s *SessionController) RevokeAllSessions(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	user, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	if err := s.JWT.InvalidateAllUserSessions(ctx, user.Email); err != nil {
+		log.Error("error while invalidating sessions", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Logged out from all sessions", nil)
+}
+
+// GetUserSessions lists the active sessions of any user (admin only)
+func (s *SessionController) GetUserSessions(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+
+	target, ok := s.getTargetUser(c)
+	if !ok {
+		return
+	}
+
+	sessions := s.SessionManager.GetActiveSessions(ctx, target.Email)
+	RespondWithSuccess(c, http.StatusOK, "Active sessions", response.ToSessionResponseList(sessions, ""))
+}
+
+// RevokeUserSession revokes a single session of any user (admin only)
+func (s *SessionController) RevokeUserSession(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	target, ok := s.getTargetUser(c)
+	if !ok {
+		return
+	}
+
+	sessionID := c.Param("session_id")
+	sess, err := s.SessionManager.GetSession(ctx, sessionID)
+	if err != nil || sess == nil || sess.Email != target.Email {
+		log.Warnf("Session %s not found for user %d", sessionID, target.Id)
+		RespondWithError(c, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	if err := s.JWT.InvalidateSession(ctx, sessionID); err != nil {
+		log.Error("error while invalidating session", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	log.Infof("Session %s of user %d revoked by admin", sessionID, target.Id)
+	RespondWithSuccess(c, http.StatusOK, "Session revoked successfully", nil)
+}
+
+// RevokeAllUserSessions revokes every session of any user (admin only)
+func (s *SessionController) RevokeAllUserSessions(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	target, ok := s.getTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := s.JWT.InvalidateAllUserSessions(ctx, target.Email); err != nil {
+		log.Error("error while invalidating sessions", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	log.Infof("All sessions of user %d revoked by admin", target.Id)
+	RespondWithSuccess(c, http.StatusOK, "All sessions revoked successfully", nil)
+}
+
+// getTargetUser resolves the user referenced by the :id route parameter
+func (s *SessionController) getTargetUser(c *gin.Context) (*dto.User, bool) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Errorf("Invalid user ID: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return nil, false
+	}
+
+	user, err := s.DBClient.GetUser(ctx, spec.ByID(id))
+	if err != nil {
+		log.Errorf("User not found: %v", err)
+		RespondWithError(c, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,532 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/api/middleware/jwt"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/dto/response"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/mfa"
+	"eduanalytics/internal/app/service/oidc"
+	"eduanalytics/internal/app/service/util"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+const defaultSsoScopes = "openid email profile"
+
+var (
+	errSsoEmailMissing    = errors.New("id token has no email")
+	errSsoEmailUnverified = errors.New("email is not verified by the identity provider")
+	errSsoOtherSchool     = errors.New("account belongs to another school")
+)
+
+// ISsoController represents the interface for SsoController
+type ISsoController interface {
+	StartSso(c *gin.Context)
+	SsoCallback(c *gin.Context)
+	GetIdentityProvider(c *gin.Context)
+	SaveIdentityProvider(c *gin.Context)
+	DeleteIdentityProvider(c *gin.Context)
+}
+
+// SsoController signs users in through the OpenID Connect provider of their school with the
+// authorization code flow and PKCE, provisioning unknown users on their first login
+type SsoController struct {
+	DBClient    repository.IUsersRepository
+	Schools     repository.ISchoolsRepository
+	Providers   repository.IIdentityProvidersRepository
+	TokensRepo  repository.IUserTokensRepository
+	JWT         jwt.IJwtService
+	Mfa         mfa.IMfaService
+	OIDC        oidc.IClient
+	States      oidc.IStateStore
+	Events      events.IEventsController
+	RedirectURI string
+}
+
+// NewSsoController creates a new instance of SsoController
+func NewSsoController(
+	dbClient repository.IUsersRepository,
+	schools repository.ISchoolsRepository,
+	providers repository.IIdentityProvidersRepository,
+	tokensRepo repository.IUserTokensRepository,
+	jwtService jwt.IJwtService,
+	mfaService mfa.IMfaService,
+	oidcClient oidc.IClient,
+	states oidc.IStateStore,
+	eventsController events.IEventsController,
+	redirectURI string,
+) ISsoController {
+	return &SsoController{
+		DBClient:    dbClient,
+		Schools:     schools,
+		Providers:   providers,
+		TokensRepo:  tokensRepo,
+		JWT:         jwtService,
+		Mfa:         mfaService,
+		OIDC:        oidcClient,
+		States:      states,
+		Events:      eventsController,
+		RedirectURI: redirectURI,
+	}
+}
+
+// StartSso redirects to the identity provider of the school. An optional login_hint is passed
+// on to the provider.
+func (s *SsoController) StartSso(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	schoolId, err := strconv.Atoi(c.Param("school_id"))
+	if err != nil {
+		RespondWithError(c, http.StatusBadRequest, "Invalid school ID")
+		return
+	}
+
+	provider, err := s.Providers.GetProviderBySchool(ctx, schoolId)
+	if err != nil || !provider.Enabled {
+		log.Warnf("SSO requested for school %d without an enabled provider: %v", schoolId, err)
+		RespondWithError(c, http.StatusNotFound, "Single sign-on is not configured for this school")
+		return
+	}
+
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		log.Error("error while generating code verifier", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		log.Error("error while generating nonce", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	state, err := s.States.Save(ctx, &oidc.AuthRequest{
+		ProviderID:   provider.Id,
+		SchoolID:     provider.SchoolId,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+	})
+	if err != nil {
+		log.Error("error while saving sso state", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	authURL, err := s.OIDC.AuthCodeURL(ctx, s.providerConfig(provider), state, nonce, oidc.CodeChallengeS256(verifier))
+	if err != nil {
+		log.Errorf("Discovery of identity provider of school %d failed: %v", schoolId, err)
+		RespondWithError(c, http.StatusBadGateway, "Identity provider is unavailable")
+		return
+	}
+	if hint := c.Query("login_hint"); hint != "" {
+		authURL += "&login_hint=" + url.QueryEscape(hint)
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// SsoCallback completes the login: it redeems the code with the PKCE verifier, verifies the ID
+// token and issues our tokens for the linked or newly provisioned user. The provider only
+// replaces the password: a user with a second factor, or whose role requires one, gets the MFA
+// challenge of the password login instead and finishes with /auth/login/mfa. Whatever the
+// provider asserts in amr is not trusted as a second factor.
+func (s *SsoController) SsoCallback(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	authRequest, ok := s.States.Take(ctx, c.Query("state"))
+	if !ok {
+		RespondWithError(c, http.StatusBadRequest, "Invalid or expired SSO state")
+		return
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		log.Warnf("Identity provider %d returned %s: %s", authRequest.ProviderID, providerError, c.Query("error_description"))
+		RespondWithError(c, http.StatusUnauthorized, "Single sign-on was not completed")
+		return
+	}
+
+	provider, err := s.Providers.GetProvider(ctx, authRequest.ProviderID)
+	if err != nil || !provider.Enabled {
+		RespondWithError(c, http.StatusNotFound, "Single sign-on is not configured for this school")
+		return
+	}
+
+	cfg := s.providerConfig(provider)
+	token, err := s.OIDC.Exchange(ctx, cfg, c.Query("code"), authRequest.CodeVerifier)
+	if err != nil {
+		log.Errorf("Code exchange with identity provider %d failed: %v", provider.Id, err)
+		RespondWithError(c, http.StatusUnauthorized, "Single sign-on failed")
+		return
+	}
+
+	claims, err := s.OIDC.VerifyIDToken(ctx, cfg, token.IDToken, authRequest.Nonce)
+	if err != nil {
+		log.Errorf("ID token of identity provider %d rejected: %v", provider.Id, err)
+		RespondWithError(c, http.StatusUnauthorized, "Single sign-on failed")
+		return
+	}
+
+	user, identity, err := s.resolveUser(ctx, provider, claims)
+	switch {
+	case errors.Is(err, errSsoEmailMissing), errors.Is(err, errSsoEmailUnverified), errors.Is(err, errSsoOtherSchool):
+		log.Warnf("SSO login through provider %d rejected: %v", provider.Id, err)
+		RespondWithError(c, http.StatusForbidden, "Cannot sign in: "+err.Error())
+		return
+	case err != nil:
+		log.Error("error while resolving sso user", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	if err := s.Providers.TouchIdentity(ctx, identity.Id); err != nil {
+		log.Warnf("Failed to record sso login of identity %d: %v", identity.Id, err)
+	}
+
+	if user.DeactivatedAt != nil {
+		log.Warnf("SSO login of deactivated user %d rejected", user.Id)
+		RespondWithError(c, http.StatusForbidden, "Account is deactivated")
+		return
+	}
+
+	challenge, err := issueMfaChallenge(ctx, s.Mfa, s.TokensRepo, user)
+	if err != nil {
+		log.Error("error while checking mfa", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	if challenge != nil {
+		RespondWithSuccess(c, http.StatusOK, "MFA required", challenge)
+		return
+	}
+
+	tokens, err := s.JWT.CreateNewTokens(ctx, user, c.Request.UserAgent(), c.ClientIP())
+	if errors.Is(err, jwt.ErrUserDeactivated) {
+		log.Warnf("SSO login of deactivated user %d rejected", user.Id)
+		RespondWithError(c, http.StatusForbidden, "Account is deactivated")
+		return
+	}
+	if err != nil {
+		log.Error("error while creating new tokens", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	s.Events.PublishEvent(dto.Event{
+		EventName: constants.EVENT_SSO_LOGIN,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    user.Id,
+		Metadata: map[string]interface{}{
+			"school_id":   user.SchoolId,
+			"provider_id": provider.Id,
+			"ip_address":  c.ClientIP(),
+		},
+	})
+
+	RespondWithSuccess(c, http.StatusOK, "Login Successfully", tokens)
+}
+
+// resolveUser finds the user of the ID token. A known subject logs in its linked user, an
+// unknown one is linked to the school's user with the same email when the provider verified
+// it, otherwise a new user is provisioned. The role follows the provider's role claim.
+func (s *SsoController) resolveUser(ctx context.Context, provider *dto.IdentityProvider, claims map[string]interface{}) (*dto.User, *dto.UserIdentity, error) {
+	log := logger.Logger(ctx)
+
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	emailVerified, _ := claims["email_verified"].(bool)
+	role, mapped := mapSsoRole(provider, claims)
+
+	identity, err := s.Providers.GetIdentity(ctx, provider.Id, subject)
+	if err == nil {
+		user, err := s.DBClient.GetUser(ctx, spec.ByID(identity.UserId))
+		if err != nil {
+			return nil, nil, err
+		}
+		if user.SchoolId != provider.SchoolId {
+			return nil, nil, errSsoOtherSchool
+		}
+		return s.syncRole(ctx, user, role, mapped), identity, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return nil, nil, err
+	}
+
+	if email == "" {
+		return nil, nil, errSsoEmailMissing
+	}
+
+	identity = &dto.UserIdentity{ProviderId: provider.Id, Subject: subject, Email: email}
+
+	user, err := s.DBClient.GetUserByEmail(ctx, email)
+	if err == nil {
+		// Linking trusts the provider's email, a provider that did not verify it could take over
+		// a local account
+		if user.SchoolId != provider.SchoolId {
+			return nil, nil, errSsoOtherSchool
+		}
+		if !emailVerified {
+			return nil, nil, errSsoEmailUnverified
+		}
+		identity.UserId = user.Id
+		if err := s.Providers.LinkIdentity(ctx, identity); err != nil {
+			return nil, nil, err
+		}
+		if !user.EmailVerified {
+			if err := s.DBClient.MarkEmailVerified(ctx, user.Id); err != nil {
+				return nil, nil, err
+			}
+			user.EmailVerified = true
+		}
+		log.Infof("Linked user %d to subject %s of identity provider %d", user.Id, subject, provider.Id)
+		return s.syncRole(ctx, user, role, mapped), identity, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return nil, nil, err
+	}
+
+	// The password is random and unknown, the user signs in through SSO or resets it
+	password, err := util.GenerateToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	hashedPassword, err := util.GenerateHash(password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name, _ := claims["name"].(string)
+	if name == "" {
+		name = email
+	}
+
+	user = &dto.User{
+		Name:          name,
+		Email:         email,
+		Password:      hashedPassword,
+		Role:          role,
+		SchoolId:      provider.SchoolId,
+		EmailVerified: emailVerified,
+	}
+	if err := s.Providers.ProvisionUser(ctx, user, identity); err != nil {
+		return nil, nil, err
+	}
+	log.Infof("Provisioned user %d with role %s from identity provider %d", user.Id, role, provider.Id)
+	return user, identity, nil
+}
+
+// syncRole applies a role the provider asserts through the role claim and ends the sessions
+// issued for the previous role. Users without a mapped claim keep their role.
+func (s *SsoController) syncRole(ctx context.Context, user *dto.User, role string, mapped bool) *dto.User {
+	log := logger.Logger(ctx)
+
+	if !mapped || role == user.Role {
+		return user
+	}
+
+	if err := s.DBClient.UpdateRole(ctx, user.Id, role); err != nil {
+		log.Errorf("Failed to update role of user %d to %s: %v", user.Id, role, err)
+		return user
+	}
+	if err := s.JWT.InvalidateAllUserSessions(ctx, user.Email); err != nil {
+		log.Warnf("Failed to invalidate sessions of user %d: %v", user.Id, err)
+	}
+
+	log.Infof("Role of user %d changed from %s to %s by identity provider", user.Id, user.Role, role)
+	user.Role = role
+	return user
+}
+
+// GetIdentityProvider returns the SSO settings of a school
+func (s *SsoController) GetIdentityProvider(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	schoolId, ok := s.schoolParam(c)
+	if !ok {
+		return
+	}
+
+	provider, err := s.Providers.GetProviderBySchool(ctx, schoolId)
+	if gorm.IsRecordNotFoundError(err) {
+		RespondWithError(c, http.StatusNotFound, "Single sign-on is not configured for this school")
+		return
+	}
+	if err != nil {
+		log.Error("error while fetching identity provider", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Identity provider", response.ToIdentityProviderResponse(provider))
+}
+
+// SaveIdentityProvider configures the identity provider of a school, the client secret may be
+// omitted to keep the stored one
+func (s *SsoController) SaveIdentityProvider(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	schoolId, ok := s.schoolParam(c)
+	if !ok {
+		return
+	}
+
+	var req request.IdentityProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if _, err := s.Schools.GetSchool(ctx, spec.ByID(schoolId)); err != nil {
+		RespondWithError(c, http.StatusNotFound, "School not found")
+		return
+	}
+
+	clientSecret := req.ClientSecret
+	if clientSecret == "" {
+		existing, err := s.Providers.GetProviderBySchool(ctx, schoolId)
+		if err != nil {
+			RespondWithError(c, http.StatusBadRequest, "client_secret is required")
+			return
+		}
+		clientSecret = existing.ClientSecret
+	}
+
+	roleMapping, err := json.Marshal(req.RoleMapping)
+	if err != nil || req.RoleMapping == nil {
+		roleMapping = []byte("{}")
+	}
+
+	provider := &dto.IdentityProvider{
+		SchoolId:     schoolId,
+		Issuer:       strings.TrimSuffix(req.Issuer, "/"),
+		ClientId:     req.ClientId,
+		ClientSecret: clientSecret,
+		Scopes:       strings.Join(req.Scopes, " "),
+		RoleClaim:    req.RoleClaim,
+		RoleMapping:  string(roleMapping),
+		DefaultRole:  req.DefaultRole,
+		Enabled:      req.Enabled == nil || *req.Enabled,
+	}
+	if provider.Scopes == "" {
+		provider.Scopes = defaultSsoScopes
+	} else if !strings.Contains(" "+provider.Scopes+" ", " openid ") {
+		provider.Scopes = "openid " + provider.Scopes
+	}
+	if provider.RoleClaim == "" {
+		provider.RoleClaim = "roles"
+	}
+	if provider.DefaultRole == "" {
+		provider.DefaultRole = constants.ROLE_STUDENT
+	}
+
+	if err := s.Providers.SaveProvider(ctx, provider); err != nil {
+		log.Error("error while saving identity provider", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	log.Infof("Identity provider %s configured for school %d", provider.Issuer, schoolId)
+	RespondWithSuccess(c, http.StatusOK, "Identity provider saved", response.ToIdentityProviderResponse(provider))
+}
+
+// DeleteIdentityProvider removes the SSO settings and the linked identities of a school, its
+// users keep their accounts
+func (s *SsoController) DeleteIdentityProvider(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	schoolId, ok := s.schoolParam(c)
+	if !ok {
+		return
+	}
+
+	if err := s.Providers.DeleteProvider(ctx, schoolId); err != nil {
+		log.Error("error while deleting identity provider", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "Identity provider deleted", nil)
+}
+
+// schoolParam parses the school of the route; admins can only manage their own school
+func (s *SsoController) schoolParam(c *gin.Context) (int, bool) {
+	admin, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return 0, false
+	}
+
+	schoolId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		RespondWithError(c, http.StatusBadRequest, "Invalid school ID")
+		return 0, false
+	}
+	if schoolId != admin.SchoolId {
+		RespondWithError(c, http.StatusForbidden, "Access denied")
+		return 0, false
+	}
+	return schoolId, true
+}
+
+func (s *SsoController) providerConfig(provider *dto.IdentityProvider) oidc.ProviderConfig {
+	return oidc.ProviderConfig{
+		Issuer:       provider.Issuer,
+		ClientID:     provider.ClientId,
+		ClientSecret: provider.ClientSecret,
+		RedirectURI:  s.RedirectURI,
+		Scopes:       strings.Fields(provider.Scopes),
+	}
+}
+
+// mapSsoRole maps the values of the provider's role claim, a string or a list, to our roles.
+// The most privileged match wins; without a match the provider's default role is used.
+func mapSsoRole(provider *dto.IdentityProvider, claims map[string]interface{}) (string, bool) {
+	mapping := map[string]string{}
+	_ = json.Unmarshal([]byte(provider.RoleMapping), &mapping)
+
+	var values []string
+	switch claim := claims[provider.RoleClaim].(type) {
+	case string:
+		values = strings.Fields(claim)
+	case []interface{}:
+		for _, value := range claim {
+			if value, ok := value.(string); ok {
+				values = append(values, value)
+			}
+		}
+	}
+
+	rank := map[string]int{constants.ROLE_STUDENT: 1, constants.ROLE_TEACHER: 2, constants.ROLE_ADMIN: 3}
+	role := ""
+	for _, value := range values {
+		if mappedRole, exists := mapping[value]; exists && rank[mappedRole] > rank[role] {
+			role = mappedRole
+		}
+	}
+
+	if role == "" {
+		return provider.DefaultRole, false
+	}
+	return role, true
+}
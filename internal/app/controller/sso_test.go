@@ -0,0 +1,359 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/api/middleware/jwt"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/mfa"
+	"eduanalytics/internal/app/service/oidc"
+	"eduanalytics/internal/app/service/oidc/mockidp"
+	"eduanalytics/internal/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+const ssoCallbackPath = "/api/v1/auth/sso/callback"
+
+// fakeSsoUsers keeps the users of the SSO tests in memory
+type fakeSsoUsers struct {
+	repository.IUsersRepository
+	users map[int]*dto.User
+}
+
+func (f *fakeSsoUsers) GetUser(ctx context.Context, s *spec.Spec) (*dto.User, error) {
+	if user, ok := f.users[s.Conditions[0].Value.(int)]; ok {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeSsoUsers) GetUserByEmail(ctx context.Context, email string) (*dto.User, error) {
+	for _, user := range f.users {
+		if strings.EqualFold(user.Email, email) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeSsoUsers) MarkEmailVerified(ctx context.Context, id int) error {
+	f.users[id].EmailVerified = true
+	return nil
+}
+
+func (f *fakeSsoUsers) UpdateRole(ctx context.Context, id int, role string) error {
+	f.users[id].Role = role
+	return nil
+}
+
+// fakeSsoProviders is the identity provider of school 1 with the identities linked to it
+type fakeSsoProviders struct {
+	repository.IIdentityProvidersRepository
+	provider   *dto.IdentityProvider
+	users      *fakeSsoUsers
+	identities map[string]*dto.UserIdentity
+}
+
+func (f *fakeSsoProviders) GetProvider(ctx context.Context, id int) (*dto.IdentityProvider, error) {
+	return f.provider, nil
+}
+
+func (f *fakeSsoProviders) GetProviderBySchool(ctx context.Context, schoolId int) (*dto.IdentityProvider, error) {
+	if schoolId != f.provider.SchoolId {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return f.provider, nil
+}
+
+func (f *fakeSsoProviders) GetIdentity(ctx context.Context, providerId int, subject string) (*dto.UserIdentity, error) {
+	if identity, ok := f.identities[subject]; ok {
+		return identity, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeSsoProviders) LinkIdentity(ctx context.Context, identity *dto.UserIdentity) error {
+	identity.Id = len(f.identities) + 1
+	f.identities[identity.Subject] = identity
+	return nil
+}
+
+func (f *fakeSsoProviders) ProvisionUser(ctx context.Context, user *dto.User, identity *dto.UserIdentity) error {
+	user.Id = len(f.users.users) + 100
+	f.users.users[user.Id] = user
+	identity.UserId = user.Id
+	return f.LinkIdentity(ctx, identity)
+}
+
+func (f *fakeSsoProviders) TouchIdentity(ctx context.Context, id int) error {
+	return nil
+}
+
+// fakeSsoJwt issues tokens naming the user they were issued for
+type fakeSsoJwt struct {
+	jwt.IJwtService
+	invalidated []string
+}
+
+func (f *fakeSsoJwt) CreateNewTokens(ctx context.Context, user *dto.User, userAgent, ipAddress string) (*jwt.TokenDetails, error) {
+	return &jwt.TokenDetails{AccessToken: "access-" + user.Email, SessionID: "session-1"}, nil
+}
+
+func (f *fakeSsoJwt) InvalidateAllUserSessions(ctx context.Context, email string) error {
+	f.invalidated = append(f.invalidated, email)
+	return nil
+}
+
+// fakeSsoMfa requires a second factor of the roles in required
+type fakeSsoMfa struct {
+	mfa.IMfaService
+	required map[string]bool
+}
+
+func (f *fakeSsoMfa) GetStatus(ctx context.Context, user *dto.User) (*mfa.Status, error) {
+	return &mfa.Status{Required: f.required[user.Role]}, nil
+}
+
+type fakeSsoTokens struct {
+	repository.IUserTokensRepository
+	created []dto.UserToken
+}
+
+func (f *fakeSsoTokens) CreateToken(ctx context.Context, token *dto.UserToken) error {
+	f.created = append(f.created, *token)
+	return nil
+}
+
+type fakeEvents struct {
+	events.IEventsController
+	published []dto.Event
+}
+
+func (f *fakeEvents) PublishEvent(e dto.Event) {
+	f.published = append(f.published, e)
+}
+
+// ssoTest is an SsoController of school 1 signing in through a mock provider
+type ssoTest struct {
+	router    *gin.Engine
+	users     *fakeSsoUsers
+	providers *fakeSsoProviders
+	jwt       *fakeSsoJwt
+	mfa       *fakeSsoMfa
+	tokens    *fakeSsoTokens
+	events    *fakeEvents
+}
+
+func newSsoTest(t *testing.T, idpUsers []mockidp.User, users ...*dto.User) *ssoTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logger.SugarLogger = zap.NewNop().Sugar()
+	constants.Config = &config.ServiceConfig{AuthConfig: config.AuthConfig{AUTH_MFA_CHALLENGE_EXP: 5}}
+
+	var handler http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	idp, err := mockidp.New(mockidp.Config{Issuer: server.URL, ClientID: "eduanalytics", ClientSecret: "secret", Users: idpUsers})
+	if err != nil {
+		t.Fatalf("mockidp.New: %v", err)
+	}
+	handler = idp.Handler()
+
+	st := &ssoTest{
+		users:  &fakeSsoUsers{users: map[int]*dto.User{}},
+		jwt:    &fakeSsoJwt{},
+		mfa:    &fakeSsoMfa{required: map[string]bool{}},
+		tokens: &fakeSsoTokens{},
+		events: &fakeEvents{},
+	}
+	for _, user := range users {
+		st.users.users[user.Id] = user
+	}
+	st.providers = &fakeSsoProviders{
+		provider: &dto.IdentityProvider{
+			Id:           1,
+			SchoolId:     1,
+			Issuer:       server.URL,
+			ClientId:     "eduanalytics",
+			ClientSecret: "secret",
+			Scopes:       defaultSsoScopes,
+			RoleClaim:    "roles",
+			RoleMapping:  `{"Faculty": "teacher", "Pupil": "student", "Principal": "admin"}`,
+			DefaultRole:  constants.ROLE_STUDENT,
+			Enabled:      true,
+		},
+		users:      st.users,
+		identities: map[string]*dto.UserIdentity{},
+	}
+
+	ctrl := NewSsoController(st.users, nil, st.providers, st.tokens, st.jwt, st.mfa, oidc.NewClient(5*time.Second),
+		oidc.NewStateStore(time.Minute), st.events, "http://localhost"+ssoCallbackPath)
+	st.router = gin.New()
+	st.router.GET("/api/v1/auth/sso/:school_id", ctrl.StartSso)
+	st.router.GET(ssoCallbackPath, ctrl.SsoCallback)
+	return st
+}
+
+// login signs in through the mock provider as the account with the email
+func (st *ssoTest) login(t *testing.T, email string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	start := httptest.NewRecorder()
+	st.router.ServeHTTP(start, httptest.NewRequest(http.MethodGet, "/api/v1/auth/sso/1?login_hint="+url.QueryEscape(email), nil))
+	if start.Code != http.StatusFound {
+		t.Fatalf("StartSso returned %d: %s", start.Code, start.Body)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d", resp.StatusCode)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	st.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil))
+	return rec
+}
+
+func TestSsoProvisionsUserWithMappedRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		roles    []string
+		wantRole string
+	}{
+		{name: "mapped role", roles: []string{"Faculty"}, wantRole: constants.ROLE_TEACHER},
+		{name: "most privileged mapped role", roles: []string{"Pupil", "Faculty"}, wantRole: constants.ROLE_TEACHER},
+		{name: "unmapped roles only", roles: []string{"Guardian"}, wantRole: constants.ROLE_STUDENT},
+		{name: "no role claim", wantRole: constants.ROLE_STUDENT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newSsoTest(t, []mockidp.User{
+				{Subject: "idp-42", Email: "new.user@example.com", EmailVerified: true, Name: "New User", Roles: tt.roles},
+			})
+
+			rec := st.login(t, "new.user@example.com")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("SsoCallback returned %d: %s", rec.Code, rec.Body)
+			}
+
+			user, err := st.users.GetUserByEmail(context.Background(), "new.user@example.com")
+			if err != nil {
+				t.Fatalf("user was not provisioned: %v", err)
+			}
+			if user.Role != tt.wantRole || user.SchoolId != 1 || user.Name != "New User" || !user.EmailVerified {
+				t.Errorf("provisioned user = %+v, want a verified %s of school 1", user, tt.wantRole)
+			}
+			if identity := st.providers.identities["idp-42"]; identity == nil || identity.UserId != user.Id {
+				t.Errorf("identity = %+v, want linked to user %d", identity, user.Id)
+			}
+			if len(st.events.published) != 1 || st.events.published[0].EventName != constants.EVENT_SSO_LOGIN {
+				t.Errorf("published events = %+v, want one sso login", st.events.published)
+			}
+		})
+	}
+}
+
+func TestSsoLinksExistingUser(t *testing.T) {
+	existing := &dto.User{Id: 7, Name: "Ada Lovelace", Email: "ada@example.com", Role: constants.ROLE_STUDENT, SchoolId: 1}
+
+	st := newSsoTest(t, []mockidp.User{
+		{Subject: "idp-7", Email: "ada@example.com", EmailVerified: true, Name: "Ada Lovelace", Roles: []string{"Faculty"}},
+	}, existing)
+
+	rec := st.login(t, "ada@example.com")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SsoCallback returned %d: %s", rec.Code, rec.Body)
+	}
+
+	// The provider's role claim wins and the sessions of the old role end
+	if user := st.users.users[7]; user.Role != constants.ROLE_TEACHER || !user.EmailVerified {
+		t.Errorf("linked user = %+v, want a verified teacher", user)
+	}
+	if identity := st.providers.identities["idp-7"]; identity == nil || identity.UserId != 7 {
+		t.Errorf("identity = %+v, want linked to user 7", identity)
+	}
+	if len(st.jwt.invalidated) != 1 || st.jwt.invalidated[0] != "ada@example.com" {
+		t.Errorf("invalidated sessions = %v", st.jwt.invalidated)
+	}
+}
+
+func TestSsoRejectsUnverifiedEmailOfExistingUser(t *testing.T) {
+	existing := &dto.User{Id: 7, Name: "Ada Lovelace", Email: "ada@example.com", Role: constants.ROLE_ADMIN, SchoolId: 1}
+
+	st := newSsoTest(t, []mockidp.User{
+		{Subject: "idp-7", Email: "ada@example.com", EmailVerified: false, Name: "Ada Lovelace"},
+	}, existing)
+
+	if rec := st.login(t, "ada@example.com"); rec.Code != http.StatusForbidden {
+		t.Errorf("SsoCallback returned %d, want 403", rec.Code)
+	}
+	if len(st.providers.identities) != 0 {
+		t.Errorf("identities = %v, want none linked", st.providers.identities)
+	}
+}
+
+// The provider replaces the password only, a role that requires MFA still gets the challenge
+func TestSsoRequiresMfaOfRole(t *testing.T) {
+	existing := &dto.User{Id: 7, Name: "Mary Jackson", Email: "mary@example.com", Role: constants.ROLE_ADMIN, SchoolId: 1, EmailVerified: true}
+
+	st := newSsoTest(t, []mockidp.User{
+		{Subject: "idp-7", Email: "mary@example.com", EmailVerified: true, Name: "Mary Jackson", Roles: []string{"Principal"}},
+	}, existing)
+	st.mfa.required[constants.ROLE_ADMIN] = true
+
+	rec := st.login(t, "mary@example.com")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("SsoCallback returned %d: %s", rec.Code, rec.Body)
+	}
+
+	var body struct {
+		Data struct {
+			MfaRequired        bool   `json:"mfa_required"`
+			MfaToken           string `json:"mfa_token"`
+			EnrollmentRequired bool   `json:"enrollment_required"`
+			AccessToken        string `json:"access_token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response: %v", err)
+	}
+	if !body.Data.MfaRequired || body.Data.MfaToken == "" || !body.Data.EnrollmentRequired || body.Data.AccessToken != "" {
+		t.Errorf("response = %s, want an MFA challenge without tokens", rec.Body)
+	}
+	if len(st.tokens.created) != 1 || st.tokens.created[0].Purpose != constants.TOKEN_PURPOSE_MFA_CHALLENGE || st.tokens.created[0].UserId != 7 {
+		t.Errorf("created tokens = %+v, want one mfa challenge of user 7", st.tokens.created)
+	}
+	if len(st.events.published) != 0 {
+		t.Errorf("published events = %+v, the login is not complete yet", st.events.published)
+	}
+}
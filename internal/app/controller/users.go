@@ -0,0 +1,493 @@
+package controller
+
+import (
+	"context"
+	"eduanalytics/internal/app/api/middleware/jwt"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/controller/events"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/db/spec"
+	"eduanalytics/internal/app/service/correlation"
+	request "eduanalytics/internal/app/service/dto/request"
+	"eduanalytics/internal/app/service/dto/response"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/loginguard"
+	"eduanalytics/internal/app/service/mailer"
+	"eduanalytics/internal/app/service/util"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// maxUserPageSize caps the page size of the user list
+const maxUserPageSize = 100
+
+// IUserController represents the interface for UserController
+type IUserController interface {
+	CreateUser(c *gin.Context)
+	UnlockUser(c *gin.Context)
+	GetUsers(c *gin.Context)
+	GetUser(c *gin.Context)
+	UpdateUser(c *gin.Context)
+	ChangeUserRole(c *gin.Context)
+	DeactivateUser(c *gin.Context)
+	ReactivateUser(c *gin.Context)
+	DeleteUser(c *gin.Context)
+}
+
+// UserController manages user accounts on behalf of admins
+type UserController struct {
+	DBClient    repository.IUsersRepository
+	SchoolsRepo repository.ISchoolsRepository
+	TokensRepo  repository.IUserTokensRepository
+	JWT         jwt.IJwtService
+	Mailer      mailer.IMailer
+	LoginGuard  loginguard.ILoginGuard
+	Events      events.IEventsController
+}
+
+// NewUserController creates a new instance of UserController
+func NewUserController(
+	dbClient repository.IUsersRepository,
+	schoolsRepo repository.ISchoolsRepository,
+	tokensRepo repository.IUserTokensRepository,
+	jwtService jwt.IJwtService,
+	mailer mailer.IMailer,
+	loginGuard loginguard.ILoginGuard,
+	eventsController events.IEventsController,
+) IUserController {
+	return &UserController{
+		DBClient:    dbClient,
+		SchoolsRepo: schoolsRepo,
+		TokensRepo:  tokensRepo,
+		JWT:         jwtService,
+		Mailer:      mailer,
+		LoginGuard:  loginGuard,
+		Events:      eventsController,
+	}
+}
+
+// CreateUser creates an account with any role, the new user still has to verify the email address
+func (u *UserController) CreateUser(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	var req request.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if err := util.ValidatePasswordPolicy(req.Password); err != nil {
+		RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := u.SchoolsRepo.GetSchool(ctx, spec.ByID(req.SchoolId)); err != nil {
+		log.Errorf("School not found: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "School not found")
+		return
+	}
+
+	if _, err := u.DBClient.GetUserByEmail(ctx, req.Email); err == nil {
+		RespondWithError(c, http.StatusConflict, "Email already registered")
+		return
+	}
+
+	hash, err := util.GenerateHash(req.Password)
+	if err != nil {
+		log.Error("error while generating hash", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	user := dto.User{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: hash,
+		Role:     req.Role,
+		SchoolId: req.SchoolId,
+	}
+	if err := u.DBClient.CreateUser(ctx, &user); errors.Is(err, repository.ErrTenantMismatch) {
+		RespondWithError(c, http.StatusForbidden, "Users can only be created in your own school")
+		return
+	} else if err != nil {
+		log.Error("error while creating user", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+	user.Password = ""
+
+	if err := sendVerificationEmail(ctx, u.TokensRepo, u.Mailer, &user); err != nil {
+		log.Errorf("Failed to send verification email: %v", err)
+	}
+
+	RespondWithSuccess(c, http.StatusCreated, "User Created Successfully", user)
+}
+
+// UnlockUser lifts a login lockout of the user before it expires
+func (u *UserController) UnlockUser(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		log.Errorf("Invalid user ID: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := u.DBClient.GetUser(ctx, spec.ByID(id))
+	if err != nil {
+		log.Errorf("User not found: %v", err)
+		RespondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	u.LoginGuard.Unlock(ctx, user.Email)
+	u.Events.PublishEvent(dto.Event{
+		EventName: constants.EVENT_ACCOUNT_UNLOCKED,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    user.Id,
+		Metadata: map[string]interface{}{
+			"school_id":   user.SchoolId,
+			"unlocked_by": admin.Id,
+		},
+	})
+
+	log.Infof("User %d unlocked by admin %d", user.Id, admin.Id)
+	RespondWithSuccess(c, http.StatusOK, "User unlocked successfully", nil)
+}
+
+// GetUsers returns a page of the users of the admin's school; super admins search every school
+func (u *UserController) GetUsers(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	var query request.UserQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if !validatePage(c, &query.Pagination, maxUserPageSize) {
+		return
+	}
+
+	filter := spec.New().
+		OrderBy(query.Order, !strings.EqualFold(query.Sort, "ASC")).
+		OrderBy("id", false).
+		Paginate(*query.Limit, query.Offset)
+	if query.Query != "" {
+		filter.And("name", spec.ILike, "%"+query.Query+"%")
+	}
+	if query.Email != "" {
+		filter.And("email", spec.ILike, "%"+query.Email+"%")
+	}
+	if query.Role != "" {
+		filter.And("role", spec.Eq, query.Role)
+	}
+	if query.SchoolId != 0 {
+		filter.And("school_id", spec.Eq, query.SchoolId)
+	}
+	switch query.Status {
+	case "active":
+		filter.And("deactivated_at", spec.IsNull, nil)
+	case "deactivated":
+		filter.And("deactivated_at", spec.NotNull, nil).And("anonymized_at", spec.IsNull, nil)
+	case "deleted":
+		filter.And("anonymized_at", spec.NotNull, nil)
+	default:
+		filter.And("anonymized_at", spec.IsNull, nil)
+	}
+
+	users, total, err := u.DBClient.GetUsers(ctx, filter)
+	if errors.Is(err, spec.ErrUnknownField) {
+		RespondWithError(c, http.StatusBadRequest, "Invalid order: "+query.Order)
+		return
+	}
+	if err != nil {
+		log.Error("error while fetching users", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	setTotal(&query.Pagination, total)
+	c.JSON(http.StatusOK, response.ResponseV2{
+		Success: true,
+		Message: "Users",
+		Data:    response.ToUserResponseList(users),
+		Request: query,
+	})
+}
+
+// GetUser returns a user of the admin's school
+func (u *UserController) GetUser(c *gin.Context) {
+	user, ok := u.getSchoolUser(c)
+	if !ok {
+		return
+	}
+
+	RespondWithSuccess(c, http.StatusOK, "User retrieved successfully", response.ToUserResponse(user))
+}
+
+// UpdateUser changes the name and email of a user, a new email address has to be verified again
+func (u *UserController) UpdateUser(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := u.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	user, ok := u.getSchoolUser(c)
+	if !ok {
+		return
+	}
+
+	var req request.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	emailChanged := req.Email != "" && !strings.EqualFold(req.Email, user.Email)
+	if emailChanged {
+		if _, err := u.DBClient.GetUserByEmail(ctx, req.Email); err == nil {
+			RespondWithError(c, http.StatusConflict, "Email already registered")
+			return
+		}
+	}
+
+	if err := u.DBClient.UpdateProfile(ctx, user.Id, req.Name, req.Email); err != nil {
+		u.respondWithUserError(ctx, c, "updating user", err)
+		return
+	}
+
+	updated, err := u.DBClient.GetUser(ctx, spec.ByID(user.Id))
+	if err != nil {
+		log.Error("error while fetching user", err)
+		RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+		return
+	}
+
+	if emailChanged {
+		if err := sendVerificationEmail(ctx, u.TokensRepo, u.Mailer, updated); err != nil {
+			log.Errorf("Failed to send verification email: %v", err)
+		}
+	}
+
+	u.publishUserEvent(constants.EVENT_USER_UPDATED, admin, updated, map[string]interface{}{"email_changed": emailChanged})
+	RespondWithSuccess(c, http.StatusOK, "User updated successfully", response.ToUserResponse(updated))
+}
+
+// ChangeUserRole replaces the base role of a user and signs the user out, so the next token
+// carries the new role
+func (u *UserController) ChangeUserRole(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := u.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	user, ok := u.getSchoolUser(c)
+	if !ok || !u.notSelf(c, admin, user) {
+		return
+	}
+
+	var req request.ChangeUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Errorf("Invalid request: %v", err)
+		RespondWithError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if req.Role == user.Role {
+		RespondWithSuccess(c, http.StatusOK, "User role unchanged", response.ToUserResponse(user))
+		return
+	}
+
+	if err := u.DBClient.UpdateRole(ctx, user.Id, req.Role); err != nil {
+		u.respondWithUserError(ctx, c, "changing user role", err)
+		return
+	}
+	if err := u.JWT.InvalidateAllUserSessions(ctx, user.Email); err != nil {
+		log.Errorf("Failed to revoke sessions of user %d: %v", user.Id, err)
+	}
+
+	previous := user.Role
+	user.Role = req.Role
+	u.publishUserEvent(constants.EVENT_USER_ROLE_CHANGED, admin, user, map[string]interface{}{"previous_role": previous, "role": req.Role})
+	log.Infof("Role of user %d changed from %s to %s by admin %d", user.Id, previous, req.Role, admin.Id)
+	RespondWithSuccess(c, http.StatusOK, "User role changed successfully", response.ToUserResponse(user))
+}
+
+// DeactivateUser stops a user from signing in and revokes the user's sessions; responses and
+// other data of the user are kept
+func (u *UserController) DeactivateUser(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := u.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	user, ok := u.getSchoolUser(c)
+	if !ok || !u.notSelf(c, admin, user) {
+		return
+	}
+
+	if err := u.DBClient.DeactivateUser(ctx, user.Id); err != nil {
+		u.respondWithUserError(ctx, c, "deactivating user", err)
+		return
+	}
+	if err := u.JWT.InvalidateAllUserSessions(ctx, user.Email); err != nil {
+		log.Errorf("Failed to revoke sessions of user %d: %v", user.Id, err)
+	}
+
+	u.publishUserEvent(constants.EVENT_USER_DEACTIVATED, admin, user, nil)
+	log.Infof("User %d deactivated by admin %d", user.Id, admin.Id)
+	RespondWithSuccess(c, http.StatusOK, "User deactivated successfully", nil)
+}
+
+// ReactivateUser lets a deactivated user sign in again
+func (u *UserController) ReactivateUser(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := u.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	user, ok := u.getSchoolUser(c)
+	if !ok {
+		return
+	}
+
+	if err := u.DBClient.ReactivateUser(ctx, user.Id); err != nil {
+		u.respondWithUserError(ctx, c, "reactivating user", err)
+		return
+	}
+
+	u.publishUserEvent(constants.EVENT_USER_REACTIVATED, admin, user, nil)
+	log.Infof("User %d reactivated by admin %d", user.Id, admin.Id)
+	RespondWithSuccess(c, http.StatusOK, "User reactivated successfully", nil)
+}
+
+// DeleteUser erases the name, email, credentials and second factors of a user. The anonymized
+// user stays referenced by its responses, so reports keep their totals.
+func (u *UserController) DeleteUser(c *gin.Context) {
+	ctx := correlation.WithReqContext(c)
+	log := logger.Logger(ctx)
+
+	admin, ok := u.adminClaims(c)
+	if !ok {
+		return
+	}
+
+	user, ok := u.getSchoolUser(c)
+	if !ok || !u.notSelf(c, admin, user) {
+		return
+	}
+
+	if err := u.DBClient.DeleteUser(ctx, user.Id); err != nil {
+		u.respondWithUserError(ctx, c, "deleting user", err)
+		return
+	}
+	if err := u.JWT.InvalidateAllUserSessions(ctx, user.Email); err != nil {
+		log.Errorf("Failed to revoke sessions of user %d: %v", user.Id, err)
+	}
+	u.LoginGuard.Unlock(ctx, user.Email)
+
+	u.publishUserEvent(constants.EVENT_USER_DELETED, admin, user, nil)
+	log.Infof("User %d deleted and anonymized by admin %d", user.Id, admin.Id)
+	RespondWithSuccess(c, http.StatusOK, "User deleted successfully", nil)
+}
+
+// getSchoolUser resolves the user of the :id route parameter. Users of other schools and deleted
+// users are not found.
+func (u *UserController) getSchoolUser(c *gin.Context) (*dto.User, bool) {
+	ctx := correlation.WithReqContext(c)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		RespondWithError(c, http.StatusBadRequest, "Invalid user ID")
+		return nil, false
+	}
+
+	user, err := u.DBClient.GetUser(ctx, spec.ByID(id).And("anonymized_at", spec.IsNull, nil))
+	if err != nil {
+		RespondWithError(c, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// notSelf answers the request if the admin targets their own account, so an admin cannot lock
+// themselves out
+func (u *UserController) notSelf(c *gin.Context, admin, user *dto.User) bool {
+	if admin.Id == user.Id {
+		RespondWithError(c, http.StatusBadRequest, "Admins cannot change the role of, deactivate or delete their own account")
+		return false
+	}
+	return true
+}
+
+// adminClaims returns the admin of the request; accounts are managed by people, not by API keys
+func (u *UserController) adminClaims(c *gin.Context) (*dto.User, bool) {
+	if _, isApiKey := getApiKey(c); isApiKey {
+		RespondWithError(c, http.StatusForbidden, "API keys cannot manage users")
+		return nil, false
+	}
+
+	admin, ok := getUserClaims(c)
+	if !ok {
+		RespondWithError(c, http.StatusUnauthorized, "Invalid user claims")
+		return nil, false
+	}
+	return admin, true
+}
+
+// respondWithUserError maps an error of a user change to the response
+func (u *UserController) respondWithUserError(ctx context.Context, c *gin.Context, action string, err error) {
+	log := logger.Logger(ctx)
+
+	if gorm.IsRecordNotFoundError(err) {
+		RespondWithError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	log.Errorf("error while %s: %v", action, err)
+	RespondWithError(c, http.StatusInternalServerError, constants.InternalServerError)
+}
+
+func (u *UserController) publishUserEvent(eventName string, admin, user *dto.User, metadata map[string]interface{}) {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["school_id"] = user.SchoolId
+	metadata["target_user_id"] = user.Id
+
+	u.Events.PublishEvent(dto.Event{
+		EventName: eventName,
+		App:       constants.EVENT_APP_AUTH,
+		UserId:    admin.Id,
+		Metadata:  metadata,
+	})
+}
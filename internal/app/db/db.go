@@ -19,11 +19,6 @@ func Init(ctx context.Context) (db *gorm.DB, err error) {
 	log := logger.Logger(ctx)
 
 	// Get database configuration parameters from constants
-	dbUserName := constants.Config.DatabaseConfig.DB_USER
-	dbPassword := constants.Config.DatabaseConfig.DB_PASSWORD
-	dbHost := constants.Config.DatabaseConfig.DB_HOST
-	dbName := constants.Config.DatabaseConfig.DB_NAME
-	dbPort := constants.Config.DatabaseConfig.DB_PORT
 	dbSchema := constants.Config.DatabaseConfig.DB_SCHEMA
 
 	// Get additional database connection configuration parameters from constants
@@ -32,8 +27,7 @@ func Init(ctx context.Context) (db *gorm.DB, err error) {
 	connectionMaxLifetime := constants.Config.DatabaseConfig.DB_CONNECTION_MAX_LIFETIME
 
 	// Construct the database URI
-	dbURI := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUserName, dbPassword, dbName)
+	dbURI := DSN()
 
 	log.Info("Connecting to DB", dbURI)
 
@@ -112,6 +106,13 @@ func Init(ctx context.Context) (db *gorm.DB, err error) {
 	return
 }
 
+// DSN returns the connection string of the configured database
+func DSN() string {
+	dbConfig := constants.Config.DatabaseConfig
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		dbConfig.DB_HOST, dbConfig.DB_PORT, dbConfig.DB_USER, dbConfig.DB_PASSWORD, dbConfig.DB_NAME)
+}
+
 func New(dbConn *gorm.DB) *DBService {
 	return &DBService{
 		DB: dbConn,
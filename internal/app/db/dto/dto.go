@@ -1,6 +1,9 @@
 package dto
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -10,39 +13,243 @@ const (
 	CLASSROOM_TABLE         = "classrooms"
 	STUDENT_CLASSROOM_TABLE = "student_classrooms"
 	QUIZ_TABLE              = "quizzes"
+	QUESTION_TABLE          = "questions"
 	EVENT_TABLE             = "events"
 	RESPONSE_TABLE          = "responses"
+	USER_TOKEN_TABLE        = "user_tokens"
+	USER_MFA_TABLE          = "user_mfa"
+	MFA_RECOVERY_CODE_TABLE = "user_mfa_recovery_codes"
+	MFA_REQUIREMENT_TABLE   = "mfa_role_requirements"
+	IDENTITY_PROVIDER_TABLE = "school_identity_providers"
+	USER_IDENTITY_TABLE     = "user_identities"
+	API_KEY_TABLE           = "api_keys"
+	CASBIN_RULE_TABLE       = "casbin_rules"
+	ROLE_TABLE              = "roles"
+	USER_ROLE_TABLE         = "user_roles"
+	AUDIT_LOG_TABLE         = "audit_log"
+	IMPORT_JOB_TABLE        = "import_jobs"
+	SOURCED_ID_TABLE        = "oneroster_sourced_ids"
+	CLASSROOM_MEMBER_TABLE  = "classroom_members"
 )
 
 type User struct {
-	Id        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password,omitempty"`
+	Id              int        `json:"id"`
+	Name            string     `json:"name"`
+	Email           string     `json:"email"`
+	Password        string     `json:"password,omitempty"`
+	Role            string     `json:"role"`
+	SchoolId        int        `json:"school_id"`
+	EmailVerified   bool       `json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// DeactivatedAt is set while the user cannot sign in, AnonymizedAt once the personal data
+	// of a deleted user was erased
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+	AnonymizedAt  *time.Time `json:"anonymized_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+	// Roles are the assigned roles the user is authorized with, Role is the base role
+	Roles []string `json:"roles,omitempty" gorm:"-"`
+}
+
+type UserToken struct {
+	Id        int        `json:"id"`
+	UserId    int        `json:"user_id"`
+	Purpose   string     `json:"purpose"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type UserMfa struct {
+	UserId       int        `json:"user_id"`
+	Secret       string     `json:"-"`
+	Enabled      bool       `json:"enabled"`
+	LastUsedStep int64      `json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type MfaRecoveryCode struct {
+	Id        int        `json:"id"`
+	UserId    int        `json:"user_id"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type MfaRoleRequirement struct {
 	Role      string    `json:"role"`
-	SchoolId  int       `json:"school_id"`
-	CreatedAt time.Time `json:"created_at"`
+	Required  bool      `json:"required"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type IdentityProvider struct {
+	Id           int       `json:"id"`
+	SchoolId     int       `json:"school_id"`
+	Issuer       string    `json:"issuer"`
+	ClientId     string    `json:"client_id"`
+	ClientSecret string    `json:"-"`
+	Scopes       string    `json:"scopes"`
+	RoleClaim    string    `json:"role_claim"`
+	RoleMapping  string    `json:"role_mapping"` // JSON object, claim value -> role
+	DefaultRole  string    `json:"default_role"`
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type UserIdentity struct {
+	Id          int        `json:"id"`
+	UserId      int        `json:"user_id"`
+	ProviderId  int        `json:"provider_id"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
 }
 
+type ApiKey struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	SchoolId   int        `json:"school_id"`
+	Role       string     `json:"role"`
+	CreatedBy  *int       `json:"created_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CasbinRule is a stored Casbin policy line, e.g. p, teacher, /quizzes, POST
+type CasbinRule struct {
+	Id    int    `json:"id"`
+	Ptype string `json:"ptype"`
+	V0    string `json:"v0"`
+	V1    string `json:"v1"`
+	V2    string `json:"v2"`
+	V3    string `json:"v3"`
+	V4    string `json:"v4"`
+	V5    string `json:"v5"`
+}
+
+// Role is a built-in or custom role; its permissions are Casbin policies with the role's name
+type Role struct {
+	Id          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	BuiltIn     bool      `json:"built_in"`
+	CreatedBy   *int      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// School is a tenant, every user, classroom and API key belongs to one school
 type School struct {
-	Id      int    `json:"id"`
-	Name    string `json:"name"`
-	Address string `json:"address"`
+	Id           int          `json:"id"`
+	Name         string       `json:"name"`
+	Address      string       `json:"address"`
+	Timezone     string       `json:"timezone"`
+	GradingScale GradingScale `json:"grading_scale"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// GradeBand awards the grade to scores of at least MinPercent
+type GradeBand struct {
+	Grade      string  `json:"grade"`
+	MinPercent float64 `json:"min_percent"`
+}
+
+// GradingScale maps percentages to grades, stored as a jsonb array ordered by MinPercent from
+// high to low
+type GradingScale []GradeBand
+
+// DefaultGradingScale is the grading scale of new schools
+var DefaultGradingScale = GradingScale{
+	{Grade: "A", MinPercent: 90},
+	{Grade: "B", MinPercent: 80},
+	{Grade: "C", MinPercent: 70},
+	{Grade: "D", MinPercent: 60},
+	{Grade: "F", MinPercent: 0},
+}
+
+// Grade returns the grade of the highest band the percentage reaches
+func (g GradingScale) Grade(percent float64) string {
+	for _, band := range g {
+		if percent >= band.MinPercent {
+			return band.Grade
+		}
+	}
+	return ""
+}
+
+// Value stores the scale as JSON
+func (g GradingScale) Value() (driver.Value, error) {
+	if g == nil {
+		return nil, nil
+	}
+	return json.Marshal(g)
 }
 
+// Scan reads the scale from JSON
+func (g *GradingScale) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*g = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, g)
+	case string:
+		return json.Unmarshal([]byte(v), g)
+	default:
+		return fmt.Errorf("cannot scan %T into GradingScale", value)
+	}
+}
+
+// Classroom is a class of a school. An archived classroom is read-only and hidden from lists
+// but stays reportable until it is purged.
 type Classroom struct {
-	Id        int       `json:"id"`
-	Name      string    `json:"name"`
-	SchoolId  int       `json:"school_id"`
-	TeacherId int       `json:"teacher_id"`
-	CreatedAt time.Time `json:"created_at"`
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	SchoolId   int        `json:"school_id"`
+	TeacherId  int        `json:"teacher_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+}
+
+// ClassroomPurge counts the rows a classroom purge deletes, a dry run deletes none
+type ClassroomPurge struct {
+	ClassroomId int  `json:"classroom_id"`
+	DryRun      bool `json:"dry_run"`
+	Quizzes     int  `json:"quizzes"`
+	Questions   int  `json:"questions"`
+	Responses   int  `json:"responses"`
+	Events      int  `json:"events"`
+	Enrollments int  `json:"enrollments"`
+	Members     int  `json:"members"`
 }
 
+// StudentClassroom is an enrollment. Enrollments that ended keep their row with UnenrolledAt
+// set and the status telling whether the student dropped or was transferred.
 type StudentClassroom struct {
+	Id           int        `json:"id"`
+	StudentId    int        `json:"student_id"`
+	ClassroomId  int        `json:"classroom_id"`
+	EnrolledAt   time.Time  `json:"enrolled_at"`
+	UnenrolledAt *time.Time `json:"unenrolled_at,omitempty"`
+	Status       string     `json:"status"`
+}
+
+// ClassroomMember is a co-teacher or teaching assistant of a classroom
+type ClassroomMember struct {
 	Id          int       `json:"id"`
-	StudentId   int       `json:"student_id"`
 	ClassroomId int       `json:"classroom_id"`
-	EnrolledAt  time.Time `json:"enrolled_at"`
+	UserId      int       `json:"user_id"`
+	Role        string    `json:"role"`
+	AddedAt     time.Time `json:"added_at"`
 }
 
 type Quiz struct {
@@ -55,6 +262,43 @@ type Quiz struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// StudentQuiz is a quiz of a classroom the student is enrolled in with the student's progress:
+// the questions answered and answered correctly
+type StudentQuiz struct {
+	Id              int
+	Title           string
+	ClassroomId     int
+	ClassroomName   string
+	StartTime       time.Time
+	EndTime         time.Time
+	Questions       int
+	Answered        int
+	Correct         int
+	LastSubmittedAt *time.Time
+}
+
+// TeacherClassroom is a classroom of a teacher with the number of enrolled students
+type TeacherClassroom struct {
+	Classroom
+	Students int
+}
+
+// TeacherQuiz is a quiz of a teacher's classroom with the participation of its students.
+// Attempts and Correct count the responses.
+type TeacherQuiz struct {
+	Id            int
+	Title         string
+	ClassroomId   int
+	ClassroomName string
+	StartTime     time.Time
+	EndTime       time.Time
+	Questions     int
+	Students      int
+	Participants  int
+	Attempts      int
+	Correct       int
+}
+
 type Question struct {
 	Id            int         `json:"id"`
 	QuizId        int         `json:"quiz_id"`
@@ -83,3 +327,279 @@ type Event struct {
 	Metadata    interface{} `json:"metadata"`
 	Timestamp   time.Time   `json:"timestamp"`
 }
+
+// JSONText is JSON kept verbatim, e.g. in a json column
+type JSONText string
+
+// MarshalJSON embeds the JSON as is
+func (j JSONText) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+// AuditActor is who performed an audited action, taken from the request context
+type AuditActor struct {
+	Type      string
+	UserId    *int
+	Role      string
+	SchoolId  *int
+	ApiKeyId  *int
+	IPAddress string
+}
+
+// AuditLog is an entry of the append-only audit log. Hash covers the entry and PrevHash, the
+// hash of the entry before it.
+type AuditLog struct {
+	Id            int64     `json:"id"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	ActorType     string    `json:"actor_type"`
+	ActorId       *int      `json:"actor_id"`
+	ActorRole     string    `json:"actor_role"`
+	ApiKeyId      *int      `json:"api_key_id,omitempty"`
+	SchoolId      *int      `json:"school_id"`
+	Action        string    `json:"action"`
+	ResourceType  string    `json:"resource_type"`
+	ResourceId    string    `json:"resource_id"`
+	Before        *JSONText `json:"before" gorm:"column:before_data"`
+	After         *JSONText `json:"after" gorm:"column:after_data"`
+	IPAddress     string    `json:"ip_address"`
+	CorrelationId string    `json:"correlation_id"`
+	PrevHash      string    `json:"prev_hash"`
+	Hash          string    `json:"hash"`
+}
+
+// AuditLogFilter selects audit log entries, zero values match everything
+type AuditLogFilter struct {
+	SchoolId     int
+	ActorId      int
+	Action       string
+	ResourceType string
+	ResourceId   string
+	From         *time.Time
+	To           *time.Time
+	Limit        int
+	Offset       int
+	Ascending    bool
+}
+
+// AuditChainStatus is the result of verifying the hash chain of the audit log
+type AuditChainStatus struct {
+	Valid          bool   `json:"valid"`
+	Checked        int    `json:"checked"`
+	FirstInvalidId *int64 `json:"first_invalid_id,omitempty"`
+	LastHash       string `json:"last_hash"`
+}
+
+// ImportJob is an import running in the background, polled until it is completed or failed.
+// Report holds the validation result of every row, Summary the changes made or, for a dry run,
+// the changes that would be made. District imports of super admins have no school.
+type ImportJob struct {
+	Id         int        `json:"id"`
+	SchoolId   *int       `json:"school_id"`
+	Kind       string     `json:"kind"`
+	Status     string     `json:"status"`
+	DryRun     bool       `json:"dry_run"`
+	FileName   string     `json:"file_name"`
+	TotalRows  int        `json:"total_rows"`
+	ErrorRows  int        `json:"error_rows"`
+	Summary    *JSONText  `json:"summary"`
+	Report     *JSONText  `json:"report"`
+	Error      string     `json:"error,omitempty"`
+	CreatedBy  *int       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// RosterRow is a row of a roster file: a user and, for teachers and students, a classroom the
+// user teaches or is enrolled in. Line is the line of the row in the file.
+type RosterRow struct {
+	Line         int    `json:"line"`
+	Email        string `json:"email"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	Classroom    string `json:"classroom,omitempty"`
+	TeacherEmail string `json:"teacher_email,omitempty"`
+}
+
+// RosterDirectory is the existing data a roster is checked against: the users with the emails
+// of the roster in any school, and the classrooms of the school with their enrollments
+type RosterDirectory struct {
+	SchoolId    int
+	Users       []User
+	Classrooms  []Classroom
+	Enrollments []StudentClassroom
+}
+
+// RosterRowResult is the validation result of a roster row with the changes the row makes
+type RosterRowResult struct {
+	Line    int      `json:"line"`
+	Email   string   `json:"email"`
+	Valid   bool     `json:"valid"`
+	Errors  []string `json:"errors,omitempty"`
+	Actions []string `json:"actions,omitempty"`
+}
+
+// RosterPlan are the changes of a validated roster. Users and classrooms with an Id exist
+// already; enrollments reference users by email and classrooms by name as new ones have no id
+// before they are written.
+type RosterPlan struct {
+	Users       []RosterUser
+	Classrooms  []RosterClassroom
+	Enrollments []RosterEnrollment
+}
+
+// RosterUser is a user to create, or with Rename set an existing user whose name changes
+type RosterUser struct {
+	Id     int
+	Email  string
+	Name   string
+	Role   string
+	Rename bool
+}
+
+// RosterClassroom is a classroom to create, or with Reassign set an existing classroom that gets
+// another teacher. TeacherEmail is empty when an existing classroom keeps its teacher.
+type RosterClassroom struct {
+	Id           int
+	Name         string
+	TeacherEmail string
+	Reassign     bool
+}
+
+type RosterEnrollment struct {
+	StudentEmail string
+	Classroom    string
+}
+
+// RosterSummary counts the changes of a roster import
+type RosterSummary struct {
+	UsersCreated         int `json:"users_created"`
+	UsersUpdated         int `json:"users_updated"`
+	ClassroomsCreated    int `json:"classrooms_created"`
+	ClassroomsReassigned int `json:"classrooms_reassigned"`
+	Enrollments          int `json:"enrollments"`
+}
+
+// SourcedId maps the sourcedId of a OneRoster resource in an external system to the local row it
+// was imported into or exported from. ResourceType is org, user, class or enrollment and LocalId
+// the id of the school, user, classroom or student_classrooms row.
+type SourcedId struct {
+	Id           int       `json:"id"`
+	SchoolId     int       `json:"school_id"`
+	ResourceType string    `json:"resource_type"`
+	SourcedId    string    `json:"sourced_id"`
+	LocalId      int       `json:"local_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// OneRosterDirectory is the existing data a OneRoster bundle is checked against. SchoolId is the
+// school an admin imports into, 0 for a district import of a super admin. Mappings are those of
+// the sourcedIds of the bundle, Users those with a mapping or an email of the bundle in any
+// school.
+type OneRosterDirectory struct {
+	SchoolId    int
+	Mappings    []SourcedId
+	Schools     []School
+	Users       []User
+	Classrooms  []Classroom
+	Enrollments []StudentClassroom
+}
+
+// OneRosterRowResult is the validation result of a row of a OneRoster file with the changes the
+// row makes
+type OneRosterRowResult struct {
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	SourcedId string   `json:"sourced_id"`
+	Valid     bool     `json:"valid"`
+	Skipped   bool     `json:"skipped,omitempty"`
+	Errors    []string `json:"errors,omitempty"`
+	Actions   []string `json:"actions,omitempty"`
+}
+
+// OneRosterPlan are the changes of a validated OneRoster bundle with every resource it names, so
+// that the sourcedIds of unchanged rows are mapped too. Rows with an Id exist already;
+// references to rows that do not exist yet use their sourcedId as they have no id before they
+// are written.
+type OneRosterPlan struct {
+	Schools     []OneRosterSchool
+	Users       []OneRosterUser
+	Classes     []OneRosterClass
+	Enrollments []OneRosterEnrollment
+}
+
+type OneRosterSchool struct {
+	SourcedId string
+	Id        int
+	Name      string
+	Rename    bool
+}
+
+// OneRosterUser is a user to create or to update, SchoolId is 0 for users of a new school
+type OneRosterUser struct {
+	SourcedId       string
+	Id              int
+	SchoolId        int
+	SchoolSourcedId string
+	Email           string
+	Name            string
+	Role            string
+	Enabled         bool
+	Rename          bool
+	Deactivate      bool
+	Reactivate      bool
+}
+
+// OneRosterClass is a classroom to create or to update. TeacherId is 0 for a new teacher and
+// TeacherSourcedId empty when an existing classroom keeps its teacher.
+type OneRosterClass struct {
+	SourcedId        string
+	Id               int
+	SchoolId         int
+	SchoolSourcedId  string
+	Name             string
+	Rename           bool
+	TeacherId        int
+	TeacherSourcedId string
+	Reassign         bool
+}
+
+// OneRosterEnrollment enrolls a student in a classroom or, with Drop set, unenrolls the student.
+// ClassroomId and StudentId are 0 for rows the import creates.
+type OneRosterEnrollment struct {
+	SourcedId      string
+	ClassroomId    int
+	ClassSourcedId string
+	StudentId      int
+	UserSourcedId  string
+	Drop           bool
+}
+
+// OneRosterSummary counts the changes of a OneRoster import
+type OneRosterSummary struct {
+	SchoolsCreated    int `json:"schools_created"`
+	SchoolsUpdated    int `json:"schools_updated"`
+	UsersCreated      int `json:"users_created"`
+	UsersUpdated      int `json:"users_updated"`
+	UsersDeactivated  int `json:"users_deactivated"`
+	UsersReactivated  int `json:"users_reactivated"`
+	ClassroomsCreated int `json:"classrooms_created"`
+	ClassroomsUpdated int `json:"classrooms_updated"`
+	Enrollments       int `json:"enrollments"`
+	Unenrollments     int `json:"unenrollments"`
+	Skipped           int `json:"skipped"`
+}
+
+// OneRosterExport is a school with its users, classrooms and enrollments and the sourcedIds they
+// are exported with, keyed by resource type and local id
+type OneRosterExport struct {
+	School      School
+	Users       []User
+	Classrooms  []Classroom
+	Enrollments []StudentClassroom
+	SourcedIds  map[string]map[int]string
+}
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- TOTP second factor, the secret is encrypted with AUTH_MFA_ENCRYPTION_KEY.
+-- enabled stays false until the user confirms the enrollment with a first code.
+CREATE TABLE user_mfa (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    enabled_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Single-use recovery codes for a lost authenticator
+CREATE TABLE user_mfa_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE(user_id, code_hash)
+);
+
+-- Roles whose members must use a second factor
+CREATE TABLE mfa_role_requirements (
+    role VARCHAR(20) PRIMARY KEY,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE mfa_role_requirements;
+DROP TABLE user_mfa_recovery_codes;
+DROP TABLE user_mfa;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- OpenID Connect identity provider of a school. role_mapping maps values of the role_claim
+-- in the ID token to local roles, users without a mapped value get default_role.
+CREATE TABLE school_identity_providers (
+    id SERIAL PRIMARY KEY,
+    school_id INT UNIQUE NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    client_secret TEXT NOT NULL,
+    scopes TEXT NOT NULL DEFAULT 'openid email profile',
+    role_claim VARCHAR(100) NOT NULL DEFAULT 'roles',
+    role_mapping JSONB NOT NULL DEFAULT '{}',
+    default_role VARCHAR(20) NOT NULL DEFAULT 'student' CHECK (default_role IN ('teacher', 'student')),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+-- Links a user to the subject of an identity provider
+CREATE TABLE user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider_id INT NOT NULL REFERENCES school_identity_providers(id) ON DELETE CASCADE,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(150),
+    last_login_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE(provider_id, subject)
+);
+
+CREATE INDEX idx_user_identities_user ON user_identities(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_identities;
+DROP TABLE school_identity_providers;
+-- +goose StatementEnd
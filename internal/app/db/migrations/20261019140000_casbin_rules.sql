@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Casbin policy rules, one row per "p" (role, path, method) or "g" (role, inherited role) line.
+-- Unused columns hold '' so the unique constraint also covers shorter rules. The table is
+-- seeded from internal/config/casbin_policy.csv when it is empty.
+CREATE TABLE casbin_rules (
+    id SERIAL PRIMARY KEY,
+    ptype VARCHAR(10) NOT NULL,
+    v0 VARCHAR(255) NOT NULL DEFAULT '',
+    v1 VARCHAR(255) NOT NULL DEFAULT '',
+    v2 VARCHAR(255) NOT NULL DEFAULT '',
+    v3 VARCHAR(255) NOT NULL DEFAULT '',
+    v4 VARCHAR(255) NOT NULL DEFAULT '',
+    v5 VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (ptype, v0, v1, v2, v3, v4, v5)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE casbin_rules;
+-- +goose StatementEnd
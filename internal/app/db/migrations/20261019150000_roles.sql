@@ -0,0 +1,58 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Roles usable in Casbin policies. The built-in roles are also the base roles of users.role,
+-- which decide the resources a user can reach; custom roles only grant routes.
+CREATE TABLE roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    built_in BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO roles (name, description, built_in) VALUES
+    ('admin', 'School administrator', TRUE),
+    ('teacher', 'Teacher of classrooms', TRUE),
+    ('student', 'Student enrolled in classrooms', TRUE);
+
+-- Roles assigned to users, a user may call every route one of its roles may call
+CREATE TABLE user_roles (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    assigned_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX idx_user_roles_role ON user_roles(role_id);
+
+-- Every existing user keeps its base role
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u JOIN roles r ON r.name = u.role;
+
+-- Policies of the role routes. A new database is seeded from casbin_policy.csv instead.
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', 'admin', v.path, v.method
+FROM (VALUES
+    ('/roles', 'GET'),
+    ('/roles', 'POST'),
+    ('/roles/:name', 'GET'),
+    ('/roles/:name', 'PUT'),
+    ('/roles/:name', 'DELETE'),
+    ('/users/:id/roles', 'GET'),
+    ('/users/:id/roles', 'POST'),
+    ('/users/:id/roles/:role', 'DELETE')
+) AS v(path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules WHERE ptype = 'p' AND (v1 LIKE '/roles%' OR v1 LIKE '/users/:id/roles%');
+DROP TABLE user_roles;
+DROP TABLE roles;
+-- +goose StatementEnd
@@ -0,0 +1,56 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Append-only record of administrative and data-access actions. Every row carries the hash of
+-- the previous row, so deleting or editing a row breaks the chain. before_data and after_data
+-- use the json type, which keeps the hashed text verbatim. Actors and resources are not
+-- foreign keys so the log outlives the rows it describes.
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMP NOT NULL,
+    actor_type VARCHAR(20) NOT NULL,
+    actor_id INT,
+    actor_role VARCHAR(50) NOT NULL DEFAULT '',
+    api_key_id INT,
+    school_id INT,
+    action VARCHAR(100) NOT NULL,
+    resource_type VARCHAR(50) NOT NULL,
+    resource_id VARCHAR(100) NOT NULL DEFAULT '',
+    before_data JSON,
+    after_data JSON,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    correlation_id VARCHAR(100) NOT NULL DEFAULT '',
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) UNIQUE NOT NULL
+);
+
+CREATE INDEX idx_audit_log_school_time ON audit_log(school_id, occurred_at);
+CREATE INDEX idx_audit_log_actor ON audit_log(actor_id);
+CREATE INDEX idx_audit_log_resource ON audit_log(resource_type, resource_id);
+CREATE INDEX idx_audit_log_action ON audit_log(action);
+
+CREATE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_append_only();
+
+-- Policies of the audit log routes. A new database is seeded from casbin_policy.csv instead.
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', 'admin', v.path, 'GET'
+FROM (VALUES ('/audit-log'), ('/audit-log/verify')) AS v(path)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules WHERE ptype = 'p' AND v1 LIKE '/audit-log%';
+DROP TABLE audit_log;
+DROP FUNCTION audit_log_append_only();
+-- +goose StatementEnd
@@ -0,0 +1,77 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Tenant-level settings of schools. Reports use the timezone and grade scores with the grading
+-- scale, a jsonb array of {grade, min_percent} ordered from the highest band down.
+ALTER TABLE schools
+    ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    ADD COLUMN grading_scale JSONB NOT NULL DEFAULT '[{"grade":"A","min_percent":90},{"grade":"B","min_percent":80},{"grade":"C","min_percent":70},{"grade":"D","min_percent":60},{"grade":"F","min_percent":0}]',
+    ADD COLUMN created_at TIMESTAMP DEFAULT NOW(),
+    ADD COLUMN updated_at TIMESTAMP DEFAULT NOW();
+
+-- Super admins manage schools and belong to none of them
+ALTER TABLE users DROP CONSTRAINT users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('super_admin', 'admin', 'teacher', 'student'));
+
+INSERT INTO roles (name, description, built_in) VALUES
+    ('super_admin', 'Platform administrator managing schools', TRUE)
+ON CONFLICT (name) DO NOTHING;
+
+-- Every tenant-scoped query filters on the school of users and classrooms
+CREATE INDEX IF NOT EXISTS idx_users_school ON users(school_id);
+CREATE INDEX IF NOT EXISTS idx_classrooms_school ON classrooms(school_id);
+
+-- Policies of the school routes. A new database is seeded from casbin_policy.csv instead.
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', v.role, v.path, v.method
+FROM (VALUES
+    ('super_admin', '/schools', 'GET'),
+    ('super_admin', '/schools', 'POST'),
+    ('super_admin', '/schools/:id', 'GET'),
+    ('super_admin', '/schools/:id', 'PUT'),
+    ('super_admin', '/schools/:id', 'DELETE'),
+    ('super_admin', '/schools/:id/settings', 'GET'),
+    ('super_admin', '/schools/:id/settings', 'PUT'),
+    ('super_admin', '/users', 'POST'),
+    ('super_admin', '/auth/logout', 'POST'),
+    ('super_admin', '/auth/change-password', 'POST'),
+    ('super_admin', '/auth/sessions', 'GET'),
+    ('super_admin', '/auth/sessions', 'DELETE'),
+    ('super_admin', '/auth/sessions/:session_id', 'DELETE'),
+    ('super_admin', '/auth/mfa', 'GET'),
+    ('super_admin', '/auth/mfa', 'DELETE'),
+    ('super_admin', '/auth/mfa/enroll', 'POST'),
+    ('super_admin', '/auth/mfa/confirm', 'POST'),
+    ('super_admin', '/auth/mfa/recovery-codes', 'POST'),
+    ('admin', '/schools/:id', 'GET'),
+    ('admin', '/schools/:id/settings', 'GET'),
+    ('admin', '/schools/:id/settings', 'PUT'),
+    ('teacher', '/schools/:id', 'GET'),
+    ('teacher', '/schools/:id/settings', 'GET'),
+    ('student', '/schools/:id', 'GET'),
+    ('student', '/schools/:id/settings', 'GET')
+) AS v(role, path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO casbin_rules (ptype, v0, v1)
+SELECT 'g', 'super_admin', 'super_admin'
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules WHERE v0 = 'super_admin';
+DELETE FROM casbin_rules WHERE ptype = 'p' AND v1 IN ('/schools/:id', '/schools/:id/settings');
+DELETE FROM roles WHERE name = 'super_admin';
+DROP INDEX IF EXISTS idx_classrooms_school;
+DROP INDEX IF EXISTS idx_users_school;
+ALTER TABLE users DROP CONSTRAINT users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('admin', 'teacher', 'student'));
+ALTER TABLE schools
+    DROP COLUMN updated_at,
+    DROP COLUMN created_at,
+    DROP COLUMN grading_scale,
+    DROP COLUMN timezone;
+-- +goose StatementEnd
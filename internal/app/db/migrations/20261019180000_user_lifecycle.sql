@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Deactivated users keep their data but cannot sign in. Deleted users are anonymized rather
+-- than removed, so the responses and reports referencing them stay intact.
+ALTER TABLE users
+    ADD COLUMN deactivated_at TIMESTAMP,
+    ADD COLUMN anonymized_at TIMESTAMP,
+    ADD COLUMN updated_at TIMESTAMP DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_users_school_role ON users(school_id, role);
+
+-- Policies of the user administration routes. A new database is seeded from
+-- casbin_policy.csv instead.
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', v.role, v.path, v.method
+FROM (VALUES
+    ('admin', '/users', 'GET'),
+    ('admin', '/users/:id', 'GET'),
+    ('admin', '/users/:id', 'PUT'),
+    ('admin', '/users/:id', 'DELETE'),
+    ('admin', '/users/:id/role', 'PUT'),
+    ('admin', '/users/:id/deactivate', 'POST'),
+    ('admin', '/users/:id/reactivate', 'POST'),
+    ('super_admin', '/users', 'GET'),
+    ('super_admin', '/users/:id', 'GET')
+) AS v(role, path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules WHERE ptype = 'p' AND (
+    (v1 = '/users' AND v2 = 'GET') OR
+    v1 IN ('/users/:id', '/users/:id/role', '/users/:id/deactivate', '/users/:id/reactivate'));
+DROP INDEX IF EXISTS idx_users_school_role;
+ALTER TABLE users
+    DROP COLUMN updated_at,
+    DROP COLUMN anonymized_at,
+    DROP COLUMN deactivated_at;
+-- +goose StatementEnd
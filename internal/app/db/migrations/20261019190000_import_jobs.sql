@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Imports run in the background; clients poll the job until it is completed or failed. The
+-- report holds the validation result of every row of the uploaded file, the file itself is not
+-- stored.
+CREATE TABLE import_jobs (
+    id SERIAL PRIMARY KEY,
+    school_id INT NOT NULL REFERENCES schools(id),
+    kind VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    total_rows INT NOT NULL DEFAULT 0,
+    error_rows INT NOT NULL DEFAULT 0,
+    summary JSONB,
+    report JSONB,
+    error TEXT NOT NULL DEFAULT '',
+    created_by INT REFERENCES users(id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_school ON import_jobs(school_id, created_at DESC);
+
+-- Policies of the import routes. A new database is seeded from casbin_policy.csv instead.
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', v.role, v.path, v.method
+FROM (VALUES
+    ('admin', '/imports/roster', 'POST'),
+    ('admin', '/imports/:id', 'GET')
+) AS v(role, path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules WHERE ptype = 'p' AND v1 IN ('/imports/roster', '/imports/:id');
+DROP TABLE IF EXISTS import_jobs;
+-- +goose StatementEnd
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- sourcedIds of OneRoster bundles mapped to the local rows they were imported into or exported
+-- from, so that repeated syncs update those rows instead of creating new ones. Orgs map to
+-- schools, users to users, classes to classrooms and enrollments to student_classrooms; the
+-- local row is not a foreign key as it depends on the resource type.
+CREATE TABLE oneroster_sourced_ids (
+    id SERIAL PRIMARY KEY,
+    school_id INT NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+    resource_type VARCHAR(20) NOT NULL CHECK (resource_type IN ('org', 'user', 'class', 'enrollment')),
+    sourced_id VARCHAR(255) NOT NULL,
+    local_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (school_id, resource_type, sourced_id),
+    UNIQUE (school_id, resource_type, local_id)
+);
+
+-- District imports of super admins span several schools
+ALTER TABLE import_jobs ALTER COLUMN school_id DROP NOT NULL;
+
+-- Policies of the OneRoster routes. A new database is seeded from casbin_policy.csv instead.
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', v.role, v.path, v.method
+FROM (VALUES
+    ('admin', '/oneroster/import', 'POST'),
+    ('admin', '/oneroster/export', 'GET'),
+    ('super_admin', '/oneroster/import', 'POST'),
+    ('super_admin', '/oneroster/export', 'GET'),
+    ('super_admin', '/imports/:id', 'GET')
+) AS v(role, path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules WHERE ptype = 'p' AND v1 IN ('/oneroster/import', '/oneroster/export');
+DELETE FROM casbin_rules WHERE ptype = 'p' AND v0 = 'super_admin' AND v1 = '/imports/:id';
+DROP TABLE IF EXISTS oneroster_sourced_ids;
+DELETE FROM import_jobs WHERE school_id IS NULL;
+ALTER TABLE import_jobs ALTER COLUMN school_id SET NOT NULL;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- The dashboards look up the quizzes of classrooms, their questions and the responses to them
+CREATE INDEX IF NOT EXISTS idx_quizzes_classroom ON quizzes(classroom_id, start_time);
+CREATE INDEX IF NOT EXISTS idx_questions_quiz ON questions(quiz_id);
+CREATE INDEX IF NOT EXISTS idx_responses_question ON responses(question_id);
+
+-- Policies of the /me routes. A new database is seeded from casbin_policy.csv instead.
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', v.role, v.path, v.method
+FROM (VALUES
+    ('teacher', '/me/classrooms', 'GET'),
+    ('teacher', '/me/dashboard', 'GET'),
+    ('student', '/me/classrooms', 'GET'),
+    ('student', '/me/quizzes', 'GET')
+) AS v(role, path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules WHERE ptype = 'p' AND v1 IN ('/me/classrooms', '/me/dashboard', '/me/quizzes');
+DROP INDEX IF EXISTS idx_responses_question;
+DROP INDEX IF EXISTS idx_questions_quiz;
+DROP INDEX IF EXISTS idx_quizzes_classroom;
+-- +goose StatementEnd
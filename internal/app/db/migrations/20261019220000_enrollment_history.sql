@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Enrollments are ended rather than deleted so reports keep the students of a classroom at any
+-- point in time. A student has at most one active enrollment per classroom but may rejoin it.
+UPDATE student_classrooms SET enrolled_at = NOW() WHERE enrolled_at IS NULL;
+ALTER TABLE student_classrooms
+    ALTER COLUMN enrolled_at SET NOT NULL,
+    ADD COLUMN unenrolled_at TIMESTAMP,
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'dropped', 'transferred')),
+    ADD CONSTRAINT student_classrooms_status_ended CHECK ((status = 'active') = (unenrolled_at IS NULL)),
+    DROP CONSTRAINT IF EXISTS student_classrooms_student_id_classroom_id_key;
+CREATE UNIQUE INDEX idx_student_classrooms_active ON student_classrooms(student_id, classroom_id)
+    WHERE unenrolled_at IS NULL;
+
+-- Co-teachers and teaching assistants of a classroom besides its teacher
+CREATE TABLE classroom_members (
+    id SERIAL PRIMARY KEY,
+    classroom_id INT NOT NULL REFERENCES classrooms(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('co_teacher', 'assistant')),
+    added_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (classroom_id, user_id)
+);
+CREATE INDEX idx_classroom_members_user ON classroom_members(user_id);
+
+-- Policies of the enrollment history, member and transfer routes. A new database is seeded from
+-- casbin_policy.csv instead.
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', v.role, v.path, v.method
+FROM (VALUES
+    ('admin', '/classrooms/:id/enrollments', 'GET'),
+    ('admin', '/classrooms/:id/transfer', 'POST'),
+    ('admin', '/classrooms/:id/members', 'GET'),
+    ('admin', '/classrooms/:id/members', 'POST'),
+    ('admin', '/classrooms/:id/members/:user_id', 'DELETE'),
+    ('teacher', '/classrooms/:id/enrollments', 'GET'),
+    ('teacher', '/classrooms/:id/transfer', 'POST'),
+    ('teacher', '/classrooms/:id/members', 'GET'),
+    ('teacher', '/classrooms/:id/members', 'POST'),
+    ('teacher', '/classrooms/:id/members/:user_id', 'DELETE')
+) AS v(role, path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules WHERE ptype = 'p' AND v1 IN (
+    '/classrooms/:id/enrollments', '/classrooms/:id/transfer', '/classrooms/:id/members', '/classrooms/:id/members/:user_id'
+);
+DROP TABLE IF EXISTS classroom_members;
+
+-- Ended enrollments cannot be kept once a student may only be enrolled once per classroom
+DELETE FROM student_classrooms WHERE unenrolled_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_student_classrooms_active;
+ALTER TABLE student_classrooms
+    DROP CONSTRAINT IF EXISTS student_classrooms_status_ended,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS unenrolled_at,
+    ALTER COLUMN enrolled_at DROP NOT NULL,
+    ADD CONSTRAINT student_classrooms_student_id_classroom_id_key UNIQUE (student_id, classroom_id);
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Deleting a classroom archives it: it is read-only and hidden from lists but stays reportable
+-- until it is purged
+ALTER TABLE classrooms ADD COLUMN archived_at TIMESTAMP;
+CREATE INDEX idx_classrooms_active ON classrooms(school_id) WHERE archived_at IS NULL;
+
+-- A purge deletes the events of the classroom and of its quizzes
+CREATE INDEX IF NOT EXISTS idx_events_classroom ON events(classroom_id);
+CREATE INDEX IF NOT EXISTS idx_events_quiz ON events(quiz_id);
+
+-- Policy of the purge route. A new database is seeded from casbin_policy.csv instead.
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', v.role, v.path, v.method
+FROM (VALUES
+    ('admin', '/classrooms/:id/purge', 'POST')
+) AS v(role, path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules WHERE ptype = 'p' AND v1 = '/classrooms/:id/purge';
+DROP INDEX IF EXISTS idx_events_quiz;
+DROP INDEX IF EXISTS idx_events_classroom;
+DROP INDEX IF EXISTS idx_classrooms_active;
+ALTER TABLE classrooms DROP COLUMN IF EXISTS archived_at;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Policies of the classroom lists of a teacher and of a student. A new database is seeded from
+-- casbin_policy.csv instead.
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', v.role, v.path, v.method
+FROM (VALUES
+    ('admin', '/teachers/:teacher_id/classrooms', 'GET'),
+    ('admin', '/students/:student_id/classrooms', 'GET'),
+    ('teacher', '/teachers/:teacher_id/classrooms', 'GET'),
+    ('teacher', '/students/:student_id/classrooms', 'GET'),
+    ('student', '/students/:student_id/classrooms', 'GET')
+) AS v(role, path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules WHERE ptype = 'p' AND v1 IN ('/teachers/:teacher_id/classrooms', '/students/:student_id/classrooms');
+-- +goose StatementEnd
@@ -0,0 +1,53 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Roles and policies apply to every school, so only super admins change them. School admins keep
+-- reading roles and assigning them to their users. A new database is seeded from
+-- casbin_policy.csv instead.
+DELETE FROM casbin_rules
+WHERE ptype = 'p' AND v0 = 'admin' AND (
+    v1 LIKE '/rbac/%'
+    OR (v1 = '/roles' AND v2 = 'POST')
+    OR (v1 = '/roles/:name' AND v2 IN ('PUT', 'DELETE'))
+);
+
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', v.role, v.path, v.method
+FROM (VALUES
+    ('super_admin', '/roles', 'GET'),
+    ('super_admin', '/roles', 'POST'),
+    ('super_admin', '/roles/:name', 'GET'),
+    ('super_admin', '/roles/:name', 'PUT'),
+    ('super_admin', '/roles/:name', 'DELETE'),
+    ('super_admin', '/rbac/policies', 'GET'),
+    ('super_admin', '/rbac/policies', 'POST'),
+    ('super_admin', '/rbac/policies', 'DELETE'),
+    ('super_admin', '/rbac/inheritance', 'GET'),
+    ('super_admin', '/rbac/inheritance', 'POST'),
+    ('super_admin', '/rbac/inheritance', 'DELETE')
+) AS v(role, path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM casbin_rules
+WHERE ptype = 'p' AND v0 = 'super_admin' AND (v1 LIKE '/rbac/%' OR v1 LIKE '/roles%');
+
+INSERT INTO casbin_rules (ptype, v0, v1, v2)
+SELECT 'p', v.role, v.path, v.method
+FROM (VALUES
+    ('admin', '/roles', 'POST'),
+    ('admin', '/roles/:name', 'PUT'),
+    ('admin', '/roles/:name', 'DELETE'),
+    ('admin', '/rbac/policies', 'GET'),
+    ('admin', '/rbac/policies', 'POST'),
+    ('admin', '/rbac/policies', 'DELETE'),
+    ('admin', '/rbac/inheritance', 'GET'),
+    ('admin', '/rbac/inheritance', 'POST'),
+    ('admin', '/rbac/inheritance', 'DELETE')
+) AS v(role, path, method)
+WHERE EXISTS (SELECT 1 FROM casbin_rules)
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
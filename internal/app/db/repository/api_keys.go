@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type IApiKeysRepository interface {
+	CreateApiKey(ctx context.Context, key *dto.ApiKey) error
+	GetActiveApiKey(ctx context.Context, keyHash string) (*dto.ApiKey, error)
+	GetApiKeys(ctx context.Context, schoolId int) ([]dto.ApiKey, error)
+	RevokeApiKey(ctx context.Context, id, schoolId int) error
+	TouchApiKey(ctx context.Context, id int, usedAt time.Time) error
+}
+
+type ApiKeysRepository struct {
+	DBService *db.DBService
+}
+
+func NewApiKeysRepository(dbService *db.DBService) IApiKeysRepository {
+	return &ApiKeysRepository{
+		DBService: dbService,
+	}
+}
+
+func (r *ApiKeysRepository) CreateApiKey(ctx context.Context, key *dto.ApiKey) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	key.CreatedAt = time.Now()
+
+	if err := tx.Table(dto.API_KEY_TABLE).Create(key).Error; err != nil {
+		return err
+	}
+	if err := auditApiKey(ctx, tx, constants.AUDIT_API_KEY_CREATE, key, nil, key); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// GetActiveApiKey returns the unrevoked, unexpired key with the given hash
+func (r *ApiKeysRepository) GetActiveApiKey(ctx context.Context, keyHash string) (*dto.ApiKey, error) {
+	var key dto.ApiKey
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.API_KEY_TABLE).
+		Where("key_hash = ? AND revoked_at IS NULL AND expires_at > ?", keyHash, time.Now()).
+		First(&key).Error; err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// GetApiKeys lists the keys of a school including revoked and expired ones
+func (r *ApiKeysRepository) GetApiKeys(ctx context.Context, schoolId int) ([]dto.ApiKey, error) {
+	var keys []dto.ApiKey
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.API_KEY_TABLE).Where("school_id = ?", schoolId).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeApiKey revokes an active key of the school
+func (r *ApiKeysRepository) RevokeApiKey(ctx context.Context, id, schoolId int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var before, after dto.ApiKey
+	if err := tx.Table(dto.API_KEY_TABLE).
+		Where("id = ? AND school_id = ? AND revoked_at IS NULL", id, schoolId).
+		First(&before).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.API_KEY_TABLE).Where("id = ?", id).Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.API_KEY_TABLE).Where("id = ?", id).First(&after).Error; err != nil {
+		return err
+	}
+	if err := auditApiKey(ctx, tx, constants.AUDIT_API_KEY_REVOKE, &after, &before, &after); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (r *ApiKeysRepository) TouchApiKey(ctx context.Context, id int, usedAt time.Time) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.API_KEY_TABLE).Where("id = ?", id).Update("last_used_at", usedAt).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// auditApiKey records a change of an API key in the audit log
+func auditApiKey(ctx context.Context, tx *gorm.DB, action string, key *dto.ApiKey, before, after interface{}) error {
+	beforeData, afterData, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	return appendAuditLog(ctx, tx, &dto.AuditLog{
+		Action:       action,
+		ResourceType: constants.AUDIT_RESOURCE_API_KEY,
+		ResourceId:   strconv.Itoa(key.Id),
+		SchoolId:     &key.SchoolId,
+		Before:       beforeData,
+		After:        afterData,
+	})
+}
@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// auditVerifyBatchSize is the number of entries read at a time while verifying the hash chain
+const auditVerifyBatchSize = 1000
+
+// auditRedacted replaces the values of sensitive fields in the audit log
+const auditRedacted = "[REDACTED]"
+
+// auditSensitiveFields are never written to the audit log in clear text
+var auditSensitiveFields = map[string]bool{
+	"password":      true,
+	"secret":        true,
+	"client_secret": true,
+	"key_hash":      true,
+}
+
+type IAuditLogRepository interface {
+	AppendAuditLog(ctx context.Context, entry *dto.AuditLog) error
+	GetAuditLogs(ctx context.Context, filter dto.AuditLogFilter) ([]dto.AuditLog, int, error)
+	VerifyAuditChain(ctx context.Context) (*dto.AuditChainStatus, error)
+}
+
+type AuditLogRepository struct {
+	DBService *db.DBService
+}
+
+func NewAuditLogRepository(dbService *db.DBService) IAuditLogRepository {
+	return &AuditLogRepository{
+		DBService: dbService,
+	}
+}
+
+// AppendAuditLog records an action that is not part of a repository change, e.g. a report view
+func (r *AuditLogRepository) AppendAuditLog(ctx context.Context, entry *dto.AuditLog) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := appendAuditLog(ctx, tx, entry); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// GetAuditLogs returns a page of the matching entries, newest first unless the filter is
+// ascending, and the number of matching entries
+func (r *AuditLogRepository) GetAuditLogs(ctx context.Context, filter dto.AuditLogFilter) ([]dto.AuditLog, int, error) {
+	var entries []dto.AuditLog
+	var total int
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	query := tx.Table(dto.AUDIT_LOG_TABLE)
+	if filter.SchoolId != 0 {
+		query = query.Where("school_id = ?", filter.SchoolId)
+	}
+	if filter.ActorId != 0 {
+		query = query.Where("actor_id = ?", filter.ActorId)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ResourceId != "" {
+		query = query.Where("resource_id = ?", filter.ResourceId)
+	}
+	if filter.From != nil {
+		query = query.Where("occurred_at >= ?", filter.From.UTC())
+	}
+	if filter.To != nil {
+		query = query.Where("occurred_at < ?", filter.To.UTC())
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order := "id DESC"
+	if filter.Ascending {
+		order = "id"
+	}
+	if err := query.Order(order).Limit(filter.Limit).Offset(filter.Offset).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// VerifyAuditChain recomputes the hash of every entry in order and stops at the first entry
+// that was changed, removed or inserted out of band
+func (r *AuditLogRepository) VerifyAuditChain(ctx context.Context) (*dto.AuditChainStatus, error) {
+	status := &dto.AuditChainStatus{Valid: true}
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var lastId int64
+	for {
+		var entries []dto.AuditLog
+		if err := tx.Table(dto.AUDIT_LOG_TABLE).Where("id > ?", lastId).Order("id").
+			Limit(auditVerifyBatchSize).Find(&entries).Error; err != nil {
+			return nil, err
+		}
+
+		if !verifyAuditEntries(status, entries) || len(entries) < auditVerifyBatchSize {
+			return status, nil
+		}
+		lastId = entries[len(entries)-1].Id
+	}
+}
+
+// verifyAuditEntries continues the chain of the status with the entries in id order and returns
+// false at the first entry that does not follow it
+func verifyAuditEntries(status *dto.AuditChainStatus, entries []dto.AuditLog) bool {
+	for i := range entries {
+		entry := &entries[i]
+		if entry.PrevHash != status.LastHash || AuditLogHash(status.LastHash, entry) != entry.Hash {
+			status.Valid = false
+			status.FirstInvalidId = &entry.Id
+			return false
+		}
+		status.LastHash = entry.Hash
+		status.Checked++
+	}
+	return true
+}
+
+// auditOccurredAt is the time an entry is stored with. Postgres stores microseconds, the hash
+// must cover the stored time.
+func auditOccurredAt(now time.Time) time.Time {
+	return now.UTC().Truncate(time.Microsecond)
+}
+
+// auditHashFields is the canonical form of an entry that is hashed, the field order is fixed
+type auditHashFields struct {
+	PrevHash      string `json:"prev_hash"`
+	OccurredAt    string `json:"occurred_at"`
+	ActorType     string `json:"actor_type"`
+	ActorId       *int   `json:"actor_id"`
+	ActorRole     string `json:"actor_role"`
+	ApiKeyId      *int   `json:"api_key_id"`
+	SchoolId      *int   `json:"school_id"`
+	Action        string `json:"action"`
+	ResourceType  string `json:"resource_type"`
+	ResourceId    string `json:"resource_id"`
+	Before        string `json:"before"`
+	After         string `json:"after"`
+	IPAddress     string `json:"ip_address"`
+	CorrelationId string `json:"correlation_id"`
+}
+
+// AuditLogHash returns the hex SHA-256 of the entry chained to the hash of the previous entry,
+// the first entry is chained to an empty hash
+func AuditLogHash(prevHash string, entry *dto.AuditLog) string {
+	fields := auditHashFields{
+		PrevHash:      prevHash,
+		OccurredAt:    entry.OccurredAt.UTC().Format(time.RFC3339Nano),
+		ActorType:     entry.ActorType,
+		ActorId:       entry.ActorId,
+		ActorRole:     entry.ActorRole,
+		ApiKeyId:      entry.ApiKeyId,
+		SchoolId:      entry.SchoolId,
+		Action:        entry.Action,
+		ResourceType:  entry.ResourceType,
+		ResourceId:    entry.ResourceId,
+		IPAddress:     entry.IPAddress,
+		CorrelationId: entry.CorrelationId,
+	}
+	if entry.Before != nil {
+		fields.Before = string(*entry.Before)
+	}
+	if entry.After != nil {
+		fields.After = string(*entry.After)
+	}
+
+	// Marshalling a struct of strings, ints and nil pointers cannot fail
+	canonical, _ := json.Marshal(fields)
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// appendAuditLog writes the entry within the transaction of the change it records, so either
+// both or neither are stored. The actor and correlation id are taken from the request context;
+// a context without a request is the system itself.
+func appendAuditLog(ctx context.Context, tx *gorm.DB, entry *dto.AuditLog) error {
+	actor, ok := ctx.Value(constants.CTK_AUDIT_ACTOR).(dto.AuditActor)
+	if !ok {
+		actor = dto.AuditActor{Type: constants.AUDIT_ACTOR_SYSTEM}
+	}
+	entry.ActorType = actor.Type
+	entry.ActorId = actor.UserId
+	entry.ActorRole = actor.Role
+	entry.ApiKeyId = actor.ApiKeyId
+	entry.IPAddress = actor.IPAddress
+	if entry.SchoolId == nil {
+		entry.SchoolId = actor.SchoolId
+	}
+	if correlationId, ok := ctx.Value(constants.CORRELATION_KEY_ID).(string); ok {
+		entry.CorrelationId = correlationId
+	}
+	entry.OccurredAt = auditOccurredAt(time.Now())
+
+	// Entries are chained one at a time, concurrent writers wait for the lock until commit
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", dto.AUDIT_LOG_TABLE).Error; err != nil {
+		return err
+	}
+
+	var last dto.AuditLog
+	err := tx.Table(dto.AUDIT_LOG_TABLE).Select("hash").Order("id DESC").Limit(1).Find(&last).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	entry.PrevHash = last.Hash
+	entry.Hash = AuditLogHash(entry.PrevHash, entry)
+
+	return tx.Table(dto.AUDIT_LOG_TABLE).Create(entry).Error
+}
+
+// auditDiff returns the fields that differ between before and after, either of which may be
+// nil for a created or deleted resource. Sensitive fields are redacted.
+func auditDiff(before, after interface{}) (*dto.JSONText, *dto.JSONText, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if beforeFields != nil && afterFields != nil {
+		for key, value := range beforeFields {
+			if other, exists := afterFields[key]; exists && reflect.DeepEqual(value, other) {
+				delete(beforeFields, key)
+				delete(afterFields, key)
+			}
+		}
+	}
+
+	beforeJSON, err := auditJSON(beforeFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterJSON, err := auditJSON(afterFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return beforeJSON, afterJSON, nil
+}
+
+// auditFields returns the JSON fields of a value with the sensitive ones redacted
+func auditFields(value interface{}) (map[string]interface{}, error) {
+	if value == nil || reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil() {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	for key := range fields {
+		if auditSensitiveFields[key] {
+			fields[key] = auditRedacted
+		}
+	}
+	return fields, nil
+}
+
+func auditJSON(fields map[string]interface{}) (*dto.JSONText, error) {
+	if fields == nil {
+		return nil, nil
+	}
+
+	// Maps are marshalled with sorted keys, so the text is stable
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	text := dto.JSONText(raw)
+	return &text, nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"testing"
+	"time"
+)
+
+// auditChain returns entries 1 to 4 chained the way appendAuditLog stores them
+func auditChain() []dto.AuditLog {
+	actorId, apiKeyId, schoolId := 5, 9, 1
+	before, after := dto.JSONText(`{"name":"Algebra 7A"}`), dto.JSONText(`{"name":"Algebra 7B"}`)
+	occurredAt := auditOccurredAt(time.Date(2026, 10, 19, 8, 30, 0, 123456789, time.UTC))
+
+	entries := []dto.AuditLog{
+		{Id: 1, ActorType: constants.AUDIT_ACTOR_SYSTEM, Action: "create", ResourceType: "school", ResourceId: "1"},
+		{Id: 2, ActorType: constants.AUDIT_ACTOR_USER, ActorId: &actorId, ActorRole: constants.ROLE_ADMIN, ApiKeyId: &apiKeyId, SchoolId: &schoolId,
+			Action: "update", ResourceType: "classroom", ResourceId: "10", Before: &before, After: &after,
+			IPAddress: "203.0.113.7", CorrelationId: "c0ffee"},
+		{Id: 3, ActorType: constants.AUDIT_ACTOR_USER, ActorId: &actorId, ActorRole: constants.ROLE_ADMIN, SchoolId: &schoolId,
+			Action: "archive", ResourceType: "classroom", ResourceId: "10"},
+		{Id: 4, ActorType: constants.AUDIT_ACTOR_SYSTEM, SchoolId: &schoolId, Action: "delete", ResourceType: "classroom", ResourceId: "11"},
+	}
+
+	prevHash := ""
+	for i := range entries {
+		entries[i].OccurredAt = occurredAt.Add(time.Duration(i) * time.Second)
+		entries[i].PrevHash = prevHash
+		entries[i].Hash = AuditLogHash(prevHash, &entries[i])
+		prevHash = entries[i].Hash
+	}
+	return entries
+}
+
+func TestVerifyAuditEntries(t *testing.T) {
+	otherId, otherText := 6, dto.JSONText(`{"name":"Geometry"}`)
+
+	tests := []struct {
+		name string
+		// change tampers with the stored entries, which are in id order
+		change      func(entries []dto.AuditLog) []dto.AuditLog
+		wantInvalid int64
+	}{
+		{name: "untouched", change: func(e []dto.AuditLog) []dto.AuditLog { return e }},
+		{name: "occurred_at", change: func(e []dto.AuditLog) []dto.AuditLog {
+			e[1].OccurredAt = e[1].OccurredAt.Add(time.Microsecond)
+			return e
+		}, wantInvalid: 2},
+		{name: "actor_type", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].ActorType = constants.AUDIT_ACTOR_SYSTEM; return e }, wantInvalid: 2},
+		{name: "actor_id", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].ActorId = &otherId; return e }, wantInvalid: 2},
+		{name: "actor_id removed", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].ActorId = nil; return e }, wantInvalid: 2},
+		{name: "actor_role", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].ActorRole = constants.ROLE_TEACHER; return e }, wantInvalid: 2},
+		{name: "api_key_id", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].ApiKeyId = nil; return e }, wantInvalid: 2},
+		{name: "school_id", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].SchoolId = &otherId; return e }, wantInvalid: 2},
+		{name: "action", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].Action = "create"; return e }, wantInvalid: 2},
+		{name: "resource_type", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].ResourceType = "user"; return e }, wantInvalid: 2},
+		{name: "resource_id", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].ResourceId = "11"; return e }, wantInvalid: 2},
+		{name: "before", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].Before = &otherText; return e }, wantInvalid: 2},
+		{name: "after removed", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].After = nil; return e }, wantInvalid: 2},
+		{name: "ip_address", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].IPAddress = "198.51.100.1"; return e }, wantInvalid: 2},
+		{name: "correlation_id", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].CorrelationId = "other"; return e }, wantInvalid: 2},
+		{name: "prev_hash", change: func(e []dto.AuditLog) []dto.AuditLog { e[1].PrevHash = e[2].Hash; return e }, wantInvalid: 2},
+		{name: "first entry", change: func(e []dto.AuditLog) []dto.AuditLog { e[0].ResourceId = "2"; return e }, wantInvalid: 1},
+		{name: "last entry", change: func(e []dto.AuditLog) []dto.AuditLog { e[3].ResourceId = "12"; return e }, wantInvalid: 4},
+		{
+			// Recomputing the hash of the edited entry breaks the link of the next one
+			name: "edited and rehashed",
+			change: func(e []dto.AuditLog) []dto.AuditLog {
+				e[1].ResourceId = "11"
+				e[1].Hash = AuditLogHash(e[1].PrevHash, &e[1])
+				return e
+			},
+			wantInvalid: 3,
+		},
+		{name: "row deleted", change: func(e []dto.AuditLog) []dto.AuditLog { return append(e[:1], e[2:]...) }, wantInvalid: 3},
+		{name: "first row deleted", change: func(e []dto.AuditLog) []dto.AuditLog { return e[1:] }, wantInvalid: 2},
+		{name: "rows reordered", change: func(e []dto.AuditLog) []dto.AuditLog { e[1], e[2] = e[2], e[1]; return e }, wantInvalid: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := tt.change(auditChain())
+			status := &dto.AuditChainStatus{Valid: true}
+			valid := verifyAuditEntries(status, entries)
+
+			if tt.wantInvalid == 0 {
+				if !valid || !status.Valid || status.FirstInvalidId != nil || status.Checked != len(entries) {
+					t.Fatalf("status = %+v, want a valid chain of %d entries", status, len(entries))
+				}
+				if status.LastHash != entries[len(entries)-1].Hash {
+					t.Errorf("LastHash = %s, want the hash of the last entry", status.LastHash)
+				}
+				return
+			}
+			if valid || status.Valid || status.FirstInvalidId == nil || *status.FirstInvalidId != tt.wantInvalid {
+				t.Fatalf("status = %+v, want first invalid id %d", status, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+// The chain is verified in batches, a batch continues from the hash the previous one ended with
+func TestVerifyAuditEntriesInBatches(t *testing.T) {
+	entries := auditChain()
+	status := &dto.AuditChainStatus{Valid: true}
+	if !verifyAuditEntries(status, entries[:2]) || !verifyAuditEntries(status, entries[2:]) {
+		t.Fatalf("status = %+v, want a valid chain", status)
+	}
+	if status.Checked != len(entries) || status.LastHash != entries[len(entries)-1].Hash {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+// Postgres keeps microseconds and rounds anything finer, the hash of an entry read back must
+// match the hash computed when it was appended
+func TestAuditOccurredAtMatchesStoredTime(t *testing.T) {
+	// stored is the timestamp Postgres returns for the time written
+	stored := func(written time.Time) time.Time {
+		return written.UTC().Round(time.Microsecond)
+	}
+
+	for _, now := range []time.Time{
+		time.Date(2026, 10, 19, 8, 30, 0, 123456789, time.UTC),
+		time.Date(2026, 10, 19, 8, 30, 0, 999999999, time.UTC),
+		time.Date(2026, 10, 19, 10, 30, 0, 500, time.FixedZone("CEST", 2*60*60)),
+		time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC),
+	} {
+		appended := dto.AuditLog{OccurredAt: auditOccurredAt(now), Action: "update"}
+		read := appended
+		read.OccurredAt = stored(appended.OccurredAt)
+		if AuditLogHash("", &appended) != AuditLogHash("", &read) {
+			t.Errorf("%s: hash of the appended entry at %s differs from the stored %s", now, appended.OccurredAt, read.OccurredAt)
+		}
+
+		// Without the truncation the nanoseconds of the clock would be hashed
+		if now.Nanosecond()%1000 != 0 {
+			raw := dto.AuditLog{OccurredAt: now, Action: "update"}
+			readRaw := raw
+			readRaw.OccurredAt = stored(now)
+			if AuditLogHash("", &raw) == AuditLogHash("", &readRaw) {
+				t.Errorf("%s: hash of the untruncated time matches the stored %s", now, readRaw.OccurredAt)
+			}
+		}
+	}
+}
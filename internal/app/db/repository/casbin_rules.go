@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+	"fmt"
+)
+
+type ICasbinRulesRepository interface {
+	GetRules(ctx context.Context) ([]dto.CasbinRule, error)
+	CountRules(ctx context.Context) (int, error)
+	AddRules(ctx context.Context, rules []dto.CasbinRule) error
+	RemoveRules(ctx context.Context, rules []dto.CasbinRule) error
+	RemoveFilteredRules(ctx context.Context, ptype string, fieldIndex int, fieldValues ...string) error
+	ReplaceRules(ctx context.Context, rules []dto.CasbinRule) error
+	NotifyRulesChanged(ctx context.Context, channel, payload string) error
+}
+
+type CasbinRulesRepository struct {
+	DBService *db.DBService
+}
+
+func NewCasbinRulesRepository(dbService *db.DBService) ICasbinRulesRepository {
+	return &CasbinRulesRepository{
+		DBService: dbService,
+	}
+}
+
+const insertCasbinRuleQuery = `INSERT INTO casbin_rules (ptype, v0, v1, v2, v3, v4, v5)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT DO NOTHING`
+
+func (r *CasbinRulesRepository) GetRules(ctx context.Context) ([]dto.CasbinRule, error) {
+	var rules []dto.CasbinRule
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.CASBIN_RULE_TABLE).Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (r *CasbinRulesRepository) CountRules(ctx context.Context) (int, error) {
+	var count int
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.CASBIN_RULE_TABLE).Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// AddRules stores the rules in one transaction, rules that already exist are skipped
+func (r *CasbinRulesRepository) AddRules(ctx context.Context, rules []dto.CasbinRule) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	for _, rule := range rules {
+		if err := tx.Exec(insertCasbinRuleQuery, rule.Ptype, rule.V0, rule.V1, rule.V2, rule.V3, rule.V4, rule.V5).Error; err != nil {
+			return err
+		}
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// RemoveRules deletes the rules in one transaction, rules that do not exist are ignored
+func (r *CasbinRulesRepository) RemoveRules(ctx context.Context, rules []dto.CasbinRule) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	for _, rule := range rules {
+		if err := tx.Table(dto.CASBIN_RULE_TABLE).
+			Where("ptype = ? AND v0 = ? AND v1 = ? AND v2 = ? AND v3 = ? AND v4 = ? AND v5 = ?",
+				rule.Ptype, rule.V0, rule.V1, rule.V2, rule.V3, rule.V4, rule.V5).
+			Delete(&dto.CasbinRule{}).Error; err != nil {
+			return err
+		}
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// RemoveFilteredRules deletes the rules of the type whose fields starting at fieldIndex equal
+// fieldValues, an empty value matches any field
+func (r *CasbinRulesRepository) RemoveFilteredRules(ctx context.Context, ptype string, fieldIndex int, fieldValues ...string) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	query := tx.Table(dto.CASBIN_RULE_TABLE).Where("ptype = ?", ptype)
+	for i, value := range fieldValues {
+		field := fieldIndex + i
+		if value == "" || field > 5 {
+			continue
+		}
+		query = query.Where(fmt.Sprintf("v%d = ?", field), value)
+	}
+
+	if err := query.Delete(&dto.CasbinRule{}).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// ReplaceRules replaces every stored rule in one transaction
+func (r *CasbinRulesRepository) ReplaceRules(ctx context.Context, rules []dto.CasbinRule) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.CASBIN_RULE_TABLE).Delete(&dto.CasbinRule{}).Error; err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err := tx.Exec(insertCasbinRuleQuery, rule.Ptype, rule.V0, rule.V1, rule.V2, rule.V3, rule.V4, rule.V5).Error; err != nil {
+			return err
+		}
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// NotifyRulesChanged sends a Postgres notification to every instance listening on the channel
+func (r *CasbinRulesRepository) NotifyRulesChanged(ctx context.Context, channel, payload string) error {
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	return tx.Exec("SELECT pg_notify(?, ?)", channel, payload).Error
+}
@@ -5,24 +5,55 @@ import (
 	"eduanalytics/internal/app/constants"
 	"eduanalytics/internal/app/db"
 	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/spec"
+	"errors"
+	"strconv"
 	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	// ErrNotEnrolled is returned when a student is not enrolled in the classroom acted on
+	ErrNotEnrolled = errors.New("student is not enrolled in the classroom")
+	// ErrClassroomArchived is returned when an archived classroom would be changed
+	ErrClassroomArchived = errors.New("classroom is archived")
+	// ErrClassroomNotArchived is returned when a classroom is purged without being archived
+	ErrClassroomNotArchived = errors.New("classroom is not archived")
 )
 
+// activeEnrollment matches the enrollments that have not ended
+const activeEnrollment = dto.STUDENT_CLASSROOM_TABLE + ".unenrolled_at IS NULL"
+
+// teacherClassrooms selects the classrooms a teacher teaches or is a member of, it takes the
+// teacher's id twice
+const teacherClassrooms = "SELECT id FROM classrooms WHERE teacher_id = ? UNION SELECT classroom_id FROM classroom_members WHERE user_id = ?"
+
 type IClassroomsRepository interface {
 	CreateClassroom(ctx context.Context, classroom *dto.Classroom) error
-	GetClassroom(ctx context.Context, where string) (*dto.Classroom, error)
+	GetClassroom(ctx context.Context, s *spec.Spec) (*dto.Classroom, error)
+	GetClassrooms(ctx context.Context, s *spec.Spec) ([]dto.Classroom, int, error)
 	GetClassroomByID(ctx context.Context, id int) (*dto.Classroom, error)
 	GetClassroomsByTeacher(ctx context.Context, teacherId int) ([]dto.Classroom, error)
-	GetClassroomsBySchool(ctx context.Context, schoolId int) ([]dto.Classroom, error)
 	UpdateClassroom(ctx context.Context, id int, classroom *dto.Classroom) error
-	DeleteClassroom(ctx context.Context, id int) error
+	ArchiveClassroom(ctx context.Context, id int) error
+	PurgeClassroom(ctx context.Context, id int, dryRun bool) (*dto.ClassroomPurge, error)
 
 	// Student-Classroom operations
 	EnrollStudents(ctx context.Context, classroomId int, studentIds []int) error
 	UnenrollStudent(ctx context.Context, classroomId int, studentId int) error
-	GetStudentsByClassroom(ctx context.Context, classroomId int) ([]dto.User, error)
+	TransferStudents(ctx context.Context, fromClassroomId int, toClassroomId int, studentIds []int) error
+	GetStudentsByClassroom(ctx context.Context, classroomId int, asOf *time.Time) ([]dto.User, error)
+	GetEnrollments(ctx context.Context, classroomId int) ([]dto.StudentClassroom, error)
 	GetClassroomsByStudent(ctx context.Context, studentId int) ([]dto.Classroom, error)
 	IsStudentEnrolled(ctx context.Context, classroomId int, studentId int) (bool, error)
+	IsStudentOfTeacher(ctx context.Context, teacherId int, studentId int) (bool, error)
+
+	// Classroom member operations
+	GetClassroomMembers(ctx context.Context, classroomId int) ([]dto.ClassroomMember, error)
+	GetClassroomMemberRole(ctx context.Context, classroomId int, userId int) (string, error)
+	AddClassroomMember(ctx context.Context, member *dto.ClassroomMember) error
+	RemoveClassroomMember(ctx context.Context, classroomId int, userId int) error
 }
 
 type ClassroomsRepository struct {
@@ -35,67 +66,82 @@ func NewClassroomsRepository(dbService *db.DBService) IClassroomsRepository {
 	}
 }
 
+// classroomFields are the columns classrooms can be filtered and sorted on
+var classroomFields = spec.NewFields("id", "name", "school_id", "teacher_id", "created_at", "archived_at")
+
 func (r *ClassroomsRepository) CreateClassroom(ctx context.Context, classroom *dto.Classroom) error {
 	tx := r.DBService.GetDB().Begin()
 	defer tx.Rollback()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
+	if err := checkTenant(ctx, classroom.SchoolId); err != nil {
+		return err
+	}
 	classroom.CreatedAt = time.Now()
 
 	if err := tx.Table(dto.CLASSROOM_TABLE).Create(classroom).Error; err != nil {
 		return err
 	}
+	if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_CREATE, classroom, nil, classroom); err != nil {
+		return err
+	}
 
 	tx.Commit()
 	return nil
 }
 
-func (r *ClassroomsRepository) GetClassroom(ctx context.Context, where string) (*dto.Classroom, error) {
+func (r *ClassroomsRepository) GetClassroom(ctx context.Context, s *spec.Spec) (*dto.Classroom, error) {
 	var classroom dto.Classroom
 
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.CLASSROOM_TABLE).Where(where).First(&classroom).Error; err != nil {
+	if err := findFirst(scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id"), s, classroomFields, &classroom); err != nil {
 		return nil, err
 	}
 
 	return &classroom, nil
 }
 
-func (r *ClassroomsRepository) GetClassroomByID(ctx context.Context, id int) (*dto.Classroom, error) {
-	var classroom dto.Classroom
+// GetClassrooms returns a page of the classrooms matching the spec and the number of matching classrooms
+func (r *ClassroomsRepository) GetClassrooms(ctx context.Context, s *spec.Spec) ([]dto.Classroom, int, error) {
+	var classrooms []dto.Classroom
 
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ?", id).First(&classroom).Error; err != nil {
-		return nil, err
+	total, err := findAll(scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id"), s, classroomFields, &classrooms)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return &classroom, nil
+	return classrooms, total, nil
 }
 
-func (r *ClassroomsRepository) GetClassroomsByTeacher(ctx context.Context, teacherId int) ([]dto.Classroom, error) {
-	var classrooms []dto.Classroom
+func (r *ClassroomsRepository) GetClassroomByID(ctx context.Context, id int) (*dto.Classroom, error) {
+	var classroom dto.Classroom
 
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.CLASSROOM_TABLE).Where("teacher_id = ?", teacherId).Find(&classrooms).Error; err != nil {
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").Where("id = ?", id).First(&classroom).Error; err != nil {
 		return nil, err
 	}
 
-	return classrooms, nil
+	return &classroom, nil
 }
 
-func (r *ClassroomsRepository) GetClassroomsBySchool(ctx context.Context, schoolId int) ([]dto.Classroom, error) {
+// GetClassroomsByTeacher returns the classrooms the teacher teaches or is a member of, archived
+// classrooms left out
+func (r *ClassroomsRepository) GetClassroomsByTeacher(ctx context.Context, teacherId int) ([]dto.Classroom, error) {
 	var classrooms []dto.Classroom
 
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.CLASSROOM_TABLE).Where("school_id = ?", schoolId).Find(&classrooms).Error; err != nil {
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").
+		Where("id IN ("+teacherClassrooms+") AND archived_at IS NULL", teacherId, teacherId).
+		Find(&classrooms).Error; err != nil {
 		return nil, err
 	}
 
@@ -107,20 +153,52 @@ func (r *ClassroomsRepository) UpdateClassroom(ctx context.Context, id int, clas
 	defer tx.Rollback()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
+	if classroom.SchoolId != 0 {
+		if err := checkTenant(ctx, classroom.SchoolId); err != nil {
+			return err
+		}
+	}
+
+	var before, after dto.Classroom
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").Where("id = ?", id).First(&before).Error; err != nil {
+		return err
+	}
 	if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ?", id).Updates(classroom).Error; err != nil {
 		return err
 	}
+	if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ?", id).First(&after).Error; err != nil {
+		return err
+	}
+	if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_UPDATE, &after, &before, &after); err != nil {
+		return err
+	}
 
 	tx.Commit()
 	return nil
 }
 
-func (r *ClassroomsRepository) DeleteClassroom(ctx context.Context, id int) error {
+// ArchiveClassroom soft deletes a classroom, its quizzes, enrollments and responses are kept for
+// reports. Archiving an archived classroom changes nothing.
+func (r *ClassroomsRepository) ArchiveClassroom(ctx context.Context, id int) error {
 	tx := r.DBService.GetDB().Begin()
 	defer tx.Rollback()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ?", id).Delete(&dto.Classroom{}).Error; err != nil {
+	var before dto.Classroom
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").Where("id = ?", id).First(&before).Error; err != nil {
+		return err
+	}
+	if before.ArchivedAt != nil {
+		return nil
+	}
+
+	after := before
+	now := time.Now()
+	after.ArchivedAt = &now
+	if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ?", id).Update("archived_at", now).Error; err != nil {
+		return err
+	}
+	if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_ARCHIVE, &before, &before, &after); err != nil {
 		return err
 	}
 
@@ -128,6 +206,88 @@ func (r *ClassroomsRepository) DeleteClassroom(ctx context.Context, id int) erro
 	return nil
 }
 
+// PurgeClassroom deletes an archived classroom with its quizzes, questions, responses, events,
+// enrollments and members in one transaction and returns what it deleted. A dry run counts the
+// rows without deleting them and works on classrooms that are not archived yet.
+func (r *ClassroomsRepository) PurgeClassroom(ctx context.Context, id int, dryRun bool) (*dto.ClassroomPurge, error) {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var classroom dto.Classroom
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").Where("id = ?", id).First(&classroom).Error; err != nil {
+		return nil, err
+	}
+	if !dryRun && classroom.ArchivedAt == nil {
+		return nil, ErrClassroomNotArchived
+	}
+
+	quizIds := tx.Table(dto.QUIZ_TABLE).Select("id").Where("classroom_id = ?", id).SubQuery()
+	questionIds := tx.Table(dto.QUESTION_TABLE).Select("id").Where("quiz_id IN ?", quizIds).SubQuery()
+	enrollmentIds := tx.Table(dto.STUDENT_CLASSROOM_TABLE).Select("id").Where("classroom_id = ?", id).SubQuery()
+
+	// Rows are deleted children first, the foreign keys of quizzes, questions and responses do
+	// not cascade
+	purge := &dto.ClassroomPurge{ClassroomId: id, DryRun: dryRun}
+	steps := []struct {
+		table string
+		model interface{}
+		query string
+		args  []interface{}
+		count *int
+	}{
+		{dto.RESPONSE_TABLE, &dto.Response{}, "question_id IN ?", []interface{}{questionIds}, &purge.Responses},
+		{dto.QUESTION_TABLE, &dto.Question{}, "quiz_id IN ?", []interface{}{quizIds}, &purge.Questions},
+		{dto.EVENT_TABLE, &dto.Event{}, "classroom_id = ? OR quiz_id IN ?", []interface{}{id, quizIds}, &purge.Events},
+		{dto.QUIZ_TABLE, &dto.Quiz{}, "classroom_id = ?", []interface{}{id}, &purge.Quizzes},
+		{dto.SOURCED_ID_TABLE, &dto.SourcedId{}, "(resource_type = ? AND local_id = ?) OR (resource_type = ? AND local_id IN ?)",
+			[]interface{}{constants.SOURCED_ID_CLASS, id, constants.SOURCED_ID_ENROLLMENT, enrollmentIds}, nil},
+		{dto.STUDENT_CLASSROOM_TABLE, &dto.StudentClassroom{}, "classroom_id = ?", []interface{}{id}, &purge.Enrollments},
+		{dto.CLASSROOM_MEMBER_TABLE, &dto.ClassroomMember{}, "classroom_id = ?", []interface{}{id}, &purge.Members},
+	}
+	for _, step := range steps {
+		query := tx.Table(step.table).Where(step.query, step.args...)
+		if step.count != nil {
+			if err := query.Count(step.count).Error; err != nil {
+				return nil, err
+			}
+		}
+		if dryRun {
+			continue
+		}
+		if err := query.Delete(step.model).Error; err != nil {
+			return nil, err
+		}
+	}
+	if dryRun {
+		return purge, nil
+	}
+
+	if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ?", id).Delete(&dto.Classroom{}).Error; err != nil {
+		return nil, err
+	}
+	if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_DELETE, &classroom, &classroom, purge); err != nil {
+		return nil, err
+	}
+
+	tx.Commit()
+	return purge, nil
+}
+
+// checkClassroomsWritable fails with ErrClassroomArchived when a classroom matching the
+// condition is archived
+func checkClassroomsWritable(tx *gorm.DB, condition string, args ...interface{}) error {
+	var archived int
+	if err := tx.Table(dto.CLASSROOM_TABLE).Where(condition, args...).Where("archived_at IS NOT NULL").
+		Count(&archived).Error; err != nil {
+		return err
+	}
+	if archived > 0 {
+		return ErrClassroomArchived
+	}
+	return nil
+}
+
 // Student-Classroom operations
 
 func (r *ClassroomsRepository) EnrollStudents(ctx context.Context, classroomId int, studentIds []int) error {
@@ -135,33 +295,125 @@ func (r *ClassroomsRepository) EnrollStudents(ctx context.Context, classroomId i
 	defer tx.Rollback()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
+	var classroom dto.Classroom
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").Where("id = ?", classroomId).First(&classroom).Error; err != nil {
+		return err
+	}
+
 	for _, studentId := range studentIds {
+		if err := checkTenantRow(ctx, tx, dto.USER_TABLE, studentId); err != nil {
+			return err
+		}
+
 		studentClassroom := dto.StudentClassroom{
 			StudentId:   studentId,
 			ClassroomId: classroomId,
 			EnrolledAt:  time.Now(),
+			Status:      constants.ENROLLMENT_STATUS_ACTIVE,
 		}
 
-		// Use FirstOrCreate to avoid duplicates
+		// Use FirstOrCreate to avoid duplicates, a student who left the classroom is enrolled anew
 		if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
-			Where("student_id = ? AND classroom_id = ?", studentId, classroomId).
+			Where("student_id = ? AND classroom_id = ? AND "+activeEnrollment, studentId, classroomId).
 			FirstOrCreate(&studentClassroom).Error; err != nil {
 			return err
 		}
 	}
 
+	after := map[string]interface{}{"student_ids": studentIds}
+	if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_ENROLL, &classroom, nil, after); err != nil {
+		return err
+	}
+
 	tx.Commit()
 	return nil
 }
 
+// UnenrollStudent ends the student's enrollment as dropped, the enrollment is kept for reports
 func (r *ClassroomsRepository) UnenrollStudent(ctx context.Context, classroomId int, studentId int) error {
 	tx := r.DBService.GetDB().Begin()
 	defer tx.Rollback()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
+	var classroom dto.Classroom
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").Where("id = ?", classroomId).First(&classroom).Error; err != nil {
+		return err
+	}
+	// Unenrolling a student who is not enrolled changes nothing and is not audited
+	var before dto.StudentClassroom
 	if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
-		Where("student_id = ? AND classroom_id = ?", studentId, classroomId).
-		Delete(&dto.StudentClassroom{}).Error; err != nil {
+		Where("student_id = ? AND classroom_id = ? AND "+activeEnrollment, studentId, classroomId).
+		First(&before).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	}
+	after, err := endEnrollment(tx, &before, constants.ENROLLMENT_STATUS_DROPPED, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_UNENROLL, &classroom, &before, after); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// TransferStudents moves students from one classroom to another in one transaction. Their
+// enrollments in the source classroom end as transferred; students already enrolled in the
+// target classroom keep that enrollment. Nothing is moved unless every student is enrolled in the
+// source classroom.
+func (r *ClassroomsRepository) TransferStudents(ctx context.Context, fromClassroomId int, toClassroomId int, studentIds []int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var from, to dto.Classroom
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").Where("id = ?", fromClassroomId).First(&from).Error; err != nil {
+		return err
+	}
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").Where("id = ?", toClassroomId).First(&to).Error; err != nil {
+		return err
+	}
+	if from.SchoolId != to.SchoolId {
+		return ErrTenantMismatch
+	}
+
+	now := time.Now()
+	for _, studentId := range studentIds {
+		var enrollment dto.StudentClassroom
+		if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
+			Where("student_id = ? AND classroom_id = ? AND "+activeEnrollment, studentId, fromClassroomId).
+			First(&enrollment).Error; gorm.IsRecordNotFoundError(err) {
+			return ErrNotEnrolled
+		} else if err != nil {
+			return err
+		}
+		if _, err := endEnrollment(tx, &enrollment, constants.ENROLLMENT_STATUS_TRANSFERRED, now); err != nil {
+			return err
+		}
+
+		transferred := dto.StudentClassroom{
+			StudentId:   studentId,
+			ClassroomId: toClassroomId,
+			EnrolledAt:  now,
+			Status:      constants.ENROLLMENT_STATUS_ACTIVE,
+		}
+		if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
+			Where("student_id = ? AND classroom_id = ? AND "+activeEnrollment, studentId, toClassroomId).
+			FirstOrCreate(&transferred).Error; err != nil {
+			return err
+		}
+	}
+
+	out := map[string]interface{}{"student_ids": studentIds, "to_classroom_id": toClassroomId}
+	if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_TRANSFER, &from, nil, out); err != nil {
+		return err
+	}
+	in := map[string]interface{}{"student_ids": studentIds, "from_classroom_id": fromClassroomId}
+	if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_TRANSFER, &to, nil, in); err != nil {
 		return err
 	}
 
@@ -169,15 +421,23 @@ func (r *ClassroomsRepository) UnenrollStudent(ctx context.Context, classroomId
 	return nil
 }
 
-func (r *ClassroomsRepository) GetStudentsByClassroom(ctx context.Context, classroomId int) ([]dto.User, error) {
+// GetStudentsByClassroom returns the students enrolled in the classroom, or those enrolled at
+// asOf when it is set
+func (r *ClassroomsRepository) GetStudentsByClassroom(ctx context.Context, classroomId int, asOf *time.Time) ([]dto.User, error) {
 	var students []dto.User
 
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.USER_TABLE).
-		Joins("JOIN "+dto.STUDENT_CLASSROOM_TABLE+" ON "+dto.USER_TABLE+".id = "+dto.STUDENT_CLASSROOM_TABLE+".student_id").
-		Where(dto.STUDENT_CLASSROOM_TABLE+".classroom_id = ?", classroomId).
+	// A student who left and rejoined has several enrollments, the subquery lists them once
+	enrolled := tx.Table(dto.STUDENT_CLASSROOM_TABLE).Select("student_id").Where("classroom_id = ?", classroomId)
+	if asOf != nil {
+		enrolled = enrolled.Where("enrolled_at <= ? AND (unenrolled_at IS NULL OR unenrolled_at > ?)", *asOf, *asOf)
+	} else {
+		enrolled = enrolled.Where(activeEnrollment)
+	}
+	if err := scopeTenant(ctx, tx.Table(dto.USER_TABLE), "school_id").
+		Where("id IN ?", enrolled.SubQuery()).
 		Find(&students).Error; err != nil {
 		return nil, err
 	}
@@ -185,15 +445,33 @@ func (r *ClassroomsRepository) GetStudentsByClassroom(ctx context.Context, class
 	return students, nil
 }
 
+// GetEnrollments returns the enrollment history of the classroom, ended enrollments included
+func (r *ClassroomsRepository) GetEnrollments(ctx context.Context, classroomId int) ([]dto.StudentClassroom, error) {
+	var enrollments []dto.StudentClassroom
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := scopeTenantClassrooms(ctx, tx.Table(dto.STUDENT_CLASSROOM_TABLE), "classroom_id").
+		Where("classroom_id = ?", classroomId).
+		Order("enrolled_at, id").
+		Find(&enrollments).Error; err != nil {
+		return nil, err
+	}
+
+	return enrollments, nil
+}
+
 func (r *ClassroomsRepository) GetClassroomsByStudent(ctx context.Context, studentId int) ([]dto.Classroom, error) {
 	var classrooms []dto.Classroom
 
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.CLASSROOM_TABLE).
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), dto.CLASSROOM_TABLE+".school_id").
 		Joins("JOIN "+dto.STUDENT_CLASSROOM_TABLE+" ON "+dto.CLASSROOM_TABLE+".id = "+dto.STUDENT_CLASSROOM_TABLE+".classroom_id").
-		Where(dto.STUDENT_CLASSROOM_TABLE+".student_id = ?", studentId).
+		Where(dto.STUDENT_CLASSROOM_TABLE+".student_id = ? AND "+activeEnrollment, studentId).
+		Where(dto.CLASSROOM_TABLE + ".archived_at IS NULL").
 		Find(&classrooms).Error; err != nil {
 		return nil, err
 	}
@@ -208,10 +486,167 @@ func (r *ClassroomsRepository) IsStudentEnrolled(ctx context.Context, classroomI
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
 	if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
-		Where("student_id = ? AND classroom_id = ?", studentId, classroomId).
+		Where("student_id = ? AND classroom_id = ? AND "+activeEnrollment, studentId, classroomId).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// IsStudentOfTeacher reports whether the student is enrolled in any classroom the teacher teaches
+// or is a member of
+func (r *ClassroomsRepository) IsStudentOfTeacher(ctx context.Context, teacherId int, studentId int) (bool, error) {
+	var count int
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
+		Where("student_id = ? AND "+activeEnrollment, studentId).
+		Where("classroom_id IN ("+teacherClassrooms+")", teacherId, teacherId).
 		Count(&count).Error; err != nil {
 		return false, err
 	}
 
 	return count > 0, nil
 }
+
+// endEnrollment ends an active enrollment with the status saying why and returns it as ended
+func endEnrollment(tx *gorm.DB, enrollment *dto.StudentClassroom, status string, at time.Time) (*dto.StudentClassroom, error) {
+	if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).Where("id = ?", enrollment.Id).
+		Updates(map[string]interface{}{"status": status, "unenrolled_at": at}).Error; err != nil {
+		return nil, err
+	}
+
+	ended := *enrollment
+	ended.Status = status
+	ended.UnenrolledAt = &at
+	return &ended, nil
+}
+
+// Classroom member operations
+
+// GetClassroomMembers returns the co-teachers and assistants of the classroom
+func (r *ClassroomsRepository) GetClassroomMembers(ctx context.Context, classroomId int) ([]dto.ClassroomMember, error) {
+	var members []dto.ClassroomMember
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := scopeTenantClassrooms(ctx, tx.Table(dto.CLASSROOM_MEMBER_TABLE), "classroom_id").
+		Where("classroom_id = ?", classroomId).
+		Order("added_at, id").
+		Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetClassroomMemberRole returns the user's role in the classroom, empty if the user is not a member
+func (r *ClassroomsRepository) GetClassroomMemberRole(ctx context.Context, classroomId int, userId int) (string, error) {
+	var member dto.ClassroomMember
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.CLASSROOM_MEMBER_TABLE).
+		Where("classroom_id = ? AND user_id = ?", classroomId, userId).
+		First(&member).Error; gorm.IsRecordNotFoundError(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return member.Role, nil
+}
+
+// AddClassroomMember adds a member to a classroom or changes the role of an existing member
+func (r *ClassroomsRepository) AddClassroomMember(ctx context.Context, member *dto.ClassroomMember) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var classroom dto.Classroom
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").Where("id = ?", member.ClassroomId).First(&classroom).Error; err != nil {
+		return err
+	}
+	if err := checkTenantRow(ctx, tx, dto.USER_TABLE, member.UserId); err != nil {
+		return err
+	}
+
+	var before *dto.ClassroomMember
+	var existing dto.ClassroomMember
+	err := tx.Table(dto.CLASSROOM_MEMBER_TABLE).
+		Where("classroom_id = ? AND user_id = ?", member.ClassroomId, member.UserId).
+		First(&existing).Error
+	switch {
+	case err == nil:
+		before = &existing
+		if err := tx.Table(dto.CLASSROOM_MEMBER_TABLE).Where("id = ?", existing.Id).
+			Update("role", member.Role).Error; err != nil {
+			return err
+		}
+		member.Id = existing.Id
+		member.AddedAt = existing.AddedAt
+	case gorm.IsRecordNotFoundError(err):
+		member.AddedAt = time.Now()
+		if err := tx.Table(dto.CLASSROOM_MEMBER_TABLE).Create(member).Error; err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_MEMBER, &classroom, before, member); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// RemoveClassroomMember removes a member from a classroom
+func (r *ClassroomsRepository) RemoveClassroomMember(ctx context.Context, classroomId int, userId int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var classroom dto.Classroom
+	if err := scopeTenant(ctx, tx.Table(dto.CLASSROOM_TABLE), "school_id").Where("id = ?", classroomId).First(&classroom).Error; err != nil {
+		return err
+	}
+	var before dto.ClassroomMember
+	if err := tx.Table(dto.CLASSROOM_MEMBER_TABLE).
+		Where("classroom_id = ? AND user_id = ?", classroomId, userId).
+		First(&before).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.CLASSROOM_MEMBER_TABLE).Where("id = ?", before.Id).Delete(&dto.ClassroomMember{}).Error; err != nil {
+		return err
+	}
+	if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_UNMEMBER, &classroom, &before, nil); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// auditClassroom records a change of a classroom or its enrollments in the audit log
+func auditClassroom(ctx context.Context, tx *gorm.DB, action string, classroom *dto.Classroom, before, after interface{}) error {
+	beforeData, afterData, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	return appendAuditLog(ctx, tx, &dto.AuditLog{
+		Action:       action,
+		ResourceType: constants.AUDIT_RESOURCE_CLASSROOM,
+		ResourceId:   strconv.Itoa(classroom.Id),
+		SchoolId:     &classroom.SchoolId,
+		Before:       beforeData,
+		After:        afterData,
+	})
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+)
+
+type IDashboardsRepository interface {
+	GetStudentQuizzes(ctx context.Context, studentId int) ([]dto.StudentQuiz, error)
+	GetTeacherClassrooms(ctx context.Context, teacherId int) ([]dto.TeacherClassroom, error)
+	GetTeacherQuizzes(ctx context.Context, teacherId int) ([]dto.TeacherQuiz, error)
+	CountTeacherStudents(ctx context.Context, teacherId int) (int, error)
+}
+
+type DashboardsRepository struct {
+	DBService *db.DBService
+}
+
+func NewDashboardsRepository(dbService *db.DBService) IDashboardsRepository {
+	return &DashboardsRepository{
+		DBService: dbService,
+	}
+}
+
+// GetStudentQuizzes returns the quizzes of the active classrooms the student is enrolled in, by start
+// time, with the distinct questions the student answered and answered correctly
+func (r *DashboardsRepository) GetStudentQuizzes(ctx context.Context, studentId int) ([]dto.StudentQuiz, error) {
+	query := `
+        SELECT z.id, z.title, z.classroom_id, c.name AS classroom_name, z.start_time, z.end_time,
+        (SELECT COUNT(*) FROM questions qc WHERE qc.quiz_id = z.id) AS questions,
+        COUNT(DISTINCT r.question_id) AS answered,
+        COUNT(DISTINCT CASE WHEN r.correct THEN r.question_id END) AS correct,
+        MAX(r.submitted_at) AS last_submitted_at
+        FROM quizzes z
+        JOIN classrooms c ON c.id = z.classroom_id
+        JOIN student_classrooms sc ON sc.classroom_id = c.id AND sc.student_id = ? AND sc.unenrolled_at IS NULL
+        LEFT JOIN questions q ON q.quiz_id = z.id
+        LEFT JOIN responses r ON r.question_id = q.id AND r.student_id = sc.student_id
+        WHERE c.archived_at IS NULL AND (CAST(? AS INT) IS NULL OR c.school_id = ?)
+        GROUP BY z.id, c.name
+        ORDER BY z.start_time, z.id;
+    `
+	var quizzes []dto.StudentQuiz
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	tenant := tenantParam(ctx)
+	if err := tx.Raw(query, studentId, tenant, tenant).Scan(&quizzes).Error; err != nil {
+		return nil, err
+	}
+	return quizzes, nil
+}
+
+// GetTeacherClassrooms returns the active classrooms the teacher teaches or is a member of by
+// name with their student counts
+func (r *DashboardsRepository) GetTeacherClassrooms(ctx context.Context, teacherId int) ([]dto.TeacherClassroom, error) {
+	query := `
+        SELECT c.id, c.name, c.school_id, c.teacher_id, c.created_at, COUNT(sc.id) AS students
+        FROM classrooms c
+        LEFT JOIN student_classrooms sc ON sc.classroom_id = c.id AND sc.unenrolled_at IS NULL
+        WHERE c.id IN (` + teacherClassrooms + `) AND c.archived_at IS NULL AND (CAST(? AS INT) IS NULL OR c.school_id = ?)
+        GROUP BY c.id
+        ORDER BY c.name, c.id;
+    `
+	var classrooms []dto.TeacherClassroom
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	tenant := tenantParam(ctx)
+	if err := tx.Raw(query, teacherId, teacherId, tenant, tenant).Scan(&classrooms).Error; err != nil {
+		return nil, err
+	}
+	return classrooms, nil
+}
+
+// GetTeacherQuizzes returns the quizzes of the teacher's active classrooms by start time with the
+// students who answered them and their responses
+func (r *DashboardsRepository) GetTeacherQuizzes(ctx context.Context, teacherId int) ([]dto.TeacherQuiz, error) {
+	query := `
+        SELECT z.id, z.title, z.classroom_id, c.name AS classroom_name, z.start_time, z.end_time,
+        (SELECT COUNT(*) FROM questions qc WHERE qc.quiz_id = z.id) AS questions,
+        (SELECT COUNT(*) FROM student_classrooms sc WHERE sc.classroom_id = c.id AND sc.unenrolled_at IS NULL) AS students,
+        COUNT(DISTINCT r.student_id) AS participants,
+        COUNT(r.id) AS attempts,
+        COUNT(CASE WHEN r.correct THEN 1 END) AS correct
+        FROM quizzes z
+        JOIN classrooms c ON c.id = z.classroom_id
+        LEFT JOIN questions q ON q.quiz_id = z.id
+        LEFT JOIN responses r ON r.question_id = q.id
+        WHERE c.id IN (` + teacherClassrooms + `) AND c.archived_at IS NULL AND (CAST(? AS INT) IS NULL OR c.school_id = ?)
+        GROUP BY z.id, c.id
+        ORDER BY z.start_time, z.id;
+    `
+	var quizzes []dto.TeacherQuiz
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	tenant := tenantParam(ctx)
+	if err := tx.Raw(query, teacherId, teacherId, tenant, tenant).Scan(&quizzes).Error; err != nil {
+		return nil, err
+	}
+	return quizzes, nil
+}
+
+// CountTeacherStudents returns the number of distinct students enrolled in the teacher's active
+// classrooms
+func (r *DashboardsRepository) CountTeacherStudents(ctx context.Context, teacherId int) (int, error) {
+	var count int
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := scopeTenantClassrooms(ctx, tx.Table(dto.STUDENT_CLASSROOM_TABLE), "classroom_id").
+		Where("classroom_id IN ("+teacherClassrooms+") AND "+activeEnrollment, teacherId, teacherId).
+		Where("classroom_id IN (SELECT id FROM classrooms WHERE archived_at IS NULL)").
+		Select("COUNT(DISTINCT student_id)").Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
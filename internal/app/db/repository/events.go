@@ -5,11 +5,13 @@ import (
 	"eduanalytics/internal/app/constants"
 	"eduanalytics/internal/app/db"
 	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/spec"
 )
 
 type IEventsRepository interface {
 	CreateEvent(ctx context.Context, event *dto.Event) error
-	GetEvent(ctx context.Context, where string) (*dto.Event, error)
+	GetEvent(ctx context.Context, s *spec.Spec) (*dto.Event, error)
+	GetEvents(ctx context.Context, s *spec.Spec) ([]dto.Event, int, error)
 }
 
 type EventsRepository struct {
@@ -22,25 +24,50 @@ func NewEventsRepository(dbService *db.DBService) IEventsRepository {
 	}
 }
 
+// eventFields are the columns events can be filtered and sorted on
+var eventFields = spec.NewFields("id", "event_name", "app", "user_id", "quiz_id", "classroom_id", "timestamp")
+
 func (r *EventsRepository) CreateEvent(ctx context.Context, event *dto.Event) error {
 	tx := r.DBService.GetDB().Begin()
 	defer tx.Rollback()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.EVENT_TABLE).Create(event).Error; err != nil {
+	query := tx.Table(dto.EVENT_TABLE)
+	// Events of no user, such as the lockout of an IP trying unknown accounts, have no user_id
+	if event.UserId == 0 {
+		query = query.Omit("user_id")
+	}
+	if err := query.Create(event).Error; err != nil {
 		return err
 	}
 	tx.Commit()
 	return nil
 }
 
-func (r *EventsRepository) GetEvent(ctx context.Context, where string) (*dto.Event, error) {
+func (r *EventsRepository) GetEvent(ctx context.Context, s *spec.Spec) (*dto.Event, error) {
+	var event dto.Event
+
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
-	var event dto.Event
 
-	if err := tx.Table(dto.EVENT_TABLE).Where(where).First(&event).Error; err != nil {
+	if err := findFirst(scopeTenantUsers(ctx, tx.Table(dto.EVENT_TABLE), "user_id"), s, eventFields, &event); err != nil {
 		return &event, err
 	}
+
 	return &event, nil
 }
+
+// GetEvents returns a page of the events matching the spec and the number of matching events
+func (r *EventsRepository) GetEvents(ctx context.Context, s *spec.Spec) ([]dto.Event, int, error) {
+	var events []dto.Event
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	total, err := findAll(scopeTenantUsers(ctx, tx.Table(dto.EVENT_TABLE), "user_id"), s, eventFields, &events)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type IIdentityProvidersRepository interface {
+	GetProvider(ctx context.Context, id int) (*dto.IdentityProvider, error)
+	GetProviderBySchool(ctx context.Context, schoolId int) (*dto.IdentityProvider, error)
+	SaveProvider(ctx context.Context, provider *dto.IdentityProvider) error
+	DeleteProvider(ctx context.Context, schoolId int) error
+	GetIdentity(ctx context.Context, providerId int, subject string) (*dto.UserIdentity, error)
+	LinkIdentity(ctx context.Context, identity *dto.UserIdentity) error
+	ProvisionUser(ctx context.Context, user *dto.User, identity *dto.UserIdentity) error
+	TouchIdentity(ctx context.Context, id int) error
+}
+
+type IdentityProvidersRepository struct {
+	DBService *db.DBService
+}
+
+func NewIdentityProvidersRepository(dbService *db.DBService) IIdentityProvidersRepository {
+	return &IdentityProvidersRepository{
+		DBService: dbService,
+	}
+}
+
+func (r *IdentityProvidersRepository) GetProvider(ctx context.Context, id int) (*dto.IdentityProvider, error) {
+	var provider dto.IdentityProvider
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.IDENTITY_PROVIDER_TABLE).Where("id = ?", id).First(&provider).Error; err != nil {
+		return nil, err
+	}
+
+	return &provider, nil
+}
+
+func (r *IdentityProvidersRepository) GetProviderBySchool(ctx context.Context, schoolId int) (*dto.IdentityProvider, error) {
+	var provider dto.IdentityProvider
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.IDENTITY_PROVIDER_TABLE).Where("school_id = ?", schoolId).First(&provider).Error; err != nil {
+		return nil, err
+	}
+
+	return &provider, nil
+}
+
+// SaveProvider creates the provider of the school or replaces its settings
+func (r *IdentityProvidersRepository) SaveProvider(ctx context.Context, provider *dto.IdentityProvider) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	now := time.Now()
+	provider.UpdatedAt = now
+
+	var existing dto.IdentityProvider
+	err := tx.Table(dto.IDENTITY_PROVIDER_TABLE).Where("school_id = ?", provider.SchoolId).First(&existing).Error
+	switch {
+	case err == nil:
+		provider.Id = existing.Id
+		provider.CreatedAt = existing.CreatedAt
+		if err := tx.Table(dto.IDENTITY_PROVIDER_TABLE).Where("id = ?", existing.Id).Updates(map[string]interface{}{
+			"issuer":        provider.Issuer,
+			"client_id":     provider.ClientId,
+			"client_secret": provider.ClientSecret,
+			"scopes":        provider.Scopes,
+			"role_claim":    provider.RoleClaim,
+			"role_mapping":  provider.RoleMapping,
+			"default_role":  provider.DefaultRole,
+			"enabled":       provider.Enabled,
+			"updated_at":    now,
+		}).Error; err != nil {
+			return err
+		}
+	case gorm.IsRecordNotFoundError(err):
+		provider.CreatedAt = now
+		if err := tx.Table(dto.IDENTITY_PROVIDER_TABLE).Create(provider).Error; err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (r *IdentityProvidersRepository) DeleteProvider(ctx context.Context, schoolId int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.IDENTITY_PROVIDER_TABLE).Where("school_id = ?", schoolId).Delete(&dto.IdentityProvider{}).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (r *IdentityProvidersRepository) GetIdentity(ctx context.Context, providerId int, subject string) (*dto.UserIdentity, error) {
+	var identity dto.UserIdentity
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.USER_IDENTITY_TABLE).
+		Where("provider_id = ? AND subject = ?", providerId, subject).
+		First(&identity).Error; err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+// LinkIdentity links an existing user to a provider subject
+func (r *IdentityProvidersRepository) LinkIdentity(ctx context.Context, identity *dto.UserIdentity) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	now := time.Now()
+	identity.CreatedAt = now
+	identity.LastLoginAt = &now
+
+	if err := tx.Table(dto.USER_IDENTITY_TABLE).Create(identity).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// ProvisionUser creates a user and its identity in one transaction
+func (r *IdentityProvidersRepository) ProvisionUser(ctx context.Context, user *dto.User, identity *dto.UserIdentity) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	now := time.Now()
+	user.CreatedAt = now
+	if err := tx.Table(dto.USER_TABLE).Create(user).Error; err != nil {
+		return err
+	}
+	if err := assignBaseRole(tx, user.Id, user.Role); err != nil {
+		return err
+	}
+
+	identity.UserId = user.Id
+	identity.CreatedAt = now
+	identity.LastLoginAt = &now
+	if err := tx.Table(dto.USER_IDENTITY_TABLE).Create(identity).Error; err != nil {
+		return err
+	}
+	if err := auditUser(ctx, tx, constants.AUDIT_USER_CREATE, user.Id, nil, user); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// TouchIdentity records a login through the identity
+func (r *IdentityProvidersRepository) TouchIdentity(ctx context.Context, id int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.USER_IDENTITY_TABLE).Where("id = ?", id).Update("last_login_at", time.Now()).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
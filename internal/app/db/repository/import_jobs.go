@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+	"time"
+)
+
+type IImportJobsRepository interface {
+	CreateImportJob(ctx context.Context, job *dto.ImportJob) error
+	GetImportJob(ctx context.Context, id int) (*dto.ImportJob, error)
+	StartImportJob(ctx context.Context, id int) error
+	FinishImportJob(ctx context.Context, job *dto.ImportJob) error
+	FailStaleImportJobs(ctx context.Context, createdBefore time.Time, reason string) (int, error)
+}
+
+type ImportJobsRepository struct {
+	DBService *db.DBService
+}
+
+func NewImportJobsRepository(dbService *db.DBService) IImportJobsRepository {
+	return &ImportJobsRepository{
+		DBService: dbService,
+	}
+}
+
+func (r *ImportJobsRepository) CreateImportJob(ctx context.Context, job *dto.ImportJob) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var schoolId int
+	if job.SchoolId != nil {
+		schoolId = *job.SchoolId
+	}
+	if err := checkTenant(ctx, schoolId); err != nil {
+		return err
+	}
+	job.Status = constants.IMPORT_STATUS_PENDING
+	job.CreatedAt = time.Now()
+
+	if err := tx.Table(dto.IMPORT_JOB_TABLE).Create(job).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// GetImportJob returns an import job of the tenant
+func (r *ImportJobsRepository) GetImportJob(ctx context.Context, id int) (*dto.ImportJob, error) {
+	var job dto.ImportJob
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := scopeTenant(ctx, tx.Table(dto.IMPORT_JOB_TABLE), "school_id").Where("id = ?", id).First(&job).Error; err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// StartImportJob marks a pending job as running
+func (r *ImportJobsRepository) StartImportJob(ctx context.Context, id int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.IMPORT_JOB_TABLE).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     constants.IMPORT_STATUS_RUNNING,
+		"started_at": time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// FinishImportJob stores the status, counts, summary, report and error of a finished job
+func (r *ImportJobsRepository) FinishImportJob(ctx context.Context, job *dto.ImportJob) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	now := time.Now()
+	job.FinishedAt = &now
+	if err := tx.Table(dto.IMPORT_JOB_TABLE).Where("id = ?", job.Id).Updates(map[string]interface{}{
+		"status":      job.Status,
+		"total_rows":  job.TotalRows,
+		"error_rows":  job.ErrorRows,
+		"summary":     job.Summary,
+		"report":      job.Report,
+		"error":       job.Error,
+		"finished_at": now,
+	}).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// FailStaleImportJobs fails the jobs created before the time that are still pending or running.
+// Their files were only held in memory by an instance that stopped before finishing them.
+func (r *ImportJobsRepository) FailStaleImportJobs(ctx context.Context, createdBefore time.Time, reason string) (int, error) {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	result := tx.Table(dto.IMPORT_JOB_TABLE).
+		Where("status IN (?) AND created_at < ?", []string{constants.IMPORT_STATUS_PENDING, constants.IMPORT_STATUS_RUNNING}, createdBefore).
+		Updates(map[string]interface{}{
+			"status":      constants.IMPORT_STATUS_FAILED,
+			"error":       reason,
+			"finished_at": time.Now(),
+		})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	tx.Commit()
+	return int(result.RowsAffected), nil
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrMfaCodeAlreadyUsed      = errors.New("mfa code already used")
+	ErrRecoveryCodeNotFound    = errors.New("recovery code not found")
+	ErrMfaEnrollmentNotPending = errors.New("no pending mfa enrollment")
+)
+
+type IMfaRepository interface {
+	GetMfa(ctx context.Context, userId int) (*dto.UserMfa, error)
+	SavePendingMfa(ctx context.Context, userId int, secret string) error
+	EnableMfa(ctx context.Context, userId int, step int64, recoveryCodeHashes []string) error
+	DisableMfa(ctx context.Context, userId int) error
+	UseStep(ctx context.Context, userId int, step int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userId int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userId int, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, userId int) (int, error)
+	GetRoleRequirements(ctx context.Context) ([]dto.MfaRoleRequirement, error)
+	IsRequiredForRole(ctx context.Context, role string) (bool, error)
+	SetRoleRequirement(ctx context.Context, role string, required bool) error
+}
+
+type MfaRepository struct {
+	DBService *db.DBService
+}
+
+func NewMfaRepository(dbService *db.DBService) IMfaRepository {
+	return &MfaRepository{
+		DBService: dbService,
+	}
+}
+
+func (r *MfaRepository) GetMfa(ctx context.Context, userId int) (*dto.UserMfa, error) {
+	var mfa dto.UserMfa
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.USER_MFA_TABLE).Where("user_id = ?", userId).First(&mfa).Error; err != nil {
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+// SavePendingMfa starts or restarts an enrollment, an enabled second factor is never replaced
+func (r *MfaRepository) SavePendingMfa(ctx context.Context, userId int, secret string) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Exec(`INSERT INTO `+dto.USER_MFA_TABLE+` (user_id, secret, enabled, created_at)
+		VALUES (?, ?, FALSE, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at
+		WHERE `+dto.USER_MFA_TABLE+`.enabled = FALSE`, userId, secret, time.Now()).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// EnableMfa confirms a pending enrollment and stores its first recovery codes
+func (r *MfaRepository) EnableMfa(ctx context.Context, userId int, step int64, recoveryCodeHashes []string) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	result := tx.Table(dto.USER_MFA_TABLE).
+		Where("user_id = ? AND enabled = FALSE", userId).
+		Updates(map[string]interface{}{
+			"enabled":        true,
+			"enabled_at":     time.Now(),
+			"last_used_step": step,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMfaEnrollmentNotPending
+	}
+
+	if err := replaceRecoveryCodes(tx, userId, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (r *MfaRepository) DisableMfa(ctx context.Context, userId int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.MFA_RECOVERY_CODE_TABLE).Where("user_id = ?", userId).Delete(&dto.MfaRecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.USER_MFA_TABLE).Where("user_id = ?", userId).Delete(&dto.UserMfa{}).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// UseStep records the time step of an accepted code, it fails with ErrMfaCodeAlreadyUsed when the
+// step or a later one was already used so that every code is accepted only once
+func (r *MfaRepository) UseStep(ctx context.Context, userId int, step int64) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	result := tx.Table(dto.USER_MFA_TABLE).
+		Where("user_id = ? AND last_used_step < ?", userId, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMfaCodeAlreadyUsed
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (r *MfaRepository) ReplaceRecoveryCodes(ctx context.Context, userId int, codeHashes []string) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := replaceRecoveryCodes(tx, userId, codeHashes); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// UseRecoveryCode consumes an unused recovery code of the user
+func (r *MfaRepository) UseRecoveryCode(ctx context.Context, userId int, codeHash string) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	result := tx.Table(dto.MFA_RECOVERY_CODE_TABLE).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left
+func (r *MfaRepository) CountRecoveryCodes(ctx context.Context, userId int) (int, error) {
+	var count int
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.MFA_RECOVERY_CODE_TABLE).
+		Where("user_id = ? AND used_at IS NULL", userId).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *MfaRepository) GetRoleRequirements(ctx context.Context) ([]dto.MfaRoleRequirement, error) {
+	var requirements []dto.MfaRoleRequirement
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.MFA_REQUIREMENT_TABLE).Order("role").Find(&requirements).Error; err != nil {
+		return nil, err
+	}
+
+	return requirements, nil
+}
+
+func (r *MfaRepository) IsRequiredForRole(ctx context.Context, role string) (bool, error) {
+	var requirements []dto.MfaRoleRequirement
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.MFA_REQUIREMENT_TABLE).Where("role = ?", role).Find(&requirements).Error; err != nil {
+		return false, err
+	}
+
+	return len(requirements) > 0 && requirements[0].Required, nil
+}
+
+func (r *MfaRepository) SetRoleRequirement(ctx context.Context, role string, required bool) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Exec(`INSERT INTO `+dto.MFA_REQUIREMENT_TABLE+` (role, required, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (role) DO UPDATE SET required = EXCLUDED.required, updated_at = EXCLUDED.updated_at`,
+		role, required, time.Now()).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// replaceRecoveryCodes deletes every recovery code of the user and stores new ones within tx
+func replaceRecoveryCodes(tx *gorm.DB, userId int, codeHashes []string) error {
+	if err := tx.Table(dto.MFA_RECOVERY_CODE_TABLE).Where("user_id = ?", userId).Delete(&dto.MfaRecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, hash := range codeHashes {
+		code := dto.MfaRecoveryCode{UserId: userId, CodeHash: hash, CreatedAt: now}
+		if err := tx.Table(dto.MFA_RECOVERY_CODE_TABLE).Create(&code).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+type IOneRosterRepository interface {
+	GetOneRosterDirectory(ctx context.Context, schoolId int, sourcedIds []string, emails []string) (*dto.OneRosterDirectory, error)
+	ApplyOneRoster(ctx context.Context, plan *dto.OneRosterPlan, passwordHash string) ([]dto.User, error)
+	GetOneRosterExport(ctx context.Context, schoolId int) (*dto.OneRosterExport, error)
+}
+
+type OneRosterRepository struct {
+	DBService *db.DBService
+}
+
+func NewOneRosterRepository(dbService *db.DBService) IOneRosterRepository {
+	return &OneRosterRepository{
+		DBService: dbService,
+	}
+}
+
+// GetOneRosterDirectory returns the mappings of the sourcedIds, in the school or, for a district
+// import with schoolId 0, in any school, with the schools, users, classrooms and enrollments they
+// map to. Users with the emails are returned from any school, as email addresses are unique
+// across schools.
+func (r *OneRosterRepository) GetOneRosterDirectory(ctx context.Context, schoolId int, sourcedIds []string, emails []string) (*dto.OneRosterDirectory, error) {
+	dir := &dto.OneRosterDirectory{SchoolId: schoolId}
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := checkTenant(ctx, schoolId); err != nil {
+		return nil, err
+	}
+
+	if len(sourcedIds) > 0 {
+		query := tx.Table(dto.SOURCED_ID_TABLE).Where("sourced_id IN (?)", sourcedIds)
+		if schoolId != 0 {
+			query = query.Where("school_id = ?", schoolId)
+		}
+		if err := query.Find(&dir.Mappings).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	localIds := map[string][]int{}
+	for _, mapping := range dir.Mappings {
+		localIds[mapping.ResourceType] = append(localIds[mapping.ResourceType], mapping.LocalId)
+	}
+	if schoolId != 0 {
+		localIds[constants.SOURCED_ID_ORG] = append(localIds[constants.SOURCED_ID_ORG], schoolId)
+	}
+
+	if ids := localIds[constants.SOURCED_ID_ORG]; len(ids) > 0 {
+		if err := tx.Table(dto.SCHOOL_TABLE).Where("id IN (?)", ids).Find(&dir.Schools).Error; err != nil {
+			return nil, err
+		}
+	}
+	if ids, matchEmails := localIds[constants.SOURCED_ID_USER], len(emails) > 0; len(ids) > 0 || matchEmails {
+		query := tx.Table(dto.USER_TABLE)
+		switch {
+		case len(ids) > 0 && matchEmails:
+			query = query.Where("id IN (?) OR LOWER(email) IN (?)", ids, emails)
+		case matchEmails:
+			query = query.Where("LOWER(email) IN (?)", emails)
+		default:
+			query = query.Where("id IN (?)", ids)
+		}
+		if err := query.Find(&dir.Users).Error; err != nil {
+			return nil, err
+		}
+	}
+	// Archived classrooms are read-only, a class mapped to one is created anew
+	if ids := localIds[constants.SOURCED_ID_CLASS]; len(ids) > 0 {
+		if err := tx.Table(dto.CLASSROOM_TABLE).Where("id IN (?) AND archived_at IS NULL", ids).Find(&dir.Classrooms).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
+			Where("classroom_id IN (SELECT id FROM classrooms WHERE id IN (?) AND archived_at IS NULL) AND "+activeEnrollment, ids).
+			Find(&dir.Enrollments).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return dir, nil
+}
+
+// ApplyOneRoster writes a validated OneRoster plan in one transaction and maps the sourcedIds of
+// the bundle to the rows they created or matched. It returns the users it created; like roster
+// imports they get the password hash nobody knows the password of.
+func (r *OneRosterRepository) ApplyOneRoster(ctx context.Context, plan *dto.OneRosterPlan, passwordHash string) ([]dto.User, error) {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	now := time.Now()
+
+	schoolIds := map[string]int{}
+	for _, planned := range plan.Schools {
+		schoolId := planned.Id
+		switch {
+		case planned.Id == 0:
+			school := dto.School{
+				Name:         planned.Name,
+				Timezone:     "UTC",
+				GradingScale: dto.DefaultGradingScale,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			if err := checkTenant(ctx, 0); err != nil {
+				return nil, err
+			}
+			if err := tx.Table(dto.SCHOOL_TABLE).Create(&school).Error; err != nil {
+				return nil, err
+			}
+			if err := auditSchool(ctx, tx, constants.AUDIT_SCHOOL_CREATE, school.Id, nil, &school); err != nil {
+				return nil, err
+			}
+			schoolId = school.Id
+		case planned.Rename:
+			if err := updateSchool(ctx, tx, constants.AUDIT_SCHOOL_UPDATE, planned.Id, map[string]interface{}{
+				"name":       planned.Name,
+				"updated_at": now,
+			}); err != nil {
+				return nil, err
+			}
+		default:
+			if err := checkTenant(ctx, planned.Id); err != nil {
+				return nil, err
+			}
+		}
+		if err := mapSourcedId(tx, schoolId, constants.SOURCED_ID_ORG, planned.SourcedId, schoolId, now); err != nil {
+			return nil, err
+		}
+		schoolIds[planned.SourcedId] = schoolId
+	}
+
+	var created []dto.User
+	userIds := map[string]int{}
+	for _, planned := range plan.Users {
+		schoolId := schoolIds[planned.SchoolSourcedId]
+		userId := planned.Id
+		if userId == 0 {
+			user := dto.User{
+				Name:      planned.Name,
+				Email:     planned.Email,
+				Password:  passwordHash,
+				Role:      planned.Role,
+				SchoolId:  schoolId,
+				CreatedAt: now,
+			}
+			if !planned.Enabled {
+				user.DeactivatedAt = &now
+			}
+			if err := tx.Table(dto.USER_TABLE).Create(&user).Error; err != nil {
+				return nil, err
+			}
+			if err := assignBaseRole(tx, user.Id, user.Role); err != nil {
+				return nil, err
+			}
+			if err := auditUser(ctx, tx, constants.AUDIT_USER_CREATE, user.Id, nil, &user); err != nil {
+				return nil, err
+			}
+			user.Password = ""
+			if planned.Enabled {
+				created = append(created, user)
+			}
+			userId = user.Id
+		}
+
+		if planned.Rename {
+			if err := updateUser(ctx, tx, constants.AUDIT_USER_UPDATE, userId, map[string]interface{}{
+				"name":       planned.Name,
+				"updated_at": now,
+			}); err != nil {
+				return nil, err
+			}
+		}
+		if planned.Deactivate {
+			if err := updateUser(ctx, tx, constants.AUDIT_USER_DEACTIVATE, userId, map[string]interface{}{
+				"deactivated_at": gorm.Expr("COALESCE(deactivated_at, ?)", now),
+				"updated_at":     now,
+			}); err != nil {
+				return nil, err
+			}
+		} else if planned.Reactivate {
+			if err := updateUser(ctx, tx, constants.AUDIT_USER_REACTIVATE, userId, map[string]interface{}{
+				"deactivated_at": nil,
+				"updated_at":     now,
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := mapSourcedId(tx, schoolId, constants.SOURCED_ID_USER, planned.SourcedId, userId, now); err != nil {
+			return nil, err
+		}
+		userIds[planned.SourcedId] = userId
+	}
+
+	classrooms := map[string]*dto.Classroom{}
+	for _, planned := range plan.Classes {
+		schoolId := schoolIds[planned.SchoolSourcedId]
+		teacherId := planned.TeacherId
+		if teacherId == 0 && planned.TeacherSourcedId != "" {
+			teacherId = userIds[planned.TeacherSourcedId]
+		}
+
+		var classroom dto.Classroom
+		if planned.Id == 0 {
+			classroom = dto.Classroom{Name: planned.Name, SchoolId: schoolId, TeacherId: teacherId, CreatedAt: now}
+			if err := tx.Table(dto.CLASSROOM_TABLE).Create(&classroom).Error; err != nil {
+				return nil, err
+			}
+			if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_CREATE, &classroom, nil, &classroom); err != nil {
+				return nil, err
+			}
+		} else {
+			var before dto.Classroom
+			if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ? AND school_id = ?", planned.Id, schoolId).First(&before).Error; err != nil {
+				return nil, err
+			}
+			classroom = before
+			fields := map[string]interface{}{}
+			if planned.Rename {
+				fields["name"] = planned.Name
+				classroom.Name = planned.Name
+			}
+			if planned.Reassign {
+				fields["teacher_id"] = teacherId
+				classroom.TeacherId = teacherId
+			}
+			if len(fields) > 0 {
+				if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ?", planned.Id).Updates(fields).Error; err != nil {
+					return nil, err
+				}
+				if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_UPDATE, &classroom, &before, &classroom); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if err := mapSourcedId(tx, schoolId, constants.SOURCED_ID_CLASS, planned.SourcedId, classroom.Id, now); err != nil {
+			return nil, err
+		}
+		classrooms[planned.SourcedId] = &classroom
+	}
+
+	// Enrollments are audited per classroom like EnrollStudents, only those that changed anything
+	enrolled := map[int][]int{}
+	unenrolled := map[int][]int{}
+	auditedClassrooms := map[int]*dto.Classroom{}
+	var order []int
+	for _, planned := range plan.Enrollments {
+		classroomId, studentId := planned.ClassroomId, planned.StudentId
+		if classroom, ok := classrooms[planned.ClassSourcedId]; ok {
+			classroomId = classroom.Id
+		}
+		if studentId == 0 {
+			studentId = userIds[planned.UserSourcedId]
+		}
+
+		classroom, ok := classrooms[planned.ClassSourcedId]
+		if !ok {
+			classroom = &dto.Classroom{}
+			if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ?", classroomId).First(classroom).Error; err != nil {
+				return nil, err
+			}
+			classrooms[planned.ClassSourcedId] = classroom
+		}
+		if err := checkTenant(ctx, classroom.SchoolId); err != nil {
+			return nil, err
+		}
+
+		var enrollment dto.StudentClassroom
+		err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
+			Where("student_id = ? AND classroom_id = ? AND "+activeEnrollment, studentId, classroomId).
+			First(&enrollment).Error
+		exists := err == nil
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+
+		switch {
+		case planned.Drop && exists:
+			if _, err := endEnrollment(tx, &enrollment, constants.ENROLLMENT_STATUS_DROPPED, now); err != nil {
+				return nil, err
+			}
+			if err := tx.Table(dto.SOURCED_ID_TABLE).
+				Where("school_id = ? AND resource_type = ? AND (sourced_id = ? OR local_id = ?)",
+					classroom.SchoolId, constants.SOURCED_ID_ENROLLMENT, planned.SourcedId, enrollment.Id).
+				Delete(&dto.SourcedId{}).Error; err != nil {
+				return nil, err
+			}
+			unenrolled[classroomId] = append(unenrolled[classroomId], studentId)
+		case planned.Drop:
+			continue
+		case !exists:
+			enrollment = dto.StudentClassroom{
+				StudentId:   studentId,
+				ClassroomId: classroomId,
+				EnrolledAt:  now,
+				Status:      constants.ENROLLMENT_STATUS_ACTIVE,
+			}
+			if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).Create(&enrollment).Error; err != nil {
+				return nil, err
+			}
+			enrolled[classroomId] = append(enrolled[classroomId], studentId)
+		}
+		if !planned.Drop {
+			if err := mapSourcedId(tx, classroom.SchoolId, constants.SOURCED_ID_ENROLLMENT, planned.SourcedId, enrollment.Id, now); err != nil {
+				return nil, err
+			}
+		}
+		if _, seen := auditedClassrooms[classroomId]; !seen {
+			auditedClassrooms[classroomId] = classroom
+			order = append(order, classroomId)
+		}
+	}
+	for _, classroomId := range order {
+		if studentIds := enrolled[classroomId]; len(studentIds) > 0 {
+			after := map[string]interface{}{"student_ids": studentIds}
+			if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_ENROLL, auditedClassrooms[classroomId], nil, after); err != nil {
+				return nil, err
+			}
+		}
+		if studentIds := unenrolled[classroomId]; len(studentIds) > 0 {
+			before := map[string]interface{}{"student_ids": studentIds}
+			if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_UNENROLL, auditedClassrooms[classroomId], before, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tx.Commit()
+	return created, nil
+}
+
+// GetOneRosterExport returns the school with its users, classrooms and enrollments. Rows without
+// a sourcedId are given a new one, which is stored so later exports and imports of the bundle
+// keep referring to the same rows. Deleted users and archived classrooms are left out.
+func (r *OneRosterRepository) GetOneRosterExport(ctx context.Context, schoolId int) (*dto.OneRosterExport, error) {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := checkTenant(ctx, schoolId); err != nil {
+		return nil, err
+	}
+
+	export := &dto.OneRosterExport{SourcedIds: map[string]map[int]string{}}
+	if err := tx.Table(dto.SCHOOL_TABLE).Where("id = ?", schoolId).First(&export.School).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Table(dto.USER_TABLE).Where("school_id = ? AND anonymized_at IS NULL", schoolId).Order("id").Find(&export.Users).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Table(dto.CLASSROOM_TABLE).Where("school_id = ? AND archived_at IS NULL", schoolId).Order("id").Find(&export.Classrooms).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
+		Where("classroom_id IN (SELECT id FROM classrooms WHERE school_id = ? AND archived_at IS NULL) AND "+activeEnrollment, schoolId).
+		Where("student_id IN (SELECT id FROM users WHERE school_id = ? AND anonymized_at IS NULL)", schoolId).
+		Order("id").Find(&export.Enrollments).Error; err != nil {
+		return nil, err
+	}
+
+	var mappings []dto.SourcedId
+	if err := tx.Table(dto.SOURCED_ID_TABLE).Where("school_id = ?", schoolId).Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+	for _, resourceType := range []string{constants.SOURCED_ID_ORG, constants.SOURCED_ID_USER, constants.SOURCED_ID_CLASS, constants.SOURCED_ID_ENROLLMENT} {
+		export.SourcedIds[resourceType] = map[int]string{}
+	}
+	for _, mapping := range mappings {
+		export.SourcedIds[mapping.ResourceType][mapping.LocalId] = mapping.SourcedId
+	}
+
+	now := time.Now()
+	assign := func(resourceType string, localId int) error {
+		if _, mapped := export.SourcedIds[resourceType][localId]; mapped {
+			return nil
+		}
+		sourcedId := uuid.New().String()
+		if err := mapSourcedId(tx, schoolId, resourceType, sourcedId, localId, now); err != nil {
+			return err
+		}
+		export.SourcedIds[resourceType][localId] = sourcedId
+		return nil
+	}
+	if err := assign(constants.SOURCED_ID_ORG, schoolId); err != nil {
+		return nil, err
+	}
+	for _, user := range export.Users {
+		if err := assign(constants.SOURCED_ID_USER, user.Id); err != nil {
+			return nil, err
+		}
+	}
+	for _, classroom := range export.Classrooms {
+		if err := assign(constants.SOURCED_ID_CLASS, classroom.Id); err != nil {
+			return nil, err
+		}
+	}
+	for _, enrollment := range export.Enrollments {
+		if err := assign(constants.SOURCED_ID_ENROLLMENT, enrollment.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	tx.Commit()
+	return export, nil
+}
+
+// mapSourcedId maps the sourcedId to the local row in the school, replacing earlier mappings of
+// either of them
+func mapSourcedId(tx *gorm.DB, schoolId int, resourceType, sourcedId string, localId int, now time.Time) error {
+	if err := tx.Table(dto.SOURCED_ID_TABLE).
+		Where("school_id = ? AND resource_type = ? AND (sourced_id = ? OR local_id = ?)", schoolId, resourceType, sourcedId, localId).
+		Delete(&dto.SourcedId{}).Error; err != nil {
+		return err
+	}
+	return tx.Table(dto.SOURCED_ID_TABLE).Create(&dto.SourcedId{
+		SchoolId:     schoolId,
+		ResourceType: resourceType,
+		SourcedId:    sourcedId,
+		LocalId:      localId,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}).Error
+}
@@ -5,11 +5,13 @@ import (
 	"eduanalytics/internal/app/constants"
 	"eduanalytics/internal/app/db"
 	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/spec"
 )
 
 type IQuizzesRepository interface {
 	CreateQuiz(ctx context.Context, quiz *dto.Quiz) error
-	GetQuiz(ctx context.Context, where string) (*dto.Quiz, error)
+	GetQuiz(ctx context.Context, s *spec.Spec) (*dto.Quiz, error)
+	GetQuizzes(ctx context.Context, s *spec.Spec) ([]dto.Quiz, int, error)
 }
 
 type QuizzesRepository struct {
@@ -22,11 +24,20 @@ func NewQuizzesRepository(dbService *db.DBService) IQuizzesRepository {
 	}
 }
 
+// quizFields are the columns quizzes can be filtered and sorted on
+var quizFields = spec.NewFields("id", "title", "classroom_id", "created_by", "start_time", "end_time", "created_at")
+
 func (r *QuizzesRepository) CreateQuiz(ctx context.Context, quiz *dto.Quiz) error {
 	tx := r.DBService.GetDB().Begin()
 	defer tx.Rollback()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
+	if err := checkTenantRow(ctx, tx, dto.CLASSROOM_TABLE, quiz.ClassroomId); err != nil {
+		return err
+	}
+	if err := checkClassroomsWritable(tx, "id = ?", quiz.ClassroomId); err != nil {
+		return err
+	}
 	if err := tx.Table(dto.QUIZ_TABLE).Create(quiz).Error; err != nil {
 		return err
 	}
@@ -34,13 +45,30 @@ func (r *QuizzesRepository) CreateQuiz(ctx context.Context, quiz *dto.Quiz) erro
 	return nil
 }
 
-func (r *QuizzesRepository) GetQuiz(ctx context.Context, where string) (*dto.Quiz, error) {
+func (r *QuizzesRepository) GetQuiz(ctx context.Context, s *spec.Spec) (*dto.Quiz, error) {
+	var quiz dto.Quiz
+
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
-	var quiz dto.Quiz
 
-	if err := tx.Table(dto.QUIZ_TABLE).Where(where).First(&quiz).Error; err != nil {
+	if err := findFirst(scopeTenantClassrooms(ctx, tx.Table(dto.QUIZ_TABLE), "classroom_id"), s, quizFields, &quiz); err != nil {
 		return &quiz, err
 	}
+
 	return &quiz, nil
 }
+
+// GetQuizzes returns a page of the quizzes matching the spec and the number of matching quizzes
+func (r *QuizzesRepository) GetQuizzes(ctx context.Context, s *spec.Spec) ([]dto.Quiz, int, error) {
+	var quizzes []dto.Quiz
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	total, err := findAll(scopeTenantClassrooms(ctx, tx.Table(dto.QUIZ_TABLE), "classroom_id"), s, quizFields, &quizzes)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return quizzes, total, nil
+}
@@ -3,12 +3,20 @@ package repository
 import (
 	"context"
 	"eduanalytics/internal/app/db"
+	"time"
 )
 
+// enrolledAsOf limits responses to those of students enrolled in the quiz's classroom at a point
+// in time, it takes the time three times and matches every response when it is NULL
+const enrolledAsOf = `(CAST(? AS TIMESTAMP) IS NULL OR EXISTS (
+        SELECT 1 FROM student_classrooms sc
+        WHERE sc.student_id = r.student_id AND sc.classroom_id = z.classroom_id
+        AND sc.enrolled_at <= ? AND (sc.unenrolled_at IS NULL OR sc.unenrolled_at > ?)))`
+
 type IReportsRepository interface {
 	GetStudentPerformanceReport(ctx context.Context, studentID int) (name string, attempts int, correct int, accuracy float64, err error)
-	GetClassroomEngagementReport(ctx context.Context, classroomID int) (name string, participants int, avgTime float64, err error)
-	GetContentEffectivenessReport(ctx context.Context, quizID int) ([]map[string]interface{}, error)
+	GetClassroomEngagementReport(ctx context.Context, classroomID int, asOf *time.Time) (name string, participants int, avgTime float64, err error)
+	GetContentEffectivenessReport(ctx context.Context, quizID int, asOf *time.Time) ([]map[string]interface{}, error)
 }
 
 type ReportsRepository struct {
@@ -26,35 +34,44 @@ func (r *ReportsRepository) GetStudentPerformanceReport(ctx context.Context, stu
         SELECT u.name, COUNT(r.id), SUM(CASE WHEN r.correct THEN 1 ELSE 0 END),
         ROUND(SUM(CASE WHEN r.correct THEN 1 ELSE 0 END)::decimal / COUNT(r.id), 2)
         FROM responses r JOIN users u ON u.id = r.student_id
-        WHERE r.student_id = ? GROUP BY u.name;
+        WHERE r.student_id = ? AND (CAST(? AS INT) IS NULL OR u.school_id = ?) GROUP BY u.name;
     `
-	row := r.DBService.GetDB().Raw(query, studentID).Row()
+	tenant := tenantParam(ctx)
+	row := r.DBService.GetDB().Raw(query, studentID, tenant, tenant).Row()
 	err = row.Scan(&name, &attempts, &correct, &accuracy)
 	return
 }
 
-func (r *ReportsRepository) GetClassroomEngagementReport(ctx context.Context, classroomID int) (name string, participants int, avgTime float64, err error) {
+// GetClassroomEngagementReport reports the participation in the classroom's quizzes, limited to
+// the students enrolled at asOf when it is set
+func (r *ReportsRepository) GetClassroomEngagementReport(ctx context.Context, classroomID int, asOf *time.Time) (name string, participants int, avgTime float64, err error) {
 	query := `
         SELECT c.name, COUNT(DISTINCT r.student_id), AVG(r.time_spent)
         FROM responses r
         JOIN questions q ON q.id = r.question_id
         JOIN quizzes z ON q.quiz_id = z.id
         JOIN classrooms c ON z.classroom_id = c.id
-        WHERE c.id = ? GROUP BY c.name;
+        WHERE c.id = ? AND (CAST(? AS INT) IS NULL OR c.school_id = ?) AND ` + enrolledAsOf + ` GROUP BY c.name;
     `
-	row := r.DBService.GetDB().Raw(query, classroomID).Row()
+	tenant := tenantParam(ctx)
+	row := r.DBService.GetDB().Raw(query, classroomID, tenant, tenant, asOf, asOf, asOf).Row()
 	err = row.Scan(&name, &participants, &avgTime)
 	return
 }
 
-func (r *ReportsRepository) GetContentEffectivenessReport(ctx context.Context, quizID int) ([]map[string]interface{}, error) {
+// GetContentEffectivenessReport reports the correctness of the quiz's questions, limited to the
+// students enrolled at asOf when it is set
+func (r *ReportsRepository) GetContentEffectivenessReport(ctx context.Context, quizID int, asOf *time.Time) ([]map[string]interface{}, error) {
 	query := `
         SELECT q.question_text, COUNT(r.id),
         ROUND(SUM(CASE WHEN r.correct THEN 1 ELSE 0 END)::decimal / COUNT(r.id), 2)
         FROM responses r JOIN questions q ON q.id = r.question_id
-        WHERE q.quiz_id = ? GROUP BY q.question_text;
+        LEFT JOIN quizzes z ON z.id = q.quiz_id
+        LEFT JOIN classrooms c ON c.id = z.classroom_id
+        WHERE q.quiz_id = ? AND (CAST(? AS INT) IS NULL OR c.school_id = ?) AND ` + enrolledAsOf + ` GROUP BY q.question_text;
     `
-	rows, err := r.DBService.GetDB().Raw(query, quizID).Rows()
+	tenant := tenantParam(ctx)
+	rows, err := r.DBService.GetDB().Raw(query, quizID, tenant, tenant, asOf, asOf, asOf).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -5,11 +5,13 @@ import (
 	"eduanalytics/internal/app/constants"
 	"eduanalytics/internal/app/db"
 	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/spec"
 )
 
 type IResponseRepository interface {
 	CreateResponse(ctx context.Context, response *dto.Response) error
-	GetResponse(ctx context.Context, where string) (*dto.Response, error)
+	GetResponse(ctx context.Context, s *spec.Spec) (*dto.Response, error)
+	GetResponses(ctx context.Context, s *spec.Spec) ([]dto.Response, int, error)
 }
 
 type ResponseRepository struct {
@@ -22,11 +24,22 @@ func NewResponseRepository(dbService *db.DBService) IResponseRepository {
 	}
 }
 
+// responseFields are the columns responses can be filtered and sorted on
+var responseFields = spec.NewFields("id", "student_id", "question_id", "answer", "correct", "time_spent", "submitted_at")
+
 func (r *ResponseRepository) CreateResponse(ctx context.Context, response *dto.Response) error {
 	tx := r.DBService.GetDB().Begin()
 	defer tx.Rollback()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
+	if err := checkTenantRow(ctx, tx, dto.USER_TABLE, response.StudentId); err != nil {
+		return err
+	}
+	// Quizzes of archived classrooms take no more responses
+	if err := checkClassroomsWritable(tx, "id IN (SELECT z.classroom_id FROM quizzes z JOIN questions q ON q.quiz_id = z.id WHERE q.id = ?)",
+		response.QuestionId); err != nil {
+		return err
+	}
 	if err := tx.Table(dto.RESPONSE_TABLE).Create(response).Error; err != nil {
 		return err
 	}
@@ -34,13 +47,30 @@ func (r *ResponseRepository) CreateResponse(ctx context.Context, response *dto.R
 	return nil
 }
 
-func (r *ResponseRepository) GetResponse(ctx context.Context, where string) (*dto.Response, error) {
+func (r *ResponseRepository) GetResponse(ctx context.Context, s *spec.Spec) (*dto.Response, error) {
+	var response dto.Response
+
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
-	var response dto.Response
 
-	if err := tx.Table(dto.RESPONSE_TABLE).Where(where).First(&response).Error; err != nil {
+	if err := findFirst(scopeTenantUsers(ctx, tx.Table(dto.RESPONSE_TABLE), "student_id"), s, responseFields, &response); err != nil {
 		return &response, err
 	}
+
 	return &response, nil
 }
+
+// GetResponses returns a page of the responses matching the spec and the number of matching responses
+func (r *ResponseRepository) GetResponses(ctx context.Context, s *spec.Spec) ([]dto.Response, int, error) {
+	var responses []dto.Response
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	total, err := findAll(scopeTenantUsers(ctx, tx.Table(dto.RESPONSE_TABLE), "student_id"), s, responseFields, &responses)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return responses, total, nil
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type IRolesRepository interface {
+	GetRoles(ctx context.Context) ([]dto.Role, error)
+	GetRoleByName(ctx context.Context, name string) (*dto.Role, error)
+	CreateRole(ctx context.Context, role *dto.Role) error
+	UpdateRoleDescription(ctx context.Context, name, description string) error
+	DeleteRole(ctx context.Context, name string) error
+	GetUserRoles(ctx context.Context, userId int) ([]dto.Role, error)
+	AssignRole(ctx context.Context, userId, roleId, assignedBy int) error
+	UnassignRole(ctx context.Context, userId, roleId int) error
+}
+
+type RolesRepository struct {
+	DBService *db.DBService
+}
+
+func NewRolesRepository(dbService *db.DBService) IRolesRepository {
+	return &RolesRepository{
+		DBService: dbService,
+	}
+}
+
+func (r *RolesRepository) GetRoles(ctx context.Context) ([]dto.Role, error) {
+	var roles []dto.Role
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.ROLE_TABLE).Order("built_in DESC, name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *RolesRepository) GetRoleByName(ctx context.Context, name string) (*dto.Role, error) {
+	var role dto.Role
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.ROLE_TABLE).Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (r *RolesRepository) CreateRole(ctx context.Context, role *dto.Role) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = role.CreatedAt
+
+	if err := tx.Table(dto.ROLE_TABLE).Create(role).Error; err != nil {
+		return err
+	}
+	if err := auditRole(ctx, tx, constants.AUDIT_ROLE_CREATE, role, nil, role); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (r *RolesRepository) UpdateRoleDescription(ctx context.Context, name, description string) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var before, after dto.Role
+	if err := tx.Table(dto.ROLE_TABLE).Where("name = ?", name).First(&before).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.ROLE_TABLE).Where("id = ?", before.Id).
+		Updates(map[string]interface{}{"description": description, "updated_at": time.Now()}).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.ROLE_TABLE).Where("id = ?", before.Id).First(&after).Error; err != nil {
+		return err
+	}
+	if err := auditRole(ctx, tx, constants.AUDIT_ROLE_UPDATE, &after, &before, &after); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// DeleteRole deletes a custom role and its assignments, built-in roles are never deleted
+func (r *RolesRepository) DeleteRole(ctx context.Context, name string) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var before dto.Role
+	if err := tx.Table(dto.ROLE_TABLE).Where("name = ? AND built_in = FALSE", name).First(&before).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.ROLE_TABLE).Where("id = ?", before.Id).Delete(&dto.Role{}).Error; err != nil {
+		return err
+	}
+	if err := auditRole(ctx, tx, constants.AUDIT_ROLE_DELETE, &before, &before, nil); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (r *RolesRepository) GetUserRoles(ctx context.Context, userId int) ([]dto.Role, error) {
+	var roles []dto.Role
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.ROLE_TABLE).
+		Select("roles.*").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userId).
+		Order("roles.name").
+		Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// AssignRole assigns a role to a user, assigning a role twice has no effect
+func (r *RolesRepository) AssignRole(ctx context.Context, userId, roleId, assignedBy int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	result := tx.Exec(`INSERT INTO user_roles (user_id, role_id, assigned_by) VALUES (?, ?, ?)
+		ON CONFLICT DO NOTHING`, userId, roleId, assignedBy)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		if err := auditRoleAssignment(ctx, tx, constants.AUDIT_USER_ROLE_ASSIGN, userId, roleId); err != nil {
+			return err
+		}
+	}
+
+	tx.Commit()
+	return nil
+}
+
+func (r *RolesRepository) UnassignRole(ctx context.Context, userId, roleId int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	result := tx.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userId, roleId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	if err := auditRoleAssignment(ctx, tx, constants.AUDIT_USER_ROLE_UNASSIGN, userId, roleId); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// assignBaseRole assigns the built-in role matching users.role within the transaction of a user
+// change
+func assignBaseRole(tx *gorm.DB, userId int, role string) error {
+	return tx.Exec(`INSERT INTO user_roles (user_id, role_id)
+		SELECT ?, id FROM roles WHERE name = ? AND built_in
+		ON CONFLICT DO NOTHING`, userId, role).Error
+}
+
+// auditRole records a change of a role in the audit log
+func auditRole(ctx context.Context, tx *gorm.DB, action string, role *dto.Role, before, after interface{}) error {
+	beforeData, afterData, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	return appendAuditLog(ctx, tx, &dto.AuditLog{
+		Action:       action,
+		ResourceType: constants.AUDIT_RESOURCE_ROLE,
+		ResourceId:   role.Name,
+		Before:       beforeData,
+		After:        afterData,
+	})
+}
+
+// auditRoleAssignment records that a role was assigned to or unassigned from a user
+func auditRoleAssignment(ctx context.Context, tx *gorm.DB, action string, userId, roleId int) error {
+	var role dto.Role
+	if err := tx.Table(dto.ROLE_TABLE).Where("id = ?", roleId).First(&role).Error; err != nil {
+		return err
+	}
+
+	assignment := map[string]interface{}{"role": role.Name}
+	if action == constants.AUDIT_USER_ROLE_UNASSIGN {
+		return auditUser(ctx, tx, action, userId, assignment, nil)
+	}
+	return auditUser(ctx, tx, action, userId, nil, assignment)
+}
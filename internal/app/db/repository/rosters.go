@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type IRostersRepository interface {
+	GetRosterDirectory(ctx context.Context, schoolId int, emails []string) (*dto.RosterDirectory, error)
+	ApplyRoster(ctx context.Context, schoolId int, plan *dto.RosterPlan, passwordHash string) ([]dto.User, error)
+}
+
+type RostersRepository struct {
+	DBService *db.DBService
+}
+
+func NewRostersRepository(dbService *db.DBService) IRostersRepository {
+	return &RostersRepository{
+		DBService: dbService,
+	}
+}
+
+// GetRosterDirectory returns the users with the emails in any school, as email addresses are
+// unique across schools, and the classrooms of the school with their enrollments
+func (r *RostersRepository) GetRosterDirectory(ctx context.Context, schoolId int, emails []string) (*dto.RosterDirectory, error) {
+	dir := &dto.RosterDirectory{SchoolId: schoolId}
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := checkTenant(ctx, schoolId); err != nil {
+		return nil, err
+	}
+
+	if len(emails) > 0 {
+		if err := tx.Table(dto.USER_TABLE).Where("LOWER(email) IN (?)", emails).Find(&dir.Users).Error; err != nil {
+			return nil, err
+		}
+	}
+	// Archived classrooms are read-only, a roster naming one creates a new classroom
+	if err := tx.Table(dto.CLASSROOM_TABLE).Where("school_id = ? AND archived_at IS NULL", schoolId).Find(&dir.Classrooms).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
+		Where("classroom_id IN (SELECT id FROM classrooms WHERE school_id = ? AND archived_at IS NULL) AND "+activeEnrollment, schoolId).
+		Find(&dir.Enrollments).Error; err != nil {
+		return nil, err
+	}
+
+	return dir, nil
+}
+
+// ApplyRoster writes a validated roster plan of the school in one transaction and returns the
+// users it created. New users get the password hash, which nobody knows the password of, and
+// set their own password by resetting it.
+func (r *RostersRepository) ApplyRoster(ctx context.Context, schoolId int, plan *dto.RosterPlan, passwordHash string) ([]dto.User, error) {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := checkTenant(ctx, schoolId); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	var created []dto.User
+	userIds := map[string]int{}
+	for _, planned := range plan.Users {
+		switch {
+		case planned.Id == 0:
+			user := dto.User{
+				Name:      planned.Name,
+				Email:     planned.Email,
+				Password:  passwordHash,
+				Role:      planned.Role,
+				SchoolId:  schoolId,
+				CreatedAt: now,
+			}
+			if err := tx.Table(dto.USER_TABLE).Create(&user).Error; err != nil {
+				return nil, err
+			}
+			if err := assignBaseRole(tx, user.Id, user.Role); err != nil {
+				return nil, err
+			}
+			if err := auditUser(ctx, tx, constants.AUDIT_USER_CREATE, user.Id, nil, &user); err != nil {
+				return nil, err
+			}
+			user.Password = ""
+			created = append(created, user)
+			userIds[planned.Email] = user.Id
+		case planned.Rename:
+			if err := updateUser(ctx, tx, constants.AUDIT_USER_UPDATE, planned.Id, map[string]interface{}{
+				"name":       planned.Name,
+				"updated_at": now,
+			}); err != nil {
+				return nil, err
+			}
+			userIds[planned.Email] = planned.Id
+		default:
+			userIds[planned.Email] = planned.Id
+		}
+	}
+
+	classroomIds := map[string]int{}
+	classrooms := map[string]*dto.Classroom{}
+	for _, planned := range plan.Classrooms {
+		var teacherId int
+		if planned.Id == 0 || planned.Reassign {
+			id, err := rosterUserId(tx, userIds, schoolId, planned.TeacherEmail)
+			if err != nil {
+				return nil, err
+			}
+			teacherId = id
+		}
+
+		var classroom dto.Classroom
+		switch {
+		case planned.Id == 0:
+			classroom = dto.Classroom{Name: planned.Name, SchoolId: schoolId, TeacherId: teacherId, CreatedAt: now}
+			if err := tx.Table(dto.CLASSROOM_TABLE).Create(&classroom).Error; err != nil {
+				return nil, err
+			}
+			if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_CREATE, &classroom, nil, &classroom); err != nil {
+				return nil, err
+			}
+		case planned.Reassign:
+			var before dto.Classroom
+			if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ? AND school_id = ?", planned.Id, schoolId).First(&before).Error; err != nil {
+				return nil, err
+			}
+			if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ?", planned.Id).Update("teacher_id", teacherId).Error; err != nil {
+				return nil, err
+			}
+			classroom = before
+			classroom.TeacherId = teacherId
+			if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_UPDATE, &classroom, &before, &classroom); err != nil {
+				return nil, err
+			}
+		default:
+			if err := tx.Table(dto.CLASSROOM_TABLE).Where("id = ? AND school_id = ?", planned.Id, schoolId).First(&classroom).Error; err != nil {
+				return nil, err
+			}
+		}
+		classroomIds[planned.Name] = classroom.Id
+		classrooms[planned.Name] = &classroom
+	}
+
+	// Enrollments are audited per classroom like EnrollStudents
+	enrolled := map[string][]int{}
+	var order []string
+	for _, planned := range plan.Enrollments {
+		studentId, err := rosterUserId(tx, userIds, schoolId, planned.StudentEmail)
+		if err != nil {
+			return nil, err
+		}
+		enrollment := dto.StudentClassroom{
+			StudentId:   studentId,
+			ClassroomId: classroomIds[planned.Classroom],
+			EnrolledAt:  now,
+			Status:      constants.ENROLLMENT_STATUS_ACTIVE,
+		}
+		if err := tx.Table(dto.STUDENT_CLASSROOM_TABLE).
+			Where("student_id = ? AND classroom_id = ? AND "+activeEnrollment, enrollment.StudentId, enrollment.ClassroomId).
+			FirstOrCreate(&enrollment).Error; err != nil {
+			return nil, err
+		}
+		if _, seen := enrolled[planned.Classroom]; !seen {
+			order = append(order, planned.Classroom)
+		}
+		enrolled[planned.Classroom] = append(enrolled[planned.Classroom], studentId)
+	}
+	for _, name := range order {
+		after := map[string]interface{}{"student_ids": enrolled[name]}
+		if err := auditClassroom(ctx, tx, constants.AUDIT_CLASSROOM_ENROLL, classrooms[name], nil, after); err != nil {
+			return nil, err
+		}
+	}
+
+	tx.Commit()
+	return created, nil
+}
+
+// rosterUserId returns the id of a user of the roster or, for teachers only named by
+// teacher_email, of the school
+func rosterUserId(tx *gorm.DB, userIds map[string]int, schoolId int, email string) (int, error) {
+	if id, ok := userIds[email]; ok {
+		return id, nil
+	}
+
+	var user dto.User
+	if err := tx.Table(dto.USER_TABLE).Select("id").
+		Where("LOWER(email) = ? AND school_id = ? AND anonymized_at IS NULL", email, schoolId).
+		First(&user).Error; err != nil {
+		return 0, err
+	}
+	userIds[email] = user.Id
+	return user.Id, nil
+}
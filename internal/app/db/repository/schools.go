@@ -5,11 +5,24 @@ import (
 	"eduanalytics/internal/app/constants"
 	"eduanalytics/internal/app/db"
 	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/spec"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
 )
 
+// ErrSchoolNotEmpty is returned when deleting a school that still has users or classrooms
+var ErrSchoolNotEmpty = errors.New("school still has users or classrooms")
+
 type ISchoolsRepository interface {
-	CreateSchool(ctx context.Context, user dto.School) error
-	GetSchool(ctx context.Context, where string) (*dto.School, error)
+	CreateSchool(ctx context.Context, school *dto.School) error
+	GetSchool(ctx context.Context, s *spec.Spec) (*dto.School, error)
+	GetSchools(ctx context.Context, s *spec.Spec) ([]dto.School, int, error)
+	UpdateSchool(ctx context.Context, id int, school *dto.School) error
+	UpdateSchoolSettings(ctx context.Context, id int, timezone string, gradingScale dto.GradingScale) error
+	DeleteSchool(ctx context.Context, id int) error
 }
 
 type SchoolsRepository struct {
@@ -22,12 +35,28 @@ func NewSchoolsRepository(dbService *db.DBService) ISchoolsRepository {
 	}
 }
 
-func (r *SchoolsRepository) CreateSchool(ctx context.Context, school dto.School) error {
+// schoolFields are the columns schools can be filtered and sorted on
+var schoolFields = spec.NewFields("id", "name", "address", "timezone", "created_at")
+
+// CreateSchool creates a school, without settings it uses UTC and the default grading scale
+func (r *SchoolsRepository) CreateSchool(ctx context.Context, school *dto.School) error {
 	tx := r.DBService.GetDB().Begin()
 	defer tx.Rollback()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.SCHOOL_TABLE).Create(&school).Error; err != nil {
+	if school.Timezone == "" {
+		school.Timezone = "UTC"
+	}
+	if len(school.GradingScale) == 0 {
+		school.GradingScale = dto.DefaultGradingScale
+	}
+	school.CreatedAt = time.Now()
+	school.UpdatedAt = school.CreatedAt
+
+	if err := tx.Table(dto.SCHOOL_TABLE).Create(school).Error; err != nil {
+		return err
+	}
+	if err := auditSchool(ctx, tx, constants.AUDIT_SCHOOL_CREATE, school.Id, nil, school); err != nil {
 		return err
 	}
 
@@ -36,15 +65,135 @@ func (r *SchoolsRepository) CreateSchool(ctx context.Context, school dto.School)
 	return nil
 }
 
-func (r *SchoolsRepository) GetSchool(ctx context.Context, where string) (*dto.School, error) {
+func (r *SchoolsRepository) GetSchool(ctx context.Context, s *spec.Spec) (*dto.School, error) {
 	var school dto.School
 
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.SCHOOL_TABLE).Where(where).First(&school).Error; err != nil {
+	if err := findFirst(scopeTenant(ctx, tx.Table(dto.SCHOOL_TABLE), "id"), s, schoolFields, &school); err != nil {
 		return &school, err
 	}
 
 	return &school, nil
 }
+
+// GetSchools returns a page of the schools matching the spec and the number of matching schools
+func (r *SchoolsRepository) GetSchools(ctx context.Context, s *spec.Spec) ([]dto.School, int, error) {
+	var schools []dto.School
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	total, err := findAll(scopeTenant(ctx, tx.Table(dto.SCHOOL_TABLE), "id"), s, schoolFields, &schools)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return schools, total, nil
+}
+
+// UpdateSchool updates the name and address of a school, empty fields are kept
+func (r *SchoolsRepository) UpdateSchool(ctx context.Context, id int, school *dto.School) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	fields := map[string]interface{}{"updated_at": time.Now()}
+	if school.Name != "" {
+		fields["name"] = school.Name
+	}
+	if school.Address != "" {
+		fields["address"] = school.Address
+	}
+
+	if err := updateSchool(ctx, tx, constants.AUDIT_SCHOOL_UPDATE, id, fields); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// UpdateSchoolSettings replaces the timezone and grading scale of a school
+func (r *SchoolsRepository) UpdateSchoolSettings(ctx context.Context, id int, timezone string, gradingScale dto.GradingScale) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	fields := map[string]interface{}{
+		"timezone":      timezone,
+		"grading_scale": gradingScale,
+		"updated_at":    time.Now(),
+	}
+	if err := updateSchool(ctx, tx, constants.AUDIT_SCHOOL_SETTINGS, id, fields); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// DeleteSchool deletes a school without users or classrooms together with its SSO provider and
+// API keys
+func (r *SchoolsRepository) DeleteSchool(ctx context.Context, id int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var before dto.School
+	if err := scopeTenant(ctx, tx.Table(dto.SCHOOL_TABLE), "id").Where("id = ?", id).First(&before).Error; err != nil {
+		return err
+	}
+
+	var members int
+	if err := tx.Raw(`SELECT (SELECT COUNT(*) FROM users WHERE school_id = ?) +
+		(SELECT COUNT(*) FROM classrooms WHERE school_id = ?)`, id, id).Row().Scan(&members); err != nil {
+		return err
+	}
+	if members > 0 {
+		return ErrSchoolNotEmpty
+	}
+
+	if err := tx.Table(dto.SCHOOL_TABLE).Where("id = ?", id).Delete(&dto.School{}).Error; err != nil {
+		return err
+	}
+	if err := auditSchool(ctx, tx, constants.AUDIT_SCHOOL_DELETE, id, &before, nil); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// updateSchool applies the fields to the school within the transaction and audits the change
+func updateSchool(ctx context.Context, tx *gorm.DB, action string, id int, fields map[string]interface{}) error {
+	var before, after dto.School
+	if err := scopeTenant(ctx, tx.Table(dto.SCHOOL_TABLE), "id").Where("id = ?", id).First(&before).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.SCHOOL_TABLE).Where("id = ?", id).Updates(fields).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.SCHOOL_TABLE).Where("id = ?", id).First(&after).Error; err != nil {
+		return err
+	}
+	return auditSchool(ctx, tx, action, id, &before, &after)
+}
+
+// auditSchool records a change of a school in the audit log of the school
+func auditSchool(ctx context.Context, tx *gorm.DB, action string, schoolId int, before, after interface{}) error {
+	beforeData, afterData, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	return appendAuditLog(ctx, tx, &dto.AuditLog{
+		Action:       action,
+		ResourceType: constants.AUDIT_RESOURCE_SCHOOL,
+		ResourceId:   strconv.Itoa(schoolId),
+		SchoolId:     &schoolId,
+		Before:       beforeData,
+		After:        afterData,
+	})
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"eduanalytics/internal/app/db/spec"
+
+	"github.com/jinzhu/gorm"
+)
+
+// findFirst scans the first row matching the spec into out
+func findFirst(query *gorm.DB, s *spec.Spec, fields spec.Fields, out interface{}) error {
+	query, err := s.Apply(query, fields)
+	if err != nil {
+		return err
+	}
+	return query.First(out).Error
+}
+
+// findAll scans a page of the rows matching the spec into out and returns the number of matching
+// rows of every page
+func findAll(query *gorm.DB, s *spec.Spec, fields spec.Fields, out interface{}) (int, error) {
+	var total int
+
+	query, err := s.Filter(query, fields)
+	if err != nil {
+		return 0, err
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	query, err = s.Order(query, fields)
+	if err != nil {
+		return 0, err
+	}
+	if err := query.Find(out).Error; err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
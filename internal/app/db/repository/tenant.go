@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrTenantMismatch is returned when a change would reach into another school than the one the
+// request is scoped to
+var ErrTenantMismatch = errors.New("resource belongs to another school")
+
+// tenantId returns the school the request is scoped to. Contexts without a tenant are system
+// jobs, public routes and super admins, which are not limited to a school.
+func tenantId(ctx context.Context) (int, bool) {
+	schoolId, ok := ctx.Value(constants.CTK_TENANT_ID).(int)
+	return schoolId, ok
+}
+
+// scopeTenant limits the query to rows whose school column is the tenant's
+func scopeTenant(ctx context.Context, query *gorm.DB, column string) *gorm.DB {
+	if schoolId, ok := tenantId(ctx); ok {
+		return query.Where(column+" = ?", schoolId)
+	}
+	return query
+}
+
+// scopeTenantUsers limits the query to rows whose user column references a user of the tenant
+func scopeTenantUsers(ctx context.Context, query *gorm.DB, column string) *gorm.DB {
+	if schoolId, ok := tenantId(ctx); ok {
+		return query.Where(column+" IN (SELECT id FROM users WHERE school_id = ?)", schoolId)
+	}
+	return query
+}
+
+// scopeTenantClassrooms limits the query to rows whose classroom column references a classroom of
+// the tenant
+func scopeTenantClassrooms(ctx context.Context, query *gorm.DB, column string) *gorm.DB {
+	if schoolId, ok := tenantId(ctx); ok {
+		return query.Where(column+" IN (SELECT id FROM classrooms WHERE school_id = ?)", schoolId)
+	}
+	return query
+}
+
+// tenantParam returns the tenant as a query parameter of raw SQL, NULL when the request is not
+// scoped to a school
+func tenantParam(ctx context.Context) interface{} {
+	if schoolId, ok := tenantId(ctx); ok {
+		return schoolId
+	}
+	return nil
+}
+
+// checkTenant returns ErrTenantMismatch unless a new row of the school may be written
+func checkTenant(ctx context.Context, schoolId int) error {
+	if tenant, ok := tenantId(ctx); ok && tenant != schoolId {
+		return ErrTenantMismatch
+	}
+	return nil
+}
+
+// checkTenantRow returns ErrTenantMismatch unless the row of the table with the id belongs to the
+// tenant, e.g. the classroom of a new quiz
+func checkTenantRow(ctx context.Context, tx *gorm.DB, table string, id int) error {
+	schoolId, ok := tenantId(ctx)
+	if !ok {
+		return nil
+	}
+
+	var count int
+	if err := tx.Table(table).Where("id = ? AND school_id = ?", id, schoolId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrTenantMismatch
+	}
+	return nil
+}
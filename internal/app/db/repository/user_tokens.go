@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db"
+	"eduanalytics/internal/app/db/dto"
+	"errors"
+	"time"
+)
+
+var ErrTokenAlreadyUsed = errors.New("token already used")
+
+type IUserTokensRepository interface {
+	CreateToken(ctx context.Context, token *dto.UserToken) error
+	GetActiveToken(ctx context.Context, tokenHash, purpose string) (*dto.UserToken, error)
+	MarkTokenUsed(ctx context.Context, id int) error
+	InvalidateUserTokens(ctx context.Context, userId int, purpose string) error
+}
+
+type UserTokensRepository struct {
+	DBService *db.DBService
+}
+
+func NewUserTokensRepository(dbService *db.DBService) IUserTokensRepository {
+	return &UserTokensRepository{
+		DBService: dbService,
+	}
+}
+
+func (r *UserTokensRepository) CreateToken(ctx context.Context, token *dto.UserToken) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	token.CreatedAt = time.Now()
+
+	if err := tx.Table(dto.USER_TOKEN_TABLE).Create(token).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// GetActiveToken returns an unused, unexpired token with the given hash and purpose
+func (r *UserTokensRepository) GetActiveToken(ctx context.Context, tokenHash, purpose string) (*dto.UserToken, error) {
+	var token dto.UserToken
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.USER_TOKEN_TABLE).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", tokenHash, purpose, time.Now()).
+		First(&token).Error; err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkTokenUsed consumes a token, it fails with ErrTokenAlreadyUsed when a concurrent request won
+func (r *UserTokensRepository) MarkTokenUsed(ctx context.Context, id int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	result := tx.Table(dto.USER_TOKEN_TABLE).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTokenAlreadyUsed
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// InvalidateUserTokens consumes every outstanding token of a user for the given purpose
+func (r *UserTokensRepository) InvalidateUserTokens(ctx context.Context, userId int, purpose string) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.USER_TOKEN_TABLE).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userId, purpose).
+		Update("used_at", time.Now()).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
@@ -5,13 +5,28 @@ import (
 	"eduanalytics/internal/app/constants"
 	"eduanalytics/internal/app/db"
 	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/spec"
+	"fmt"
+	"strconv"
 	"time"
+
+	"github.com/jinzhu/gorm"
 )
 
 type IUsersRepository interface {
 	CreateUser(ctx context.Context, user *dto.User) error
-	GetUser(ctx context.Context, where string) (*dto.User, error)
+	GetUser(ctx context.Context, s *spec.Spec) (*dto.User, error)
+	GetUsers(ctx context.Context, s *spec.Spec) ([]dto.User, int, error)
 	GetUserByEmail(ctx context.Context, email string) (*dto.User, error)
+	MarkEmailVerified(ctx context.Context, id int) error
+	UpdatePassword(ctx context.Context, id int, passwordHash string) error
+	UpdateRole(ctx context.Context, id int, role string) error
+	UpdateProfile(ctx context.Context, id int, name, email string) error
+	DeactivateUser(ctx context.Context, id int) error
+	ReactivateUser(ctx context.Context, id int) error
+	DeleteUser(ctx context.Context, id int) error
+	IsUserActive(ctx context.Context, id int) (bool, error)
+	GetUserRoleNames(ctx context.Context, id int) ([]string, error)
 }
 
 type UsersRepository struct {
@@ -24,36 +39,63 @@ func NewUsersRepository(dbService *db.DBService) IUsersRepository {
 	}
 }
 
+// userFields are the columns users can be filtered and sorted on
+var userFields = spec.NewFields("id", "name", "email", "role", "school_id", "email_verified", "deactivated_at",
+	"anonymized_at", "created_at", "updated_at")
+
 func (r *UsersRepository) CreateUser(ctx context.Context, user *dto.User) error {
 
 	tx := r.DBService.GetDB().Begin()
 	defer tx.Rollback()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+	if err := checkTenant(ctx, user.SchoolId); err != nil {
+		return err
+	}
 	user.CreatedAt = time.Now()
 
 	if err := tx.Table(dto.USER_TABLE).Create(user).Error; err != nil {
 		return err
 	}
+	if err := assignBaseRole(tx, user.Id, user.Role); err != nil {
+		return err
+	}
+	if err := auditUser(ctx, tx, constants.AUDIT_USER_CREATE, user.Id, nil, user); err != nil {
+		return err
+	}
 
 	tx.Commit()
 
 	return nil
 }
 
-func (r *UsersRepository) GetUser(ctx context.Context, where string) (*dto.User, error) {
-
+func (r *UsersRepository) GetUser(ctx context.Context, s *spec.Spec) (*dto.User, error) {
 	var user dto.User
 
 	tx := r.DBService.GetDB()
 	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
 
-	if err := tx.Table(dto.USER_TABLE).Where(where).First(&user).Error; err != nil {
+	if err := findFirst(scopeTenant(ctx, tx.Table(dto.USER_TABLE), "school_id"), s, userFields, &user); err != nil {
 		return &user, err
 	}
 
 	return &user, nil
 }
 
+// GetUsers returns a page of the users matching the spec and the number of matching users
+func (r *UsersRepository) GetUsers(ctx context.Context, s *spec.Spec) ([]dto.User, int, error) {
+	var users []dto.User
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	total, err := findAll(scopeTenant(ctx, tx.Table(dto.USER_TABLE), "school_id"), s, userFields, &users)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
 func (r *UsersRepository) GetUserByEmail(ctx context.Context, email string) (*dto.User, error) {
 
 	var user dto.User
@@ -67,3 +109,257 @@ func (r *UsersRepository) GetUserByEmail(ctx context.Context, email string) (*dt
 
 	return &user, nil
 }
+
+func (r *UsersRepository) MarkEmailVerified(ctx context.Context, id int) error {
+
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := scopeTenant(ctx, tx.Table(dto.USER_TABLE), "school_id").Where("id = ?", id).Updates(map[string]interface{}{
+		"email_verified":    true,
+		"email_verified_at": time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+
+	tx.Commit()
+
+	return nil
+}
+
+func (r *UsersRepository) UpdatePassword(ctx context.Context, id int, passwordHash string) error {
+
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	result := scopeTenant(ctx, tx.Table(dto.USER_TABLE), "school_id").Where("id = ?", id).Update("password", passwordHash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	// The hash is never logged, the entry only records that the password changed
+	if err := auditUser(ctx, tx, constants.AUDIT_USER_PASSWORD, id, nil, map[string]interface{}{"password": passwordHash}); err != nil {
+		return err
+	}
+
+	tx.Commit()
+
+	return nil
+}
+
+func (r *UsersRepository) UpdateRole(ctx context.Context, id int, role string) error {
+
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var before dto.User
+	if err := scopeTenant(ctx, tx.Table(dto.USER_TABLE), "school_id").
+		Where("id = ? AND anonymized_at IS NULL", id).First(&before).Error; err != nil {
+		return err
+	}
+
+	// The assignment of the old base role is replaced by the new one, other roles are kept
+	if err := tx.Exec(`DELETE FROM user_roles WHERE user_id = ? AND role_id IN
+		(SELECT r.id FROM roles r JOIN users u ON u.role = r.name WHERE u.id = ?)`, id, id).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Table(dto.USER_TABLE).Where("id = ?", id).Updates(map[string]interface{}{
+		"role":       role,
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+
+	if err := assignBaseRole(tx, id, role); err != nil {
+		return err
+	}
+	if err := auditUser(ctx, tx, constants.AUDIT_USER_ROLE_CHANGE, id,
+		map[string]interface{}{"role": before.Role}, map[string]interface{}{"role": role}); err != nil {
+		return err
+	}
+
+	tx.Commit()
+
+	return nil
+}
+
+// UpdateProfile changes the name and email of a user, empty fields are kept. A new email address
+// has to be verified again.
+func (r *UsersRepository) UpdateProfile(ctx context.Context, id int, name, email string) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	fields := map[string]interface{}{"updated_at": time.Now()}
+	if name != "" {
+		fields["name"] = name
+	}
+	if email != "" {
+		fields["email"] = email
+		fields["email_verified"] = gorm.Expr("email_verified AND email = ?", email)
+		fields["email_verified_at"] = gorm.Expr("CASE WHEN email = ? THEN email_verified_at END", email)
+	}
+
+	if err := updateUser(ctx, tx, constants.AUDIT_USER_UPDATE, id, fields); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// DeactivateUser stops the user from signing in, the user's data is kept
+func (r *UsersRepository) DeactivateUser(ctx context.Context, id int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	now := time.Now()
+	if err := updateUser(ctx, tx, constants.AUDIT_USER_DEACTIVATE, id, map[string]interface{}{
+		"deactivated_at": gorm.Expr("COALESCE(deactivated_at, ?)", now),
+		"updated_at":     now,
+	}); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// ReactivateUser lets a deactivated user sign in again
+func (r *UsersRepository) ReactivateUser(ctx context.Context, id int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := updateUser(ctx, tx, constants.AUDIT_USER_REACTIVATE, id, map[string]interface{}{
+		"deactivated_at": nil,
+		"updated_at":     time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// DeleteUser erases the personal data and credentials of a user. The row is kept, anonymized and
+// deactivated, so responses, enrollments and classrooms referencing the user stay reportable.
+func (r *UsersRepository) DeleteUser(ctx context.Context, id int) error {
+	tx := r.DBService.GetDB().Begin()
+	defer tx.Rollback()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	var before dto.User
+	if err := scopeTenant(ctx, tx.Table(dto.USER_TABLE), "school_id").
+		Where("id = ? AND anonymized_at IS NULL", id).First(&before).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Table(dto.USER_TABLE).Where("id = ?", id).Updates(map[string]interface{}{
+		"name":              "Deleted user",
+		"email":             fmt.Sprintf("deleted-user-%d@anonymized.invalid", id),
+		"password":          "",
+		"email_verified":    false,
+		"email_verified_at": nil,
+		"deactivated_at":    gorm.Expr("COALESCE(deactivated_at, ?)", now),
+		"anonymized_at":     now,
+		"updated_at":        now,
+	}).Error; err != nil {
+		return err
+	}
+
+	// Credentials, second factors, SSO links and role assignments go with the personal data
+	for _, table := range []string{dto.USER_TOKEN_TABLE, dto.MFA_RECOVERY_CODE_TABLE, dto.USER_MFA_TABLE,
+		dto.USER_IDENTITY_TABLE, dto.USER_ROLE_TABLE} {
+		if err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", id).Error; err != nil {
+			return err
+		}
+	}
+
+	// The entry leaves out the erased name and email
+	if err := auditUser(ctx, tx, constants.AUDIT_USER_DELETE, id,
+		map[string]interface{}{"role": before.Role}, map[string]interface{}{"anonymized_at": now}); err != nil {
+		return err
+	}
+
+	tx.Commit()
+	return nil
+}
+
+// IsUserActive reports whether the user exists and is neither deactivated nor deleted
+func (r *UsersRepository) IsUserActive(ctx context.Context, id int) (bool, error) {
+	var count int
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.USER_TABLE).Where("id = ? AND deactivated_at IS NULL", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetUserRoleNames returns the names of the roles assigned to the user
+func (r *UsersRepository) GetUserRoleNames(ctx context.Context, id int) ([]string, error) {
+	var names []string
+
+	tx := r.DBService.GetDB()
+	tx.LogMode(constants.Config.DatabaseConfig.DB_LOG_MODE)
+
+	if err := tx.Table(dto.USER_ROLE_TABLE).
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id = ?", id).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error; err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// updateUser applies the fields to a user of the tenant that was not deleted and audits the change
+func updateUser(ctx context.Context, tx *gorm.DB, action string, id int, fields map[string]interface{}) error {
+	var before, after dto.User
+	if err := scopeTenant(ctx, tx.Table(dto.USER_TABLE), "school_id").
+		Where("id = ? AND anonymized_at IS NULL", id).First(&before).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.USER_TABLE).Where("id = ?", id).Updates(fields).Error; err != nil {
+		return err
+	}
+	if err := tx.Table(dto.USER_TABLE).Where("id = ?", id).First(&after).Error; err != nil {
+		return err
+	}
+	return auditUser(ctx, tx, action, id, &before, &after)
+}
+
+// auditUser records a change of a user in the audit log under the user's school
+func auditUser(ctx context.Context, tx *gorm.DB, action string, userId int, before, after interface{}) error {
+	beforeData, afterData, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	entry := &dto.AuditLog{
+		Action:       action,
+		ResourceType: constants.AUDIT_RESOURCE_USER,
+		ResourceId:   strconv.Itoa(userId),
+		Before:       beforeData,
+		After:        afterData,
+	}
+	var user dto.User
+	if err := tx.Table(dto.USER_TABLE).Select("school_id").Where("id = ?", userId).First(&user).Error; err != nil {
+		return err
+	}
+	entry.SchoolId = &user.SchoolId
+	return appendAuditLog(ctx, tx, entry)
+}
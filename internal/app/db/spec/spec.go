@@ -0,0 +1,185 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Operator compares a field with a value
+type Operator string
+
+const (
+	Eq      Operator = "="
+	Ne      Operator = "<>"
+	Lt      Operator = "<"
+	Lte     Operator = "<="
+	Gt      Operator = ">"
+	Gte     Operator = ">="
+	In      Operator = "IN"
+	NotIn   Operator = "NOT IN"
+	Like    Operator = "LIKE"
+	ILike   Operator = "ILIKE"
+	IsNull  Operator = "IS NULL"
+	NotNull Operator = "IS NOT NULL"
+)
+
+var (
+	ErrUnknownField    = errors.New("spec: unknown field")
+	ErrUnknownOperator = errors.New("spec: unknown operator")
+	ErrInvalidValue    = errors.New("spec: invalid value")
+)
+
+// Condition restricts a field, the value is always sent as a bound parameter
+type Condition struct {
+	Field    string
+	Operator Operator
+	Value    interface{}
+}
+
+// Sort orders the result by a field
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Spec selects rows of a table: every condition must hold, rows are sorted in order and a
+// limit of 0 returns every row
+type Spec struct {
+	Conditions []Condition
+	Sorts      []Sort
+	Limit      int
+	Offset     int
+}
+
+// Fields are the columns a repository lets a spec filter and sort on
+type Fields map[string]bool
+
+// NewFields returns the set of the given columns
+func NewFields(columns ...string) Fields {
+	fields := make(Fields, len(columns))
+	for _, column := range columns {
+		fields[column] = true
+	}
+	return fields
+}
+
+// New returns a spec matching every row
+func New() *Spec {
+	return &Spec{}
+}
+
+// Where returns a spec with a single condition
+func Where(field string, operator Operator, value interface{}) *Spec {
+	return New().And(field, operator, value)
+}
+
+// ByID returns a spec matching the row with the id
+func ByID(id int) *Spec {
+	return Where("id", Eq, id)
+}
+
+// And adds a condition
+func (s *Spec) And(field string, operator Operator, value interface{}) *Spec {
+	s.Conditions = append(s.Conditions, Condition{Field: field, Operator: operator, Value: value})
+	return s
+}
+
+// OrderBy adds a sort, earlier sorts take precedence
+func (s *Spec) OrderBy(field string, desc bool) *Spec {
+	s.Sorts = append(s.Sorts, Sort{Field: field, Desc: desc})
+	return s
+}
+
+// Paginate limits the result to limit rows starting at offset
+func (s *Spec) Paginate(limit, offset int) *Spec {
+	s.Limit = limit
+	s.Offset = offset
+	return s
+}
+
+// Filter applies the conditions to the query. Fields are checked against the allowed columns,
+// so neither fields nor operators can carry SQL.
+func (s *Spec) Filter(query *gorm.DB, fields Fields) (*gorm.DB, error) {
+	if s == nil {
+		return query, nil
+	}
+
+	for _, condition := range s.Conditions {
+		if !fields[condition.Field] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, condition.Field)
+		}
+
+		switch condition.Operator {
+		case Eq, Ne, Lt, Lte, Gt, Gte:
+			query = query.Where(fmt.Sprintf("%s %s ?", condition.Field, condition.Operator), condition.Value)
+		case Like, ILike:
+			if _, ok := condition.Value.(string); !ok {
+				return nil, fmt.Errorf("%w: %s needs a string", ErrInvalidValue, condition.Operator)
+			}
+			query = query.Where(fmt.Sprintf("%s %s ?", condition.Field, condition.Operator), condition.Value)
+		case In, NotIn:
+			value := reflect.ValueOf(condition.Value)
+			if value.Kind() != reflect.Slice {
+				return nil, fmt.Errorf("%w: %s needs a slice", ErrInvalidValue, condition.Operator)
+			}
+			// An empty IN list is invalid SQL, it matches nothing and an empty NOT IN everything
+			if value.Len() == 0 {
+				if condition.Operator == In {
+					query = query.Where("FALSE")
+				}
+				continue
+			}
+			query = query.Where(fmt.Sprintf("%s %s (?)", condition.Field, condition.Operator), condition.Value)
+		case IsNull, NotNull:
+			query = query.Where(fmt.Sprintf("%s %s", condition.Field, condition.Operator))
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownOperator, condition.Operator)
+		}
+	}
+
+	return query, nil
+}
+
+// Order sorts and paginates the query
+func (s *Spec) Order(query *gorm.DB, fields Fields) (*gorm.DB, error) {
+	if s == nil {
+		return query, nil
+	}
+
+	if len(s.Sorts) > 0 {
+		order := make([]string, 0, len(s.Sorts))
+		for _, sort := range s.Sorts {
+			if !fields[sort.Field] {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownField, sort.Field)
+			}
+			direction := "ASC"
+			if sort.Desc {
+				direction = "DESC"
+			}
+			order = append(order, sort.Field+" "+direction)
+		}
+		query = query.Order(strings.Join(order, ", "))
+	}
+
+	if s.Limit > 0 {
+		query = query.Limit(s.Limit)
+	}
+	if s.Offset > 0 {
+		query = query.Offset(s.Offset)
+	}
+
+	return query, nil
+}
+
+// Apply filters, sorts and paginates the query
+func (s *Spec) Apply(query *gorm.DB, fields Fields) (*gorm.DB, error) {
+	query, err := s.Filter(query, fields)
+	if err != nil {
+		return nil, err
+	}
+	return s.Order(query, fields)
+}
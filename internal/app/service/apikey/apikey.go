@@ -0,0 +1,97 @@
+package apikey
+
+import (
+	"context"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/util"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// KeyPrefix marks our API keys so they are recognisable in logs and secret scanners
+	KeyPrefix = "eak_"
+	// displayLength is the length of the key start stored in clear to identify a key
+	displayLength = len(KeyPrefix) + 8
+	// touchInterval limits how often last_used_at is written for a busy key
+	touchInterval = time.Minute
+)
+
+var ErrInvalidKey = errors.New("invalid api key")
+
+// IApiKeyService defines the interface for issuing and checking API keys
+type IApiKeyService interface {
+	Create(ctx context.Context, key *dto.ApiKey) (string, error)
+	Authenticate(ctx context.Context, rawKey string) (*dto.ApiKey, error)
+}
+
+// ApiKeyService stores API keys as SHA-256 hashes; the key itself is only shown on creation
+type ApiKeyService struct {
+	Repo        repository.IApiKeysRepository
+	lastTouched map[int]time.Time
+	mu          sync.Mutex
+}
+
+// NewApiKeyService creates a new ApiKeyService
+func NewApiKeyService(repo repository.IApiKeysRepository) IApiKeyService {
+	return &ApiKeyService{
+		Repo:        repo,
+		lastTouched: make(map[int]time.Time),
+	}
+}
+
+// Create generates the key, stores its hash and returns the key in clear
+func (s *ApiKeyService) Create(ctx context.Context, key *dto.ApiKey) (string, error) {
+	secret, err := util.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	rawKey := KeyPrefix + secret
+	key.Prefix = rawKey[:displayLength]
+	key.KeyHash = util.HashToken(rawKey)
+
+	if err := s.Repo.CreateApiKey(ctx, key); err != nil {
+		return "", err
+	}
+	return rawKey, nil
+}
+
+// Authenticate returns the active key matching rawKey and records its use
+func (s *ApiKeyService) Authenticate(ctx context.Context, rawKey string) (*dto.ApiKey, error) {
+	log := logger.Logger(ctx)
+
+	if !strings.HasPrefix(rawKey, KeyPrefix) {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := s.Repo.GetActiveApiKey(ctx, util.HashToken(rawKey))
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	touch := now.Sub(s.lastTouched[key.Id]) >= touchInterval
+	if touch {
+		s.lastTouched[key.Id] = now
+	}
+	s.mu.Unlock()
+
+	if touch {
+		if err := s.Repo.TouchApiKey(ctx, key.Id, now); err != nil {
+			log.Warnf("Failed to record use of api key %d: %v", key.Id, err)
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
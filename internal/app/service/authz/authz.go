@@ -0,0 +1,166 @@
+// Package authz checks access to individual resources. Casbin decides which routes a role may
+// call, authz decides which classrooms, students and quizzes the caller may act on.
+package authz
+
+import (
+	"context"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"errors"
+)
+
+// Action is what the subject wants to do with a resource
+type Action string
+
+const (
+	ActionRead  Action = "read"
+	ActionWrite Action = "write"
+	// ActionManage deletes or hands over a classroom and manages its members, which co-teachers
+	// may not
+	ActionManage Action = "manage"
+)
+
+var ErrForbidden = errors.New("access denied")
+
+// Subject is the caller of a request
+type Subject struct {
+	UserId   int
+	Role     string
+	SchoolId int
+	// ApiKeyId is set for machine clients. They act for no user, so only admin keys reach
+	// classrooms and students, school-wide like admins.
+	ApiKeyId int
+}
+
+// schoolWide reports whether the subject may act on any resource of its school
+func (s Subject) schoolWide() bool {
+	return s.Role == constants.ROLE_ADMIN
+}
+
+// ownerless reports whether the subject is an API key of a non-admin role, which owns no
+// classrooms and is no student, so it is denied every ownership-scoped resource
+func (s Subject) ownerless() bool {
+	return s.ApiKeyId != 0 && !s.schoolWide()
+}
+
+// IAuthorizer defines the resource-level access rules
+type IAuthorizer interface {
+	School(ctx context.Context, subject Subject, schoolId int) error
+	Classroom(ctx context.Context, subject Subject, classroom *dto.Classroom, action Action) error
+	Student(ctx context.Context, subject Subject, student *dto.User) error
+	Teacher(ctx context.Context, subject Subject, teacher *dto.User) error
+	Quiz(ctx context.Context, subject Subject, quiz *dto.Quiz) error
+}
+
+// Authorizer limits admins to their school, teachers to the classrooms they teach or are members
+// of and students to themselves and the classrooms they are enrolled in
+type Authorizer struct {
+	ClassroomRepo repository.IClassroomsRepository
+}
+
+// NewAuthorizer creates a new Authorizer
+func NewAuthorizer(classroomRepo repository.IClassroomsRepository) IAuthorizer {
+	return &Authorizer{
+		ClassroomRepo: classroomRepo,
+	}
+}
+
+// School allows school-wide subjects to act on their own school only
+func (a *Authorizer) School(ctx context.Context, subject Subject, schoolId int) error {
+	if !subject.schoolWide() || schoolId != subject.SchoolId {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Classroom allows teachers their own classrooms, co-teachers to read and write the classrooms
+// they are members of, assistants to read them and students to read the classrooms they are
+// enrolled in
+func (a *Authorizer) Classroom(ctx context.Context, subject Subject, classroom *dto.Classroom, action Action) error {
+	if classroom.SchoolId != subject.SchoolId {
+		return ErrForbidden
+	}
+
+	switch {
+	case subject.schoolWide():
+		return nil
+	case subject.ownerless():
+		return ErrForbidden
+	case subject.Role == constants.ROLE_TEACHER:
+		if classroom.TeacherId == subject.UserId {
+			return nil
+		}
+		if classroom.Id == 0 || action == ActionManage {
+			break
+		}
+		role, err := a.ClassroomRepo.GetClassroomMemberRole(ctx, classroom.Id, subject.UserId)
+		if err != nil {
+			return err
+		}
+		if role == constants.CLASSROOM_MEMBER_CO_TEACHER || (role == constants.CLASSROOM_MEMBER_ASSISTANT && action == ActionRead) {
+			return nil
+		}
+	case subject.Role == constants.ROLE_STUDENT && action == ActionRead:
+		enrolled, err := a.ClassroomRepo.IsStudentEnrolled(ctx, classroom.Id, subject.UserId)
+		if err != nil {
+			return err
+		}
+		if enrolled {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+// Student allows students their own records and teachers the records of students enrolled in
+// one of the classrooms they teach or are members of
+func (a *Authorizer) Student(ctx context.Context, subject Subject, student *dto.User) error {
+	if student.SchoolId != subject.SchoolId {
+		return ErrForbidden
+	}
+
+	switch {
+	case subject.schoolWide():
+		return nil
+	case subject.ownerless():
+		return ErrForbidden
+	case subject.Role == constants.ROLE_STUDENT:
+		if student.Id == subject.UserId {
+			return nil
+		}
+	case subject.Role == constants.ROLE_TEACHER:
+		taught, err := a.ClassroomRepo.IsStudentOfTeacher(ctx, subject.UserId, student.Id)
+		if err != nil {
+			return err
+		}
+		if taught {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+// Teacher allows teachers to act as themselves only, e.g. when creating or listing classrooms
+func (a *Authorizer) Teacher(ctx context.Context, subject Subject, teacher *dto.User) error {
+	if teacher.SchoolId != subject.SchoolId {
+		return ErrForbidden
+	}
+	if subject.schoolWide() || (subject.Role == constants.ROLE_TEACHER && !subject.ownerless() && teacher.Id == subject.UserId) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// Quiz follows the quiz's classroom, the teacher who created a quiz keeps access to it
+func (a *Authorizer) Quiz(ctx context.Context, subject Subject, quiz *dto.Quiz) error {
+	if subject.Role == constants.ROLE_TEACHER && subject.ApiKeyId == 0 && quiz.CreatedBy == subject.UserId {
+		return nil
+	}
+
+	classroom, err := a.ClassroomRepo.GetClassroomByID(ctx, quiz.ClassroomId)
+	if err != nil {
+		return err
+	}
+	return a.Classroom(ctx, subject, classroom, ActionRead)
+}
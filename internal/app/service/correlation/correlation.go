@@ -4,12 +4,15 @@ import (
 	"context"
 
 	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-// WithReqContext returns logger
+// WithReqContext returns the request context carrying the correlation id, the actor of the
+// request for the audit log and the school the request is scoped to. Repositories only return
+// rows of that school; public routes and super admins are not scoped to a school.
 func WithReqContext(c *gin.Context) context.Context {
 	correlationId := c.GetHeader(constants.CORRELATION_KEY_ID.String())
 	if len(correlationId) == 0 {
@@ -19,10 +22,41 @@ func WithReqContext(c *gin.Context) context.Context {
 	}
 	c.Writer.Header().Set(constants.CORRELATION_KEY_ID.String(), correlationId)
 
+	actor := requestActor(c)
 	requestCtx := context.WithValue(context.Background(), constants.CORRELATION_KEY_ID, correlationId)
+	requestCtx = context.WithValue(requestCtx, constants.CTK_AUDIT_ACTOR, actor)
+	if actor.SchoolId != nil && actor.Role != constants.ROLE_SUPER_ADMIN {
+		requestCtx = context.WithValue(requestCtx, constants.CTK_TENANT_ID, *actor.SchoolId)
+	}
 	return requestCtx
 }
 
+// requestActor describes the authenticated user or API key of the request, requests of the
+// public routes are anonymous
+func requestActor(c *gin.Context) dto.AuditActor {
+	actor := dto.AuditActor{Type: constants.AUDIT_ACTOR_ANONYMOUS, IPAddress: c.ClientIP()}
+
+	if value, exists := c.Get(constants.CTK_API_KEY.String()); exists {
+		if key, ok := value.(*dto.ApiKey); ok && key != nil {
+			actor.Type = constants.AUDIT_ACTOR_API_KEY
+			actor.ApiKeyId = &key.Id
+			actor.Role = key.Role
+			actor.SchoolId = &key.SchoolId
+			return actor
+		}
+	}
+
+	if value, exists := c.Get(constants.CTK_CLAIM_KEY.String()); exists {
+		if user, ok := value.(*dto.User); ok && user != nil {
+			actor.Type = constants.AUDIT_ACTOR_USER
+			actor.UserId = &user.Id
+			actor.Role = user.Role
+			actor.SchoolId = &user.SchoolId
+		}
+	}
+	return actor
+}
+
 func ContextCorrelationId(ctx context.Context) string {
 	if ctxCorrelationID, ok := ctx.Value(constants.CORRELATION_KEY_ID).(string); ok {
 		return ctxCorrelationID
@@ -2,14 +2,179 @@ package request
 
 import (
 	"eduanalytics/internal/app/service/util"
+	"time"
 )
 
+type RegisterRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Email    string `json:"email" binding:"required,email,max=150"`
+	Password string `json:"password" binding:"required"`
+	SchoolId int    `json:"school_id" binding:"required"`
+}
+
+type CreateUserRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Email    string `json:"email" binding:"required,email,max=150"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required,oneof=admin teacher student"`
+	SchoolId int    `json:"school_id" binding:"required"`
+}
+
+// UserQuery searches the users: query matches part of the name and email part of the email
+// address. Without a status active and deactivated users are listed, deleted ones are not.
+type UserQuery struct {
+	Pagination
+	Email    string `form:"email" binding:"max=150"`
+	Role     string `form:"role" binding:"omitempty,oneof=super_admin admin teacher student"`
+	SchoolId int    `form:"school_id" binding:"omitempty,min=1"`
+	Status   string `form:"status" binding:"omitempty,oneof=active deactivated deleted"`
+}
+
+// UpdateUserRequest changes the profile of a user, fields left out are kept
+type UpdateUserRequest struct {
+	Name  string `json:"name" binding:"max=100"`
+	Email string `json:"email" binding:"omitempty,email,max=150"`
+}
+
+type ChangeUserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin teacher student"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type MfaLoginRequest struct {
+	MfaToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MfaEnrollLoginRequest struct {
+	MfaToken string `json:"mfa_token" binding:"required"`
+}
+
+type MfaCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableMfaRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MfaRequirementRequest struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+type IdentityProviderRequest struct {
+	Issuer       string            `json:"issuer" binding:"required,url"`
+	ClientId     string            `json:"client_id" binding:"required"`
+	ClientSecret string            `json:"client_secret"`
+	Scopes       []string          `json:"scopes"`
+	RoleClaim    string            `json:"role_claim"`
+	RoleMapping  map[string]string `json:"role_mapping" binding:"dive,oneof=admin teacher student"`
+	DefaultRole  string            `json:"default_role" binding:"omitempty,oneof=teacher student"`
+	Enabled      *bool             `json:"enabled"`
+}
+
+type CreateApiKeyRequest struct {
+	Name          string `json:"name" binding:"required,max=100"`
+	Role          string `json:"role" binding:"required,oneof=admin teacher student"`
+	ExpiresInDays int    `json:"expires_in_days" binding:"omitempty,min=1"`
+}
+
+// PolicyRequest is a Casbin policy: role may call method on the route path, e.g. /classrooms/:id
+type PolicyRequest struct {
+	Role   string `json:"role" binding:"required,max=50"`
+	Path   string `json:"path" binding:"required,startswith=/,max=255"`
+	Method string `json:"method" binding:"required,oneof=GET POST PUT PATCH DELETE"`
+}
+
+// RoleInheritanceRequest lets role inherit every policy of the inherited role
+type RoleInheritanceRequest struct {
+	Role     string `json:"role" binding:"required,max=50"`
+	Inherits string `json:"inherits" binding:"required,max=50,nefield=Role"`
+}
+
+// CreateRoleRequest creates a custom role, inherits lists the roles whose policies it inherits
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Description string   `json:"description" binding:"max=255"`
+	Inherits    []string `json:"inherits" binding:"omitempty,dive,required,max=50"`
+}
+
+type UpdateRoleRequest struct {
+	Description string `json:"description" binding:"max=255"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required,max=50"`
+}
+
+// CreateSchoolRequest creates a school, settings left out default to UTC and the letter grading
+// scale
+type CreateSchoolRequest struct {
+	Name         string      `json:"name" binding:"required,max=150"`
+	Address      string      `json:"address"`
+	Timezone     string      `json:"timezone" binding:"max=64"`
+	GradingScale []GradeBand `json:"grading_scale" binding:"omitempty,dive"`
+}
+
+type UpdateSchoolRequest struct {
+	Name    string `json:"name" binding:"max=150"`
+	Address string `json:"address"`
+}
+
+// SchoolSettingsRequest replaces the tenant-level settings of a school, timezone is an IANA name
+// such as Europe/Berlin
+type SchoolSettingsRequest struct {
+	Timezone     string      `json:"timezone" binding:"required,max=64"`
+	GradingScale []GradeBand `json:"grading_scale" binding:"required,min=1,dive"`
+}
+
+// GradeBand awards the grade to scores of at least min_percent
+type GradeBand struct {
+	Grade      string   `json:"grade" binding:"required,max=10"`
+	MinPercent *float64 `json:"min_percent" binding:"required,min=0,max=100"`
+}
+
 type CreateClassroomRequest struct {
 	Name      string `json:"name" binding:"required"`
 	SchoolId  int    `json:"school_id" binding:"required"`
 	TeacherId int    `json:"teacher_id" binding:"required"`
 }
 
+// ClassroomQuery filters the classroom list, query searches the name. created_from and
+// created_to are RFC 3339 times and created_to is exclusive. Without a status only active
+// classrooms are listed.
+type ClassroomQuery struct {
+	Pagination
+	TeacherId   int        `form:"teacher_id" binding:"omitempty,min=1"`
+	SchoolId    int        `form:"school_id" binding:"omitempty,min=1"`
+	CreatedFrom *time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo   *time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Status      string     `form:"status" binding:"omitempty,oneof=active archived"`
+}
+
+// MyQuizzesQuery limits the signed in student's quizzes to one status
+type MyQuizzesQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=upcoming active completed"`
+}
+
 type UpdateClassroomRequest struct {
 	Name      string `json:"name"`
 	TeacherId int    `json:"teacher_id"`
@@ -19,6 +184,57 @@ type EnrollStudentsRequest struct {
 	StudentIds []int `json:"student_ids" binding:"required,min=1"`
 }
 
+// TransferStudentsRequest moves students of a classroom to another section
+type TransferStudentsRequest struct {
+	StudentIds    []int `json:"student_ids" binding:"required,min=1"`
+	ToClassroomId int   `json:"to_classroom_id" binding:"required,min=1"`
+}
+
+// AddClassroomMemberRequest adds a co-teacher or teaching assistant to a classroom
+type AddClassroomMemberRequest struct {
+	UserId int    `json:"user_id" binding:"required,min=1"`
+	Role   string `json:"role" binding:"required,oneof=co_teacher assistant"`
+}
+
+// PurgeClassroomQuery asks for the impact of a classroom purge without deleting anything
+type PurgeClassroomQuery struct {
+	DryRun bool `form:"dry_run"`
+}
+
+// AsOfQuery looks at enrollments at a point in time, as_of is an RFC 3339 time
+type AsOfQuery struct {
+	AsOf *time.Time `form:"as_of" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// RosterImportRequest is the multipart form of a roster import, file is the CSV file. A dry run
+// only validates the file.
+type RosterImportRequest struct {
+	DryRun bool `form:"dry_run"`
+}
+
+// OneRosterImportRequest is the multipart form of a OneRoster import, file is the zipped CSV
+// bundle. OrgSourcedId chooses the admin's school among the schools of a district bundle.
+type OneRosterImportRequest struct {
+	DryRun       bool   `form:"dry_run"`
+	OrgSourcedId string `form:"org_sourced_id" binding:"max=255"`
+}
+
+// OneRosterExportQuery chooses the school super admins export, admins export their own
+type OneRosterExportQuery struct {
+	SchoolId int `form:"school_id" binding:"omitempty,min=1"`
+}
+
+// AuditLogQuery filters the audit log, from and to are RFC 3339 times and to is exclusive
+type AuditLogQuery struct {
+	Pagination
+	ActorId      int        `form:"actor_id" binding:"omitempty,min=1"`
+	Action       string     `form:"action" binding:"max=100"`
+	ResourceType string     `form:"resource_type" binding:"max=50"`
+	ResourceId   string     `form:"resource_id" binding:"max=100"`
+	From         *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To           *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
 type Pagination struct {
 	Limit      *int   `json:"limit,omitempty" form:"limit"`
 	Page       *int   `json:"page,omitempty" form:"page"`
@@ -1,16 +1,22 @@
 package response
 
 import (
+	"eduanalytics/internal/app/api/middleware/jwt"
 	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/service/session"
+	"encoding/json"
+	"math"
+	"strings"
 	"time"
 )
 
 type ClassroomResponse struct {
-	Id        int       `json:"id"`
-	Name      string    `json:"name"`
-	SchoolId  int       `json:"school_id"`
-	TeacherId int       `json:"teacher_id"`
-	CreatedAt time.Time `json:"created_at"`
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	SchoolId   int        `json:"school_id"`
+	TeacherId  int        `json:"teacher_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
 }
 
 type ClassroomWithStudentsResponse struct {
@@ -31,11 +37,12 @@ type StudentResponse struct {
 
 func ToClassroomResponse(classroom *dto.Classroom) ClassroomResponse {
 	return ClassroomResponse{
-		Id:        classroom.Id,
-		Name:      classroom.Name,
-		SchoolId:  classroom.SchoolId,
-		TeacherId: classroom.TeacherId,
-		CreatedAt: classroom.CreatedAt,
+		Id:         classroom.Id,
+		Name:       classroom.Name,
+		SchoolId:   classroom.SchoolId,
+		TeacherId:  classroom.TeacherId,
+		CreatedAt:  classroom.CreatedAt,
+		ArchivedAt: classroom.ArchivedAt,
 	}
 }
 
@@ -63,6 +70,242 @@ func ToStudentResponseList(users []dto.User) []StudentResponse {
 	return responses
 }
 
+// StudentQuizResponse is a quiz of the signed in student. Score and grade are set once the
+// student answered a question; the score is the percentage of the quiz's questions answered
+// correctly.
+type StudentQuizResponse struct {
+	Id            int        `json:"id"`
+	Title         string     `json:"title"`
+	ClassroomId   int        `json:"classroom_id"`
+	ClassroomName string     `json:"classroom_name"`
+	StartTime     time.Time  `json:"start_time"`
+	EndTime       time.Time  `json:"end_time"`
+	Status        string     `json:"status"`
+	Questions     int        `json:"questions"`
+	Answered      int        `json:"answered"`
+	Correct       int        `json:"correct"`
+	Score         *float64   `json:"score,omitempty"`
+	Grade         string     `json:"grade,omitempty"`
+	SubmittedAt   *time.Time `json:"submitted_at,omitempty"`
+}
+
+// QuizGroupsResponse groups quizzes by whether they start later, are open or have ended
+type QuizGroupsResponse struct {
+	Upcoming  interface{} `json:"upcoming"`
+	Active    interface{} `json:"active"`
+	Completed interface{} `json:"completed"`
+}
+
+func ToStudentQuizResponse(quiz *dto.StudentQuiz, status string, scale dto.GradingScale) StudentQuizResponse {
+	response := StudentQuizResponse{
+		Id:            quiz.Id,
+		Title:         quiz.Title,
+		ClassroomId:   quiz.ClassroomId,
+		ClassroomName: quiz.ClassroomName,
+		StartTime:     quiz.StartTime,
+		EndTime:       quiz.EndTime,
+		Status:        status,
+		Questions:     quiz.Questions,
+		Answered:      quiz.Answered,
+		Correct:       quiz.Correct,
+		SubmittedAt:   quiz.LastSubmittedAt,
+	}
+	if quiz.Answered > 0 && quiz.Questions > 0 {
+		score := math.Round(float64(quiz.Correct)*10000/float64(quiz.Questions)) / 100
+		response.Score = &score
+		response.Grade = scale.Grade(score)
+	}
+	return response
+}
+
+// TeacherClassroomResponse is a classroom of the signed in teacher
+type TeacherClassroomResponse struct {
+	ClassroomResponse
+	Students int `json:"students"`
+}
+
+// TeacherQuizResponse is a quiz of the signed in teacher's classrooms. Accuracy is the share of
+// correct responses, set once students responded.
+type TeacherQuizResponse struct {
+	Id            int       `json:"id"`
+	Title         string    `json:"title"`
+	ClassroomId   int       `json:"classroom_id"`
+	ClassroomName string    `json:"classroom_name"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	Status        string    `json:"status"`
+	Questions     int       `json:"questions"`
+	Students      int       `json:"students"`
+	Participants  int       `json:"participants"`
+	Accuracy      *float64  `json:"accuracy,omitempty"`
+}
+
+func ToTeacherQuizResponse(quiz *dto.TeacherQuiz, status string) TeacherQuizResponse {
+	response := TeacherQuizResponse{
+		Id:            quiz.Id,
+		Title:         quiz.Title,
+		ClassroomId:   quiz.ClassroomId,
+		ClassroomName: quiz.ClassroomName,
+		StartTime:     quiz.StartTime,
+		EndTime:       quiz.EndTime,
+		Status:        status,
+		Questions:     quiz.Questions,
+		Students:      quiz.Students,
+		Participants:  quiz.Participants,
+	}
+	if quiz.Attempts > 0 {
+		accuracy := math.Round(float64(quiz.Correct)*100/float64(quiz.Attempts)) / 100
+		response.Accuracy = &accuracy
+	}
+	return response
+}
+
+// TeacherDashboardResponse is the overview of the signed in teacher: the classrooms, the number
+// of distinct students enrolled in them and the quizzes of the classrooms
+type TeacherDashboardResponse struct {
+	Classrooms []TeacherClassroomResponse `json:"classrooms"`
+	Students   int                        `json:"students"`
+	Quizzes    QuizGroupsResponse         `json:"quizzes"`
+}
+
+// UserResponse is a user without credentials
+type UserResponse struct {
+	Id            int        `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	SchoolId      int        `json:"school_id"`
+	EmailVerified bool       `json:"email_verified"`
+	Active        bool       `json:"active"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+	AnonymizedAt  *time.Time `json:"anonymized_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
+func ToUserResponse(user *dto.User) UserResponse {
+	return UserResponse{
+		Id:            user.Id,
+		Name:          user.Name,
+		Email:         user.Email,
+		Role:          user.Role,
+		SchoolId:      user.SchoolId,
+		EmailVerified: user.EmailVerified,
+		Active:        user.DeactivatedAt == nil,
+		DeactivatedAt: user.DeactivatedAt,
+		AnonymizedAt:  user.AnonymizedAt,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+	}
+}
+
+func ToUserResponseList(users []dto.User) []UserResponse {
+	responses := make([]UserResponse, 0, len(users))
+	for _, user := range users {
+		responses = append(responses, ToUserResponse(&user))
+	}
+	return responses
+}
+
+type SessionResponse struct {
+	SessionID string    `json:"session_id"`
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Current   bool      `json:"current"`
+}
+
+func ToSessionResponse(s *session.Session, currentSessionID string) SessionResponse {
+	return SessionResponse{
+		SessionID: s.SessionID,
+		UserAgent: s.UserAgent,
+		IPAddress: s.IPAddress,
+		CreatedAt: s.CreatedAt,
+		ExpiresAt: s.ExpiresAt,
+		Current:   currentSessionID != "" && s.SessionID == currentSessionID,
+	}
+}
+
+func ToSessionResponseList(sessions []*session.Session, currentSessionID string) []SessionResponse {
+	responses := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		responses = append(responses, ToSessionResponse(s, currentSessionID))
+	}
+	return responses
+}
+
+// MfaChallengeResponse is returned by the login when a second factor is needed. The mfa_token
+// identifies the login in the second step; enrollment_required is set when the user's role
+// requires MFA but the user has not enrolled yet.
+type MfaChallengeResponse struct {
+	MfaRequired        bool      `json:"mfa_required"`
+	MfaToken           string    `json:"mfa_token"`
+	EnrollmentRequired bool      `json:"enrollment_required"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+// MfaLoginResponse carries the tokens of a completed MFA login and, after an enrollment during
+// login, the new recovery codes
+type MfaLoginResponse struct {
+	*jwt.TokenDetails
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type IdentityProviderResponse struct {
+	Id          int               `json:"id"`
+	SchoolId    int               `json:"school_id"`
+	Issuer      string            `json:"issuer"`
+	ClientId    string            `json:"client_id"`
+	Scopes      []string          `json:"scopes"`
+	RoleClaim   string            `json:"role_claim"`
+	RoleMapping map[string]string `json:"role_mapping"`
+	DefaultRole string            `json:"default_role"`
+	Enabled     bool              `json:"enabled"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+func ToIdentityProviderResponse(provider *dto.IdentityProvider) IdentityProviderResponse {
+	mapping := map[string]string{}
+	_ = json.Unmarshal([]byte(provider.RoleMapping), &mapping)
+
+	return IdentityProviderResponse{
+		Id:          provider.Id,
+		SchoolId:    provider.SchoolId,
+		Issuer:      provider.Issuer,
+		ClientId:    provider.ClientId,
+		Scopes:      strings.Fields(provider.Scopes),
+		RoleClaim:   provider.RoleClaim,
+		RoleMapping: mapping,
+		DefaultRole: provider.DefaultRole,
+		Enabled:     provider.Enabled,
+		UpdatedAt:   provider.UpdatedAt,
+	}
+}
+
+// CreateApiKeyResponse carries the key in clear, it cannot be retrieved again
+type CreateApiKeyResponse struct {
+	*dto.ApiKey
+	Key string `json:"key"`
+}
+
+// RoleResponse is a role with the roles it inherits and its own policies
+type RoleResponse struct {
+	*dto.Role
+	Inherits []string         `json:"inherits"`
+	Policies []PolicyResponse `json:"policies"`
+}
+
+// SchoolSettings are the tenant-level settings of a school
+type SchoolSettings struct {
+	Timezone     string           `json:"timezone"`
+	GradingScale dto.GradingScale `json:"grading_scale"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
 type TokenDetails struct {
 	AccessToken  string
 	RefreshToken string
@@ -117,3 +360,38 @@ type ResponseV2 struct {
 type Data struct {
 	Message string `json:"message"`
 }
+
+type PolicyResponse struct {
+	Role   string `json:"role"`
+	Path   string `json:"path"`
+	Method string `json:"method"`
+}
+
+type RoleInheritanceResponse struct {
+	Role     string `json:"role"`
+	Inherits string `json:"inherits"`
+}
+
+// ToPolicyResponseList maps Casbin "p" rules (role, path, method) to responses
+func ToPolicyResponseList(policies [][]string) []PolicyResponse {
+	result := make([]PolicyResponse, 0, len(policies))
+	for _, policy := range policies {
+		if len(policy) < 3 {
+			continue
+		}
+		result = append(result, PolicyResponse{Role: policy[0], Path: policy[1], Method: policy[2]})
+	}
+	return result
+}
+
+// ToRoleInheritanceResponseList maps Casbin "g" rules (role, inherited role) to responses
+func ToRoleInheritanceResponseList(rules [][]string) []RoleInheritanceResponse {
+	result := make([]RoleInheritanceResponse, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule) < 2 {
+			continue
+		}
+		result = append(result, RoleInheritanceResponse{Role: rule[0], Inherits: rule[1]})
+	}
+	return result
+}
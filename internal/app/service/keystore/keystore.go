@@ -0,0 +1,306 @@
+package keystore
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"eduanalytics/internal/app/service/logger"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	privateKeySuffix = ".pem"
+	publicKeySuffix  = ".pub.pem"
+)
+
+var (
+	ErrNoSigningKey = errors.New("no signing key available")
+	ErrUnknownKey   = errors.New("unknown key id")
+)
+
+// Key is a signing or verification key identified by its kid
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer // nil for verification-only keys
+	PublicKey  crypto.PublicKey
+}
+
+// JWK is the public part of a key as published in a JWKS document (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// IKeyStore defines the interface for the token signing keys
+type IKeyStore interface {
+	SigningKey() (*Key, error)
+	VerificationKey(kid string) (*Key, error)
+	JWKS() JWKSet
+	Reload(ctx context.Context) error
+}
+
+// KeyStore holds the keys loaded from a key directory.
+//
+// Every "<kid>.pem" file holds a PKCS#8 (or PKCS#1 RSA) private key that can sign and verify.
+// Every "<kid>.pub.pem" file holds a PKIX public key of a retired key that can only verify, so
+// tokens signed before a rollover stay valid until they expire. The signing key is the
+// configured kid or, when none is configured, the private key with the greatest kid.
+type KeyStore struct {
+	dir          string
+	signingKeyID string
+	mu           sync.RWMutex
+	keys         map[string]*Key
+	signing      *Key
+}
+
+// NewKeyStore loads the keys from dir
+func NewKeyStore(ctx context.Context, dir, signingKeyID string) (IKeyStore, error) {
+	ks := &KeyStore{
+		dir:          dir,
+		signingKeyID: signingKeyID,
+	}
+
+	if err := ks.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// NewEphemeralKeyStore generates a single in-memory Ed25519 key. Tokens signed with it do not
+// survive a restart and cannot be verified by other instances, use it for local development only.
+func NewEphemeralKeyStore(ctx context.Context) (IKeyStore, error) {
+	log := logger.Logger(ctx)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		ID:         "ephemeral-" + time.Now().UTC().Format("20060102150405"),
+		Method:     jwt.SigningMethodEdDSA,
+		PrivateKey: private,
+		PublicKey:  public,
+	}
+	log.Warnf("Using ephemeral signing key %s", key.ID)
+
+	return &KeyStore{
+		keys:    map[string]*Key{key.ID: key},
+		signing: key,
+	}, nil
+}
+
+// StartReloader periodically reloads the key directory so new keys are picked up without a restart
+func StartReloader(ctx context.Context, ks IKeyStore, interval time.Duration) {
+	log := logger.Logger(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := ks.Reload(ctx); err != nil {
+			log.Errorf("Failed to reload signing keys: %v", err)
+		}
+	}
+}
+
+// Reload reads the key directory again; the current keys are kept if it fails
+func (ks *KeyStore) Reload(ctx context.Context) error {
+	log := logger.Logger(ctx)
+
+	if ks.dir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*Key)
+	var signingIDs []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, privateKeySuffix) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(ks.dir, name))
+		if err != nil {
+			return err
+		}
+
+		var key *Key
+		if strings.HasSuffix(name, publicKeySuffix) {
+			key, err = parsePublicKey(strings.TrimSuffix(name, publicKeySuffix), data)
+		} else {
+			key, err = parsePrivateKey(strings.TrimSuffix(name, privateKeySuffix), data)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		// A private key wins over the public half of the same kid
+		if existing, exists := keys[key.ID]; exists && existing.PrivateKey != nil {
+			continue
+		}
+		keys[key.ID] = key
+		if key.PrivateKey != nil {
+			signingIDs = append(signingIDs, key.ID)
+		}
+	}
+
+	signingID := ks.signingKeyID
+	if signingID == "" && len(signingIDs) > 0 {
+		sort.Strings(signingIDs)
+		signingID = signingIDs[len(signingIDs)-1]
+	}
+
+	signing, exists := keys[signingID]
+	if !exists || signing.PrivateKey == nil {
+		return fmt.Errorf("%w: %q in %s", ErrNoSigningKey, signingID, ks.dir)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.keys = keys
+	ks.signing = signing
+
+	log.Infof("Loaded %d signing keys, active key %s", len(keys), signing.ID)
+	return nil
+}
+
+// SigningKey returns the key new tokens are signed with
+func (ks *KeyStore) SigningKey() (*Key, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if ks.signing == nil {
+		return nil, ErrNoSigningKey
+	}
+	return ks.signing, nil
+}
+
+// VerificationKey returns the key with the given kid
+func (ks *KeyStore) VerificationKey(kid string) (*Key, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, exists := ks.keys[kid]
+	if !exists {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// JWKS returns the public keys of every key in the store
+func (ks *KeyStore) JWKS() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, key := range ks.keys {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// JWK returns the public part of the key in JWK format
+func (k *Key) JWK() JWK {
+	jwk := JWK{
+		Kid: k.ID,
+		Use: "sig",
+		Alg: k.Method.Alg(),
+	}
+
+	switch public := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+func parsePrivateKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, PrivateKey: private, PublicKey: &private.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, PrivateKey: private, PublicKey: private.Public()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+}
+
+func parsePublicKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, PublicKey: public}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, PublicKey: public}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+}
@@ -0,0 +1,212 @@
+package loginguard
+
+import (
+	"context"
+	"eduanalytics/internal/app/service/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy configures when login attempts are delayed or locked out
+type Policy struct {
+	MaxAccountFailures int           // failures per account before the account is locked
+	MaxIPFailures      int           // failures per IP before the IP is locked
+	DelayAfter         int           // failures after which every further attempt is delayed
+	BaseDelay          time.Duration // first delay, doubled for every further failure
+	MaxDelay           time.Duration
+	LockoutDuration    time.Duration
+	Window             time.Duration // failures older than this are forgotten
+}
+
+// FailureResult describes the state after a failed attempt
+type FailureResult struct {
+	Failures      int
+	AccountLocked bool
+	IPLocked      bool
+}
+
+// ILoginGuard defines the interface for brute-force protection of the login endpoint
+type ILoginGuard interface {
+	Check(ctx context.Context, email, ipAddress string) (retryAfter time.Duration, allowed bool)
+	RecordFailure(ctx context.Context, email, ipAddress string) FailureResult
+	RecordSuccess(ctx context.Context, email, ipAddress string) (previousFailures int)
+	Unlock(ctx context.Context, email string)
+	CleanupExpiredAttempts(ctx context.Context)
+}
+
+// attempts tracks recent failures of one account or IP
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginGuard tracks failed login attempts in memory
+type LoginGuard struct {
+	policy   Policy
+	accounts map[string]*attempts // email -> attempts
+	ips      map[string]*attempts // ip -> attempts
+	mu       sync.Mutex
+}
+
+// NewLoginGuard creates a new login guard
+func NewLoginGuard(policy Policy) ILoginGuard {
+	lg := &LoginGuard{
+		policy:   policy,
+		accounts: make(map[string]*attempts),
+		ips:      make(map[string]*attempts),
+	}
+
+	// Start background cleanup goroutine
+	go lg.startCleanupRoutine()
+
+	return lg
+}
+
+// Check reports whether a login attempt may proceed and, if not, how long the caller has to wait
+func (lg *LoginGuard) Check(ctx context.Context, email, ipAddress string) (time.Duration, bool) {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	now := time.Now()
+	wait := lg.waitFor(lg.accounts[normalize(email)], now)
+	if ipWait := lg.waitFor(lg.ips[ipAddress], now); ipWait > wait {
+		wait = ipWait
+	}
+
+	return wait, wait <= 0
+}
+
+// RecordFailure counts a failed attempt against the account and the IP and locks them once
+// their thresholds are reached
+func (lg *LoginGuard) RecordFailure(ctx context.Context, email, ipAddress string) FailureResult {
+	log := logger.Logger(ctx)
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	now := time.Now()
+	account := lg.record(lg.accounts, normalize(email), now)
+	ip := lg.record(lg.ips, ipAddress, now)
+
+	result := FailureResult{Failures: account.failures}
+
+	if account.failures >= lg.policy.MaxAccountFailures && account.lockedUntil.Before(now) {
+		account.lockedUntil = now.Add(lg.policy.LockoutDuration)
+		result.AccountLocked = true
+		log.Warnf("Account %s locked until %s after %d failed logins", email, account.lockedUntil, account.failures)
+	}
+
+	if ip.failures >= lg.policy.MaxIPFailures && ip.lockedUntil.Before(now) {
+		ip.lockedUntil = now.Add(lg.policy.LockoutDuration)
+		result.IPLocked = true
+		log.Warnf("IP %s locked until %s after %d failed logins", ipAddress, ip.lockedUntil, ip.failures)
+	}
+
+	return result
+}
+
+// RecordSuccess clears the account failures and returns how many there were
+func (lg *LoginGuard) RecordSuccess(ctx context.Context, email, ipAddress string) int {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	key := normalize(email)
+	previous := 0
+	if account, exists := lg.accounts[key]; exists {
+		previous = account.failures
+		delete(lg.accounts, key)
+	}
+
+	return previous
+}
+
+// Unlock clears the lockout and failure count of an account
+func (lg *LoginGuard) Unlock(ctx context.Context, email string) {
+	log := logger.Logger(ctx)
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	delete(lg.accounts, normalize(email))
+	log.Infof("Account %s unlocked", email)
+}
+
+// CleanupExpiredAttempts forgets attempts outside the window that are not locked
+func (lg *LoginGuard) CleanupExpiredAttempts(ctx context.Context) {
+	log := logger.Logger(ctx)
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	now := time.Now()
+	removed := lg.cleanup(lg.accounts, now) + lg.cleanup(lg.ips, now)
+
+	if removed > 0 {
+		log.Infof("Cleaned up %d expired login attempt records", removed)
+	}
+}
+
+// waitFor returns how long the holder of the attempts has to wait; the caller must hold the lock
+func (lg *LoginGuard) waitFor(a *attempts, now time.Time) time.Duration {
+	if a == nil {
+		return 0
+	}
+
+	if now.Before(a.lockedUntil) {
+		return a.lockedUntil.Sub(now)
+	}
+
+	if a.failures < lg.policy.DelayAfter {
+		return 0
+	}
+
+	// Progressive delay, doubled for every failure past the threshold
+	delay := lg.policy.MaxDelay
+	if shift := a.failures - lg.policy.DelayAfter; shift < 16 {
+		if d := lg.policy.BaseDelay << uint(shift); d < delay {
+			delay = d
+		}
+	}
+	return a.lastFailure.Add(delay).Sub(now)
+}
+
+// record adds a failure to the attempts under key; the caller must hold the lock
+func (lg *LoginGuard) record(records map[string]*attempts, key string, now time.Time) *attempts {
+	a, exists := records[key]
+	if !exists || (now.Sub(a.lastFailure) > lg.policy.Window && now.After(a.lockedUntil)) {
+		a = &attempts{}
+		records[key] = a
+	}
+
+	a.failures++
+	a.lastFailure = now
+	return a
+}
+
+func (lg *LoginGuard) cleanup(records map[string]*attempts, now time.Time) int {
+	removed := 0
+	for key, a := range records {
+		if now.Sub(a.lastFailure) > lg.policy.Window && now.After(a.lockedUntil) {
+			delete(records, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// startCleanupRoutine starts a background goroutine to forget expired attempts
+func (lg *LoginGuard) startCleanupRoutine() {
+	ticker := time.NewTicker(15 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		lg.CleanupExpiredAttempts(ctx)
+	}
+}
+
+func normalize(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"context"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/config"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DRIVER_LOG  = "log"
+	DRIVER_FILE = "file"
+	DRIVER_SMTP = "smtp"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// IMailer defines the interface for delivering emails
+type IMailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailer creates the mailer selected by MAILER_DRIVER
+func NewMailer(cfg config.MailerConfig) (IMailer, error) {
+	switch cfg.MAILER_DRIVER {
+	case DRIVER_LOG, "":
+		return &LogMailer{}, nil
+	case DRIVER_FILE:
+		return NewFileMailer(cfg.MAILER_FILE_DIR, cfg.MAILER_FROM)
+	case DRIVER_SMTP:
+		return &SMTPMailer{
+			Host:     cfg.MAILER_SMTP_HOST,
+			Port:     cfg.MAILER_SMTP_PORT,
+			Username: cfg.MAILER_SMTP_USERNAME,
+			Password: cfg.MAILER_SMTP_PASSWORD,
+			From:     cfg.MAILER_FROM,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", cfg.MAILER_DRIVER)
+	}
+}
+
+// LogMailer writes messages to the service log instead of sending them
+type LogMailer struct{}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log := logger.Logger(ctx)
+	log.Infof("Mail to %s, subject: %s, body: %s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes every message to its own .eml file, which makes delivered mails easy to
+// inspect in tests and local development
+type FileMailer struct {
+	Dir     string
+	From    string
+	counter uint64
+}
+
+// NewFileMailer creates a FileMailer writing into dir
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileMailer{Dir: dir, From: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	log := logger.Logger(ctx)
+
+	n := atomic.AddUint64(&m.counter, 1)
+	name := fmt.Sprintf("%s-%06d.eml", time.Now().UTC().Format("20060102T150405.000000000"), n)
+	path := filepath.Join(m.Dir, name)
+
+	if err := os.WriteFile(path, buildMessage(m.From, msg), 0o600); err != nil {
+		return err
+	}
+
+	log.Infof("Mail to %s written to %s", msg.To, path)
+	return nil
+}
+
+// SMTPMailer delivers messages through an SMTP relay
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, buildMessage(m.From, msg))
+}
+
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
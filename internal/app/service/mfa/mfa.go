@@ -0,0 +1,270 @@
+package mfa
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/util"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrAlreadyEnabled = errors.New("mfa is already enabled")
+	ErrNotEnabled     = errors.New("mfa is not enabled")
+	ErrInvalidCode    = errors.New("invalid mfa code")
+)
+
+// Status describes the second factor of a user
+type Status struct {
+	Enabled           bool       `json:"enabled"`
+	Required          bool       `json:"required"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+}
+
+// Enrollment is a pending TOTP enrollment; the secret is shown to the user once
+type Enrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// IMfaService defines the interface for TOTP second factors and recovery codes
+type IMfaService interface {
+	GetStatus(ctx context.Context, user *dto.User) (*Status, error)
+	IsRequired(ctx context.Context, role string) (bool, error)
+	BeginEnrollment(ctx context.Context, user *dto.User) (*Enrollment, error)
+	ConfirmEnrollment(ctx context.Context, user *dto.User, code string) ([]string, error)
+	Verify(ctx context.Context, user *dto.User, code string) (usedRecoveryCode bool, err error)
+	RegenerateRecoveryCodes(ctx context.Context, user *dto.User) ([]string, error)
+	Disable(ctx context.Context, user *dto.User) error
+}
+
+// MfaService stores TOTP secrets encrypted with AES-GCM and recovery codes as SHA-256 hashes
+type MfaService struct {
+	Repo   repository.IMfaRepository
+	Issuer string
+	aead   cipher.AEAD
+}
+
+// NewMfaService creates a new MfaService, encryptionKey may be any non-empty secret
+func NewMfaService(repo repository.IMfaRepository, issuer, encryptionKey string) (IMfaService, error) {
+	if encryptionKey == "" {
+		return nil, errors.New("mfa encryption key is empty")
+	}
+
+	key := sha256.Sum256([]byte(encryptionKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MfaService{
+		Repo:   repo,
+		Issuer: issuer,
+		aead:   aead,
+	}, nil
+}
+
+func (m *MfaService) GetStatus(ctx context.Context, user *dto.User) (*Status, error) {
+	required, err := m.IsRequired(ctx, user.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Required: required}
+
+	mfa, err := m.Repo.GetMfa(ctx, user.Id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status.Enabled = mfa.Enabled
+	status.EnabledAt = mfa.EnabledAt
+	if mfa.Enabled {
+		if status.RecoveryCodesLeft, err = m.Repo.CountRecoveryCodes(ctx, user.Id); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+func (m *MfaService) IsRequired(ctx context.Context, role string) (bool, error) {
+	return m.Repo.IsRequiredForRole(ctx, role)
+}
+
+// BeginEnrollment generates a new secret; it only takes effect once confirmed with a code
+func (m *MfaService) BeginEnrollment(ctx context.Context, user *dto.User) (*Enrollment, error) {
+	log := logger.Logger(ctx)
+
+	if mfa, err := m.Repo.GetMfa(ctx, user.Id); err == nil && mfa.Enabled {
+		return nil, ErrAlreadyEnabled
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := m.encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.Repo.SavePendingMfa(ctx, user.Id, encrypted); err != nil {
+		return nil, err
+	}
+
+	log.Infof("MFA enrollment started for user %d", user.Id)
+	return &Enrollment{
+		Secret:          secret,
+		ProvisioningURI: ProvisioningURI(m.Issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables the pending second factor and returns the first recovery codes
+func (m *MfaService) ConfirmEnrollment(ctx context.Context, user *dto.User, code string) ([]string, error) {
+	mfa, err := m.Repo.GetMfa(ctx, user.Id)
+	if err != nil || mfa.Enabled {
+		return nil, repository.ErrMfaEnrollmentNotPending
+	}
+
+	step, ok := m.validateCode(mfa, code)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.Repo.EnableMfa(ctx, user.Id, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify accepts a current TOTP code or an unused recovery code, each only once
+func (m *MfaService) Verify(ctx context.Context, user *dto.User, code string) (bool, error) {
+	mfa, err := m.Repo.GetMfa(ctx, user.Id)
+	if err != nil || !mfa.Enabled {
+		return false, ErrNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := m.validateCode(mfa, code); ok {
+		if err := m.Repo.UseStep(ctx, user.Id, step); err != nil {
+			if errors.Is(err, repository.ErrMfaCodeAlreadyUsed) {
+				return false, ErrInvalidCode
+			}
+			return false, err
+		}
+		return false, nil
+	}
+
+	if err := m.Repo.UseRecoveryCode(ctx, user.Id, hashRecoveryCode(code)); err != nil {
+		if errors.Is(err, repository.ErrRecoveryCodeNotFound) {
+			return false, ErrInvalidCode
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user
+func (m *MfaService) RegenerateRecoveryCodes(ctx context.Context, user *dto.User) ([]string, error) {
+	if mfa, err := m.Repo.GetMfa(ctx, user.Id); err != nil || !mfa.Enabled {
+		return nil, ErrNotEnabled
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.Repo.ReplaceRecoveryCodes(ctx, user.Id, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable removes the second factor and the recovery codes of the user
+func (m *MfaService) Disable(ctx context.Context, user *dto.User) error {
+	return m.Repo.DisableMfa(ctx, user.Id)
+}
+
+func (m *MfaService) validateCode(mfa *dto.UserMfa, code string) (int64, bool) {
+	secret, err := m.decrypt(mfa.Secret)
+	if err != nil {
+		return 0, false
+	}
+	return ValidateCode(secret, code, time.Now())
+}
+
+func (m *MfaService) encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := m.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (m *MfaService) decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < m.aead.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+
+	nonce, sealed := sealed[:m.aead.NonceSize()], sealed[m.aead.NonceSize():]
+	plaintext, err := m.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// generateRecoveryCodes returns new recovery codes formatted as xxxxx-xxxxx and their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		random := make([]byte, 5)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(random)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code ignoring case and the separator
+func hashRecoveryCode(code string) string {
+	return util.HashToken(strings.ToLower(strings.ReplaceAll(code, "-", "")))
+}
@@ -0,0 +1,342 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"eduanalytics/internal/app/service/logger"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	// cacheTTL bounds how long discovery documents and key sets are reused
+	cacheTTL = time.Hour
+	// minKeyRefresh limits refetching a key set for unknown kids
+	minKeyRefresh = time.Minute
+	// clockSkew tolerates small clock differences when checking exp and iat
+	clockSkew = 2 * time.Minute
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrUnknownKey     = errors.New("unknown id token signing key")
+)
+
+// ProviderConfig identifies a relying party at an OpenID provider
+type ProviderConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	Scopes       []string
+}
+
+// Discovery is the subset of the provider metadata (OpenID Connect Discovery 1.0) we use
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// TokenResponse is the response of the token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// IClient defines the interface for the authorization code flow of an OpenID provider
+type IClient interface {
+	AuthCodeURL(ctx context.Context, cfg ProviderConfig, state, nonce, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, cfg ProviderConfig, code, codeVerifier string) (*TokenResponse, error)
+	VerifyIDToken(ctx context.Context, cfg ProviderConfig, rawIDToken, nonce string) (jwt.MapClaims, error)
+}
+
+type cachedDiscovery struct {
+	discovery *Discovery
+	fetchedAt time.Time
+}
+
+type cachedKeys struct {
+	keys      map[string]interface{} // kid -> public key
+	fetchedAt time.Time
+}
+
+// Client talks to OpenID providers and caches their metadata and signing keys
+type Client struct {
+	HTTPClient *http.Client
+	mu         sync.Mutex
+	discovery  map[string]*cachedDiscovery // issuer -> metadata
+	keys       map[string]*cachedKeys      // jwks uri -> keys
+}
+
+// NewClient creates a new OpenID Connect client
+func NewClient(timeout time.Duration) IClient {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: timeout},
+		discovery:  make(map[string]*cachedDiscovery),
+		keys:       make(map[string]*cachedKeys),
+	}
+}
+
+// AuthCodeURL returns the authorization endpoint URL the user is redirected to
+func (c *Client) AuthCodeURL(ctx context.Context, cfg ProviderConfig, state, nonce, codeChallenge string) (string, error) {
+	discovery, err := c.discover(ctx, cfg.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", cfg.ClientID)
+	params.Set("redirect_uri", cfg.RedirectURI)
+	params.Set("scope", strings.Join(cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code together with its PKCE verifier
+func (c *Client) Exchange(ctx context.Context, cfg ProviderConfig, code, codeVerifier string) (*TokenResponse, error) {
+	discovery, err := c.discover(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURI)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	var token TokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return &token, nil
+}
+
+// VerifyIDToken checks the signature of an ID token against the provider's JWKS as well as its
+// issuer, audience, expiry and nonce, and returns its claims
+func (c *Client) VerifyIDToken(ctx context.Context, cfg ProviderConfig, rawIDToken, nonce string) (jwt.MapClaims, error) {
+	discovery, err := c.discover(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return c.key(ctx, discovery.JwksURI, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidIDToken
+	}
+
+	now := time.Now()
+	switch {
+	case !claims.VerifyIssuer(discovery.Issuer, true):
+		return nil, fmt.Errorf("%w: issuer mismatch", ErrInvalidIDToken)
+	case !claims.VerifyAudience(cfg.ClientID, true):
+		return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidIDToken)
+	case !claims.VerifyExpiresAt(now.Add(-clockSkew).Unix(), true):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case !claims.VerifyIssuedAt(now.Add(clockSkew).Unix(), false):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// discover returns the cached metadata of the issuer, fetching it when missing or stale
+func (c *Client) discover(ctx context.Context, issuer string) (*Discovery, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	c.mu.Lock()
+	cached, exists := c.discovery[issuer]
+	c.mu.Unlock()
+	if exists && time.Since(cached.fetchedAt) < cacheTTL {
+		return cached.discovery, nil
+	}
+
+	var discovery Discovery
+	if err := c.getJSON(ctx, issuer+discoveryPath, &discovery); err != nil {
+		return nil, fmt.Errorf("discovery of %s failed: %w", issuer, err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery of %s returned issuer %s", issuer, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, fmt.Errorf("discovery of %s is missing endpoints", issuer)
+	}
+
+	c.mu.Lock()
+	c.discovery[issuer] = &cachedDiscovery{discovery: &discovery, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return &discovery, nil
+}
+
+// key returns the public key with the given kid; an unknown kid refreshes the key set so that
+// provider key rotations are picked up
+func (c *Client) key(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	log := logger.Logger(ctx)
+
+	c.mu.Lock()
+	cached, exists := c.keys[jwksURI]
+	c.mu.Unlock()
+
+	if exists {
+		if key, found := lookupKey(cached.keys, kid); found && time.Since(cached.fetchedAt) < cacheTTL {
+			return key, nil
+		}
+		if time.Since(cached.fetchedAt) < minKeyRefresh {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	var set jwkSet
+	if err := c.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("fetching %s failed: %w", jwksURI, err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		public, err := k.publicKey()
+		if err != nil {
+			log.Warnf("Skipping key %s of %s: %v", k.Kid, jwksURI, err)
+			continue
+		}
+		keys[k.Kid] = public
+	}
+
+	c.mu.Lock()
+	c.keys[jwksURI] = &cachedKeys{keys: keys, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	if key, found := lookupKey(keys, kid); found {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// lookupKey finds the key by kid, a token without kid is accepted when the set has one key
+func lookupKey(keys map[string]interface{}, kid string) (interface{}, bool) {
+	if key, exists := keys[kid]; exists {
+		return key, true
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (c *Client) getJSON(ctx context.Context, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// NewCodeVerifier returns a random PKCE code verifier (RFC 7636)
+func NewCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// CodeChallengeS256 derives the S256 code challenge of a verifier
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// NewNonce returns a random nonce binding the ID token to the authorization request
+func NewNonce() (string, error) {
+	return randomString(16)
+}
+
+// randomString returns n random bytes encoded as unpadded base64url
+func randomString(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
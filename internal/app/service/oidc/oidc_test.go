@@ -0,0 +1,258 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"eduanalytics/internal/app/service/logger"
+	"eduanalytics/internal/app/service/oidc/mockidp"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+)
+
+const (
+	testClientID     = "eduanalytics"
+	testClientSecret = "secret"
+	testRedirectURI  = "http://localhost:9090/api/v1/auth/sso/callback"
+)
+
+var testUser = mockidp.User{Subject: "teacher-1", Email: "teacher@example.com", EmailVerified: true, Name: "Test Teacher", Roles: []string{"teacher"}}
+
+// newMockIdp serves a mock provider whose issuer is the URL of the test server
+func newMockIdp(t *testing.T) (*mockidp.Provider, ProviderConfig) {
+	t.Helper()
+	logger.SugarLogger = zap.NewNop().Sugar()
+
+	var handler http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := mockidp.New(mockidp.Config{
+		Issuer:       server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		Users:        []mockidp.User{testUser},
+	})
+	if err != nil {
+		t.Fatalf("mockidp.New: %v", err)
+	}
+	handler = provider.Handler()
+
+	return provider, ProviderConfig{
+		Issuer:       server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURI:  testRedirectURI,
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+// authorize follows the authorization URL to the provider and returns the code and state of its
+// redirect back to us
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET %s: %v", authURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d, want 302", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Location: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURI) {
+		t.Fatalf("redirected to %s, want %s", location, testRedirectURI)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	_, cfg := newMockIdp(t)
+	client := NewClient(5 * time.Second)
+	ctx := context.Background()
+
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatalf("NewCodeVerifier: %v", err)
+	}
+	nonce, err := NewNonce()
+	if err != nil {
+		t.Fatalf("NewNonce: %v", err)
+	}
+
+	authURL, err := client.AuthCodeURL(ctx, cfg, "state-1", nonce, CodeChallengeS256(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, state := authorize(t, authURL)
+	if code == "" || state != "state-1" {
+		t.Fatalf("code %q, state %q", code, state)
+	}
+
+	token, err := client.Exchange(ctx, cfg, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := client.VerifyIDToken(ctx, cfg, token.IDToken, nonce)
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims["sub"] != testUser.Subject || claims["email"] != testUser.Email {
+		t.Errorf("claims = %v", claims)
+	}
+
+	// A code is redeemed once
+	if _, err := client.Exchange(ctx, cfg, code, verifier); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("second Exchange error = %v, want invalid_grant", err)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	_, cfg := newMockIdp(t)
+	client := NewClient(5 * time.Second)
+	ctx := context.Background()
+
+	verifier, _ := NewCodeVerifier()
+	authURL, err := client.AuthCodeURL(ctx, cfg, "state-1", "nonce-1", CodeChallengeS256(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, _ := authorize(t, authURL)
+
+	otherVerifier, _ := NewCodeVerifier()
+	if _, err := client.Exchange(ctx, cfg, code, otherVerifier); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Exchange error = %v, want invalid_grant", err)
+	}
+}
+
+func TestAuthorizeRequiresPKCE(t *testing.T) {
+	_, cfg := newMockIdp(t)
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", testClientID)
+	params.Set("redirect_uri", testRedirectURI)
+	resp, err := http.Get(cfg.Issuer + "/authorize?" + params.Encode())
+	if err != nil {
+		t.Fatalf("GET /authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("authorize without code_challenge returned %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	provider, cfg := newMockIdp(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	validClaims := func() jwt.MapClaims {
+		now := time.Now()
+		return jwt.MapClaims{
+			"iss":   cfg.Issuer,
+			"aud":   testClientID,
+			"sub":   testUser.Subject,
+			"email": testUser.Email,
+			"nonce": "nonce-1",
+			"iat":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+		}
+	}
+	signWith := func(key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return signed
+	}
+	signByProvider := func(change func(jwt.MapClaims)) string {
+		claims := validClaims()
+		change(claims)
+		signed, err := provider.Sign(claims)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantMsg string
+	}{
+		{
+			name:    "signed with another key",
+			token:   signWith(otherKey, "mock-idp", validClaims()),
+			wantMsg: "verification error",
+		},
+		{
+			name:    "unknown kid",
+			token:   signWith(otherKey, "rotated-away", validClaims()),
+			wantMsg: ErrUnknownKey.Error(),
+		},
+		{
+			name:    "wrong audience",
+			token:   signByProvider(func(c jwt.MapClaims) { c["aud"] = "another-client" }),
+			wantMsg: "audience mismatch",
+		},
+		{
+			name:    "wrong issuer",
+			token:   signByProvider(func(c jwt.MapClaims) { c["iss"] = "https://idp.example.com" }),
+			wantMsg: "issuer mismatch",
+		},
+		{
+			name:    "expired",
+			token:   signByProvider(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-10 * time.Minute).Unix() }),
+			wantMsg: "expired",
+		},
+		{
+			name:    "nonce mismatch",
+			token:   signByProvider(func(c jwt.MapClaims) { c["nonce"] = "nonce-of-another-login" }),
+			wantMsg: "nonce mismatch",
+		},
+		{
+			name:    "no subject",
+			token:   signByProvider(func(c jwt.MapClaims) { delete(c, "sub") }),
+			wantMsg: "missing subject",
+		},
+	}
+
+	client := NewClient(5 * time.Second)
+	ctx := context.Background()
+
+	// The provider's own token is accepted, so the failures below are due to the changes
+	if _, err := client.VerifyIDToken(ctx, cfg, signByProvider(func(jwt.MapClaims) {}), "nonce-1"); err != nil {
+		t.Fatalf("VerifyIDToken of a valid token: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.VerifyIDToken(ctx, cfg, tt.token, "nonce-1")
+			if !errors.Is(err, ErrInvalidIDToken) || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("VerifyIDToken error = %v, want %v containing %q", err, ErrInvalidIDToken, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package oidc
+
+import (
+	"context"
+	"eduanalytics/internal/app/service/logger"
+	"sync"
+	"time"
+)
+
+// AuthRequest is an authorization request waiting for the provider's callback
+type AuthRequest struct {
+	ProviderID   int
+	SchoolID     int
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
+
+// IStateStore defines the interface for pending authorization requests keyed by state
+type IStateStore interface {
+	Save(ctx context.Context, req *AuthRequest) (state string, err error)
+	Take(ctx context.Context, state string) (*AuthRequest, bool)
+	CleanupExpiredRequests(ctx context.Context)
+}
+
+// StateStore keeps pending authorization requests in memory. The callback therefore has to
+// reach the instance that started the login, e.g. through sticky sessions.
+type StateStore struct {
+	ttl      time.Duration
+	requests map[string]*AuthRequest
+	mu       sync.Mutex
+}
+
+// NewStateStore creates a store whose requests expire after ttl
+func NewStateStore(ttl time.Duration) IStateStore {
+	s := &StateStore{
+		ttl:      ttl,
+		requests: make(map[string]*AuthRequest),
+	}
+
+	// Start background cleanup goroutine
+	go s.startCleanupRoutine()
+
+	return s
+}
+
+// Save stores the request under a new random state
+func (s *StateStore) Save(ctx context.Context, req *AuthRequest) (string, error) {
+	state, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req.ExpiresAt = time.Now().Add(s.ttl)
+	s.requests[state] = req
+	return state, nil
+}
+
+// Take removes and returns the request of a state, every state can be used once
+func (s *StateStore) Take(ctx context.Context, state string) (*AuthRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, exists := s.requests[state]
+	if !exists {
+		return nil, false
+	}
+	delete(s.requests, state)
+
+	if time.Now().After(req.ExpiresAt) {
+		return nil, false
+	}
+	return req, true
+}
+
+// CleanupExpiredRequests removes requests whose callback never arrived
+func (s *StateStore) CleanupExpiredRequests(ctx context.Context) {
+	log := logger.Logger(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for state, req := range s.requests {
+		if now.After(req.ExpiresAt) {
+			delete(s.requests, state)
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		log.Infof("Cleaned up %d expired authorization requests", removed)
+	}
+}
+
+// startCleanupRoutine starts a background goroutine to remove expired requests
+func (s *StateStore) startCleanupRoutine() {
+	ticker := time.NewTicker(15 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		s.CleanupExpiredRequests(ctx)
+	}
+}
@@ -0,0 +1,314 @@
+package oneroster
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Files of a OneRoster CSV bundle that are imported and exported. Roles of users are in roles.csv
+// since OneRoster 1.2; bundles of 1.1 carry them in the role column of users.csv instead.
+const (
+	FileManifest    = "manifest.csv"
+	FileOrgs        = "orgs.csv"
+	FileUsers       = "users.csv"
+	FileRoles       = "roles.csv"
+	FileClasses     = "classes.csv"
+	FileEnrollments = "enrollments.csv"
+)
+
+// Status of a row of a delta file, rows of bulk files have none
+const StatusToBeDeleted = "tobedeleted"
+
+// maxFileSize caps the uncompressed size of a file of a bundle
+const maxFileSize = 50 << 20
+
+var (
+	ErrMissingFile     = errors.New("missing file")
+	ErrTooManyRows     = errors.New("the bundle has too many rows")
+	ErrFileTooLarge    = errors.New("a file of the bundle is too large")
+	ErrUnsupportedSpec = errors.New("unsupported OneRoster version")
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+type Org struct {
+	Line      int
+	SourcedId string
+	Status    string
+	Name      string
+	Type      string
+}
+
+// User is a row of users.csv. Role and OrgSourcedIds are the OneRoster 1.1 columns.
+type User struct {
+	Line                int
+	SourcedId           string
+	Status              string
+	EnabledUser         string
+	GivenName           string
+	FamilyName          string
+	Email               string
+	PrimaryOrgSourcedId string
+	Role                string
+	OrgSourcedIds       []string
+}
+
+type Role struct {
+	Line          int
+	SourcedId     string
+	Status        string
+	UserSourcedId string
+	RoleType      string
+	Role          string
+	OrgSourcedId  string
+}
+
+type Class struct {
+	Line            int
+	SourcedId       string
+	Status          string
+	Title           string
+	SchoolSourcedId string
+}
+
+type Enrollment struct {
+	Line            int
+	SourcedId       string
+	Status          string
+	ClassSourcedId  string
+	SchoolSourcedId string
+	UserSourcedId   string
+	Role            string
+	Primary         string
+}
+
+// Bundle are the rows of the imported files of a OneRoster CSV bundle
+type Bundle struct {
+	Orgs        []Org
+	Users       []User
+	Roles       []Role
+	Classes     []Class
+	Enrollments []Enrollment
+}
+
+// Rows returns the number of rows of the bundle
+func (b *Bundle) Rows() int {
+	return len(b.Orgs) + len(b.Users) + len(b.Roles) + len(b.Classes) + len(b.Enrollments)
+}
+
+// ReadBundle reads the orgs, users, roles, classes and enrollments of a zipped OneRoster 1.1 or
+// 1.2 CSV bundle. orgs.csv and users.csv are required, the other files may be left out or
+// declared absent in the manifest. Files may be in a folder of the zip; columns are matched by
+// name and columns that are not imported are ignored.
+func ReadBundle(r io.ReaderAt, size int64, maxRows int) (*Bundle, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a zip file: %w", err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		if !file.FileInfo().IsDir() {
+			files[strings.ToLower(path.Base(file.Name))] = file
+		}
+	}
+
+	absent := map[string]bool{}
+	if file, ok := files[FileManifest]; ok {
+		manifest, err := readTable(file, "propertyName", "value")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", FileManifest, err)
+		}
+		for _, row := range manifest.rows {
+			property, value := manifest.get(row, "propertyName"), strings.ToLower(manifest.get(row, "value"))
+			switch {
+			case property == "oneroster.version" && value != "1.1" && value != "1.2":
+				return nil, fmt.Errorf("%w %s", ErrUnsupportedSpec, value)
+			case strings.HasPrefix(property, "file.") && value == "absent":
+				absent[strings.ToLower(strings.TrimPrefix(property, "file."))+".csv"] = true
+			}
+		}
+	}
+
+	open := func(name string, required bool, columns ...string) (*table, error) {
+		file, ok := files[name]
+		if !ok || absent[name] {
+			if required {
+				return nil, fmt.Errorf("%w %s", ErrMissingFile, name)
+			}
+			return nil, nil
+		}
+		t, err := readTable(file, columns...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return t, nil
+	}
+
+	bundle := &Bundle{}
+	orgs, err := open(FileOrgs, true, "sourcedId", "name", "type")
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range orgs.rows {
+		bundle.Orgs = append(bundle.Orgs, Org{
+			Line:      orgs.lines[i],
+			SourcedId: orgs.get(row, "sourcedId"),
+			Status:    strings.ToLower(orgs.get(row, "status")),
+			Name:      orgs.get(row, "name"),
+			Type:      strings.ToLower(orgs.get(row, "type")),
+		})
+	}
+
+	users, err := open(FileUsers, true, "sourcedId", "givenName", "familyName", "email")
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range users.rows {
+		var orgSourcedIds []string
+		for _, id := range strings.Split(users.get(row, "orgSourcedIds"), ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				orgSourcedIds = append(orgSourcedIds, id)
+			}
+		}
+		bundle.Users = append(bundle.Users, User{
+			Line:                users.lines[i],
+			SourcedId:           users.get(row, "sourcedId"),
+			Status:              strings.ToLower(users.get(row, "status")),
+			EnabledUser:         strings.ToLower(users.get(row, "enabledUser")),
+			GivenName:           users.get(row, "givenName"),
+			FamilyName:          users.get(row, "familyName"),
+			Email:               strings.ToLower(users.get(row, "email")),
+			PrimaryOrgSourcedId: users.get(row, "primaryOrgSourcedId"),
+			Role:                users.get(row, "role"),
+			OrgSourcedIds:       orgSourcedIds,
+		})
+	}
+
+	roles, err := open(FileRoles, false, "userSourcedId", "roleType", "role", "orgSourcedId")
+	if err != nil {
+		return nil, err
+	}
+	if roles != nil {
+		for i, row := range roles.rows {
+			bundle.Roles = append(bundle.Roles, Role{
+				Line:          roles.lines[i],
+				SourcedId:     roles.get(row, "sourcedId"),
+				Status:        strings.ToLower(roles.get(row, "status")),
+				UserSourcedId: roles.get(row, "userSourcedId"),
+				RoleType:      strings.ToLower(roles.get(row, "roleType")),
+				Role:          roles.get(row, "role"),
+				OrgSourcedId:  roles.get(row, "orgSourcedId"),
+			})
+		}
+	}
+
+	classes, err := open(FileClasses, false, "sourcedId", "title", "schoolSourcedId")
+	if err != nil {
+		return nil, err
+	}
+	if classes != nil {
+		for i, row := range classes.rows {
+			bundle.Classes = append(bundle.Classes, Class{
+				Line:            classes.lines[i],
+				SourcedId:       classes.get(row, "sourcedId"),
+				Status:          strings.ToLower(classes.get(row, "status")),
+				Title:           classes.get(row, "title"),
+				SchoolSourcedId: classes.get(row, "schoolSourcedId"),
+			})
+		}
+	}
+
+	enrollments, err := open(FileEnrollments, false, "sourcedId", "classSourcedId", "userSourcedId", "role")
+	if err != nil {
+		return nil, err
+	}
+	if enrollments != nil {
+		for i, row := range enrollments.rows {
+			bundle.Enrollments = append(bundle.Enrollments, Enrollment{
+				Line:            enrollments.lines[i],
+				SourcedId:       enrollments.get(row, "sourcedId"),
+				Status:          strings.ToLower(enrollments.get(row, "status")),
+				ClassSourcedId:  enrollments.get(row, "classSourcedId"),
+				SchoolSourcedId: enrollments.get(row, "schoolSourcedId"),
+				UserSourcedId:   enrollments.get(row, "userSourcedId"),
+				Role:            enrollments.get(row, "role"),
+				Primary:         strings.ToLower(enrollments.get(row, "primary")),
+			})
+		}
+	}
+
+	if bundle.Rows() > maxRows {
+		return nil, ErrTooManyRows
+	}
+	return bundle, nil
+}
+
+// table is a CSV file read by column name
+type table struct {
+	columns map[string]int
+	rows    [][]string
+	lines   []int
+}
+
+// get returns the trimmed value of the column, empty when the file has no such column
+func (t *table) get(row []string, column string) string {
+	if i, ok := t.columns[strings.ToLower(column)]; ok && i < len(row) {
+		return strings.TrimSpace(row[i])
+	}
+	return ""
+}
+
+// readTable reads a CSV file of the bundle with a header row that has the required columns
+func readTable(file *zip.File, required ...string) (*table, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFileSize {
+		return nil, ErrFileTooLarge
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file has no header row")
+	} else if err != nil {
+		return nil, err
+	}
+
+	t := &table{columns: map[string]int{}}
+	for i, name := range header {
+		t.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range required {
+		if _, ok := t.columns[strings.ToLower(name)]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		t.rows = append(t.rows, row)
+		t.lines = append(t.lines, line)
+	}
+	return t, nil
+}
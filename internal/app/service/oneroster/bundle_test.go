@@ -0,0 +1,149 @@
+package oneroster
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readFixture reads a bundle of testdata
+func readFixture(t *testing.T, name string, maxRows int) (*Bundle, error) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read fixture %s: %v", name, err)
+	}
+	return ReadBundle(bytes.NewReader(data), int64(len(data)), maxRows)
+}
+
+// zipOf zips files given by name and content
+func zipOf(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		file, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := file.Write([]byte(content)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestReadBundle(t *testing.T) {
+	bundle, err := readFixture(t, "valid.zip", 1000)
+	if err != nil {
+		t.Fatalf("ReadBundle: %v", err)
+	}
+
+	if got := []int{len(bundle.Orgs), len(bundle.Users), len(bundle.Roles), len(bundle.Classes), len(bundle.Enrollments)}; !reflect.DeepEqual(got, []int{2, 4, 4, 1, 3}) {
+		t.Errorf("orgs, users, roles, classes, enrollments = %v, want [2 4 4 1 3]", got)
+	}
+	if bundle.Rows() != 14 {
+		t.Errorf("Rows() = %d, want 14", bundle.Rows())
+	}
+
+	// users.csv starts with a byte order mark, its first column is still sourcedId
+	first := bundle.Users[0]
+	if first.SourcedId != "t-1" || first.Line != 2 || first.GivenName != "Grace" || first.Email != "grace.hopper@riverside.example" {
+		t.Errorf("first user = %+v", first)
+	}
+	if org := bundle.Orgs[1]; org.SourcedId != "org-1" || org.Type != "school" || org.Name != "Riverside High" {
+		t.Errorf("second org = %+v", org)
+	}
+	if e := bundle.Enrollments[0]; e.ClassSourcedId != "c-1" || e.UserSourcedId != "t-1" || e.Role != "teacher" || e.Primary != "true" {
+		t.Errorf("first enrollment = %+v", e)
+	}
+}
+
+func TestReadBundleErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		read    func(t *testing.T) (*Bundle, error)
+		wantErr error
+	}{
+		{
+			name: "file of the manifest missing",
+			read: func(t *testing.T) (*Bundle, error) {
+				return readFixture(t, "missing_manifest_file.zip", 1000)
+			},
+			wantErr: ErrMissingFile,
+		},
+		{
+			name: "too many rows",
+			read: func(t *testing.T) (*Bundle, error) {
+				return readFixture(t, "valid.zip", 13)
+			},
+			wantErr: ErrTooManyRows,
+		},
+		{
+			name: "unsupported version",
+			read: func(t *testing.T) (*Bundle, error) {
+				r := zipOf(t, map[string]string{
+					FileManifest: "propertyName,value\noneroster.version,1.0\n",
+					FileOrgs:     "sourcedId,name,type\n",
+					FileUsers:    "sourcedId,givenName,familyName,email\n",
+				})
+				return ReadBundle(r, r.Size(), 1000)
+			},
+			wantErr: ErrUnsupportedSpec,
+		},
+		{
+			name: "file declared absent",
+			read: func(t *testing.T) (*Bundle, error) {
+				r := zipOf(t, map[string]string{
+					FileManifest: "propertyName,value\noneroster.version,1.2\nfile.users,absent\n",
+					FileOrgs:     "sourcedId,name,type\n",
+					FileUsers:    "sourcedId,givenName,familyName,email\n",
+				})
+				return ReadBundle(r, r.Size(), 1000)
+			},
+			wantErr: ErrMissingFile,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.read(t); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReadBundle error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadBundleMissingColumn(t *testing.T) {
+	r := zipOf(t, map[string]string{
+		FileOrgs:  "sourcedId,name,type\norg-1,Riverside High,school\n",
+		FileUsers: "sourcedId,givenName,familyName\nt-1,Grace,Hopper\n",
+	})
+	_, err := ReadBundle(r, r.Size(), 1000)
+	if err == nil || err.Error() != `users.csv: missing column "email"` {
+		t.Errorf("ReadBundle error = %v, want the missing email column of users.csv", err)
+	}
+}
+
+// A OneRoster 1.1 bundle has no manifest and carries the roles in users.csv
+func TestReadBundleOneRoster11(t *testing.T) {
+	r := zipOf(t, map[string]string{
+		FileOrgs:  "sourcedId,name,type\norg-1,Riverside High,school\n",
+		FileUsers: "sourcedId,orgSourcedIds,role,givenName,familyName,email\nt-1,\"org-1, org-2\",teacher,Grace,Hopper,Grace.Hopper@Riverside.example\n",
+	})
+	bundle, err := ReadBundle(r, r.Size(), 1000)
+	if err != nil {
+		t.Fatalf("ReadBundle: %v", err)
+	}
+	user := bundle.Users[0]
+	if user.Role != "teacher" || !reflect.DeepEqual(user.OrgSourcedIds, []string{"org-1", "org-2"}) || user.Email != "grace.hopper@riverside.example" {
+		t.Errorf("user = %+v", user)
+	}
+}
@@ -0,0 +1,126 @@
+package oneroster
+
+import (
+	"archive/zip"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"encoding/csv"
+	"strings"
+)
+
+// Columns of the exported OneRoster 1.2 files
+var (
+	orgColumns        = []string{"sourcedId", "status", "dateLastModified", "name", "type", "identifier", "parentSourcedId"}
+	userColumns       = []string{"sourcedId", "status", "dateLastModified", "enabledUser", "username", "userIds", "givenName", "familyName", "middleName", "identifier", "email", "sms", "phone", "agentSourcedIds", "grades", "password", "userMasterIdentifier", "resourceSourcedIds", "preferredGivenName", "preferredMiddleName", "preferredFamilyName", "primaryOrgSourcedId", "pronouns"}
+	roleColumns       = []string{"sourcedId", "status", "dateLastModified", "userSourcedId", "roleType", "role", "beginDate", "endDate", "orgSourcedId", "userProfileSourcedId"}
+	classColumns      = []string{"sourcedId", "status", "dateLastModified", "title", "grades", "courseSourcedId", "classCode", "classType", "location", "schoolSourcedId", "termSourcedIds", "subjects", "subjectCodes", "periods"}
+	enrollmentColumns = []string{"sourcedId", "status", "dateLastModified", "classSourcedId", "schoolSourcedId", "userSourcedId", "role", "primary", "beginDate", "endDate"}
+)
+
+// manifestFiles are the files of a OneRoster 1.2 bundle in the order of the manifest
+var manifestFiles = []string{"academicSessions", "categories", "classes", "classResources", "courses",
+	"courseResources", "demographics", "enrollments", "lineItemLearningObjectiveIds", "lineItems",
+	"lineItemScoreScales", "orgs", "resources", "resultLearningObjectiveIds", "results",
+	"resultScoreScales", "roles", "scoreScales", "userProfiles", "userResources", "users"}
+
+// exportedFiles are the files an export contains, every other file is declared absent
+var exportedFiles = map[string]bool{"orgs": true, "users": true, "roles": true, "classes": true, "enrollments": true}
+
+// exportRoles are the OneRoster roles of the local roles
+var exportRoles = map[string]string{
+	constants.ROLE_ADMIN:   "siteAdministrator",
+	constants.ROLE_TEACHER: "teacher",
+	constants.ROLE_STUDENT: "student",
+}
+
+// WriteBundle writes the school as a zipped OneRoster 1.2 bulk CSV bundle. Every classroom is a
+// class of its own course, its teacher is exported as the primary teacher enrollment.
+func WriteBundle(w *zip.Writer, export *dto.OneRosterExport) error {
+	ids := func(resourceType string, id int) string {
+		return export.SourcedIds[resourceType][id]
+	}
+	orgId := ids(constants.SOURCED_ID_ORG, export.School.Id)
+
+	manifest := [][]string{
+		{"manifest.version", "1.0"},
+		{"oneroster.version", "1.2"},
+	}
+	for _, name := range manifestFiles {
+		mode := "absent"
+		if exportedFiles[name] {
+			mode = "bulk"
+		}
+		manifest = append(manifest, []string{"file." + name, mode})
+	}
+	manifest = append(manifest, []string{"source.systemName", "EduAnalytics"}, []string{"source.systemCode", "eduanalytics"})
+	if err := writeFile(w, FileManifest, []string{"propertyName", "value"}, manifest); err != nil {
+		return err
+	}
+
+	orgs := [][]string{{orgId, "", "", export.School.Name, "school", "", ""}}
+	if err := writeFile(w, FileOrgs, orgColumns, orgs); err != nil {
+		return err
+	}
+
+	var users, roles [][]string
+	for _, user := range export.Users {
+		userId := ids(constants.SOURCED_ID_USER, user.Id)
+		givenName, familyName := splitName(user.Name)
+		enabled := "true"
+		if user.DeactivatedAt != nil {
+			enabled = "false"
+		}
+		users = append(users, []string{userId, "", "", enabled, user.Email, "", givenName, familyName, "", "",
+			user.Email, "", "", "", "", "", "", "", "", "", "", orgId, ""})
+		roles = append(roles, []string{userId + "-" + orgId, "", "", userId, "primary", exportRoles[user.Role], "", "", orgId, ""})
+	}
+	if err := writeFile(w, FileUsers, userColumns, users); err != nil {
+		return err
+	}
+	if err := writeFile(w, FileRoles, roleColumns, roles); err != nil {
+		return err
+	}
+
+	var classes, enrollments [][]string
+	for _, classroom := range export.Classrooms {
+		classId := ids(constants.SOURCED_ID_CLASS, classroom.Id)
+		classes = append(classes, []string{classId, "", "", classroom.Name, "", classId, "", "scheduled", "", orgId, "", "", "", ""})
+		if teacherId := ids(constants.SOURCED_ID_USER, classroom.TeacherId); teacherId != "" {
+			enrollments = append(enrollments, []string{classId + "-" + teacherId, "", "", classId, orgId, teacherId, "teacher", "true", "", ""})
+		}
+	}
+	for _, enrollment := range export.Enrollments {
+		enrollments = append(enrollments, []string{ids(constants.SOURCED_ID_ENROLLMENT, enrollment.Id), "", "",
+			ids(constants.SOURCED_ID_CLASS, enrollment.ClassroomId), orgId,
+			ids(constants.SOURCED_ID_USER, enrollment.StudentId), "student", "false", "", ""})
+	}
+	if err := writeFile(w, FileClasses, classColumns, classes); err != nil {
+		return err
+	}
+	return writeFile(w, FileEnrollments, enrollmentColumns, enrollments)
+}
+
+func writeFile(w *zip.Writer, name string, header []string, rows [][]string) error {
+	file, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// splitName splits a name at its last space into given and family name
+func splitName(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, " "); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
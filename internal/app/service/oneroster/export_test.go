@@ -0,0 +1,120 @@
+package oneroster
+
+import (
+	"archive/zip"
+	"bytes"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"testing"
+	"time"
+)
+
+// schoolExport is a school as GetOneRosterExport returns it, every row mapped to a sourcedId
+func schoolExport() *dto.OneRosterExport {
+	deactivatedAt := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	return &dto.OneRosterExport{
+		School: dto.School{Id: 7, Name: "Riverside High"},
+		Users: []dto.User{
+			{Id: 1, SchoolId: 7, Name: "Mary Jackson", Email: "mary.jackson@riverside.example", Role: constants.ROLE_ADMIN},
+			{Id: 2, SchoolId: 7, Name: "Grace Hopper", Email: "grace.hopper@riverside.example", Role: constants.ROLE_TEACHER},
+			{Id: 3, SchoolId: 7, Name: "Ada Lovelace", Email: "ada.lovelace@riverside.example", Role: constants.ROLE_STUDENT},
+			{Id: 4, SchoolId: 7, Name: "Alan Turing", Email: "alan.turing@riverside.example", Role: constants.ROLE_STUDENT, DeactivatedAt: &deactivatedAt},
+		},
+		Classrooms: []dto.Classroom{
+			{Id: 10, SchoolId: 7, Name: "Algebra I", TeacherId: 2},
+		},
+		Enrollments: []dto.StudentClassroom{
+			{Id: 100, ClassroomId: 10, StudentId: 3},
+			{Id: 101, ClassroomId: 10, StudentId: 4},
+		},
+		SourcedIds: map[string]map[int]string{
+			constants.SOURCED_ID_ORG:        {7: "org-riverside"},
+			constants.SOURCED_ID_USER:       {1: "u-1", 2: "u-2", 3: "u-3", 4: "u-4"},
+			constants.SOURCED_ID_CLASS:      {10: "c-10"},
+			constants.SOURCED_ID_ENROLLMENT: {100: "e-100", 101: "e-101"},
+		},
+	}
+}
+
+// directoryOf is the directory GetOneRosterDirectory returns for the exported school: its rows
+// and the oneroster_sourced_ids mappings the export stored
+func directoryOf(export *dto.OneRosterExport) *dto.OneRosterDirectory {
+	dir := &dto.OneRosterDirectory{
+		SchoolId:    export.School.Id,
+		Schools:     []dto.School{export.School},
+		Users:       export.Users,
+		Classrooms:  export.Classrooms,
+		Enrollments: export.Enrollments,
+	}
+	for resourceType, ids := range export.SourcedIds {
+		for localId, sourcedId := range ids {
+			dir.Mappings = append(dir.Mappings, dto.SourcedId{
+				SchoolId:     export.School.Id,
+				ResourceType: resourceType,
+				SourcedId:    sourcedId,
+				LocalId:      localId,
+			})
+		}
+	}
+	return dir
+}
+
+// Importing an export into the same school matches every row by its sourcedId and changes
+// nothing, so a nightly re-sync of an unchanged roster is a no-op
+func TestExportImportRoundTrip(t *testing.T) {
+	export := schoolExport()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	if err := WriteBundle(archive, export); err != nil {
+		t.Fatalf("WriteBundle: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+
+	bundle, err := ReadBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 1000)
+	if err != nil {
+		t.Fatalf("ReadBundle: %v", err)
+	}
+
+	result := Validate(bundle, directoryOf(export), "")
+	if result.Invalid != 0 {
+		t.Fatalf("Invalid = %d, rows: %+v", result.Invalid, result.Rows)
+	}
+	if result.Summary != (dto.OneRosterSummary{}) {
+		t.Errorf("Summary = %+v, want no changes", result.Summary)
+	}
+	for _, row := range result.Rows {
+		if len(row.Actions) > 0 {
+			t.Errorf("%s line %d has actions %q", row.File, row.Line, row.Actions)
+		}
+	}
+
+	// Every planned row is the exported row its sourcedId is mapped to
+	plan := result.Plan
+	if len(plan.Schools) != 1 || plan.Schools[0].Id != 7 || plan.Schools[0].Rename {
+		t.Errorf("Plan.Schools = %+v", plan.Schools)
+	}
+	if len(plan.Users) != len(export.Users) {
+		t.Fatalf("Plan.Users = %+v, want %d users", plan.Users, len(export.Users))
+	}
+	for _, u := range plan.Users {
+		if id := export.SourcedIds[constants.SOURCED_ID_USER]; u.Id == 0 || id[u.Id] != u.SourcedId || u.Rename || u.Deactivate || u.Reactivate {
+			t.Errorf("planned user = %+v", u)
+		}
+	}
+	if len(plan.Classes) != 1 || plan.Classes[0].Id != 10 || plan.Classes[0].Rename || plan.Classes[0].Reassign {
+		t.Errorf("Plan.Classes = %+v", plan.Classes)
+	}
+	if len(plan.Enrollments) != len(export.Enrollments) {
+		t.Fatalf("Plan.Enrollments = %+v, want %d enrollments", plan.Enrollments, len(export.Enrollments))
+	}
+	for i, e := range plan.Enrollments {
+		exported := export.Enrollments[i]
+		if e.ClassroomId != exported.ClassroomId || e.StudentId != exported.StudentId || e.Drop ||
+			e.SourcedId != export.SourcedIds[constants.SOURCED_ID_ENROLLMENT][exported.Id] {
+			t.Errorf("planned enrollment = %+v, want enrollment %d", e, exported.Id)
+		}
+	}
+}
@@ -0,0 +1,665 @@
+package oneroster
+
+import (
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+const (
+	maxSchoolNameLength = 150
+	maxNameLength       = 100
+	maxEmailLength      = 150
+	maxTitleLength      = 100
+)
+
+// importRoles are the local roles of the OneRoster roles that are imported; guardians, parents,
+// aides and the other roles are skipped
+var importRoles = map[string]string{
+	"administrator":         constants.ROLE_ADMIN,
+	"districtadministrator": constants.ROLE_ADMIN,
+	"siteadministrator":     constants.ROLE_ADMIN,
+	"systemadministrator":   constants.ROLE_ADMIN,
+	"principal":             constants.ROLE_ADMIN,
+	"teacher":               constants.ROLE_TEACHER,
+	"student":               constants.ROLE_STUDENT,
+}
+
+// Result is the validation report of a bundle and, when every row is valid, the changes to make
+type Result struct {
+	Rows    []dto.OneRosterRowResult
+	Invalid int
+	Plan    dto.OneRosterPlan
+	Summary dto.OneRosterSummary
+}
+
+// org is an imported school org, schoolId is 0 for a school the import creates
+type org struct {
+	schoolId int
+}
+
+// user is an imported user or a mapped user the bundle refers to
+type user struct {
+	id       int
+	orgId    string
+	schoolId int
+	role     string
+}
+
+// class is an imported class or a mapped class the bundle refers to
+type class struct {
+	id       int
+	orgId    string
+	schoolId int
+}
+
+// validator checks a bundle against the directory. Rows of orgs that are not imported, such as
+// the district or, for an admin, the other schools of the district, are skipped together with
+// the users, classes and enrollments of those orgs.
+type validator struct {
+	dir    *dto.OneRosterDirectory
+	result *Result
+
+	mappings   map[string]map[string][]dto.SourcedId
+	schools    map[int]*dto.School
+	users      map[int]*dto.User
+	emails     map[string]*dto.User
+	classrooms map[int]*dto.Classroom
+	enrolled   map[[2]int]bool
+
+	orgs        map[string]*org
+	skippedOrgs map[string]bool
+	rosterUsers map[string]*user
+	skipped     map[string]bool
+	classes     map[string]*class
+}
+
+// Validate checks every row of the bundle and plans the changes. Resources are matched by their
+// mapped sourcedId first; users without a mapping are matched by email within their school.
+// Admins import into their own school: its org is the mapped one, orgSourcedId or the only
+// school org of the bundle. Super admins import every school org of the bundle and create
+// the schools that are not mapped yet. Roles of existing users are not changed and nothing is
+// deleted except enrollments with the status tobedeleted; users with that status are
+// deactivated.
+func Validate(bundle *Bundle, dir *dto.OneRosterDirectory, orgSourcedId string) *Result {
+	v := &validator{
+		dir:         dir,
+		result:      &Result{},
+		mappings:    map[string]map[string][]dto.SourcedId{},
+		schools:     map[int]*dto.School{},
+		users:       map[int]*dto.User{},
+		emails:      map[string]*dto.User{},
+		classrooms:  map[int]*dto.Classroom{},
+		enrolled:    map[[2]int]bool{},
+		orgs:        map[string]*org{},
+		skippedOrgs: map[string]bool{},
+		rosterUsers: map[string]*user{},
+		skipped:     map[string]bool{},
+		classes:     map[string]*class{},
+	}
+	for _, mapping := range dir.Mappings {
+		if v.mappings[mapping.ResourceType] == nil {
+			v.mappings[mapping.ResourceType] = map[string][]dto.SourcedId{}
+		}
+		v.mappings[mapping.ResourceType][mapping.SourcedId] = append(v.mappings[mapping.ResourceType][mapping.SourcedId], mapping)
+	}
+	for i := range dir.Schools {
+		v.schools[dir.Schools[i].Id] = &dir.Schools[i]
+	}
+	for i := range dir.Users {
+		v.users[dir.Users[i].Id] = &dir.Users[i]
+		v.emails[strings.ToLower(dir.Users[i].Email)] = &dir.Users[i]
+	}
+	for i := range dir.Classrooms {
+		v.classrooms[dir.Classrooms[i].Id] = &dir.Classrooms[i]
+	}
+	for _, enrollment := range dir.Enrollments {
+		v.enrolled[[2]int{enrollment.ClassroomId, enrollment.StudentId}] = true
+	}
+
+	v.validateOrgs(bundle.Orgs, orgSourcedId)
+	v.validateUsers(bundle.Users, bundle.Roles)
+	teachers := v.classTeachers(bundle.Enrollments)
+	v.validateClasses(bundle.Classes, teachers)
+	v.validateEnrollments(bundle.Enrollments, teachers)
+
+	return v.result
+}
+
+// mapped returns the local id of a sourcedId in the school, 0 when it is not mapped
+func (v *validator) mapped(resourceType, sourcedId string, schoolId int) int {
+	for _, mapping := range v.mappings[resourceType][sourcedId] {
+		if mapping.SchoolId == schoolId {
+			return mapping.LocalId
+		}
+	}
+	return 0
+}
+
+func (v *validator) validateOrgs(orgs []Org, orgSourcedId string) {
+	// The school of an admin's import is the org mapped to it, the given org or the only school
+	var own string
+	if v.dir.SchoolId != 0 {
+		var schoolOrgs []string
+		for _, o := range orgs {
+			if o.Type != "school" {
+				continue
+			}
+			schoolOrgs = append(schoolOrgs, o.SourcedId)
+			if v.mapped(constants.SOURCED_ID_ORG, o.SourcedId, v.dir.SchoolId) == v.dir.SchoolId {
+				own = o.SourcedId
+			}
+		}
+		switch {
+		case own != "":
+		case orgSourcedId != "":
+			own = orgSourcedId
+		case len(schoolOrgs) == 1:
+			own = schoolOrgs[0]
+		}
+	}
+
+	seen := map[string]int{}
+	for _, o := range orgs {
+		report := dto.OneRosterRowResult{File: FileOrgs, Line: o.Line, SourcedId: o.SourcedId}
+
+		if o.SourcedId == "" {
+			v.reject(&report, "sourcedId is required")
+			continue
+		}
+		if line, duplicate := seen[o.SourcedId]; duplicate {
+			v.reject(&report, fmt.Sprintf("duplicate sourcedId, already on line %d", line))
+			continue
+		}
+		seen[o.SourcedId] = o.Line
+
+		switch {
+		case o.Type != "school":
+			v.skipOrg(&report, o.SourcedId, fmt.Sprintf("orgs of type %s are not imported", o.Type))
+			continue
+		case v.dir.SchoolId != 0 && own == "":
+			v.reject(&report, "the bundle has several schools, choose yours with org_sourced_id")
+			continue
+		case v.dir.SchoolId != 0 && o.SourcedId != own:
+			v.skipOrg(&report, o.SourcedId, "not your school")
+			continue
+		case o.Status == StatusToBeDeleted:
+			v.skipOrg(&report, o.SourcedId, "schools are not deleted by imports")
+			continue
+		}
+
+		if o.Name == "" {
+			v.reject(&report, "name is required")
+			continue
+		} else if len(o.Name) > maxSchoolNameLength {
+			v.reject(&report, fmt.Sprintf("name is longer than %d characters", maxSchoolNameLength))
+			continue
+		}
+
+		planned := dto.OneRosterSchool{SourcedId: o.SourcedId, Name: o.Name}
+		if v.dir.SchoolId != 0 {
+			// Admins sync into their school and do not rename it
+			if mappedId := v.mapped(constants.SOURCED_ID_ORG, o.SourcedId, v.dir.SchoolId); mappedId == 0 {
+				if v.hasOrgMapping(v.dir.SchoolId) {
+					v.reject(&report, "your school is mapped to another org")
+					continue
+				}
+				report.Actions = append(report.Actions, "map to your school")
+			}
+			planned.Id = v.dir.SchoolId
+		} else {
+			var matches []int
+			for _, mapping := range v.mappings[constants.SOURCED_ID_ORG][o.SourcedId] {
+				if _, exists := v.schools[mapping.LocalId]; exists {
+					matches = append(matches, mapping.LocalId)
+				}
+			}
+			switch len(matches) {
+			case 0:
+				v.result.Summary.SchoolsCreated++
+				report.Actions = append(report.Actions, fmt.Sprintf("create school %q", o.Name))
+			case 1:
+				planned.Id = matches[0]
+				if school := v.schools[planned.Id]; school.Name != o.Name {
+					planned.Rename = true
+					v.result.Summary.SchoolsUpdated++
+					report.Actions = append(report.Actions, fmt.Sprintf("rename school from %q", school.Name))
+				}
+			default:
+				v.reject(&report, fmt.Sprintf("the sourcedId is mapped to %d schools", len(matches)))
+				continue
+			}
+		}
+
+		v.orgs[o.SourcedId] = &org{schoolId: planned.Id}
+		v.result.Plan.Schools = append(v.result.Plan.Schools, planned)
+		v.accept(&report)
+	}
+}
+
+// hasOrgMapping reports whether the school is mapped to an org
+func (v *validator) hasOrgMapping(schoolId int) bool {
+	for _, mappings := range v.mappings[constants.SOURCED_ID_ORG] {
+		for _, mapping := range mappings {
+			if mapping.SchoolId == schoolId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// orgOf resolves the org of a row: imported, skipped or, as a failure message, unknown
+func (v *validator) orgOf(sourcedId string) (*org, bool, string) {
+	if sourcedId == "" {
+		return nil, false, "the org is missing"
+	}
+	if v.skippedOrgs[sourcedId] {
+		return nil, true, ""
+	}
+	if o, ok := v.orgs[sourcedId]; ok {
+		return o, false, ""
+	}
+	return nil, false, fmt.Sprintf("unknown org %s", sourcedId)
+}
+
+func (v *validator) validateUsers(users []User, roles []Role) {
+	// The primary role of roles.csv wins over the first one and over the 1.1 role column
+	type userRole struct {
+		role, orgId string
+		primary     bool
+	}
+	roleOf := map[string]userRole{}
+	for _, r := range roles {
+		if r.Status == StatusToBeDeleted {
+			continue
+		}
+		current, exists := roleOf[r.UserSourcedId]
+		if !exists || (!current.primary && r.RoleType == "primary") {
+			roleOf[r.UserSourcedId] = userRole{role: r.Role, orgId: r.OrgSourcedId, primary: r.RoleType == "primary"}
+		}
+	}
+
+	seen := map[string]int{}
+	seenEmails := map[string]int{}
+	for _, u := range users {
+		report := dto.OneRosterRowResult{File: FileUsers, Line: u.Line, SourcedId: u.SourcedId}
+
+		if u.SourcedId == "" {
+			v.reject(&report, "sourcedId is required")
+			continue
+		}
+		if line, duplicate := seen[u.SourcedId]; duplicate {
+			v.reject(&report, fmt.Sprintf("duplicate sourcedId, already on line %d", line))
+			continue
+		}
+		seen[u.SourcedId] = u.Line
+
+		roleName, orgId := u.Role, u.PrimaryOrgSourcedId
+		if r, ok := roleOf[u.SourcedId]; ok {
+			roleName, orgId = r.role, r.orgId
+		}
+		if orgId == "" && len(u.OrgSourcedIds) > 0 {
+			orgId = u.OrgSourcedIds[0]
+		}
+		if orgId == "" {
+			orgId = u.PrimaryOrgSourcedId
+		}
+
+		if roleName == "" {
+			v.reject(&report, "the user has no role")
+			continue
+		}
+		role, imported := importRoles[strings.ToLower(roleName)]
+		if !imported {
+			v.skip(&report, u.SourcedId, fmt.Sprintf("users with the role %s are not imported", roleName))
+			continue
+		}
+		o, skippedOrg, failure := v.orgOf(orgId)
+		if skippedOrg {
+			v.skip(&report, u.SourcedId, "the user's org is not imported")
+			continue
+		} else if failure != "" {
+			v.reject(&report, failure)
+			continue
+		}
+
+		name := strings.TrimSpace(u.GivenName + " " + u.FamilyName)
+		if name == "" {
+			report.Errors = append(report.Errors, "givenName or familyName is required")
+		} else if len(name) > maxNameLength {
+			report.Errors = append(report.Errors, fmt.Sprintf("the name is longer than %d characters", maxNameLength))
+		}
+		if u.Email == "" {
+			report.Errors = append(report.Errors, "email is required")
+		} else if len(u.Email) > maxEmailLength {
+			report.Errors = append(report.Errors, fmt.Sprintf("email is longer than %d characters", maxEmailLength))
+		} else if address, err := mail.ParseAddress(u.Email); err != nil || address.Address != u.Email {
+			report.Errors = append(report.Errors, fmt.Sprintf("email %q is not a valid address", u.Email))
+		} else if line, duplicate := seenEmails[u.Email]; duplicate {
+			report.Errors = append(report.Errors, fmt.Sprintf("duplicate email %s, already on line %d", u.Email, line))
+		} else {
+			seenEmails[u.Email] = u.Line
+		}
+		if len(report.Errors) > 0 {
+			v.reject(&report)
+			continue
+		}
+
+		planned := dto.OneRosterUser{
+			SourcedId:       u.SourcedId,
+			SchoolId:        o.schoolId,
+			SchoolSourcedId: orgId,
+			Email:           u.Email,
+			Name:            name,
+			Role:            role,
+			Enabled:         u.EnabledUser != "false" && u.Status != StatusToBeDeleted,
+		}
+
+		// The mapped user or the user with the email in the same school
+		var existing *dto.User
+		if o.schoolId != 0 {
+			if mappedId := v.mapped(constants.SOURCED_ID_USER, u.SourcedId, o.schoolId); mappedId != 0 {
+				if mappedUser, ok := v.users[mappedId]; ok && mappedUser.AnonymizedAt == nil {
+					existing = mappedUser
+				}
+			}
+		}
+		if byEmail, ok := v.emails[u.Email]; ok && (existing == nil || existing.Id != byEmail.Id) {
+			switch {
+			case existing != nil:
+				v.reject(&report, fmt.Sprintf("email %s belongs to another user", u.Email))
+				continue
+			case byEmail.SchoolId != o.schoolId || o.schoolId == 0:
+				v.reject(&report, fmt.Sprintf("email %s belongs to a user of another school", u.Email))
+				continue
+			}
+			existing = byEmail
+		}
+
+		switch {
+		case existing == nil:
+			v.result.Summary.UsersCreated++
+			report.Actions = append(report.Actions, fmt.Sprintf("create %s %s", role, u.Email))
+			if !planned.Enabled {
+				report.Actions = append(report.Actions, "create deactivated")
+			}
+		case existing.Role != role:
+			v.reject(&report, fmt.Sprintf("%s is already a %s, imports do not change roles", u.Email, existing.Role))
+			continue
+		default:
+			planned.Id = existing.Id
+			if existing.Name != name {
+				planned.Rename = true
+				v.result.Summary.UsersUpdated++
+				report.Actions = append(report.Actions, fmt.Sprintf("rename from %q", existing.Name))
+			}
+			if !planned.Enabled && existing.DeactivatedAt == nil {
+				planned.Deactivate = true
+				v.result.Summary.UsersDeactivated++
+				report.Actions = append(report.Actions, "deactivate")
+			} else if planned.Enabled && existing.DeactivatedAt != nil {
+				planned.Reactivate = true
+				v.result.Summary.UsersReactivated++
+				report.Actions = append(report.Actions, "reactivate")
+			}
+		}
+
+		v.rosterUsers[u.SourcedId] = &user{id: planned.Id, orgId: orgId, schoolId: o.schoolId, role: role}
+		v.result.Plan.Users = append(v.result.Plan.Users, planned)
+		v.accept(&report)
+	}
+}
+
+// userOf resolves a user of the bundle or a mapped user of the school of the org
+func (v *validator) userOf(sourcedId, orgId string) (*user, bool) {
+	if u, ok := v.rosterUsers[sourcedId]; ok {
+		return u, true
+	}
+	if o, ok := v.orgs[orgId]; ok && o.schoolId != 0 {
+		if mappedUser, ok := v.users[v.mapped(constants.SOURCED_ID_USER, sourcedId, o.schoolId)]; ok && mappedUser.AnonymizedAt == nil {
+			return &user{id: mappedUser.Id, orgId: orgId, schoolId: o.schoolId, role: mappedUser.Role}, true
+		}
+	}
+	return nil, false
+}
+
+// classTeachers returns the teacher of each class: the primary teacher enrollment or else the
+// first one
+func (v *validator) classTeachers(enrollments []Enrollment) map[string]string {
+	teachers := map[string]string{}
+	primary := map[string]bool{}
+	for _, e := range enrollments {
+		if strings.ToLower(e.Role) != "teacher" || e.Status == StatusToBeDeleted {
+			continue
+		}
+		if _, assigned := teachers[e.ClassSourcedId]; !assigned || (!primary[e.ClassSourcedId] && e.Primary == "true") {
+			teachers[e.ClassSourcedId] = e.UserSourcedId
+			primary[e.ClassSourcedId] = e.Primary == "true"
+		}
+	}
+	return teachers
+}
+
+func (v *validator) validateClasses(classes []Class, teachers map[string]string) {
+	seen := map[string]int{}
+	for _, c := range classes {
+		report := dto.OneRosterRowResult{File: FileClasses, Line: c.Line, SourcedId: c.SourcedId}
+
+		if c.SourcedId == "" {
+			v.reject(&report, "sourcedId is required")
+			continue
+		}
+		if line, duplicate := seen[c.SourcedId]; duplicate {
+			v.reject(&report, fmt.Sprintf("duplicate sourcedId, already on line %d", line))
+			continue
+		}
+		seen[c.SourcedId] = c.Line
+
+		o, skippedOrg, failure := v.orgOf(c.SchoolSourcedId)
+		if skippedOrg {
+			v.skip(&report, c.SourcedId, "the class's school is not imported")
+			continue
+		} else if failure != "" {
+			v.reject(&report, failure)
+			continue
+		}
+		if c.Status == StatusToBeDeleted {
+			v.skip(&report, c.SourcedId, "classes are not deleted by imports")
+			continue
+		}
+		if c.Title == "" {
+			v.reject(&report, "title is required")
+			continue
+		} else if len(c.Title) > maxTitleLength {
+			v.reject(&report, fmt.Sprintf("title is longer than %d characters", maxTitleLength))
+			continue
+		}
+
+		planned := dto.OneRosterClass{SourcedId: c.SourcedId, SchoolId: o.schoolId, SchoolSourcedId: c.SchoolSourcedId, Name: c.Title}
+		var existing *dto.Classroom
+		if o.schoolId != 0 {
+			existing = v.classrooms[v.mapped(constants.SOURCED_ID_CLASS, c.SourcedId, o.schoolId)]
+		}
+
+		var teacher *user
+		if teacherId, ok := teachers[c.SourcedId]; ok {
+			var known bool
+			if teacher, known = v.userOf(teacherId, c.SchoolSourcedId); !known {
+				if v.skipped[teacherId] {
+					v.reject(&report, fmt.Sprintf("the teacher %s is not imported", teacherId))
+				} else {
+					v.reject(&report, fmt.Sprintf("unknown teacher %s", teacherId))
+				}
+				continue
+			}
+			if teacher.role != constants.ROLE_TEACHER {
+				v.reject(&report, fmt.Sprintf("the teacher %s is a %s", teacherId, teacher.role))
+				continue
+			}
+			if teacher.orgId != c.SchoolSourcedId {
+				v.reject(&report, fmt.Sprintf("the teacher %s belongs to another school", teacherId))
+				continue
+			}
+		}
+
+		switch {
+		case existing == nil && teacher == nil:
+			v.reject(&report, "the class has no teacher enrollment")
+			continue
+		case existing == nil:
+			planned.TeacherId = teacher.id
+			planned.TeacherSourcedId = teachers[c.SourcedId]
+			v.result.Summary.ClassroomsCreated++
+			report.Actions = append(report.Actions, fmt.Sprintf("create classroom %q", c.Title))
+		default:
+			planned.Id = existing.Id
+			changed := false
+			if existing.Name != c.Title {
+				planned.Rename = true
+				changed = true
+				report.Actions = append(report.Actions, fmt.Sprintf("rename from %q", existing.Name))
+			}
+			if teacher != nil && (teacher.id == 0 || teacher.id != existing.TeacherId) {
+				planned.TeacherId = teacher.id
+				planned.TeacherSourcedId = teachers[c.SourcedId]
+				planned.Reassign = true
+				changed = true
+				report.Actions = append(report.Actions, fmt.Sprintf("assign to teacher %s", planned.TeacherSourcedId))
+			}
+			if changed {
+				v.result.Summary.ClassroomsUpdated++
+			}
+		}
+
+		v.classes[c.SourcedId] = &class{id: planned.Id, orgId: c.SchoolSourcedId, schoolId: o.schoolId}
+		v.result.Plan.Classes = append(v.result.Plan.Classes, planned)
+		v.accept(&report)
+	}
+}
+
+// classOf resolves a class of the bundle or a mapped class of the school of the org
+func (v *validator) classOf(sourcedId, orgId string) (*class, bool) {
+	if c, ok := v.classes[sourcedId]; ok {
+		return c, true
+	}
+	if o, ok := v.orgs[orgId]; ok && o.schoolId != 0 {
+		if classroom, ok := v.classrooms[v.mapped(constants.SOURCED_ID_CLASS, sourcedId, o.schoolId)]; ok {
+			return &class{id: classroom.Id, orgId: orgId, schoolId: o.schoolId}, true
+		}
+	}
+	return nil, false
+}
+
+func (v *validator) validateEnrollments(enrollments []Enrollment, teachers map[string]string) {
+	seen := map[string]int{}
+	for _, e := range enrollments {
+		report := dto.OneRosterRowResult{File: FileEnrollments, Line: e.Line, SourcedId: e.SourcedId}
+
+		if e.SourcedId == "" {
+			v.reject(&report, "sourcedId is required")
+			continue
+		}
+		if line, duplicate := seen[e.SourcedId]; duplicate {
+			v.reject(&report, fmt.Sprintf("duplicate sourcedId, already on line %d", line))
+			continue
+		}
+		seen[e.SourcedId] = e.Line
+
+		role := strings.ToLower(e.Role)
+		if role != "student" && role != "teacher" {
+			v.skip(&report, e.SourcedId, fmt.Sprintf("enrollments with the role %s are not imported", e.Role))
+			continue
+		}
+		if v.skipped[e.ClassSourcedId] || v.skipped[e.UserSourcedId] || v.skippedOrgs[e.SchoolSourcedId] {
+			v.skip(&report, e.SourcedId, "the class or user is not imported")
+			continue
+		}
+
+		orgId := e.SchoolSourcedId
+		if c, ok := v.classes[e.ClassSourcedId]; ok && orgId == "" {
+			orgId = c.orgId
+		}
+		c, knownClass := v.classOf(e.ClassSourcedId, orgId)
+		if !knownClass {
+			v.reject(&report, fmt.Sprintf("unknown class %s", e.ClassSourcedId))
+			continue
+		}
+		u, knownUser := v.userOf(e.UserSourcedId, c.orgId)
+		if !knownUser {
+			v.reject(&report, fmt.Sprintf("unknown user %s", e.UserSourcedId))
+			continue
+		}
+		if u.orgId != c.orgId {
+			v.reject(&report, "the user and the class belong to different schools")
+			continue
+		}
+		if u.role != role {
+			v.reject(&report, fmt.Sprintf("the user is a %s", u.role))
+			continue
+		}
+
+		if role == constants.ROLE_TEACHER {
+			if e.Status == StatusToBeDeleted {
+				v.skip(&report, e.SourcedId, "teachers are not removed from classes by imports")
+			} else if teachers[e.ClassSourcedId] != e.UserSourcedId {
+				v.skip(&report, e.SourcedId, "the class has another primary teacher")
+			} else {
+				v.accept(&report)
+			}
+			continue
+		}
+
+		enrolled := c.id != 0 && u.id != 0 && v.enrolled[[2]int{c.id, u.id}]
+		planned := dto.OneRosterEnrollment{
+			SourcedId:      e.SourcedId,
+			ClassroomId:    c.id,
+			ClassSourcedId: e.ClassSourcedId,
+			StudentId:      u.id,
+			UserSourcedId:  e.UserSourcedId,
+		}
+		switch {
+		case e.Status == StatusToBeDeleted && !enrolled:
+			v.skip(&report, e.SourcedId, "the student is not enrolled")
+			continue
+		case e.Status == StatusToBeDeleted:
+			planned.Drop = true
+			v.result.Summary.Unenrollments++
+			report.Actions = append(report.Actions, "unenroll")
+		case !enrolled:
+			v.result.Summary.Enrollments++
+			report.Actions = append(report.Actions, "enroll")
+		}
+
+		v.result.Plan.Enrollments = append(v.result.Plan.Enrollments, planned)
+		v.accept(&report)
+	}
+}
+
+func (v *validator) accept(report *dto.OneRosterRowResult) {
+	report.Valid = true
+	v.result.Rows = append(v.result.Rows, *report)
+}
+
+func (v *validator) reject(report *dto.OneRosterRowResult, failures ...string) {
+	report.Errors = append(report.Errors, failures...)
+	v.result.Invalid++
+	v.result.Rows = append(v.result.Rows, *report)
+}
+
+// skip records a valid row that is not imported, rows referring to its sourcedId are skipped too
+func (v *validator) skip(report *dto.OneRosterRowResult, sourcedId, reason string) {
+	report.Valid = true
+	report.Skipped = true
+	report.Actions = append(report.Actions, "skipped: "+reason)
+	v.skipped[sourcedId] = true
+	v.result.Summary.Skipped++
+	v.result.Rows = append(v.result.Rows, *report)
+}
+
+func (v *validator) skipOrg(report *dto.OneRosterRowResult, sourcedId, reason string) {
+	v.skippedOrgs[sourcedId] = true
+	v.skip(report, sourcedId, reason)
+}
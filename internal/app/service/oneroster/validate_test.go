@@ -0,0 +1,117 @@
+package oneroster
+
+import (
+	"eduanalytics/internal/app/db/dto"
+	"reflect"
+	"testing"
+)
+
+// rowOf returns the validation result of a row, nil when the row was not validated
+func rowOf(result *Result, file string, line int) *dto.OneRosterRowResult {
+	for i := range result.Rows {
+		if result.Rows[i].File == file && result.Rows[i].Line == line {
+			return &result.Rows[i]
+		}
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	bundle, err := readFixture(t, "valid.zip", 1000)
+	if err != nil {
+		t.Fatalf("ReadBundle: %v", err)
+	}
+
+	result := Validate(bundle, &dto.OneRosterDirectory{SchoolId: 7}, "")
+	if result.Invalid != 0 {
+		t.Fatalf("Invalid = %d, rows: %+v", result.Invalid, result.Rows)
+	}
+
+	// The district and the guardian are skipped, everything of the school is created
+	want := dto.OneRosterSummary{UsersCreated: 3, ClassroomsCreated: 1, Enrollments: 2, Skipped: 2}
+	if result.Summary != want {
+		t.Errorf("Summary = %+v, want %+v", result.Summary, want)
+	}
+	if len(result.Plan.Schools) != 1 || result.Plan.Schools[0].Id != 7 || result.Plan.Schools[0].SourcedId != "org-1" {
+		t.Errorf("Plan.Schools = %+v, want org-1 mapped to school 7", result.Plan.Schools)
+	}
+	if row := rowOf(result, FileOrgs, 3); row == nil || !reflect.DeepEqual(row.Actions, []string{"map to your school"}) {
+		t.Errorf("row of org-1 = %+v", row)
+	}
+	if row := rowOf(result, FileUsers, 5); row == nil || !row.Skipped {
+		t.Errorf("row of the guardian = %+v, want skipped", row)
+	}
+	if len(result.Plan.Classes) != 1 || result.Plan.Classes[0].TeacherSourcedId != "t-1" {
+		t.Errorf("Plan.Classes = %+v, want c-1 taught by t-1", result.Plan.Classes)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	tests := []struct {
+		fixture string
+		file    string
+		line    int
+		errors  []string
+	}{
+		{
+			fixture: "duplicate_sourced_ids.zip",
+			file:    FileUsers,
+			line:    6,
+			errors:  []string{"duplicate sourcedId, already on line 3"},
+		},
+		{
+			fixture: "duplicate_sourced_ids.zip",
+			file:    FileEnrollments,
+			line:    5,
+			errors:  []string{"duplicate sourcedId, already on line 3"},
+		},
+		{
+			fixture: "unknown_class.zip",
+			file:    FileEnrollments,
+			line:    5,
+			errors:  []string{"unknown class c-9"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture+"/"+tt.file, func(t *testing.T) {
+			bundle, err := readFixture(t, tt.fixture, 1000)
+			if err != nil {
+				t.Fatalf("ReadBundle: %v", err)
+			}
+
+			result := Validate(bundle, &dto.OneRosterDirectory{SchoolId: 7}, "")
+			row := rowOf(result, tt.file, tt.line)
+			if row == nil {
+				t.Fatalf("no result for %s line %d", tt.file, tt.line)
+			}
+			if row.Valid || !reflect.DeepEqual(row.Errors, tt.errors) {
+				t.Errorf("row = %+v, want errors %q", row, tt.errors)
+			}
+			if result.Invalid == 0 {
+				t.Error("Invalid = 0, an invalid row must fail the bundle")
+			}
+		})
+	}
+}
+
+func TestValidateSeveralSchools(t *testing.T) {
+	bundle := &Bundle{Orgs: []Org{
+		{Line: 2, SourcedId: "org-1", Name: "Riverside High", Type: "school"},
+		{Line: 3, SourcedId: "org-2", Name: "Hillside High", Type: "school"},
+	}}
+
+	// An admin has to choose the school of a district bundle
+	result := Validate(bundle, &dto.OneRosterDirectory{SchoolId: 7}, "")
+	if result.Invalid != 2 {
+		t.Errorf("Invalid = %d, want both orgs rejected", result.Invalid)
+	}
+
+	result = Validate(bundle, &dto.OneRosterDirectory{SchoolId: 7}, "org-2")
+	if result.Invalid != 0 || len(result.Plan.Schools) != 1 || result.Plan.Schools[0].SourcedId != "org-2" {
+		t.Errorf("with org_sourced_id: Invalid = %d, Plan.Schools = %+v", result.Invalid, result.Plan.Schools)
+	}
+	if row := rowOf(result, FileOrgs, 2); row == nil || !row.Skipped {
+		t.Errorf("row of org-1 = %+v, want skipped", row)
+	}
+}
@@ -0,0 +1,204 @@
+package ratelimit
+
+import (
+	"context"
+	"eduanalytics/internal/app/service/logger"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy allows Limit requests per Window. The bucket holds at most Limit tokens and refills
+// continuously, so short bursts up to Limit are allowed as long as the average rate is kept.
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// Result describes the state of a bucket after a request was counted
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed, zero when allowed
+}
+
+// ILimiter defines the interface for a request rate limiter
+type ILimiter interface {
+	Allow(ctx context.Context, key, role string) Result
+	Policy() Policy
+}
+
+// bucket is a token bucket of one client
+type bucket struct {
+	tokens   float64
+	updated  time.Time
+	capacity float64
+}
+
+// Limiter keeps a token bucket per key. A role multiplier scales the limit of the buckets of
+// users with that role, e.g. to give teachers more headroom than students.
+type Limiter struct {
+	policy          Policy
+	roleMultipliers map[string]float64
+	buckets         map[string]*bucket
+	mu              sync.Mutex
+}
+
+// NewLimiter creates a limiter enforcing policy
+func NewLimiter(policy Policy, roleMultipliers map[string]float64) ILimiter {
+	l := &Limiter{
+		policy:          policy,
+		roleMultipliers: roleMultipliers,
+		buckets:         make(map[string]*bucket),
+	}
+
+	// Start background cleanup goroutine
+	go l.startCleanupRoutine()
+
+	return l
+}
+
+// Policy returns the policy the limiter enforces
+func (l *Limiter) Policy() Policy {
+	return l.policy
+}
+
+// Allow takes a token from the bucket of key
+func (l *Limiter) Allow(ctx context.Context, key, role string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	capacity := l.capacity(role)
+	rate := l.rate(capacity)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: capacity, updated: now, capacity: capacity}
+		l.buckets[key] = b
+	}
+
+	// Refill for the time elapsed since the last request
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	b.capacity = capacity
+
+	result := Result{Limit: int(capacity)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / rate)
+	return result
+}
+
+// CleanupIdleBuckets forgets buckets that have refilled completely
+func (l *Limiter) CleanupIdleBuckets(ctx context.Context) {
+	log := logger.Logger(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate(b.capacity) >= b.capacity {
+			delete(l.buckets, key)
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		log.Infof("Cleaned up %d idle %s rate limit buckets", removed, l.policy.Name)
+	}
+}
+
+// capacity returns the bucket size for a role
+func (l *Limiter) capacity(role string) float64 {
+	capacity := float64(l.policy.Limit)
+	if multiplier, exists := l.roleMultipliers[role]; exists {
+		capacity *= multiplier
+	}
+	return math.Max(1, math.Floor(capacity))
+}
+
+// rate returns the refill rate in tokens per second for a bucket of the given size
+func (l *Limiter) rate(capacity float64) float64 {
+	return capacity / l.policy.Window.Seconds()
+}
+
+// startCleanupRoutine starts a background goroutine to forget idle buckets
+func (l *Limiter) startCleanupRoutine() {
+	ticker := time.NewTicker(l.policy.Window + time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		l.CleanupIdleBuckets(ctx)
+	}
+}
+
+// Routes selects the limiter of a route, routes without an entry use Default
+type Routes struct {
+	Default ILimiter
+	routes  map[string]ILimiter // "METHOD /full/path" -> limiter
+}
+
+// NewRoutes creates a route table falling back to defaultLimiter
+func NewRoutes(defaultLimiter ILimiter) *Routes {
+	return &Routes{
+		Default: defaultLimiter,
+		routes:  make(map[string]ILimiter),
+	}
+}
+
+// Set assigns a limiter to the route registered as method and fullPath
+func (r *Routes) Set(method, fullPath string, limiter ILimiter) *Routes {
+	r.routes[method+" "+fullPath] = limiter
+	return r
+}
+
+// For returns the limiter of the route registered as method and fullPath
+func (r *Routes) For(method, fullPath string) ILimiter {
+	if limiter, exists := r.routes[method+" "+fullPath]; exists {
+		return limiter
+	}
+	return r.Default
+}
+
+// ParseRoleMultipliers parses "role:multiplier" pairs such as ["teacher:2", "admin:5"]
+func ParseRoleMultipliers(pairs []string) (map[string]float64, error) {
+	multipliers := make(map[string]float64, len(pairs))
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		role, value, found := strings.Cut(pair, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid role multiplier %q, expected role:multiplier", pair)
+		}
+
+		multiplier, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || multiplier <= 0 {
+			return nil, fmt.Errorf("invalid role multiplier %q", pair)
+		}
+		multipliers[strings.TrimSpace(role)] = multiplier
+	}
+	return multipliers, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,134 @@
+// Package rbac stores the Casbin policy in Postgres and keeps the enforcers of all instances in
+// sync. Policy changes are written through the adapter and announced with a Postgres
+// notification, every other instance reloads its policy when it receives it.
+package rbac
+
+import (
+	"context"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"errors"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// maxRuleFields is the number of value columns of casbin_rules
+const maxRuleFields = 6
+
+var errRuleTooLong = errors.New("casbin rule has more than 6 fields")
+
+// Adapter is a Casbin adapter backed by the casbin_rules table
+type Adapter struct {
+	Repo repository.ICasbinRulesRepository
+}
+
+var _ persist.BatchAdapter = &Adapter{}
+
+// NewAdapter creates a new Adapter
+func NewAdapter(repo repository.ICasbinRulesRepository) *Adapter {
+	return &Adapter{
+		Repo: repo,
+	}
+}
+
+// LoadPolicy loads every stored rule into the model
+func (a *Adapter) LoadPolicy(m model.Model) error {
+	rules, err := a.Repo.GetRules(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if err := persist.LoadPolicyArray(ruleToArray(rule), m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SavePolicy replaces the stored rules with the rules of the model
+func (a *Adapter) SavePolicy(m model.Model) error {
+	var rules []dto.CasbinRule
+	for _, sec := range []string{"p", "g"} {
+		for ptype, assertion := range m[sec] {
+			for _, values := range assertion.Policy {
+				rule, err := newRule(ptype, values)
+				if err != nil {
+					return err
+				}
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return a.Repo.ReplaceRules(context.Background(), rules)
+}
+
+func (a *Adapter) AddPolicy(sec string, ptype string, values []string) error {
+	return a.AddPolicies(sec, ptype, [][]string{values})
+}
+
+func (a *Adapter) AddPolicies(sec string, ptype string, values [][]string) error {
+	rules, err := newRules(ptype, values)
+	if err != nil {
+		return err
+	}
+	return a.Repo.AddRules(context.Background(), rules)
+}
+
+func (a *Adapter) RemovePolicy(sec string, ptype string, values []string) error {
+	return a.RemovePolicies(sec, ptype, [][]string{values})
+}
+
+func (a *Adapter) RemovePolicies(sec string, ptype string, values [][]string) error {
+	rules, err := newRules(ptype, values)
+	if err != nil {
+		return err
+	}
+	return a.Repo.RemoveRules(context.Background(), rules)
+}
+
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return a.Repo.RemoveFilteredRules(context.Background(), ptype, fieldIndex, fieldValues...)
+}
+
+// newRule maps a policy line without its type to a row, unused fields stay empty
+func newRule(ptype string, values []string) (dto.CasbinRule, error) {
+	if len(values) > maxRuleFields {
+		return dto.CasbinRule{}, errRuleTooLong
+	}
+
+	var fields [maxRuleFields]string
+	copy(fields[:], values)
+	return dto.CasbinRule{
+		Ptype: ptype,
+		V0:    fields[0],
+		V1:    fields[1],
+		V2:    fields[2],
+		V3:    fields[3],
+		V4:    fields[4],
+		V5:    fields[5],
+	}, nil
+}
+
+func newRules(ptype string, values [][]string) ([]dto.CasbinRule, error) {
+	rules := make([]dto.CasbinRule, 0, len(values))
+	for _, v := range values {
+		rule, err := newRule(ptype, v)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ruleToArray maps a row back to a policy line starting with its type, trailing empty fields
+// are dropped
+func ruleToArray(rule dto.CasbinRule) []string {
+	line := []string{rule.Ptype, rule.V0, rule.V1, rule.V2, rule.V3, rule.V4, rule.V5}
+	for len(line) > 1 && line[len(line)-1] == "" {
+		line = line[:len(line)-1]
+	}
+	return line
+}
@@ -0,0 +1,96 @@
+package rbac
+
+import (
+	"bufio"
+	"context"
+	"eduanalytics/internal/app/db/dto"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/logger"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/casbin/casbin/v2"
+)
+
+// NewEnforcer creates an enforcer with the model at modelPath and the policy stored in the
+// database. An empty policy table is seeded from the CSV policy file at seedPath first.
+func NewEnforcer(ctx context.Context, modelPath, seedPath string, repo repository.ICasbinRulesRepository) (*casbin.SyncedEnforcer, error) {
+	log := logger.Logger(ctx)
+
+	seeded, err := Seed(ctx, repo, seedPath)
+	if err != nil {
+		return nil, fmt.Errorf("seeding casbin policy from %s: %w", seedPath, err)
+	}
+	if seeded > 0 {
+		log.Infof("Seeded Casbin policy with %d rules from %s", seeded, seedPath)
+	}
+
+	// NewSyncedEnforcer loads the policy through the adapter
+	return casbin.NewSyncedEnforcer(modelPath, NewAdapter(repo))
+}
+
+// Watch reloads the enforcer's policy whenever the watcher reports a change
+func Watch(enforcer *casbin.SyncedEnforcer, watcher *Watcher) error {
+	if err := enforcer.SetWatcher(watcher); err != nil {
+		return err
+	}
+	// The default callback reloads the unsynchronised enforcer, reload through the synced one
+	return watcher.SetUpdateCallback(func(string) {
+		_ = enforcer.LoadPolicy()
+	})
+}
+
+// Seed stores the rules of the CSV policy file when no rule is stored yet and returns the
+// number of rules read from the file
+func Seed(ctx context.Context, repo repository.ICasbinRulesRepository, path string) (int, error) {
+	count, err := repo.CountRules(ctx)
+	if err != nil || count > 0 {
+		return 0, err
+	}
+
+	rules, err := ReadPolicyFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if err := repo.AddRules(ctx, rules); err != nil {
+		return 0, err
+	}
+	return len(rules), nil
+}
+
+// ReadPolicyFile parses a Casbin CSV policy file such as internal/config/casbin_policy.csv
+func ReadPolicyFile(path string) ([]dto.CasbinRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []dto.CasbinRule
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		reader := csv.NewReader(strings.NewReader(line))
+		reader.TrimLeadingSpace = true
+		fields, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: rule without values", lineNumber)
+		}
+
+		rule, err := newRule(strings.TrimSpace(fields[0]), fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
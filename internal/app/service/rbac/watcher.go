@@ -0,0 +1,134 @@
+package rbac
+
+import (
+	"context"
+	"eduanalytics/internal/app/db/repository"
+	"eduanalytics/internal/app/service/logger"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// PolicyChannel is the Postgres notification channel of policy changes
+const PolicyChannel = "casbin_policy"
+
+// pingInterval keeps the listener connection alive and detects broken connections
+const pingInterval = 90 * time.Second
+
+// Watcher announces local policy changes with NOTIFY and calls the update callback when another
+// instance changed the policy. The callback also runs after the listener reconnected, because
+// notifications sent while it was disconnected are lost, and every reloadInterval as a fallback.
+type Watcher struct {
+	Repo repository.ICasbinRulesRepository
+
+	listener       *pq.Listener
+	instanceId     string
+	reloadInterval time.Duration
+	done           chan struct{}
+	closeOnce      sync.Once
+
+	mu       sync.Mutex
+	callback func(string)
+}
+
+var _ persist.Watcher = &Watcher{}
+
+// NewWatcher starts listening on PolicyChannel with a dedicated connection to dsn. A
+// reloadInterval of 0 disables the periodic reload.
+func NewWatcher(ctx context.Context, dsn string, repo repository.ICasbinRulesRepository, reloadInterval time.Duration) (*Watcher, error) {
+	log := logger.Logger(ctx)
+
+	listener := pq.NewListener(dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Warnf("Casbin policy listener: %v", err)
+		}
+	})
+	if err := listener.Listen(PolicyChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	w := &Watcher{
+		Repo:           repo,
+		listener:       listener,
+		instanceId:     uuid.NewString(),
+		reloadInterval: reloadInterval,
+		done:           make(chan struct{}),
+	}
+	go w.listen(ctx)
+	return w, nil
+}
+
+// SetUpdateCallback sets the function called when the policy must be reloaded
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update tells the other instances that the policy changed
+func (w *Watcher) Update() error {
+	return w.Repo.NotifyRulesChanged(context.Background(), PolicyChannel, w.instanceId)
+}
+
+// Close stops listening, the callback is not called any more
+func (w *Watcher) Close() {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.listener.Close()
+	})
+}
+
+func (w *Watcher) listen(ctx context.Context) {
+	log := logger.Logger(ctx)
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+
+	var reload <-chan time.Time
+	if w.reloadInterval > 0 {
+		ticker := time.NewTicker(w.reloadInterval)
+		defer ticker.Stop()
+		reload = ticker.C
+	}
+
+	for {
+		select {
+		case notification := <-w.listener.Notify:
+			if notification == nil {
+				log.Info("Casbin policy listener reconnected, reloading policy")
+				w.notify("")
+				continue
+			}
+			// Changes of this instance are already applied
+			if notification.Extra == w.instanceId {
+				continue
+			}
+			log.Infof("Casbin policy changed by instance %s, reloading policy", notification.Extra)
+			w.notify(notification.Extra)
+		case <-reload:
+			w.notify("")
+		case <-ping.C:
+			go w.listener.Ping()
+		case <-w.done:
+			return
+		case <-ctx.Done():
+			w.Close()
+			return
+		}
+	}
+}
+
+func (w *Watcher) notify(source string) {
+	w.mu.Lock()
+	callback := w.callback
+	w.mu.Unlock()
+
+	if callback != nil {
+		callback(source)
+	}
+}
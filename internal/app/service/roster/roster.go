@@ -0,0 +1,359 @@
+package roster
+
+import (
+	"bytes"
+	"eduanalytics/internal/app/constants"
+	"eduanalytics/internal/app/db/dto"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+)
+
+const (
+	maxNameLength      = 100
+	maxEmailLength     = 150
+	maxClassroomLength = 100
+)
+
+// Columns of a roster file. Email, name and role are required, classroom and teacher_email may
+// be left out.
+const (
+	ColumnEmail        = "email"
+	ColumnName         = "name"
+	ColumnRole         = "role"
+	ColumnClassroom    = "classroom"
+	ColumnTeacherEmail = "teacher_email"
+)
+
+var (
+	ErrEmptyFile   = errors.New("the file has no header row")
+	ErrNoRows      = errors.New("the file has no rows")
+	ErrTooManyRows = errors.New("the file has too many rows")
+)
+
+// utf8BOM starts CSV files saved by spreadsheet applications
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Result is the validation report of a roster and, when every row is valid, the changes to make
+type Result struct {
+	Rows    []dto.RosterRowResult
+	Invalid int
+	Plan    dto.RosterPlan
+	Summary dto.RosterSummary
+}
+
+// Parse reads a roster CSV file with a header row. Columns are matched by name in any order,
+// unknown columns are rejected so that a misspelt column is not silently ignored.
+func Parse(r io.Reader, maxRows int) ([]dto.RosterRow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, ErrEmptyFile
+	} else if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case ColumnEmail, ColumnName, ColumnRole, ColumnClassroom, ColumnTeacherEmail:
+		default:
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, duplicate := columns[name]; duplicate {
+			return nil, fmt.Errorf("column %q appears twice", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{ColumnEmail, ColumnName, ColumnRole} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []dto.RosterRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(rows) == maxRows {
+			return nil, ErrTooManyRows
+		}
+
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, dto.RosterRow{
+			Line:         line,
+			Email:        strings.ToLower(field(record, ColumnEmail)),
+			Name:         field(record, ColumnName),
+			Role:         strings.ToLower(field(record, ColumnRole)),
+			Classroom:    field(record, ColumnClassroom),
+			TeacherEmail: strings.ToLower(field(record, ColumnTeacherEmail)),
+		})
+	}
+	if len(rows) == 0 {
+		return nil, ErrNoRows
+	}
+
+	return rows, nil
+}
+
+// rosterUser is the user a roster describes, taken from the first row of its email
+type rosterUser struct {
+	line     int
+	name     string
+	role     string
+	existing *dto.User
+}
+
+// assignment is the teacher a roster gives a classroom and the row that does so
+type assignment struct {
+	line         int
+	teacherEmail string
+}
+
+// Validate checks every row of the roster against the other rows and the directory and plans
+// the changes. A user may appear on several rows to be placed in several classrooms, as long as
+// the rows agree on the user's name and role. Teachers teach the classroom of their rows, students
+// are enrolled in it; teacher_email of a student row names the classroom's teacher, which has to
+// be a teacher of the school or of the roster. Roles of existing users are not changed.
+func Validate(rows []dto.RosterRow, dir *dto.RosterDirectory) *Result {
+	existingUsers := map[string]*dto.User{}
+	for i := range dir.Users {
+		existingUsers[strings.ToLower(dir.Users[i].Email)] = &dir.Users[i]
+	}
+	existingClassrooms := map[string][]*dto.Classroom{}
+	for i := range dir.Classrooms {
+		classroom := &dir.Classrooms[i]
+		existingClassrooms[classroom.Name] = append(existingClassrooms[classroom.Name], classroom)
+	}
+	enrolled := map[[2]int]bool{}
+	for _, enrollment := range dir.Enrollments {
+		enrolled[[2]int{enrollment.ClassroomId, enrollment.StudentId}] = true
+	}
+
+	// The first row of an email defines the user, the first row naming a classroom's teacher
+	// assigns the classroom
+	users := map[string]*rosterUser{}
+	teachers := map[string]bool{}
+	assignments := map[string]assignment{}
+	for _, row := range rows {
+		if row.Email == "" || !validRole(row.Role) {
+			continue
+		}
+		if _, seen := users[row.Email]; !seen {
+			users[row.Email] = &rosterUser{line: row.Line, name: row.Name, role: row.Role, existing: existingUsers[row.Email]}
+			if row.Role == constants.ROLE_TEACHER {
+				teachers[row.Email] = true
+			}
+		}
+
+		teacherEmail := row.TeacherEmail
+		if row.Role == constants.ROLE_TEACHER {
+			teacherEmail = row.Email
+		}
+		if row.Classroom != "" && teacherEmail != "" && row.Role != constants.ROLE_ADMIN {
+			if _, assigned := assignments[row.Classroom]; !assigned {
+				assignments[row.Classroom] = assignment{line: row.Line, teacherEmail: teacherEmail}
+			}
+		}
+	}
+	for email, user := range existingUsers {
+		if user.Role == constants.ROLE_TEACHER && user.SchoolId == dir.SchoolId && user.AnonymizedAt == nil {
+			teachers[email] = true
+		}
+	}
+
+	result := &Result{Rows: make([]dto.RosterRowResult, 0, len(rows))}
+	placed := map[[2]string]int{}
+	plannedUsers := map[string]bool{}
+	plannedClassrooms := map[string]bool{}
+
+	for _, row := range rows {
+		report := dto.RosterRowResult{Line: row.Line, Email: row.Email}
+		fail := func(format string, args ...interface{}) {
+			report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+		}
+
+		// The row on its own
+		if row.Email == "" {
+			fail("email is required")
+		} else if len(row.Email) > maxEmailLength {
+			fail("email is longer than %d characters", maxEmailLength)
+		} else if address, err := mail.ParseAddress(row.Email); err != nil || address.Address != row.Email {
+			fail("email %q is not a valid address", row.Email)
+		}
+		if row.Name == "" {
+			fail("name is required")
+		} else if len(row.Name) > maxNameLength {
+			fail("name is longer than %d characters", maxNameLength)
+		}
+		if !validRole(row.Role) {
+			fail("role %q is not one of admin, teacher, student", row.Role)
+		}
+		if len(row.Classroom) > maxClassroomLength {
+			fail("classroom is longer than %d characters", maxClassroomLength)
+		}
+		switch row.Role {
+		case constants.ROLE_ADMIN:
+			if row.Classroom != "" || row.TeacherEmail != "" {
+				fail("admins cannot be placed in a classroom")
+			}
+		case constants.ROLE_TEACHER:
+			if row.TeacherEmail != "" && row.TeacherEmail != row.Email {
+				fail("teacher_email of a teacher row must be empty or the teacher's own email")
+			}
+		case constants.ROLE_STUDENT:
+			if row.TeacherEmail != "" && row.Classroom == "" {
+				fail("teacher_email needs a classroom")
+			}
+		}
+		if len(report.Errors) > 0 {
+			result.reject(report)
+			continue
+		}
+
+		// The row against the other rows and the school
+		user := users[row.Email]
+		if user.line != row.Line && (user.name != row.Name || user.role != row.Role) {
+			fail("duplicate email %s with another name or role than on line %d", row.Email, user.line)
+		}
+		if line, duplicate := placed[[2]string{row.Email, row.Classroom}]; duplicate {
+			if row.Classroom == "" {
+				fail("duplicate email %s, already on line %d", row.Email, line)
+			} else {
+				fail("duplicate row, %s is already placed in classroom %q on line %d", row.Email, row.Classroom, line)
+			}
+		} else {
+			placed[[2]string{row.Email, row.Classroom}] = row.Line
+		}
+		if existing := user.existing; existing != nil {
+			if existing.SchoolId != dir.SchoolId || existing.AnonymizedAt != nil {
+				fail("email %s belongs to a user of another school", row.Email)
+			} else if existing.Role != row.Role {
+				fail("%s is already a %s, imports do not change roles", row.Email, existing.Role)
+			}
+		}
+
+		var classroom *dto.Classroom
+		classroomAssignment, assigned := assignments[row.Classroom]
+		if row.Classroom != "" {
+			matches := existingClassrooms[row.Classroom]
+			if len(matches) > 1 {
+				fail("classroom %q matches %d classrooms of the school", row.Classroom, len(matches))
+			} else if len(matches) == 1 {
+				classroom = matches[0]
+			}
+
+			teacherEmail := row.TeacherEmail
+			if row.Role == constants.ROLE_TEACHER {
+				teacherEmail = row.Email
+			}
+			if teacherEmail != "" && !teachers[teacherEmail] {
+				fail("unknown teacher %s", teacherEmail)
+			} else if teacherEmail != "" && classroomAssignment.teacherEmail != teacherEmail {
+				fail("classroom %q is assigned to %s on line %d", row.Classroom, classroomAssignment.teacherEmail, classroomAssignment.line)
+			} else if !assigned && classroom == nil {
+				fail("classroom %q does not exist, teacher_email is required", row.Classroom)
+			} else if assigned && !teachers[classroomAssignment.teacherEmail] {
+				fail("classroom %q has the unknown teacher %s of line %d", row.Classroom, classroomAssignment.teacherEmail, classroomAssignment.line)
+			}
+		}
+		if len(report.Errors) > 0 {
+			result.reject(report)
+			continue
+		}
+
+		// The changes of a valid row
+		if !plannedUsers[row.Email] {
+			plannedUsers[row.Email] = true
+			switch existing := user.existing; {
+			case existing == nil:
+				result.Plan.Users = append(result.Plan.Users, dto.RosterUser{Email: row.Email, Name: row.Name, Role: row.Role})
+				result.Summary.UsersCreated++
+				report.Actions = append(report.Actions, "create "+row.Role+" "+row.Email)
+			case existing.Name != row.Name:
+				result.Plan.Users = append(result.Plan.Users, dto.RosterUser{Id: existing.Id, Email: row.Email, Name: row.Name, Role: row.Role, Rename: true})
+				result.Summary.UsersUpdated++
+				report.Actions = append(report.Actions, fmt.Sprintf("rename %s from %q", row.Email, existing.Name))
+			default:
+				result.Plan.Users = append(result.Plan.Users, dto.RosterUser{Id: existing.Id, Email: row.Email, Name: row.Name, Role: row.Role})
+			}
+		}
+
+		if row.Classroom == "" {
+			result.accept(report)
+			continue
+		}
+
+		if !plannedClassrooms[row.Classroom] {
+			plannedClassrooms[row.Classroom] = true
+			planned := dto.RosterClassroom{Name: row.Classroom, TeacherEmail: classroomAssignment.teacherEmail}
+			switch {
+			case classroom == nil:
+				result.Summary.ClassroomsCreated++
+				report.Actions = append(report.Actions, fmt.Sprintf("create classroom %q taught by %s", row.Classroom, planned.TeacherEmail))
+			case assigned && !isTeacher(existingUsers[planned.TeacherEmail], classroom):
+				planned.Id = classroom.Id
+				planned.Reassign = true
+				result.Summary.ClassroomsReassigned++
+				report.Actions = append(report.Actions, fmt.Sprintf("assign classroom %q to %s", row.Classroom, planned.TeacherEmail))
+			default:
+				planned.Id = classroom.Id
+			}
+			result.Plan.Classrooms = append(result.Plan.Classrooms, planned)
+		}
+
+		if row.Role == constants.ROLE_STUDENT {
+			if classroom != nil && user.existing != nil && enrolled[[2]int{classroom.Id, user.existing.Id}] {
+				report.Actions = append(report.Actions, fmt.Sprintf("already enrolled in %q", row.Classroom))
+			} else {
+				result.Plan.Enrollments = append(result.Plan.Enrollments, dto.RosterEnrollment{StudentEmail: row.Email, Classroom: row.Classroom})
+				result.Summary.Enrollments++
+				report.Actions = append(report.Actions, fmt.Sprintf("enroll in %q", row.Classroom))
+			}
+		}
+		result.accept(report)
+	}
+
+	return result
+}
+
+func (r *Result) accept(report dto.RosterRowResult) {
+	report.Valid = true
+	r.Rows = append(r.Rows, report)
+}
+
+func (r *Result) reject(report dto.RosterRowResult) {
+	r.Invalid++
+	r.Rows = append(r.Rows, report)
+}
+
+func validRole(role string) bool {
+	return role == constants.ROLE_ADMIN || role == constants.ROLE_TEACHER || role == constants.ROLE_STUDENT
+}
+
+// isTeacher reports whether the existing user teaches the classroom
+func isTeacher(user *dto.User, classroom *dto.Classroom) bool {
+	return user != nil && user.Id == classroom.TeacherId
+}
@@ -5,18 +5,34 @@ import (
 	"crypto/rand"
 	"eduanalytics/internal/app/service/logger"
 	"encoding/hex"
+	"errors"
 	"sync"
 	"time"
 )
 
+var (
+	// ErrSessionInvalid is returned when a session does not exist, has expired or
+	// does not belong to the presented refresh token
+	ErrSessionInvalid = errors.New("session expired or invalid")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
 // Session represents a user session
 type Session struct {
-	SessionID string
-	Email     string
-	CreatedAt time.Time
-	ExpiresAt time.Time
-	UserAgent string
-	IPAddress string
+	SessionID      string
+	FamilyID       string // shared by every session rotated from the same login
+	RefreshTokenID string // ID of the only refresh token that may rotate this session
+	Email          string
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	UserAgent      string
+	IPAddress      string
+}
+
+// usedRefreshToken remembers a rotated refresh token so that a replay can be detected
+type usedRefreshToken struct {
+	FamilyID string
 }
 
 // ISessionManager defines the interface for session management
@@ -28,22 +44,28 @@ type ISessionManager interface {
 	IsSessionValid(ctx context.Context, sessionID string) bool
 	CleanupExpiredSessions(ctx context.Context)
 	GetActiveSessions(ctx context.Context, email string) []*Session
+	RotateSession(ctx context.Context, sessionID, refreshTokenID, userAgent, ipAddress string) (*Session, error)
+	DeleteSessionFamily(ctx context.Context, familyID string) error
 }
 
 // SessionManager manages user sessions in memory
 type SessionManager struct {
-	sessions      map[string]*Session
-	userSessions  map[string][]string // email -> list of session IDs
-	mu            sync.RWMutex
-	sessionExpiry time.Duration
+	sessions          map[string]*Session
+	userSessions      map[string][]string // email -> list of session IDs
+	families          map[string][]string // family ID -> list of session IDs
+	usedRefreshTokens map[string]usedRefreshToken
+	mu                sync.RWMutex
+	sessionExpiry     time.Duration
 }
 
 // NewSessionManager creates a new session manager
 func NewSessionManager(sessionExpiry time.Duration) ISessionManager {
 	sm := &SessionManager{
-		sessions:      make(map[string]*Session),
-		userSessions:  make(map[string][]string),
-		sessionExpiry: sessionExpiry,
+		sessions:          make(map[string]*Session),
+		userSessions:      make(map[string][]string),
+		families:          make(map[string][]string),
+		usedRefreshTokens: make(map[string]usedRefreshToken),
+		sessionExpiry:     sessionExpiry,
 	}
 
 	// Start background cleanup goroutine
@@ -61,41 +83,151 @@ func generateSessionID() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// newSession builds a session with fresh session and refresh token IDs
+func (sm *SessionManager) newSession(email, familyID, userAgent, ipAddress string) (*Session, error) {
+	sessionID, err := generateSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokenID, err := generateSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	if familyID == "" {
+		if familyID, err = generateSessionID(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Session{
+		SessionID:      sessionID,
+		FamilyID:       familyID,
+		RefreshTokenID: refreshTokenID,
+		Email:          email,
+		CreatedAt:      time.Now(),
+		ExpiresAt:      time.Now().Add(sm.sessionExpiry),
+		UserAgent:      userAgent,
+		IPAddress:      ipAddress,
+	}, nil
+}
+
 // CreateSession creates a new session for a user
 func (sm *SessionManager) CreateSession(ctx context.Context, email, userAgent, ipAddress string) (*Session, error) {
 	log := logger.Logger(ctx)
 
-	sessionID, err := generateSessionID()
+	session, err := sm.newSession(email, "", userAgent, ipAddress)
 	if err != nil {
 		log.Errorf("Failed to generate session ID: %v", err)
 		return nil, err
 	}
 
-	session := &Session{
-		SessionID: sessionID,
-		Email:     email,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(sm.sessionExpiry),
-		UserAgent: userAgent,
-		IPAddress: ipAddress,
-	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.storeSession(session)
+
+	log.Infof("Created session %s for user %s", session.SessionID, email)
+	return session, nil
+}
+
+// RotateSession consumes the refresh token of a session and replaces the session with a new
+// one in the same family. Presenting a refresh token that was already consumed revokes the
+// whole family and returns ErrRefreshTokenReused.
+func (sm *SessionManager) RotateSession(ctx context.Context, sessionID, refreshTokenID, userAgent, ipAddress string) (*Session, error) {
+	log := logger.Logger(ctx)
 
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	// Store session
-	sm.sessions[sessionID] = session
+	if used, exists := sm.usedRefreshTokens[refreshTokenID]; exists {
+		count := sm.deleteFamily(used.FamilyID)
+		log.Warnf("Refresh token reuse detected for family %s, revoked %d sessions", used.FamilyID, count)
+		return nil, ErrRefreshTokenReused
+	}
+
+	current, exists := sm.sessions[sessionID]
+	if !exists || time.Now().After(current.ExpiresAt) || current.RefreshTokenID != refreshTokenID {
+		return nil, ErrSessionInvalid
+	}
 
-	// Add to user sessions
-	if _, exists := sm.userSessions[email]; !exists {
-		sm.userSessions[email] = make([]string, 0)
+	session, err := sm.newSession(current.Email, current.FamilyID, userAgent, ipAddress)
+	if err != nil {
+		log.Errorf("Failed to generate session ID: %v", err)
+		return nil, err
 	}
-	sm.userSessions[email] = append(sm.userSessions[email], sessionID)
 
-	log.Infof("Created session %s for user %s", sessionID, email)
+	sm.usedRefreshTokens[refreshTokenID] = usedRefreshToken{FamilyID: current.FamilyID}
+	sm.removeSession(sessionID)
+	sm.storeSession(session)
+
+	log.Infof("Rotated session %s to %s for user %s", sessionID, session.SessionID, session.Email)
 	return session, nil
 }
 
+// DeleteSessionFamily removes every session rotated from the same login
+func (sm *SessionManager) DeleteSessionFamily(ctx context.Context, familyID string) error {
+	log := logger.Logger(ctx)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	count := sm.deleteFamily(familyID)
+	log.Infof("Deleted session family %s (count: %d)", familyID, count)
+	return nil
+}
+
+// storeSession indexes a session; the caller must hold the write lock
+func (sm *SessionManager) storeSession(session *Session) {
+	sm.sessions[session.SessionID] = session
+	sm.userSessions[session.Email] = append(sm.userSessions[session.Email], session.SessionID)
+	sm.families[session.FamilyID] = append(sm.families[session.FamilyID], session.SessionID)
+}
+
+// removeSession drops a session from every index; the caller must hold the write lock
+func (sm *SessionManager) removeSession(sessionID string) *Session {
+	session, exists := sm.sessions[sessionID]
+	if !exists {
+		return nil
+	}
+
+	delete(sm.sessions, sessionID)
+
+	if remaining := removeID(sm.userSessions[session.Email], sessionID); len(remaining) == 0 {
+		delete(sm.userSessions, session.Email)
+	} else {
+		sm.userSessions[session.Email] = remaining
+	}
+
+	if remaining := removeID(sm.families[session.FamilyID], sessionID); len(remaining) == 0 {
+		delete(sm.families, session.FamilyID)
+	} else {
+		sm.families[session.FamilyID] = remaining
+	}
+
+	return session
+}
+
+// deleteFamily removes all sessions of a family; the caller must hold the write lock
+func (sm *SessionManager) deleteFamily(familyID string) int {
+	sessionIDs := append([]string(nil), sm.families[familyID]...)
+	for _, sessionID := range sessionIDs {
+		sm.removeSession(sessionID)
+	}
+	return len(sessionIDs)
+}
+
+func removeID(ids []string, id string) []string {
+	remaining := make([]string, 0, len(ids))
+	for _, sid := range ids {
+		if sid != id {
+			remaining = append(remaining, sid)
+		}
+	}
+	return remaining
+}
+
 // GetSession retrieves a session by ID
 func (sm *SessionManager) GetSession(ctx context.Context, sessionID string) (*Session, error) {
 	sm.mu.RLock()
@@ -121,29 +253,11 @@ func (sm *SessionManager) DeleteSession(ctx context.Context, sessionID string) e
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, exists := sm.sessions[sessionID]
-	if !exists {
+	session := sm.removeSession(sessionID)
+	if session == nil {
 		return nil
 	}
 
-	// Remove from sessions map
-	delete(sm.sessions, sessionID)
-
-	// Remove from user sessions
-	if userSessionIDs, exists := sm.userSessions[session.Email]; exists {
-		newSessions := make([]string, 0)
-		for _, sid := range userSessionIDs {
-			if sid != sessionID {
-				newSessions = append(newSessions, sid)
-			}
-		}
-		if len(newSessions) == 0 {
-			delete(sm.userSessions, session.Email)
-		} else {
-			sm.userSessions[session.Email] = newSessions
-		}
-	}
-
 	log.Infof("Deleted session %s for user %s", sessionID, session.Email)
 	return nil
 }
@@ -161,13 +275,10 @@ func (sm *SessionManager) DeleteAllUserSessions(ctx context.Context, email strin
 	}
 
 	// Delete all sessions
-	for _, sessionID := range sessionIDs {
-		delete(sm.sessions, sessionID)
+	for _, sessionID := range append([]string(nil), sessionIDs...) {
+		sm.removeSession(sessionID)
 	}
 
-	// Remove user sessions entry
-	delete(sm.userSessions, email)
-
 	log.Infof("Deleted all sessions for user %s (count: %d)", email, len(sessionIDs))
 	return nil
 }
@@ -199,28 +310,19 @@ func (sm *SessionManager) CleanupExpiredSessions(ctx context.Context) {
 	// Find and remove expired sessions
 	for sessionID, session := range sm.sessions {
 		if now.After(session.ExpiresAt) {
-			// Remove from sessions
-			delete(sm.sessions, sessionID)
-
-			// Remove from user sessions
-			if userSessionIDs, exists := sm.userSessions[session.Email]; exists {
-				newSessions := make([]string, 0)
-				for _, sid := range userSessionIDs {
-					if sid != sessionID {
-						newSessions = append(newSessions, sid)
-					}
-				}
-				if len(newSessions) == 0 {
-					delete(sm.userSessions, session.Email)
-				} else {
-					sm.userSessions[session.Email] = newSessions
-				}
-			}
-
+			sm.removeSession(sessionID)
 			expiredCount++
 		}
 	}
 
+	// Forget rotated refresh tokens once their family is gone, a replay can no longer
+	// revoke anything and will be rejected as an invalid session instead
+	for refreshTokenID, used := range sm.usedRefreshTokens {
+		if _, alive := sm.families[used.FamilyID]; !alive {
+			delete(sm.usedRefreshTokens, refreshTokenID)
+		}
+	}
+
 	if expiredCount > 0 {
 		log.Infof("Cleaned up %d expired sessions", expiredCount)
 	}
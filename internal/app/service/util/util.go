@@ -1,14 +1,25 @@
 package util
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
 	"strings"
+	"unicode"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	PASSWORD_MIN_LENGTH = 8
+	// bcrypt ignores everything after 72 bytes
+	PASSWORD_MAX_LENGTH = 72
+)
+
 func ValidatePassword(password string, hashedPassword string) bool {
 	// Comparing the password with the hash
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
@@ -29,6 +40,48 @@ func GenerateHash(password string) (string, error) {
 	return string(hash), nil
 }
 
+// ValidatePasswordPolicy checks that a password is long enough and mixes
+// upper case letters, lower case letters and digits
+func ValidatePasswordPolicy(password string) error {
+	if len(password) < PASSWORD_MIN_LENGTH {
+		return errors.New("password must be at least 8 characters long")
+	}
+	if len(password) > PASSWORD_MAX_LENGTH {
+		return errors.New("password must be at most 72 bytes long")
+	}
+
+	var hasUpper, hasLower, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasUpper || !hasLower || !hasDigit {
+		return errors.New("password must contain upper case letters, lower case letters and digits")
+	}
+	return nil
+}
+
+// GenerateToken returns a random URL safe token for links sent to users
+func GenerateToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// HashToken returns the SHA-256 hex digest under which a token is stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func Int(v int) *int { return &v }
 
 // ParseTokenClaims parses JWT token claims without validation
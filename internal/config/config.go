@@ -9,11 +9,13 @@ import (
 )
 
 type JwtConfig struct {
-	JWT_MAGIC_SECRET   string `env:"JWT_MAGIC_SECRET"`
-	JWT_ACCESS_SECRET  string `env:"JWT_ACCESS_SECRET"`
-	JWT_REFRESH_SECRET string `env:"JWT_REFRESH_SECRET"`
-	JWT_ACCESS_EXP     int    `env:"JWT_ACCESS_EXP"`
-	JWT_REFRESH_EXP    int    `env:"JWT_REFRESH_EXP"`
+	JWT_MAGIC_SECRET        string `env:"JWT_MAGIC_SECRET"`
+	JWT_ACCESS_EXP          int    `env:"JWT_ACCESS_EXP"`
+	JWT_REFRESH_EXP         int    `env:"JWT_REFRESH_EXP"`
+	JWT_ISSUER              string `env:"JWT_ISSUER" envDefault:"eduanalytics"`
+	JWT_KEY_DIR             string `env:"JWT_KEY_DIR"`
+	JWT_SIGNING_KEY_ID      string `env:"JWT_SIGNING_KEY_ID"`
+	JWT_KEY_RELOAD_INTERVAL int    `env:"JWT_KEY_RELOAD_INTERVAL"`
 }
 
 type DatabaseConfig struct {
@@ -30,14 +32,15 @@ type DatabaseConfig struct {
 }
 
 type HTTPServerConfig struct {
-	HTTPSERVER_URL                         string `env:"HTTPSERVER_URL"`
-	HTTPSERVER_LISTEN                      string `env:"HTTPSERVER_LISTEN"`
-	HTTPSERVER_PORT                        string `env:"HTTPSERVER_PORT"`
-	HTTPSERVER_READ_TIMEOUT                int    `env:"HTTPSERVER_READ_TIMEOUT"`
-	HTTPSERVER_WRITE_TIMEOUT               int    `env:"HTTPSERVER_WRITE_TIMEOUT"`
-	HTTPSERVER_MAX_CONNECTIONS_PER_IP      int    `env:"HTTPSERVER_MAX_CONNECTIONS_PER_IP"`
-	HTTPSERVER_MAX_REQUESTS_PER_CONNECTION int    `env:"HTTPSERVER_MAX_REQUESTS_PER_CONNECTION"`
-	HTTPSERVER_MAX_KEEP_ALIVE_DURATION     int    `env:"HTTPSERVER_MAX_KEEP_ALIVE_DURATION"`
+	HTTPSERVER_URL                         string   `env:"HTTPSERVER_URL"`
+	HTTPSERVER_LISTEN                      string   `env:"HTTPSERVER_LISTEN"`
+	HTTPSERVER_PORT                        string   `env:"HTTPSERVER_PORT"`
+	HTTPSERVER_READ_TIMEOUT                int      `env:"HTTPSERVER_READ_TIMEOUT"`
+	HTTPSERVER_WRITE_TIMEOUT               int      `env:"HTTPSERVER_WRITE_TIMEOUT"`
+	HTTPSERVER_MAX_CONNECTIONS_PER_IP      int      `env:"HTTPSERVER_MAX_CONNECTIONS_PER_IP"`
+	HTTPSERVER_MAX_REQUESTS_PER_CONNECTION int      `env:"HTTPSERVER_MAX_REQUESTS_PER_CONNECTION"`
+	HTTPSERVER_MAX_KEEP_ALIVE_DURATION     int      `env:"HTTPSERVER_MAX_KEEP_ALIVE_DURATION"`
+	HTTPSERVER_TRUSTED_PROXIES             []string `env:"HTTPSERVER_TRUSTED_PROXIES" envSeparator:","`
 }
 
 type LogConfig struct {
@@ -48,12 +51,59 @@ type LogConfig struct {
 	LOG_FILE_MAXAGE    int    `env:"LOG_FILE_MAXAGE"`
 }
 
+type AuthConfig struct {
+	AUTH_EMAIL_VERIFICATION_EXP int    `env:"AUTH_EMAIL_VERIFICATION_EXP" envDefault:"2880"`
+	AUTH_PASSWORD_RESET_EXP     int    `env:"AUTH_PASSWORD_RESET_EXP" envDefault:"30"`
+	AUTH_LOGIN_MAX_ATTEMPTS     int    `env:"AUTH_LOGIN_MAX_ATTEMPTS" envDefault:"5"`
+	AUTH_LOGIN_IP_MAX_ATTEMPTS  int    `env:"AUTH_LOGIN_IP_MAX_ATTEMPTS" envDefault:"20"`
+	AUTH_LOGIN_DELAY_AFTER      int    `env:"AUTH_LOGIN_DELAY_AFTER" envDefault:"3"`
+	AUTH_LOGIN_MAX_DELAY        int    `env:"AUTH_LOGIN_MAX_DELAY" envDefault:"60"`
+	AUTH_LOGIN_LOCKOUT_DURATION int    `env:"AUTH_LOGIN_LOCKOUT_DURATION" envDefault:"15"`
+	AUTH_LOGIN_ATTEMPT_WINDOW   int    `env:"AUTH_LOGIN_ATTEMPT_WINDOW" envDefault:"15"`
+	AUTH_MFA_ISSUER             string `env:"AUTH_MFA_ISSUER" envDefault:"EduAnalytics"`
+	AUTH_MFA_ENCRYPTION_KEY     string `env:"AUTH_MFA_ENCRYPTION_KEY"`
+	AUTH_MFA_CHALLENGE_EXP      int    `env:"AUTH_MFA_CHALLENGE_EXP" envDefault:"5"`
+	AUTH_SSO_REDIRECT_URL       string `env:"AUTH_SSO_REDIRECT_URL" envDefault:"http://localhost:9090/api/v1/auth/sso/callback"`
+	AUTH_SSO_STATE_EXP          int    `env:"AUTH_SSO_STATE_EXP" envDefault:"10"`
+	AUTH_SSO_HTTP_TIMEOUT       int    `env:"AUTH_SSO_HTTP_TIMEOUT" envDefault:"10"`
+	AUTH_API_KEY_DEFAULT_EXP    int    `env:"AUTH_API_KEY_DEFAULT_EXP" envDefault:"90"`
+	AUTH_API_KEY_MAX_EXP        int    `env:"AUTH_API_KEY_MAX_EXP" envDefault:"365"`
+	AUTH_RBAC_POLICY_SEED       string `env:"AUTH_RBAC_POLICY_SEED" envDefault:"internal/config/casbin_policy.csv"`
+	AUTH_RBAC_RELOAD_INTERVAL   int    `env:"AUTH_RBAC_RELOAD_INTERVAL" envDefault:"300"`
+}
+
+type RateLimitConfig struct {
+	RATE_LIMIT_ENABLED          bool     `env:"RATE_LIMIT_ENABLED" envDefault:"true"`
+	RATE_LIMIT_WINDOW           int      `env:"RATE_LIMIT_WINDOW" envDefault:"60"`
+	RATE_LIMIT_DEFAULT          int      `env:"RATE_LIMIT_DEFAULT" envDefault:"100"`
+	RATE_LIMIT_LOGIN            int      `env:"RATE_LIMIT_LOGIN" envDefault:"10"`
+	RATE_LIMIT_AUTH             int      `env:"RATE_LIMIT_AUTH" envDefault:"20"`
+	RATE_LIMIT_REPORTS          int      `env:"RATE_LIMIT_REPORTS" envDefault:"10"`
+	RATE_LIMIT_RESPONSES        int      `env:"RATE_LIMIT_RESPONSES" envDefault:"1000"`
+	RATE_LIMIT_IP               int      `env:"RATE_LIMIT_IP" envDefault:"3000"`
+	RATE_LIMIT_ROLE_MULTIPLIERS []string `env:"RATE_LIMIT_ROLE_MULTIPLIERS" envSeparator:"," envDefault:"teacher:2,admin:5"`
+}
+
+type MailerConfig struct {
+	MAILER_DRIVER        string `env:"MAILER_DRIVER" envDefault:"log"`
+	MAILER_FROM          string `env:"MAILER_FROM" envDefault:"no-reply@eduanalytics.local"`
+	MAILER_BASE_URL      string `env:"MAILER_BASE_URL" envDefault:"http://localhost:9090"`
+	MAILER_FILE_DIR      string `env:"MAILER_FILE_DIR" envDefault:"/tmp/eduanalytics-mail"`
+	MAILER_SMTP_HOST     string `env:"MAILER_SMTP_HOST"`
+	MAILER_SMTP_PORT     string `env:"MAILER_SMTP_PORT"`
+	MAILER_SMTP_USERNAME string `env:"MAILER_SMTP_USERNAME"`
+	MAILER_SMTP_PASSWORD string `env:"MAILER_SMTP_PASSWORD"`
+}
+
 type ServiceConfig struct {
 	ProjectVersion   string `env:"VERSION"`
 	JwtConfig        JwtConfig
 	DatabaseConfig   DatabaseConfig
 	HTTPServerConfig HTTPServerConfig
 	LogConfig        LogConfig
+	AuthConfig       AuthConfig
+	MailerConfig     MailerConfig
+	RateLimitConfig  RateLimitConfig
 	Environment      string `env:"ENVIRONMENT"`
 }
 
@@ -6,7 +6,6 @@ import (
 	"eduanalytics/internal/app/constants"
 	"eduanalytics/internal/app/service/logger"
 	"eduanalytics/internal/config"
-	"fmt"
 )
 
 func main() {
@@ -24,7 +23,7 @@ func main() {
 	log := logger.Logger(ctx)
 
 	r := server.Init(ctx)
-	if err := r.Run(fmt.Sprintf("%s:%s", constants.Config.HTTPServerConfig.HTTPSERVER_LISTEN, constants.Config.HTTPServerConfig.HTTPSERVER_PORT)); err != nil {
+	if err := server.Run(ctx, r); err != nil {
 		log.Fatal("Server not able to startup with error: ", err)
 	}
 }